@@ -80,7 +80,12 @@ func NewNatsConsumer(natsServerAddress string, topics []string, groupID string)
 	}
 
 	for _, subject := range topics {
-		sub, err := js.ChanSubscribe(subject, consumer.msgChan)
+		var sub *nats.Subscription
+		if isLiveSubject(subject) {
+			sub, err = nc.ChanSubscribe(subject, consumer.msgChan)
+		} else {
+			sub, err = js.ChanSubscribe(subject, consumer.msgChan)
+		}
 		if err != nil {
 			return nil, fmt.Errorf("failed to subscribe to topic %s: %v", subject, err)
 		}
@@ -94,6 +99,16 @@ func NewNatsConsumer(natsServerAddress string, topics []string, groupID string)
 	return consumer, nil
 }
 
+// isLiveSubject tells whether the subject is published without the stream
+func isLiveSubject(subject string) bool {
+	for _, live := range LiveSubjectNames {
+		if subject == live {
+			return true
+		}
+	}
+	return false
+}
+
 // InitConsumer initializes an event consumer with configuration from environment or config
 // and returns a channel that will receive messages from the topics
 func InitConsumer(cfg config.Config, topics []string, groupID string) (Consumer, error) {
@@ -6,6 +6,10 @@ const (
 	NoteSubject     string = "note"
 	BlockSubject    string = "block"
 	TaskSubject     string = "task"
+
+	// PresenceSubject carries who is viewing which note between servers. It
+	// is not part of the stream: presence is only worth something live.
+	PresenceSubject string = "presence"
 )
 
 var SubjectNames = []string{
@@ -16,6 +20,12 @@ var SubjectNames = []string{
 	TaskSubject,
 }
 
+// LiveSubjectNames are the subjects published and consumed without the
+// stream, see Producer.Notify
+var LiveSubjectNames = []string{
+	PresenceSubject,
+}
+
 type EventType string
 
 const (
@@ -24,11 +34,16 @@ const (
 	NoteUpdated  EventType = "note.updated"
 	NoteDeleted  EventType = "note.deleted"
 	NoteRestored EventType = "note.restored"
+	// NoteStateUpdated reports a change to a user's pinned, favourite or
+	// archived state of a note
+	NoteStateUpdated EventType = "note.state_updated"
 
 	NotebookCreated  EventType = "notebook.created"
 	NotebookUpdated  EventType = "notebook.updated"
 	NotebookDeleted  EventType = "notebook.deleted"
 	NotebookRestored EventType = "notebook.restored"
+	// NotebookStateUpdated is NoteStateUpdated for notebooks
+	NotebookStateUpdated EventType = "notebook.state_updated"
 
 	BlockCreated EventType = "block.created"
 	BlockUpdated EventType = "block.updated"
@@ -38,6 +53,10 @@ const (
 	TaskUpdated EventType = "task.updated"
 	TaskDeleted EventType = "task.deleted"
 
+	// Attachment events are published on the note subject
+	AttachmentCreated EventType = "attachment.created"
+	AttachmentDeleted EventType = "attachment.deleted"
+
 	// User events
 	UserCreated EventType = "user.created"
 	UserUpdated EventType = "user.updated"
@@ -45,4 +64,18 @@ const (
 
 	// Trash events
 	TrashEmptied EventType = "trash.emptied"
+
+	// Presence events, published on the presence subject
+	PresenceJoined  EventType = "presence.joined"
+	PresenceUpdated EventType = "presence.updated"
+	PresenceLeft    EventType = "presence.left"
+	// PresenceRefreshed extends the expiry of an entry without activity
+	PresenceRefreshed EventType = "presence.refreshed"
 )
+
+// PrivateEventTypes are the events only the user named by the "user_id" of
+// their payload is told about, however many others can view the resource
+var PrivateEventTypes = map[EventType]bool{
+	NoteStateUpdated:     true,
+	NotebookStateUpdated: true,
+}
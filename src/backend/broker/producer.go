@@ -15,6 +15,9 @@ import (
 // Producer defines the interface for message production
 type Producer interface {
 	PublishMessage(topic string, value string) error
+	// Notify publishes a message to the subscribers connected right now,
+	// without storing it in the stream
+	Notify(topic string, value string) error
 	CreateTopics(string, []string) error
 	Close()
 	IsAvailable() bool
@@ -138,6 +141,18 @@ func (p *NatsProducer) PublishMessage(topic string, value string) error {
 	return nil
 }
 
+// Notify implements the Producer interface for NATSProducer
+func (p *NatsProducer) Notify(topic string, value string) error {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	if !p.available || p.nc == nil {
+		return fmt.Errorf("event producer is not available, message not sent")
+	}
+
+	return p.nc.Publish(topic, []byte(value))
+}
+
 // Close implements the Producer interface
 func (p *NatsProducer) Close() {
 	p.mutex.Lock()
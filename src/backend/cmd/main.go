@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 
 	"owlistic-notes/owlistic/broker"
@@ -14,6 +15,7 @@ import (
 	"owlistic-notes/owlistic/middleware"
 	"owlistic-notes/owlistic/routes"
 	"owlistic-notes/owlistic/services"
+	"owlistic-notes/owlistic/storage"
 
 	"github.com/gin-gonic/gin"
 )
@@ -49,6 +51,27 @@ func main() {
 	services.BlockServiceInstance = services.NewBlockService()
 	services.TaskServiceInstance = services.NewTaskService()
 	services.TrashServiceInstance = services.NewTrashService()
+	services.SearchServiceInstance = services.NewSearchService()
+	services.ExportServiceInstance = services.NewExportService()
+	services.ImportServiceInstance = services.NewImportService()
+	services.RevisionServiceInstance = services.NewRevisionService()
+	services.NoteLinkServiceInstance = services.NewNoteLinkService()
+	services.GraphServiceInstance = services.NewGraphService()
+	services.TagServiceInstance = services.NewTagService()
+	services.TemplateServiceInstance = services.NewTemplateService()
+	services.JournalServiceInstance = services.NewJournalService()
+	services.ResourceStateServiceInstance = services.NewResourceStateService()
+	services.CollabServiceInstance = services.NewCollabService()
+	services.SyncServiceInstance = services.NewSyncService()
+	services.PresenceServiceInstance = services.NewPresenceService()
+
+	// Initialize attachment storage
+	store, err := storage.New(cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize attachment storage: %v", err)
+	}
+	services.AttachmentServiceInstance = services.NewAttachmentService(store,
+		int64(cfg.AttachmentMaxSizeMB)<<20, strings.Split(cfg.AttachmentMediaTypes, ","))
 
 	// Initialize eventHandler service with the database
 	eventHandlerService := services.NewEventHandlerService(db)
@@ -99,6 +122,19 @@ func main() {
 	routes.RegisterBlockRoutes(protectedGroup, db, services.BlockServiceInstance)
 	routes.RegisterTrashRoutes(protectedGroup, db, services.TrashServiceInstance)
 	routes.RegisterRoleRoutes(protectedGroup, db, services.RoleServiceInstance)
+	routes.RegisterSearchRoutes(protectedGroup, db, services.SearchServiceInstance)
+	routes.RegisterExportRoutes(protectedGroup, db, services.ExportServiceInstance)
+	routes.RegisterImportRoutes(protectedGroup, db, services.ImportServiceInstance)
+	routes.RegisterRevisionRoutes(protectedGroup, db, services.RevisionServiceInstance)
+	routes.RegisterNoteLinkRoutes(protectedGroup, db, services.NoteLinkServiceInstance)
+	routes.RegisterGraphRoutes(protectedGroup, db, services.GraphServiceInstance)
+	routes.RegisterTagRoutes(protectedGroup, db, services.TagServiceInstance)
+	routes.RegisterTemplateRoutes(protectedGroup, db, services.TemplateServiceInstance)
+	routes.RegisterJournalRoutes(protectedGroup, db, services.JournalServiceInstance)
+	routes.RegisterResourceStateRoutes(protectedGroup, db, services.ResourceStateServiceInstance)
+	routes.RegisterAttachmentRoutes(protectedGroup, db, services.AttachmentServiceInstance)
+	routes.RegisterSyncRoutes(protectedGroup, db, services.SyncServiceInstance)
+	routes.RegisterPresenceRoutes(protectedGroup, db, services.PresenceServiceInstance)
 
 	// Register WebSocket routes with consistent auth middleware
 	wsGroup := router.Group("/ws")
@@ -17,6 +17,17 @@ type Config struct {
 	DBName             string
 	JWTSecret          string
 	JWTExpirationHours int
+	// Attachment storage: "local" keeps files in StoragePath, "s3" in an
+	// S3 compatible bucket
+	StorageBackend       string
+	StoragePath          string
+	S3Endpoint           string
+	S3Region             string
+	S3Bucket             string
+	S3AccessKey          string
+	S3SecretKey          string
+	AttachmentMaxSizeMB  int
+	AttachmentMediaTypes string
 }
 
 func getEnv(key, defaultValue string) string {
@@ -41,16 +52,26 @@ func Load() Config {
 	log.Println("Loading configuration...")
 
 	cfg := Config{
-		AppPort:            getEnv("APP_PORT", "8080"),
-		AppOrigins:         getEnv("APP_ORIGINS", "*"),
-		EventBroker:        getEnv("BROKER_ADDRESS", "localhost:4222"),
-		DBHost:             getEnv("DB_HOST", "localhost"),
-		DBPort:             getEnv("DB_PORT", "5432"),
-		DBUser:             getEnv("DB_USER", "owlistic"),
-		DBPassword:         getEnv("DB_PASSWORD", "owlistic"),
-		DBName:             getEnv("DB_NAME", "owlistic"),
-		JWTSecret:          getEnv("JWT_SECRET", "your-super-secret-key-change-this-in-production"),
-		JWTExpirationHours: getEnvAsInt("JWT_EXPIRATION_HOURS", 24),
+		AppPort:             getEnv("APP_PORT", "8080"),
+		AppOrigins:          getEnv("APP_ORIGINS", "*"),
+		EventBroker:         getEnv("BROKER_ADDRESS", "localhost:4222"),
+		DBHost:              getEnv("DB_HOST", "localhost"),
+		DBPort:              getEnv("DB_PORT", "5432"),
+		DBUser:              getEnv("DB_USER", "owlistic"),
+		DBPassword:          getEnv("DB_PASSWORD", "owlistic"),
+		DBName:              getEnv("DB_NAME", "owlistic"),
+		JWTSecret:           getEnv("JWT_SECRET", "your-super-secret-key-change-this-in-production"),
+		JWTExpirationHours:  getEnvAsInt("JWT_EXPIRATION_HOURS", 24),
+		StorageBackend:      getEnv("STORAGE_BACKEND", "local"),
+		StoragePath:         getEnv("STORAGE_PATH", "./data/attachments"),
+		S3Endpoint:          getEnv("S3_ENDPOINT", "http://localhost:9000"),
+		S3Region:            getEnv("S3_REGION", "us-east-1"),
+		S3Bucket:            getEnv("S3_BUCKET", "owlistic"),
+		S3AccessKey:         getEnv("S3_ACCESS_KEY", ""),
+		S3SecretKey:         getEnv("S3_SECRET_KEY", ""),
+		AttachmentMaxSizeMB: getEnvAsInt("ATTACHMENT_MAX_SIZE_MB", 25),
+		AttachmentMediaTypes: getEnv("ATTACHMENT_MEDIA_TYPES",
+			"image/*,application/pdf,text/plain,application/zip"),
 	}
 	Print(cfg)
 
@@ -68,4 +89,6 @@ func Print(cfg Config) {
 	log.Printf("DB Password: %s\n", cfg.DBPassword)
 	log.Printf("JWT Secret: %s\n", cfg.JWTSecret)
 	log.Printf("JWT Expiration Hours: %d\n", cfg.JWTExpirationHours)
+	log.Printf("Storage Backend: %s\n", cfg.StorageBackend)
+	log.Printf("Attachment Max Size MB: %d\n", cfg.AttachmentMaxSizeMB)
 }
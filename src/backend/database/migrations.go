@@ -8,10 +8,34 @@ import (
 	"gorm.io/gorm"
 )
 
+// searchIndexes holds the GIN indexes backing full-text search.
+// The indexed expressions must match the ones used by SearchService
+// so that PostgreSQL can use them when evaluating the tsquery.
+var searchIndexes = []string{
+	`CREATE INDEX IF NOT EXISTS idx_notes_title_fts ON notes
+		USING GIN (to_tsvector('english', coalesce(title, '')))`,
+	`CREATE INDEX IF NOT EXISTS idx_blocks_content_text_fts ON blocks
+		USING GIN (to_tsvector('english', coalesce(content->>'text', '')))`,
+	`CREATE INDEX IF NOT EXISTS idx_tasks_title_description_fts ON tasks
+		USING GIN (to_tsvector('english', coalesce(title, '') || ' ' || coalesce(description, '')))`,
+}
+
+// backfillTags gives the tags written on notes before tags had rows of
+// their own one. Every write path creates the rows since.
+const backfillTags = `INSERT INTO tags (id, user_id, name)
+	SELECT gen_random_uuid(), user_id, name FROM (
+		SELECT DISTINCT user_id, unnest(tags) AS name FROM notes
+		WHERE deleted_at IS NULL
+	) AS used
+	ON CONFLICT (user_id, name) DO NOTHING`
+
 // RunMigrations runs database migrations to ensure tables are up to date
 func RunMigrations(db *gorm.DB) error {
 	log.Println("Running database migrations...")
 
+	// Tags used so far are backfilled once, when their table is created
+	hadTags := db.Migrator().HasTable(&models.Tag{})
+
 	// Add all models that should be migrated
 	err := db.AutoMigrate(
 		&models.User{},
@@ -21,6 +45,13 @@ func RunMigrations(db *gorm.DB) error {
 		&models.Block{},
 		&models.Task{},
 		&models.Event{},
+		&models.NoteRevision{},
+		&models.NoteLink{},
+		&models.Tag{},
+		&models.Template{},
+		&models.JournalEntry{},
+		&models.ResourceState{},
+		&models.Attachment{},
 	)
 
 	if err != nil {
@@ -28,5 +59,33 @@ func RunMigrations(db *gorm.DB) error {
 		return err
 	}
 
+	if err := createSearchIndexes(db); err != nil {
+		log.Printf("Search index migration failed: %v", err)
+		return err
+	}
+
+	if !hadTags && db.Dialector.Name() == "postgres" {
+		if err := db.Exec(backfillTags).Error; err != nil {
+			log.Printf("Tag backfill failed: %v", err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// createSearchIndexes creates the tsvector indexes used by full-text search
+func createSearchIndexes(db *gorm.DB) error {
+	// tsvector indexes are PostgreSQL specific
+	if db.Dialector.Name() != "postgres" {
+		return nil
+	}
+
+	for _, stmt := range searchIndexes {
+		if err := db.Exec(stmt).Error; err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Attachment is a file uploaded to a note. Its bytes are kept by the
+// storage backend under Hash, the SHA-256 of the content, so identical
+// uploads share one blob.
+type Attachment struct {
+	ID          uuid.UUID `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+	UserID      uuid.UUID `gorm:"type:uuid;not null;index" json:"user_id"`
+	NoteID      uuid.UUID `gorm:"type:uuid;not null;index" json:"note_id"`
+	Filename    string    `gorm:"not null" json:"filename"`
+	ContentType string    `gorm:"not null" json:"content_type"`
+	Size        int64     `gorm:"not null" json:"size"`
+	Hash        string    `gorm:"type:char(64);not null;index" json:"hash"`
+	CreatedAt   time.Time `gorm:"not null;default:now()" json:"created_at"`
+}
@@ -4,6 +4,7 @@ import (
 	"database/sql/driver"
 	"encoding/json"
 	"errors"
+	"sort"
 	"time"
 
 	"github.com/google/uuid"
@@ -18,8 +19,19 @@ const (
 	HeadingBlock        BlockType = "header"
 	ListItemBlock       BlockType = "listItem"
 	HorizontalRuleBlock BlockType = "horizontalRule"
+	CodeBlock           BlockType = "code"
+	QuoteBlock          BlockType = "quote"
+	ImageBlock          BlockType = "image"
+	TableBlock          BlockType = "table"
+	CalloutBlock        BlockType = "callout"
+	ToggleBlock         BlockType = "toggle"
+	NoteLinkBlock       BlockType = "noteLink"
+	FileBlock           BlockType = "file"
 )
 
+// NoteLinkSpan is the inline span type linking a range of text to a note
+const NoteLinkSpan = "noteLink"
+
 type BlockContent map[string]interface{}
 
 // Value implements the driver.Valuer interface for JSONB storage
@@ -73,16 +85,22 @@ func (bm *BlockMetadata) Scan(value interface{}) error {
 
 // Block represents a content block within a note
 type Block struct {
-	ID        uuid.UUID      `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
-	UserID    uuid.UUID      `gorm:"type:uuid;not null;constraint:OnDelete:CASCADE;" json:"user_id"`
-	NoteID    uuid.UUID      `gorm:"type:uuid;not null;constraint:OnDelete:CASCADE;" json:"note_id"`
-	Type      BlockType      `gorm:"type:varchar(20);not null" json:"type"`
-	Content   BlockContent   `gorm:"type:jsonb;default:'{}'::jsonb" json:"content"`
-	Metadata  BlockMetadata  `gorm:"type:jsonb;default:'{}'::jsonb" json:"metadata"`
-	Order     float64        `gorm:"not null" json:"order"`
-	CreatedAt time.Time      `gorm:"not null;default:now()" json:"created_at"`
-	UpdatedAt time.Time      `gorm:"not null;default:now()" json:"updated_at"`
-	DeletedAt gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
+	ID     uuid.UUID `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+	UserID uuid.UUID `gorm:"type:uuid;not null;constraint:OnDelete:CASCADE;" json:"user_id"`
+	NoteID uuid.UUID `gorm:"type:uuid;not null;constraint:OnDelete:CASCADE;" json:"note_id"`
+	// ParentBlockID nests the block under another block of the same note;
+	// Order is relative to the block's siblings
+	ParentBlockID *uuid.UUID     `gorm:"type:uuid;index" json:"parent_block_id"`
+	Type          BlockType      `gorm:"type:varchar(20);not null" json:"type"`
+	Content       BlockContent   `gorm:"type:jsonb;default:'{}'::jsonb" json:"content"`
+	Metadata      BlockMetadata  `gorm:"type:jsonb;default:'{}'::jsonb" json:"metadata"`
+	Order         float64        `gorm:"not null" json:"order"`
+	Version       int64          `gorm:"not null;default:1" json:"version"`
+	CreatedAt     time.Time      `gorm:"not null;default:now()" json:"created_at"`
+	UpdatedAt     time.Time      `gorm:"not null;default:now()" json:"updated_at"`
+	DeletedAt     gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
+	// Children is only filled in when blocks are returned as a tree
+	Children []Block `gorm:"-" json:"children,omitempty"`
 }
 
 // GetHeadingLevel returns the header level (for header blocks)
@@ -91,8 +109,11 @@ func (b *Block) GetHeadingLevel() int {
 		return 0
 	}
 
-	if level, ok := b.Metadata["level"].(float64); ok {
+	switch level := b.Metadata["level"].(type) {
+	case float64:
 		return int(level)
+	case int:
+		return level
 	}
 	return 1 // Default header level
 }
@@ -134,3 +155,177 @@ func (b *Block) GetTaskID() string {
 	}
 	return ""
 }
+
+// GetCodeLanguage returns the language of a code block, if any
+func (b *Block) GetCodeLanguage() string {
+	if b.Type != CodeBlock {
+		return ""
+	}
+
+	if language, ok := b.Metadata["language"].(string); ok {
+		return language
+	}
+	return ""
+}
+
+// GetTableRows returns the cells of a table block row by row
+func (b *Block) GetTableRows() [][]string {
+	if b.Type != TableBlock {
+		return nil
+	}
+
+	switch rows := b.Content["rows"].(type) {
+	case [][]string:
+		return rows
+	case []interface{}:
+		result := make([][]string, 0, len(rows))
+		for _, row := range rows {
+			cells, _ := row.([]interface{})
+			values := make([]string, len(cells))
+			for i, cell := range cells {
+				values[i], _ = cell.(string)
+			}
+			result = append(result, values)
+		}
+		return result
+	}
+	return nil
+}
+
+// IsCollapsed returns whether a toggle block hides its children
+func (b *Block) IsCollapsed() bool {
+	if b.Type != ToggleBlock {
+		return false
+	}
+
+	if collapsed, ok := b.Metadata["collapsed"].(bool); ok {
+		return collapsed
+	}
+	return false
+}
+
+// GetLinkedNoteIDs returns the distinct notes the block links to, either as
+// a noteLink block or through noteLink spans in its text
+func (b *Block) GetLinkedNoteIDs() []uuid.UUID {
+	var ids []uuid.UUID
+	seen := make(map[uuid.UUID]bool)
+	add := func(value interface{}) {
+		text, _ := value.(string)
+		if id, err := uuid.Parse(text); err == nil && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+
+	if b.Type == NoteLinkBlock {
+		add(b.Content["note_id"])
+	}
+	for _, span := range b.GetSpans() {
+		if span["type"] == NoteLinkSpan {
+			add(span["note_id"])
+		}
+	}
+	return ids
+}
+
+// BuildBlockTree nests blocks under their parents, with siblings sorted by
+// Order. Blocks whose parent is not in the list are treated as roots.
+func BuildBlockTree(blocks []Block) []Block {
+	children := groupBlocksByParent(blocks)
+	visited := make(map[uuid.UUID]bool, len(blocks))
+
+	var build func(siblings []Block) []Block
+	build = func(siblings []Block) []Block {
+		tree := make([]Block, 0, len(siblings))
+		for _, block := range siblings {
+			if block.ID != uuid.Nil {
+				// A block in a parent cycle is only listed once
+				if visited[block.ID] {
+					continue
+				}
+				visited[block.ID] = true
+				block.Children = build(children[block.ID])
+			}
+			tree = append(tree, block)
+		}
+		return tree
+	}
+	return build(blockTreeRoots(blocks, children))
+}
+
+// SortBlocksDepthFirst orders blocks so that every block is followed by its
+// descendants, which is the order they appear in on the page
+func SortBlocksDepthFirst(blocks []Block) []Block {
+	children := groupBlocksByParent(blocks)
+	visited := make(map[uuid.UUID]bool, len(blocks))
+	sorted := make([]Block, 0, len(blocks))
+
+	var visit func(siblings []Block)
+	visit = func(siblings []Block) {
+		for _, block := range siblings {
+			if block.ID == uuid.Nil {
+				sorted = append(sorted, block)
+				continue
+			}
+			if visited[block.ID] {
+				continue
+			}
+			visited[block.ID] = true
+			sorted = append(sorted, block)
+			visit(children[block.ID])
+		}
+	}
+	visit(blockTreeRoots(blocks, children))
+	return sorted
+}
+
+// groupBlocksByParent returns the sorted children of each block, roots
+// being listed under uuid.Nil
+func groupBlocksByParent(blocks []Block) map[uuid.UUID][]Block {
+	present := make(map[uuid.UUID]bool, len(blocks))
+	for _, block := range blocks {
+		present[block.ID] = true
+	}
+
+	children := make(map[uuid.UUID][]Block)
+	for _, block := range blocks {
+		parent := uuid.Nil
+		if block.ParentBlockID != nil && present[*block.ParentBlockID] && *block.ParentBlockID != block.ID {
+			parent = *block.ParentBlockID
+		}
+		children[parent] = append(children[parent], block)
+	}
+
+	for parent := range children {
+		siblings := children[parent]
+		sort.SliceStable(siblings, func(i, j int) bool { return siblings[i].Order < siblings[j].Order })
+	}
+	return children
+}
+
+// blockTreeRoots returns the top level blocks. Blocks caught in a parent
+// cycle can't be reached from the top level, so the first block of each
+// cycle is promoted to a root to keep them from disappearing.
+func blockTreeRoots(blocks []Block, children map[uuid.UUID][]Block) []Block {
+	roots := children[uuid.Nil]
+
+	reachable := make(map[uuid.UUID]bool, len(blocks))
+	var mark func(siblings []Block)
+	mark = func(siblings []Block) {
+		for _, block := range siblings {
+			if block.ID != uuid.Nil && !reachable[block.ID] {
+				reachable[block.ID] = true
+				mark(children[block.ID])
+			}
+		}
+	}
+	mark(roots)
+
+	for _, block := range blocks {
+		if block.ID != uuid.Nil && !reachable[block.ID] {
+			roots = append(roots, block)
+			mark([]Block{block})
+		}
+	}
+	return roots
+}
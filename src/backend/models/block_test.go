@@ -88,3 +88,53 @@ func TestBlockContentSerialization(t *testing.T) {
 	nested := scanned["nested"].(map[string]interface{})
 	assert.Equal(t, "value", nested["key"])
 }
+
+func TestBuildBlockTree(t *testing.T) {
+	parentID := uuid.New()
+	childID := uuid.New()
+	orphanParentID := uuid.New()
+
+	blocks := []Block{
+		{ID: childID, ParentBlockID: &parentID, Type: ListItemBlock, Order: 1},
+		{ID: uuid.New(), Type: TextBlock, Order: 2},
+		{ID: parentID, Type: ListItemBlock, Order: 1},
+		{ID: uuid.New(), ParentBlockID: &childID, Type: TaskBlock, Order: 1},
+		{ID: uuid.New(), ParentBlockID: &orphanParentID, Type: TextBlock, Order: 3},
+	}
+
+	tree := BuildBlockTree(blocks)
+	assert.Len(t, tree, 3)
+	assert.Equal(t, parentID, tree[0].ID)
+	assert.Equal(t, blocks[1].ID, tree[1].ID)
+	// A block whose parent isn't listed is shown at the top level
+	assert.Equal(t, blocks[4].ID, tree[2].ID)
+
+	assert.Len(t, tree[0].Children, 1)
+	assert.Equal(t, childID, tree[0].Children[0].ID)
+	assert.Len(t, tree[0].Children[0].Children, 1)
+	assert.Equal(t, blocks[3].ID, tree[0].Children[0].Children[0].ID)
+}
+
+func TestSortBlocksDepthFirst(t *testing.T) {
+	first := uuid.New()
+	second := uuid.New()
+	firstChild := uuid.New()
+
+	blocks := []Block{
+		{ID: second, Order: 2},
+		{ID: firstChild, ParentBlockID: &first, Order: 5},
+		{ID: first, Order: 1},
+	}
+
+	var ids []uuid.UUID
+	for _, block := range SortBlocksDepthFirst(blocks) {
+		ids = append(ids, block.ID)
+	}
+	assert.Equal(t, []uuid.UUID{first, firstChild, second}, ids)
+
+	// Blocks caught in a parent cycle are still listed exactly once
+	a, b := uuid.New(), uuid.New()
+	cycle := []Block{{ID: a, ParentBlockID: &b, Order: 1}, {ID: b, ParentBlockID: &a, Order: 2}}
+	assert.Len(t, SortBlocksDepthFirst(cycle), 2)
+	assert.Len(t, BuildBlockTree(cycle), 1)
+}
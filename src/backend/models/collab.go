@@ -0,0 +1,29 @@
+package models
+
+import (
+	"owlistic-notes/owlistic/utils/ot"
+
+	"github.com/google/uuid"
+)
+
+// BlockDocument is the text of a block as a client joining its editing
+// session starts from. Session changes whenever the server starts over from
+// the stored text, which invalidates the revisions of the previous session.
+type BlockDocument struct {
+	BlockID  uuid.UUID `json:"block_id"`
+	NoteID   uuid.UUID `json:"note_id"`
+	Session  string    `json:"session"`
+	Revision int       `json:"revision"`
+	Text     string    `json:"text"`
+}
+
+// BlockOperation is an edit of a block's text as merged by the server,
+// taking the document to Revision
+type BlockOperation struct {
+	BlockID   uuid.UUID    `json:"block_id"`
+	NoteID    uuid.UUID    `json:"note_id"`
+	UserID    uuid.UUID    `json:"user_id"`
+	Session   string       `json:"session"`
+	Revision  int          `json:"revision"`
+	Operation ot.Operation `json:"operation"`
+}
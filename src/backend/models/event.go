@@ -12,11 +12,15 @@ type Event struct {
 	Event        string          `gorm:"not null" json:"event"`
 	Version      int             `gorm:"not null" json:"version"`
 	Entity       string          `gorm:"not null" json:"entity"`
-	Timestamp    time.Time       `gorm:"not null" json:"timestamp"`
+	Timestamp    time.Time       `gorm:"not null;index" json:"timestamp"`
 	Data         json.RawMessage `gorm:"type:jsonb;not null" json:"data"`
 	Status       string          `gorm:"not null;default:'pending'" json:"status"`
 	Dispatched   bool            `gorm:"not null;default:false" json:"dispatched"`
 	DispatchedAt *time.Time      `json:"dispatched_at,omitempty"`
+	// Sequence numbers events in the order they became visible. It is
+	// assigned by the dispatcher once the event is committed, so writes
+	// through the model leave it alone.
+	Sequence *int64 `gorm:"uniqueIndex;->" json:"sequence,omitempty"`
 }
 
 func NewEvent(event, entity string, data interface{}) (*Event, error) {
@@ -0,0 +1,84 @@
+package models
+
+// GraphNodeType is the kind of entity a graph node stands for
+type GraphNodeType string
+
+const (
+	GraphNoteNode     GraphNodeType = "note"
+	GraphNotebookNode GraphNodeType = "notebook"
+	GraphTagNode      GraphNodeType = "tag"
+)
+
+// GraphEdgeType is the relationship an edge stands for
+type GraphEdgeType string
+
+const (
+	// GraphReferenceEdge goes from a note to a note it links to
+	GraphReferenceEdge GraphEdgeType = "reference"
+	// GraphTagEdge goes from a note to one of its tags
+	GraphTagEdge GraphEdgeType = "tag"
+	// GraphContainsEdge goes from a notebook to one of its notes or to a
+	// notebook nested in it
+	GraphContainsEdge GraphEdgeType = "contains"
+)
+
+// GraphNode is a note, notebook or tag. IDs are prefixed with the node type,
+// as in "note:<uuid>" or "tag:design", so they are unique across types.
+type GraphNode struct {
+	ID    string        `json:"id"`
+	Type  GraphNodeType `json:"type"`
+	Label string        `json:"label"`
+	// Orphan marks notes that neither link to nor are linked from another note
+	Orphan bool `json:"orphan,omitempty"`
+}
+
+// GraphEdge is a directed relationship between two nodes
+type GraphEdge struct {
+	Source string        `json:"source"`
+	Target string        `json:"target"`
+	Type   GraphEdgeType `json:"type"`
+}
+
+// Graph is the relationship graph of the notes a user can see
+type Graph struct {
+	Nodes []GraphNode `json:"nodes"`
+	Edges []GraphEdge `json:"edges"`
+}
+
+// Within returns the part of the graph reachable from start in at most hops
+// steps, following edges in either direction
+func (g Graph) Within(start string, hops int) Graph {
+	neighbours := make(map[string][]string)
+	for _, edge := range g.Edges {
+		neighbours[edge.Source] = append(neighbours[edge.Source], edge.Target)
+		neighbours[edge.Target] = append(neighbours[edge.Target], edge.Source)
+	}
+
+	reached := map[string]bool{start: true}
+	frontier := []string{start}
+	for hop := 0; hop < hops && len(frontier) > 0; hop++ {
+		var next []string
+		for _, id := range frontier {
+			for _, neighbour := range neighbours[id] {
+				if !reached[neighbour] {
+					reached[neighbour] = true
+					next = append(next, neighbour)
+				}
+			}
+		}
+		frontier = next
+	}
+
+	result := Graph{Nodes: []GraphNode{}, Edges: []GraphEdge{}}
+	for _, node := range g.Nodes {
+		if reached[node.ID] {
+			result.Nodes = append(result.Nodes, node)
+		}
+	}
+	for _, edge := range g.Edges {
+		if reached[edge.Source] && reached[edge.Target] {
+			result.Edges = append(result.Edges, edge)
+		}
+	}
+	return result
+}
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGraphWithin(t *testing.T) {
+	graph := Graph{
+		Nodes: []GraphNode{
+			{ID: "note:a"}, {ID: "note:b"}, {ID: "note:c"}, {ID: "tag:x"}, {ID: "note:d"},
+		},
+		Edges: []GraphEdge{
+			{Source: "note:a", Target: "note:b", Type: GraphReferenceEdge},
+			{Source: "note:c", Target: "note:b", Type: GraphReferenceEdge},
+			{Source: "note:c", Target: "tag:x", Type: GraphTagEdge},
+			{Source: "note:d", Target: "tag:x", Type: GraphTagEdge},
+		},
+	}
+
+	ids := func(g Graph) []string {
+		var result []string
+		for _, node := range g.Nodes {
+			result = append(result, node.ID)
+		}
+		return result
+	}
+
+	assert.Equal(t, []string{"note:a"}, ids(graph.Within("note:a", 0)))
+	assert.Equal(t, []string{"note:a", "note:b"}, ids(graph.Within("note:a", 1)))
+
+	// Edges are followed against their direction too
+	twoHops := graph.Within("note:a", 2)
+	assert.Equal(t, []string{"note:a", "note:b", "note:c"}, ids(twoHops))
+	assert.Len(t, twoHops.Edges, 2)
+
+	assert.Len(t, graph.Within("note:a", 4).Nodes, 5)
+}
@@ -0,0 +1,65 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// JournalPeriod is the span of time a periodic journal note covers
+type JournalPeriod string
+
+const (
+	JournalDaily   JournalPeriod = "daily"
+	JournalWeekly  JournalPeriod = "weekly"
+	JournalMonthly JournalPeriod = "monthly"
+)
+
+// JournalEntry ties a periodic note to the period it was created for, so
+// the note is found again even after it has been renamed. Date is the
+// first day of the period as YYYY-MM-DD: the Monday of a week, the 1st of
+// a month. It is kept as text so no timezone can shift it.
+type JournalEntry struct {
+	ID        uuid.UUID     `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+	UserID    uuid.UUID     `gorm:"type:uuid;not null;uniqueIndex:idx_journal_entries_period;constraint:OnDelete:CASCADE;" json:"user_id"`
+	Period    JournalPeriod `gorm:"not null;uniqueIndex:idx_journal_entries_period" json:"period"`
+	Date      string        `gorm:"not null;uniqueIndex:idx_journal_entries_period" json:"date"`
+	NoteID    uuid.UUID     `gorm:"type:uuid;not null;index;constraint:OnDelete:CASCADE;" json:"note_id"`
+	CreatedAt time.Time     `gorm:"not null;default:now()" json:"created_at"`
+}
+
+// ParseJournalPeriod checks that period is one of the known periods
+func ParseJournalPeriod(period string) (JournalPeriod, bool) {
+	switch JournalPeriod(period) {
+	case JournalDaily, JournalWeekly, JournalMonthly:
+		return JournalPeriod(period), true
+	}
+	return "", false
+}
+
+// Start returns the first day of the period containing date
+func (p JournalPeriod) Start(date time.Time) time.Time {
+	day := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, date.Location())
+	switch p {
+	case JournalWeekly:
+		// Weeks start on Monday, as ISO weeks do
+		offset := (int(day.Weekday()) + 6) % 7
+		return day.AddDate(0, 0, -offset)
+	case JournalMonthly:
+		return time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, day.Location())
+	default:
+		return day
+	}
+}
+
+// DefaultTitleFormat is the title format used when the user hasn't set one
+func (p JournalPeriod) DefaultTitleFormat() string {
+	switch p {
+	case JournalWeekly:
+		return "GGGG-[W]WW"
+	case JournalMonthly:
+		return "YYYY-MM"
+	default:
+		return "YYYY-MM-DD"
+	}
+}
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJournalPeriodStart(t *testing.T) {
+	// A Sunday, late in the evening
+	date := time.Date(2026, time.November, 1, 23, 30, 0, 0, time.UTC)
+
+	assert.Equal(t, time.Date(2026, time.November, 1, 0, 0, 0, 0, time.UTC), JournalDaily.Start(date))
+	assert.Equal(t, time.Date(2026, time.October, 26, 0, 0, 0, 0, time.UTC), JournalWeekly.Start(date))
+	assert.Equal(t, time.Date(2026, time.November, 1, 0, 0, 0, 0, time.UTC), JournalMonthly.Start(date))
+
+	monday := time.Date(2026, time.October, 26, 8, 0, 0, 0, time.UTC)
+	assert.Equal(t, time.Date(2026, time.October, 26, 0, 0, 0, 0, time.UTC), JournalWeekly.Start(monday))
+}
+
+func TestParseJournalPeriod(t *testing.T) {
+	period, ok := ParseJournalPeriod("weekly")
+	assert.True(t, ok)
+	assert.Equal(t, JournalWeekly, period)
+
+	_, ok = ParseJournalPeriod("yearly")
+	assert.False(t, ok)
+}
@@ -14,10 +14,14 @@ type Note struct {
 	NotebookID uuid.UUID      `gorm:"type:uuid;not null;constraint:OnDelete:CASCADE;" json:"notebook_id"`
 	Title      string         `gorm:"not null" json:"title"`
 	Blocks     []Block        `gorm:"foreignKey:NoteID" json:"blocks"`
-	Tags       []string       `gorm:"type:text[]" json:"tags"`
+	Tags       StringArray    `gorm:"type:text[]" json:"tags"`
+	Version    int64          `gorm:"not null;default:1" json:"version"`
 	CreatedAt  time.Time      `gorm:"not null;default:now()" json:"created_at"`
 	UpdatedAt  time.Time      `gorm:"not null;default:now()" json:"updated_at"`
 	DeletedAt  gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
+	// State is the requesting user's pinned, favourite and archived state,
+	// filled in by note listings
+	State *ResourceState `gorm:"-" json:"state,omitempty"`
 }
 
 func (n *Note) FromJSON(data []byte) error {
@@ -0,0 +1,53 @@
+package models
+
+import "github.com/google/uuid"
+
+// Text diff operations
+const (
+	DiffEqual  = "equal"
+	DiffInsert = "insert"
+	DiffDelete = "delete"
+)
+
+// TextChange is a run of words that was kept, inserted or deleted
+type TextChange struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+// FieldChange is a change of a single block or note field. Fields are named
+// "type", "content.<key>" or "metadata.<key>"; a nil value means absent.
+type FieldChange struct {
+	Field string      `json:"field"`
+	From  interface{} `json:"from"`
+	To    interface{} `json:"to"`
+}
+
+// BlockMove is a block whose position changed between two snapshots
+type BlockMove struct {
+	BlockID   uuid.UUID `json:"block_id"`
+	FromOrder float64   `json:"from_order"`
+	ToOrder   float64   `json:"to_order"`
+}
+
+// BlockChange is a block whose type, content or metadata changed
+type BlockChange struct {
+	BlockID  uuid.UUID     `json:"block_id"`
+	Before   BlockSnapshot `json:"before"`
+	After    BlockSnapshot `json:"after"`
+	Changes  []FieldChange `json:"changes"`
+	TextDiff []TextChange  `json:"text_diff,omitempty"`
+}
+
+// NoteDiff is the block-level difference between two states of a note.
+// A nil To revision refers to the live state of the note.
+type NoteDiff struct {
+	NoteID   uuid.UUID       `json:"note_id"`
+	From     int             `json:"from"`
+	To       *int            `json:"to"`
+	Title    *FieldChange    `json:"title,omitempty"`
+	Added    []BlockSnapshot `json:"added"`
+	Removed  []BlockSnapshot `json:"removed"`
+	Moved    []BlockMove     `json:"moved"`
+	Modified []BlockChange   `json:"modified"`
+}
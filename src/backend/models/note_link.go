@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// NoteLink records that a block of one note links to another note. Links
+// are derived from block content and rewritten whenever the block changes.
+type NoteLink struct {
+	ID            uuid.UUID `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+	SourceNoteID  uuid.UUID `gorm:"type:uuid;not null;index" json:"source_note_id"`
+	SourceBlockID uuid.UUID `gorm:"type:uuid;not null;index" json:"source_block_id"`
+	TargetNoteID  uuid.UUID `gorm:"type:uuid;not null;index" json:"target_note_id"`
+	// SourceDeleted and TargetDeleted follow the notes into and out of the trash
+	SourceDeleted bool      `gorm:"not null;default:false" json:"source_deleted"`
+	TargetDeleted bool      `gorm:"not null;default:false" json:"target_deleted"`
+	CreatedAt     time.Time `gorm:"not null;default:now()" json:"created_at"`
+	// NoteTitle is the title of the note at the other end of the link
+	NoteTitle string `gorm:"->;-:migration" json:"note_title"`
+}
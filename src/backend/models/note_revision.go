@@ -0,0 +1,71 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// BlockSnapshot is the state of a single block captured in a note revision
+type BlockSnapshot struct {
+	ID            uuid.UUID     `json:"id"`
+	ParentBlockID *uuid.UUID    `json:"parent_block_id,omitempty"`
+	Type          BlockType     `json:"type"`
+	Content       BlockContent  `json:"content"`
+	Metadata      BlockMetadata `json:"metadata"`
+	Order         float64       `json:"order"`
+}
+
+// BlockSnapshots is the ordered list of blocks of a note revision
+type BlockSnapshots []BlockSnapshot
+
+// Value implements the driver.Valuer interface for JSONB storage
+func (bs BlockSnapshots) Value() (driver.Value, error) {
+	if bs == nil {
+		return json.Marshal([]BlockSnapshot{})
+	}
+	return json.Marshal(bs)
+}
+
+// Scan implements the sql.Scanner interface for JSONB retrieval
+func (bs *BlockSnapshots) Scan(value interface{}) error {
+	if value == nil {
+		*bs = BlockSnapshots{}
+		return nil
+	}
+
+	bytes, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+
+	return json.Unmarshal(bytes, bs)
+}
+
+// NoteRevision is a point-in-time snapshot of a note's title and blocks.
+// Revisions are numbered sequentially per note starting at 1; the oldest
+// ones are dropped once a note has many.
+type NoteRevision struct {
+	ID        uuid.UUID      `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+	NoteID    uuid.UUID      `gorm:"type:uuid;not null;uniqueIndex:idx_note_revisions_note_revision" json:"note_id"`
+	Revision  int            `gorm:"not null;uniqueIndex:idx_note_revisions_note_revision" json:"revision"`
+	UserID    uuid.UUID      `gorm:"type:uuid;not null" json:"user_id"`
+	Title     string         `gorm:"not null" json:"title"`
+	Blocks    BlockSnapshots `gorm:"type:jsonb;not null" json:"blocks,omitempty"`
+	CreatedAt time.Time      `gorm:"not null;default:now()" json:"created_at"`
+}
+
+// NewBlockSnapshot captures the current state of a block
+func NewBlockSnapshot(block Block) BlockSnapshot {
+	return BlockSnapshot{
+		ID:            block.ID,
+		ParentBlockID: block.ParentBlockID,
+		Type:          block.Type,
+		Content:       block.Content,
+		Metadata:      block.Metadata,
+		Order:         block.Order,
+	}
+}
@@ -8,15 +8,26 @@ import (
 	"gorm.io/gorm"
 )
 
+// MaxNotebookDepth bounds how deeply notebooks can be nested
+const MaxNotebookDepth = 32
+
 type Notebook struct {
 	ID          uuid.UUID      `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
 	UserID      uuid.UUID      `gorm:"type:uuid;not null;constraint:OnDelete:CASCADE;" json:"user_id"`
 	Name        string         `gorm:"not null" json:"name"`
 	Description string         `json:"description"`
+	Version     int64          `gorm:"not null;default:1" json:"version"`
 	Notes       []Note         `gorm:"foreignKey:NotebookID" json:"notes"`
 	CreatedAt   time.Time      `gorm:"not null;default:now()" json:"created_at"`
 	UpdatedAt   time.Time      `gorm:"not null;default:now()" json:"updated_at"`
 	DeletedAt   gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
+	// ParentNotebookID nests the notebook under another; nil at the top
+	ParentNotebookID *uuid.UUID `gorm:"type:uuid;index" json:"parent_notebook_id"`
+	// Children are the nested notebooks, filled in by tree listings
+	Children []Notebook `gorm:"-" json:"children,omitempty"`
+	// State is the requesting user's pinned, favourite and archived state,
+	// filled in by notebook listings
+	State *ResourceState `gorm:"-" json:"state,omitempty"`
 }
 
 func (nb *Notebook) FromJSON(data []byte) error {
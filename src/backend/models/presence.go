@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Presence is a connection viewing a note: whose it is, the block its
+// cursor is in, if any, and when its user last did something there. The
+// entry lapses at ExpiresAt unless the connection answers pings until then.
+type Presence struct {
+	ConnectionID string     `json:"connection_id"`
+	UserID       uuid.UUID  `json:"user_id"`
+	NoteID       uuid.UUID  `json:"note_id"`
+	BlockID      *uuid.UUID `json:"block_id,omitempty"`
+	LastActive   time.Time  `json:"last_active"`
+	ExpiresAt    time.Time  `json:"expires_at"`
+}
+
+// PresenceChange is a presence event, such as "presence.joined", with the
+// entry it is about
+type PresenceChange struct {
+	Event    string   `json:"event"`
+	Presence Presence `json:"presence"`
+}
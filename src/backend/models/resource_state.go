@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ResourceState is one user's own view of a note or notebook: whether they
+// pinned it and where, marked it as a favourite or archived it. Each user of
+// a shared note keeps their own state.
+type ResourceState struct {
+	UserID       uuid.UUID    `gorm:"type:uuid;primaryKey" json:"user_id"`
+	ResourceID   uuid.UUID    `gorm:"type:uuid;primaryKey" json:"resource_id"`
+	ResourceType ResourceType `gorm:"type:varchar(50);not null;index" json:"resource_type"`
+	Pinned       bool         `gorm:"not null" json:"pinned"`
+	// PinOrder sorts pinned items among themselves, lowest first
+	PinOrder  float64   `gorm:"not null" json:"pin_order"`
+	Favourite bool      `gorm:"not null" json:"favourite"`
+	Archived  bool      `gorm:"not null" json:"archived"`
+	UpdatedAt time.Time `gorm:"not null;default:now()" json:"updated_at"`
+}
+
+// PinnedBefore reports whether an item in state a sorts before one in state
+// b when pinned items come first, in pin order. Either state may be nil.
+func PinnedBefore(a, b *ResourceState) bool {
+	aPinned, bPinned := a != nil && a.Pinned, b != nil && b.Pinned
+	if aPinned != bPinned {
+		return aPinned
+	}
+	return aPinned && a.PinOrder < b.PinOrder
+}
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPinnedBefore(t *testing.T) {
+	first := &ResourceState{Pinned: true, PinOrder: 1000}
+	second := &ResourceState{Pinned: true, PinOrder: 2000}
+	favourite := &ResourceState{Favourite: true}
+
+	assert.True(t, PinnedBefore(first, second))
+	assert.False(t, PinnedBefore(second, first))
+	assert.True(t, PinnedBefore(second, nil))
+	assert.True(t, PinnedBefore(second, favourite))
+	assert.False(t, PinnedBefore(nil, first))
+	assert.False(t, PinnedBefore(nil, favourite))
+	assert.False(t, PinnedBefore(favourite, nil))
+}
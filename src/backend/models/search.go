@@ -0,0 +1,16 @@
+package models
+
+import (
+	"github.com/google/uuid"
+)
+
+// SearchResult represents a single ranked full-text search hit
+type SearchResult struct {
+	ResourceType ResourceType `json:"resource_type"`
+	ResourceID   uuid.UUID    `json:"resource_id"`
+	NoteID       uuid.UUID    `json:"note_id"`
+	BlockID      *uuid.UUID   `json:"block_id,omitempty"`
+	Title        string       `json:"title"`
+	Snippets     []string     `json:"snippets"`
+	Rank         float64      `json:"rank"`
+}
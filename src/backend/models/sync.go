@@ -0,0 +1,66 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SyncChange is the current state of a notebook, note, block or task that
+// changed since a client last synced. Deleted resources, in the trash or
+// gone for good, come as tombstones without data.
+type SyncChange struct {
+	Type      string      `json:"type"`
+	ID        uuid.UUID   `json:"id"`
+	Deleted   bool        `json:"deleted"`
+	Version   int64       `json:"version,omitempty"`
+	Data      interface{} `json:"data,omitempty"`
+	ChangedAt time.Time   `json:"changed_at"`
+}
+
+// SyncPage is one page of the change feed. Cursor is passed back as "since"
+// to continue after it; HasMore tells whether there are changes past it
+// already.
+type SyncPage struct {
+	Changes []SyncChange `json:"changes"`
+	Cursor  string       `json:"cursor"`
+	HasMore bool         `json:"has_more"`
+}
+
+// Sync mutation operations
+const (
+	SyncCreate = "create"
+	SyncUpdate = "update"
+	SyncDelete = "delete"
+)
+
+// SyncMutation is a change a client made while offline. ClientID names the
+// mutation in the results; for a create it also stands in for the ID of the
+// new resource in the mutations following it.
+type SyncMutation struct {
+	ClientID        string                 `json:"client_id"`
+	Type            string                 `json:"type"`
+	Op              string                 `json:"op"`
+	ID              string                 `json:"id,omitempty"`
+	ExpectedVersion *int64                 `json:"expected_version,omitempty"`
+	Data            map[string]interface{} `json:"data,omitempty"`
+}
+
+// Sync mutation result statuses
+const (
+	SyncApplied  = "applied"
+	SyncConflict = "conflict"
+	SyncFailed   = "failed"
+)
+
+// SyncResult tells how a pushed mutation went. Data is the resource after an
+// applied create or update; Current is the resource as the server has it
+// when the mutation was based on an outdated version.
+type SyncResult struct {
+	ClientID string      `json:"client_id,omitempty"`
+	Status   string      `json:"status"`
+	ID       string      `json:"id,omitempty"`
+	Data     interface{} `json:"data,omitempty"`
+	Current  interface{} `json:"current,omitempty"`
+	Error    string      `json:"error,omitempty"`
+}
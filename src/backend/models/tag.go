@@ -0,0 +1,170 @@
+package models
+
+import (
+	"database/sql/driver"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+)
+
+// Tag holds the colour of a tag used on a user's notes. Notes keep their
+// tags by name in Note.Tags, so a tag's notes are found through its name.
+type Tag struct {
+	ID        uuid.UUID `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+	UserID    uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_tags_user_name;constraint:OnDelete:CASCADE;" json:"user_id"`
+	Name      string    `gorm:"not null;uniqueIndex:idx_tags_user_name" json:"name"`
+	Color     string    `gorm:"not null;default:''" json:"color"`
+	CreatedAt time.Time `gorm:"not null;default:now()" json:"created_at"`
+	UpdatedAt time.Time `gorm:"not null;default:now()" json:"updated_at"`
+	// NoteCount is the number of the user's notes carrying the tag
+	NoteCount int64 `gorm:"->;-:migration" json:"note_count"`
+}
+
+// inlineTagPattern matches #tag words in block text. The # must not follow
+// a letter, digit or another # so that anchors in URLs and "C#" are skipped.
+var inlineTagPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_#&/])#([\p{L}\p{N}_][\p{L}\p{N}_/-]*)`)
+
+// NormalizeTagName trims a tag name and the # it may have been written with.
+// It returns an empty string when the name can't be used as a tag.
+func NormalizeTagName(name string) string {
+	name = strings.TrimPrefix(strings.TrimSpace(name), "#")
+	if name == "" {
+		return ""
+	}
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' && r != '-' && r != '/' {
+			return ""
+		}
+	}
+	return name
+}
+
+// ExtractInlineTags returns the distinct #tags written in text, in order.
+// Purely numeric words such as "#1" are not tags.
+func ExtractInlineTags(text string) []string {
+	var tags []string
+	seen := make(map[string]bool)
+	for _, match := range inlineTagPattern.FindAllStringSubmatch(text, -1) {
+		name := strings.TrimRight(match[1], "/-")
+		if name == "" || seen[name] || strings.IndexFunc(name, func(r rune) bool { return !unicode.IsDigit(r) }) < 0 {
+			continue
+		}
+		seen[name] = true
+		tags = append(tags, name)
+	}
+	return tags
+}
+
+// ReplaceInlineTag rewrites the #name tags written in text as
+// #replacement, or as plain words when replacement is empty
+func ReplaceInlineTag(text string, name string, replacement string) string {
+	var replaced strings.Builder
+	last := 0
+	for _, match := range inlineTagPattern.FindAllStringSubmatchIndex(text, -1) {
+		start, end := match[2], match[3]
+		if strings.TrimRight(text[start:end], "/-") != name {
+			continue
+		}
+
+		// The # comes right before the name
+		replaced.WriteString(text[last : start-1])
+		if replacement != "" {
+			replaced.WriteString("#" + replacement)
+		} else {
+			replaced.WriteString(name)
+		}
+		last = start + len(name)
+	}
+	replaced.WriteString(text[last:])
+	return replaced.String()
+}
+
+// GetInlineTags returns the #tags written in the block's text. Code blocks
+// never carry tags.
+func (b *Block) GetInlineTags() []string {
+	if b.Type == CodeBlock {
+		return nil
+	}
+
+	text, _ := b.Content["text"].(string)
+	return ExtractInlineTags(text)
+}
+
+// StringArray stores a list of strings as a PostgreSQL text[]
+type StringArray []string
+
+// Value implements the driver.Valuer interface for text[] storage
+func (a StringArray) Value() (driver.Value, error) {
+	if a == nil {
+		return nil, nil
+	}
+
+	var sb strings.Builder
+	sb.WriteByte('{')
+	for i, value := range a {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteByte('"')
+		sb.WriteString(strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value))
+		sb.WriteByte('"')
+	}
+	sb.WriteByte('}')
+	return sb.String(), nil
+}
+
+// Scan implements the sql.Scanner interface for text[] retrieval
+func (a *StringArray) Scan(value interface{}) error {
+	var literal string
+	switch v := value.(type) {
+	case nil:
+		*a = nil
+		return nil
+	case []byte:
+		literal = string(v)
+	case string:
+		literal = v
+	default:
+		return errors.New("type assertion to string failed")
+	}
+
+	if len(literal) < 2 || literal[0] != '{' || literal[len(literal)-1] != '}' {
+		return errors.New("invalid text array literal")
+	}
+
+	result := StringArray{}
+	body := literal[1 : len(literal)-1]
+	for i := 0; i < len(body); {
+		var sb strings.Builder
+		quoted := body[i] == '"'
+		if quoted {
+			i++
+			for i < len(body) && body[i] != '"' {
+				if body[i] == '\\' && i+1 < len(body) {
+					i++
+				}
+				sb.WriteByte(body[i])
+				i++
+			}
+			i++ // closing quote
+		} else {
+			for i < len(body) && body[i] != ',' {
+				sb.WriteByte(body[i])
+				i++
+			}
+		}
+
+		// Unquoted NULL elements carry no tag
+		if quoted || sb.String() != "NULL" {
+			result = append(result, sb.String())
+		}
+		i++ // separator
+	}
+
+	*a = result
+	return nil
+}
@@ -0,0 +1,59 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeTagName(t *testing.T) {
+	assert.Equal(t, "design", NormalizeTagName(" #design "))
+	assert.Equal(t, "projects/owl-2", NormalizeTagName("projects/owl-2"))
+	assert.Equal(t, "", NormalizeTagName("#"))
+	assert.Equal(t, "", NormalizeTagName("two words"))
+	assert.Equal(t, "", NormalizeTagName("a,b"))
+}
+
+func TestExtractInlineTags(t *testing.T) {
+	text := "#design review for #api/v2, see http://example.com/#anchor and C# notes #42 #design."
+	assert.Equal(t, []string{"design", "api/v2"}, ExtractInlineTags(text))
+	assert.Nil(t, ExtractInlineTags("no tags here"))
+}
+
+func TestReplaceInlineTag(t *testing.T) {
+	text := "#design review, #design/ui and #designs. See http://example.com/#design, #design-"
+	assert.Equal(t, "#ux review, #design/ui and #designs. See http://example.com/#design, #ux-",
+		ReplaceInlineTag(text, "design", "ux"))
+	assert.Equal(t, "design review, #design/ui and #designs. See http://example.com/#design, design-",
+		ReplaceInlineTag(text, "design", ""))
+	assert.Equal(t, "no tags here", ReplaceInlineTag("no tags here", "design", "ux"))
+}
+
+func TestBlockGetInlineTags(t *testing.T) {
+	text := Block{Type: TextBlock, Content: BlockContent{"text": "ship it #release"}}
+	assert.Equal(t, []string{"release"}, text.GetInlineTags())
+
+	code := Block{Type: CodeBlock, Content: BlockContent{"text": "#include <stdio.h>"}}
+	assert.Nil(t, code.GetInlineTags())
+}
+
+func TestStringArray(t *testing.T) {
+	value, err := StringArray{"plain", `with "quotes"`, `back\slash`}.Value()
+	assert.NoError(t, err)
+	assert.Equal(t, `{"plain","with \"quotes\"","back\\slash"}`, value)
+
+	var scanned StringArray
+	assert.NoError(t, scanned.Scan([]byte(value.(string))))
+	assert.Equal(t, StringArray{"plain", `with "quotes"`, `back\slash`}, scanned)
+
+	assert.NoError(t, scanned.Scan("{design,\"two words\",NULL}"))
+	assert.Equal(t, StringArray{"design", "two words"}, scanned)
+
+	assert.NoError(t, scanned.Scan("{}"))
+	assert.Equal(t, StringArray{}, scanned)
+
+	assert.NoError(t, scanned.Scan(nil))
+	assert.Nil(t, scanned)
+
+	assert.Error(t, scanned.Scan("design"))
+}
@@ -45,6 +45,7 @@ type Task struct {
 	IsCompleted bool           `gorm:"default:false" json:"is_completed"`
 	DueDate     string         `json:"due_date"`
 	Metadata    TaskMetadata   `gorm:"type:jsonb;default:'{}'::jsonb" json:"metadata,omitempty"`
+	Version     int64          `gorm:"not null;default:1" json:"version"`
 	CreatedAt   time.Time      `gorm:"not null;default:now()" json:"created_at"`
 	UpdatedAt   time.Time      `gorm:"not null;default:now()" json:"updated_at"`
 	DeletedAt   gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Template is a saved skeleton new notes can start from. Its title and the
+// text of its blocks may hold placeholders such as {{date}} or
+// {{prompt:Project name}}, filled in when a note is created from it.
+type Template struct {
+	ID     uuid.UUID `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+	UserID uuid.UUID `gorm:"type:uuid;not null;index;constraint:OnDelete:CASCADE;" json:"user_id"`
+	Name   string    `gorm:"not null" json:"name"`
+	// Title is the title given to notes created from the template
+	Title string      `json:"title"`
+	Tags  StringArray `gorm:"type:text[]" json:"tags"`
+	// Blocks are listed parents first; their IDs only link children to
+	// parents within the template
+	Blocks    BlockSnapshots `gorm:"type:jsonb;not null" json:"blocks"`
+	CreatedAt time.Time      `gorm:"not null;default:now()" json:"created_at"`
+	UpdatedAt time.Time      `gorm:"not null;default:now()" json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
+	// Prompts lists the values to ask for before using the template
+	Prompts []string `gorm:"-" json:"prompts"`
+}
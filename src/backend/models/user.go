@@ -1,24 +1,53 @@
 package models
 
 import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
 	"time"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
+// UserPreferences holds free-form user settings such as "timezone"
+type UserPreferences map[string]interface{}
+
+// Value implements the driver.Valuer interface for JSONB storage
+func (p UserPreferences) Value() (driver.Value, error) {
+	if p == nil {
+		return nil, nil
+	}
+	return json.Marshal(p)
+}
+
+// Scan implements the sql.Scanner interface for JSONB retrieval
+func (p *UserPreferences) Scan(value interface{}) error {
+	if value == nil {
+		*p = nil
+		return nil
+	}
+
+	bytes, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+
+	return json.Unmarshal(bytes, p)
+}
+
 // User represents the user entity stored in the database
 type User struct {
-	ID           uuid.UUID              `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
-	Email        string                 `gorm:"unique;not null" json:"email"`
-	PasswordHash string                 `json:"-"` // Password hash is never exposed in JSON
-	Username     string                 `gorm:"unique" json:"username"`
-	DisplayName  string                 `json:"display_name"`
-	ProfilePic   string                 `json:"profile_pic"`
-	Preferences  map[string]interface{} `gorm:"type:jsonb" json:"preferences"`
-	CreatedAt    time.Time              `gorm:"not null;default:now()" json:"created_at"`
-	UpdatedAt    time.Time              `gorm:"not null;default:now()" json:"updated_at"`
-	DeletedAt    gorm.DeletedAt         `gorm:"index" json:"deleted_at,omitempty"`
+	ID           uuid.UUID       `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+	Email        string          `gorm:"unique;not null" json:"email"`
+	PasswordHash string          `json:"-"` // Password hash is never exposed in JSON
+	Username     string          `gorm:"unique" json:"username"`
+	DisplayName  string          `json:"display_name"`
+	ProfilePic   string          `json:"profile_pic"`
+	Preferences  UserPreferences `gorm:"type:jsonb" json:"preferences"`
+	CreatedAt    time.Time       `gorm:"not null;default:now()" json:"created_at"`
+	UpdatedAt    time.Time       `gorm:"not null;default:now()" json:"updated_at"`
+	DeletedAt    gorm.DeletedAt  `gorm:"index" json:"deleted_at,omitempty"`
 }
 
 // UserRegistrationInput represents data needed for registration
@@ -23,6 +23,9 @@ type StandardMessage struct {
 	Payload      map[string]interface{} `json:"payload"`
 	ResourceID   string                 `json:"resource_id,omitempty"`   // Used for RBAC
 	ResourceType string                 `json:"resource_type,omitempty"` // Used for RBAC
+	// ResourceVersion is the version a block, note, notebook or task event
+	// left its resource at, for clients to drop updates arriving out of order
+	ResourceVersion int64 `json:"resource_version,omitempty"`
 }
 
 // NewStandardMessage creates a new standard message
@@ -42,3 +45,9 @@ func (m *StandardMessage) WithResource(resourceType string, resourceID string) *
 	m.ResourceID = resourceID
 	return m
 }
+
+// WithVersion adds the version of the resource to the message
+func (m *StandardMessage) WithVersion(version int64) *StandardMessage {
+	m.ResourceVersion = version
+	return m
+}
@@ -0,0 +1,174 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"owlistic-notes/owlistic/database"
+	"owlistic-notes/owlistic/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// multipartOverhead is what an upload may take besides the file itself:
+// boundaries, part headers and other form fields
+const multipartOverhead = 1 << 20
+
+// RegisterAttachmentRoutes registers the endpoints uploading files to notes
+// and downloading them
+func RegisterAttachmentRoutes(group *gin.RouterGroup, db *database.Database, attachmentService services.AttachmentServiceInterface) {
+	group.POST("/notes/:id/attachments", func(c *gin.Context) { UploadAttachment(c, db, attachmentService) })
+	group.GET("/notes/:id/attachments", func(c *gin.Context) { ListAttachments(c, db, attachmentService) })
+	group.GET("/attachments/:id", func(c *gin.Context) { GetAttachment(c, db, attachmentService) })
+	group.DELETE("/attachments/:id", func(c *gin.Context) { DeleteAttachment(c, db, attachmentService) })
+}
+
+// UploadAttachment adds the multipart "file" to the note
+func UploadAttachment(c *gin.Context, db *database.Database, attachmentService services.AttachmentServiceInterface) {
+	userIDInterface, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	params := map[string]interface{}{
+		"user_id": userIDInterface.(uuid.UUID).String(),
+	}
+
+	// Oversized uploads are cut off while reading rather than spooled whole
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, attachmentService.MaxSize()+multipartOverhead)
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": services.ErrAttachmentTooLarge.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Expected a multipart form with a file"})
+		return
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	defer file.Close()
+
+	attachment, err := attachmentService.UploadAttachment(db, c.Param("id"), header.Filename, file, params)
+	if err != nil {
+		handleAttachmentError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, attachment)
+}
+
+// ListAttachments returns the attachments of the note
+func ListAttachments(c *gin.Context, db *database.Database, attachmentService services.AttachmentServiceInterface) {
+	userIDInterface, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	params := map[string]interface{}{
+		"user_id": userIDInterface.(uuid.UUID).String(),
+	}
+
+	attachments, err := attachmentService.ListAttachments(db, c.Param("id"), params)
+	if err != nil {
+		handleAttachmentError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, attachments)
+}
+
+// GetAttachment serves the content of an attachment. Images are shown
+// inline, other files are downloaded.
+func GetAttachment(c *gin.Context, db *database.Database, attachmentService services.AttachmentServiceInterface) {
+	userIDInterface, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	params := map[string]interface{}{
+		"user_id": userIDInterface.(uuid.UUID).String(),
+	}
+
+	attachment, content, err := attachmentService.GetAttachment(db, c.Param("id"), params)
+	if err != nil {
+		handleAttachmentError(c, err)
+		return
+	}
+	defer content.Close()
+
+	// The content behind a hash never changes
+	etag := `"` + attachment.Hash + `"`
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", "private, max-age=31536000, immutable")
+	if c.GetHeader("If-None-Match") == etag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	disposition := "attachment"
+	if mediaType, _, _ := mime.ParseMediaType(attachment.ContentType); strings.HasPrefix(mediaType, "image/") {
+		disposition = "inline"
+	}
+	c.Header("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": attachment.Filename}))
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Content-Length", strconv.FormatInt(attachment.Size, 10))
+	c.Header("Content-Type", attachment.ContentType)
+	c.Status(http.StatusOK)
+
+	if _, err := io.Copy(c.Writer, content); err != nil {
+		c.Error(fmt.Errorf("serving attachment %s: %w", attachment.ID, err))
+	}
+}
+
+// DeleteAttachment removes an attachment from its note
+func DeleteAttachment(c *gin.Context, db *database.Database, attachmentService services.AttachmentServiceInterface) {
+	userIDInterface, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	params := map[string]interface{}{
+		"user_id": userIDInterface.(uuid.UUID).String(),
+	}
+
+	if err := attachmentService.DeleteAttachment(db, c.Param("id"), params); err != nil {
+		handleAttachmentError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func handleAttachmentError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrAttachmentTooLarge):
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrAttachmentMediaType):
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrInvalidInput):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrNoteNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Note not found"})
+	case errors.Is(err, services.ErrAttachmentNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Attachment not found"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
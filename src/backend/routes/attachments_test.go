@@ -0,0 +1,161 @@
+package routes
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"owlistic-notes/owlistic/database"
+	"owlistic-notes/owlistic/models"
+	"owlistic-notes/owlistic/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+type MockAttachmentService struct {
+	deleted []string
+	uploads int
+}
+
+func (m *MockAttachmentService) UploadAttachment(db *database.Database, noteID string, filename string, file io.Reader, params map[string]interface{}) (models.Attachment, error) {
+	m.uploads++
+	data, _ := io.ReadAll(file)
+	switch {
+	case noteID == "missing":
+		return models.Attachment{}, services.ErrNoteNotFound
+	case len(data) > 8:
+		return models.Attachment{}, services.ErrAttachmentTooLarge
+	case filename == "script.sh":
+		return models.Attachment{}, services.ErrAttachmentMediaType
+	}
+	return models.Attachment{ID: uuid.New(), Filename: filename, Size: int64(len(data))}, nil
+}
+
+func (m *MockAttachmentService) GetAttachment(db *database.Database, id string, params map[string]interface{}) (models.Attachment, io.ReadCloser, error) {
+	if id == "missing" {
+		return models.Attachment{}, nil, services.ErrAttachmentNotFound
+	}
+	attachment := models.Attachment{Filename: "plan.pdf", ContentType: "application/pdf", Size: 4, Hash: "abcd"}
+	return attachment, io.NopCloser(strings.NewReader("%PDF")), nil
+}
+
+func (m *MockAttachmentService) ListAttachments(db *database.Database, noteID string, params map[string]interface{}) ([]models.Attachment, error) {
+	return []models.Attachment{{Filename: "plan.pdf"}}, nil
+}
+
+func (m *MockAttachmentService) DeleteAttachment(db *database.Database, id string, params map[string]interface{}) error {
+	m.deleted = append(m.deleted, id)
+	return nil
+}
+
+func (m *MockAttachmentService) DeleteUnusedBlobs(db *database.Database, hashes []string) {}
+
+func (m *MockAttachmentService) MaxSize() int64 {
+	return 8
+}
+
+func attachmentUpload(t *testing.T, url string, filename string, content string) *http.Request {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("file", filename)
+	assert.NoError(t, err)
+	part.Write([]byte(content))
+	writer.Close()
+
+	req, _ := http.NewRequest("POST", url, &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return req
+}
+
+func TestAttachmentRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	db := &database.Database{}
+	service := &MockAttachmentService{}
+
+	// Add mock middleware to set userID in context
+	router.Use(func(c *gin.Context) {
+		c.Set("userID", uuid.Must(uuid.Parse("90a12345-f12a-98c4-a456-513432930000")))
+		c.Next()
+	})
+
+	apiGroup := router.Group("/api/v1")
+	RegisterAttachmentRoutes(apiGroup, db, service)
+
+	t.Run("Upload Attachment", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, attachmentUpload(t, "/api/v1/notes/"+uuid.New().String()+"/attachments", "plan.pdf", "%PDF"))
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Contains(t, w.Body.String(), `"filename":"plan.pdf"`)
+	})
+
+	t.Run("Upload Errors", func(t *testing.T) {
+		cases := map[string]int{
+			"missing|a.pdf|%PDF":     http.StatusNotFound,
+			"note|big.pdf|%PDF-1.7 ": http.StatusRequestEntityTooLarge,
+			"note|script.sh|#!":      http.StatusUnsupportedMediaType,
+		}
+		for upload, status := range cases {
+			fields := strings.Split(upload, "|")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, attachmentUpload(t, "/api/v1/notes/"+fields[0]+"/attachments", fields[1], fields[2]))
+			assert.Equal(t, status, w.Code, upload)
+		}
+
+		// Bodies far over the limit never reach the service
+		uploads := service.uploads
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, attachmentUpload(t, "/api/v1/notes/note/attachments", "huge.bin", strings.Repeat("x", 2*multipartOverhead)))
+		assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+		assert.Equal(t, uploads, service.uploads)
+
+		w = httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/notes/note/attachments", strings.NewReader("{}"))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Download Attachment", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/attachments/"+uuid.New().String(), nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "%PDF", w.Body.String())
+		assert.Equal(t, "application/pdf", w.Header().Get("Content-Type"))
+		assert.Equal(t, `attachment; filename=plan.pdf`, w.Header().Get("Content-Disposition"))
+		assert.Equal(t, "nosniff", w.Header().Get("X-Content-Type-Options"))
+
+		w = httptest.NewRecorder()
+		req, _ = http.NewRequest("GET", "/api/v1/attachments/"+uuid.New().String(), nil)
+		req.Header.Set("If-None-Match", `"abcd"`)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusNotModified, w.Code)
+
+		w = httptest.NewRecorder()
+		req, _ = http.NewRequest("GET", "/api/v1/attachments/missing", nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("List And Delete Attachments", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/notes/"+uuid.New().String()+"/attachments", nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "plan.pdf")
+
+		id := uuid.New().String()
+		w = httptest.NewRecorder()
+		req, _ = http.NewRequest("DELETE", "/api/v1/attachments/"+id, nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		assert.Equal(t, []string{id}, service.deleted)
+	})
+}
@@ -23,6 +23,12 @@ func RegisterBlockRoutes(group *gin.RouterGroup, db *database.Database, blockSer
 	group.GET("/blocks/:id", func(c *gin.Context) { GetBlockById(c, db, blockService) })
 	group.PUT("/blocks/:id", func(c *gin.Context) { UpdateBlock(c, db, blockService) })
 	group.DELETE("/blocks/:id", func(c *gin.Context) { DeleteBlock(c, db, blockService) })
+
+	// Blocks of a note, optionally nested into a tree
+	group.GET("/notes/:id/blocks", func(c *gin.Context) { GetBlocksByNote(c, db, blockService) })
+
+	// Batch endpoint applying several block operations to a note at once
+	group.POST("/notes/:id/blocks/batch", func(c *gin.Context) { ApplyBlockBatch(c, db, blockService) })
 }
 
 func GetBlocks(c *gin.Context, db *database.Database, blockService services.BlockServiceInterface) {
@@ -104,6 +110,13 @@ func CreateBlock(c *gin.Context, db *database.Database, blockService services.Bl
 
 	block, err := blockService.CreateBlock(db, blockData, params)
 	if err != nil {
+		if respondBlockValidationError(c, err) {
+			return
+		}
+		if errors.Is(err, services.ErrInvalidBlockType) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -134,6 +147,7 @@ func GetBlockById(c *gin.Context, db *database.Database, blockService services.B
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	setVersionETag(c, block.Version)
 	c.JSON(http.StatusOK, block)
 }
 
@@ -160,6 +174,10 @@ func UpdateBlock(c *gin.Context, db *database.Database, blockService services.Bl
 	// Note: blockData may contain metadata field with styling information
 	// which will be properly handled by the UpdateBlock service method
 
+	if !expectVersion(c, blockData) {
+		return
+	}
+
 	block, err := blockService.UpdateBlock(db, id, blockData, params)
 	if err != nil {
 		if errors.Is(err, services.ErrBlockNotFound) {
@@ -168,10 +186,16 @@ func UpdateBlock(c *gin.Context, db *database.Database, blockService services.Bl
 		} else if errors.Is(err, services.ErrInvalidInput) {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input data"})
 			return
+		} else if errors.Is(err, services.ErrInvalidBlockType) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		} else if respondBlockValidationError(c, err) || respondVersionConflict(c, err) {
+			return
 		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	setVersionETag(c, block.Version)
 	c.JSON(http.StatusOK, block)
 }
 
@@ -190,10 +214,18 @@ func DeleteBlock(c *gin.Context, db *database.Database, blockService services.Bl
 		return
 	}
 
+	// What happens to child blocks: "cascade" (default) or "reparent"
+	if children := c.Query("children"); children != "" {
+		params["children"] = children
+	}
+
 	if err := blockService.DeleteBlock(db, id, params); err != nil {
 		if errors.Is(err, services.ErrBlockNotFound) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Block not found"})
 			return
+		} else if errors.Is(err, services.ErrInvalidInput) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
 		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -202,7 +234,7 @@ func DeleteBlock(c *gin.Context, db *database.Database, blockService services.Bl
 }
 
 func GetBlocksByNote(c *gin.Context, db *database.Database, blockService services.BlockServiceInterface) {
-	noteID := c.Param("note_id")
+	noteID := c.Param("id")
 
 	// Extract query parameters
 	params := make(map[string]interface{})
@@ -220,6 +252,11 @@ func GetBlocksByNote(c *gin.Context, db *database.Database, blockService service
 	// Add note ID to params
 	params["note_id"] = noteID
 
+	// Nest child blocks under their parents instead of a flat list
+	if tree := c.Query("tree"); tree == "true" {
+		params["tree"] = true
+	}
+
 	blocks, err := blockService.ListBlocksByNote(db, noteID, params)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -227,3 +264,58 @@ func GetBlocksByNote(c *gin.Context, db *database.Database, blockService service
 	}
 	c.JSON(http.StatusOK, blocks)
 }
+
+func ApplyBlockBatch(c *gin.Context, db *database.Database, blockService services.BlockServiceInterface) {
+	var request struct {
+		Operations []services.BlockOperation `json:"operations" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Create params map for permissions check
+	params := make(map[string]interface{})
+
+	// Add user ID from context to params
+	userIDInterface, exists := c.Get("userID")
+	if exists {
+		params["user_id"] = userIDInterface.(uuid.UUID).String()
+	} else {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	result, err := blockService.ApplyBatch(db, c.Param("id"), request.Operations, params)
+	if err != nil {
+		if respondBlockValidationError(c, err) || respondVersionConflict(c, err) {
+			return
+		}
+		switch {
+		case errors.Is(err, services.ErrNoteNotFound), errors.Is(err, services.ErrBlockNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrInvalidInput), errors.Is(err, services.ErrInvalidBlockType):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// respondBlockValidationError answers with a 422 naming the fields that
+// violate the block schema, and reports whether err was such a violation
+func respondBlockValidationError(c *gin.Context, err error) bool {
+	var validationErr *services.BlockValidationError
+	if !errors.As(err, &validationErr) {
+		return false
+	}
+
+	c.JSON(http.StatusUnprocessableEntity, gin.H{
+		"error":      err.Error(),
+		"block_type": validationErr.BlockType,
+		"fields":     validationErr.Fields,
+	})
+	return true
+}
@@ -2,7 +2,9 @@ package routes
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"strconv"
@@ -134,6 +136,14 @@ func (m *MockBlockService) UpdateBlock(db *database.Database, id string, blockDa
 	}
 
 	if id == "123e4567-e89b-12d3-a456-426614174000" {
+		// The stored block is at version 2
+		if expected, ok := blockData["expected_version"].(int64); ok && expected != 2 {
+			return models.Block{}, &services.VersionConflictError{
+				Expected: expected,
+				Current:  models.Block{ID: uuid.Must(uuid.Parse(id)), Type: models.TextBlock, Version: 2},
+			}
+		}
+
 		// Handle content updates
 		var content models.BlockContent
 		if c, ok := blockData["content"]; ok {
@@ -154,6 +164,7 @@ func (m *MockBlockService) UpdateBlock(db *database.Database, id string, blockDa
 			Content: content,
 			Type:    models.TextBlock,
 			Order:   1,
+			Version: 3,
 		}, nil
 	}
 	return models.Block{}, services.ErrBlockNotFound
@@ -167,6 +178,10 @@ func (m *MockBlockService) DeleteBlock(db *database.Database, id string, params
 		return errors.New("user_id must be provided in parameters")
 	}
 
+	if children, ok := params["children"].(string); ok && children != services.DeleteChildrenCascade && children != services.DeleteChildrenReparent {
+		return services.ErrInvalidInput
+	}
+
 	if id == "123e4567-e89b-12d3-a456-426614174000" {
 		return nil
 	}
@@ -182,7 +197,7 @@ func (m *MockBlockService) ListBlocksByNote(db *database.Database, noteID string
 	}
 
 	if noteID == "90a12345-f12a-98c4-a456-513432930000" {
-		return []models.Block{
+		blocks := []models.Block{
 			{
 				ID:      uuid.Must(uuid.Parse("123e4567-e89b-12d3-a456-426614174000")),
 				NoteID:  uuid.Must(uuid.Parse(noteID)),
@@ -190,11 +205,42 @@ func (m *MockBlockService) ListBlocksByNote(db *database.Database, noteID string
 				Content: models.BlockContent{"text": "Test Content"},
 				Order:   1,
 			},
-		}, nil
+		}
+		if tree, _ := params["tree"].(bool); tree {
+			blocks[0].Children = []models.Block{{
+				ID:      uuid.Must(uuid.Parse("123e4567-e89b-12d3-a456-426614174001")),
+				NoteID:  uuid.Must(uuid.Parse(noteID)),
+				Type:    models.TextBlock,
+				Content: models.BlockContent{"text": "Nested Content"},
+				Order:   1,
+			}}
+		}
+		return blocks, nil
 	}
 	return []models.Block{}, nil
 }
 
+func (m *MockBlockService) ApplyBatch(db *database.Database, noteID string, operations []services.BlockOperation, params map[string]interface{}) (services.BlockBatchResult, error) {
+	if noteID != "90a12345-f12a-98c4-a456-513432930000" {
+		return services.BlockBatchResult{}, services.ErrNoteNotFound
+	}
+
+	result := services.BlockBatchResult{BatchID: uuid.New()}
+	for i, operation := range operations {
+		if operation.Op != services.BlockOpCreate && operation.BlockID == "" {
+			return services.BlockBatchResult{}, services.ErrInvalidInput
+		}
+		if operation.Type == string(models.HeadingBlock) {
+			return services.BlockBatchResult{}, fmt.Errorf("operation %d (%s): %w", i, operation.Op, &services.BlockValidationError{
+				BlockType: models.HeadingBlock,
+				Fields:    []services.FieldError{{Field: "metadata.level", Message: "must be an integer"}},
+			})
+		}
+		result.Results = append(result.Results, services.BlockOperationResult{Op: operation.Op, BlockID: uuid.New()})
+	}
+	return result, nil
+}
+
 func TestCreateBlock(t *testing.T) {
 	router := gin.Default()
 	db := &database.Database{}
@@ -309,6 +355,52 @@ func TestUpdateBlock(t *testing.T) {
 	})
 }
 
+func TestUpdateBlockVersions(t *testing.T) {
+	router := gin.Default()
+	db := &database.Database{}
+	mockService := &MockBlockService{}
+
+	router.Use(func(c *gin.Context) {
+		c.Set("userID", uuid.Must(uuid.Parse("90a12345-f12a-98c4-a456-513432930000")))
+		c.Next()
+	})
+
+	apiGroup := router.Group("/api/v1")
+	RegisterBlockRoutes(apiGroup, db, mockService)
+
+	update := func(ifMatch string, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("PUT", "/api/v1/blocks/123e4567-e89b-12d3-a456-426614174000", bytes.NewBufferString(body))
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("Current Version", func(t *testing.T) {
+		w := update(`"2"`, `{"content":{"text":"mine"}}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, `"3"`, w.Header().Get("ETag"))
+	})
+
+	t.Run("Stale If-Match", func(t *testing.T) {
+		w := update(`"1"`, `{"content":{"text":"mine"}}`)
+		assert.Equal(t, http.StatusConflict, w.Code)
+
+		var response struct {
+			Current models.Block `json:"current"`
+		}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, int64(2), response.Current.Version)
+	})
+
+	t.Run("Malformed If-Match", func(t *testing.T) {
+		w := update(`"abc"`, `{"content":{"text":"mine"}}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
 func TestDeleteBlock(t *testing.T) {
 	router := gin.Default()
 	db := &database.Database{}
@@ -359,6 +451,72 @@ func TestListBlocksByNote(t *testing.T) {
 	})
 }
 
+func TestGetBlocksByNote(t *testing.T) {
+	router := gin.Default()
+	db := &database.Database{}
+	mockService := &MockBlockService{}
+
+	// Add mock middleware to set userID in context
+	router.Use(func(c *gin.Context) {
+		c.Set("userID", uuid.Must(uuid.Parse("90a12345-f12a-98c4-a456-513432930000")))
+		c.Next()
+	})
+
+	apiGroup := router.Group("/api/v1")
+	RegisterBlockRoutes(apiGroup, db, mockService)
+
+	t.Run("Flat List", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/notes/90a12345-f12a-98c4-a456-513432930000/blocks", nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "Test Content")
+		assert.NotContains(t, w.Body.String(), "children")
+	})
+
+	t.Run("Tree", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/notes/90a12345-f12a-98c4-a456-513432930000/blocks?tree=true", nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var blocks []models.Block
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &blocks))
+		if assert.Len(t, blocks, 1) && assert.Len(t, blocks[0].Children, 1) {
+			assert.Equal(t, "Nested Content", blocks[0].Children[0].Content["text"])
+		}
+	})
+}
+
+func TestDeleteBlockChildrenMode(t *testing.T) {
+	router := gin.Default()
+	db := &database.Database{}
+	mockService := &MockBlockService{}
+
+	// Add mock middleware to set userID in context
+	router.Use(func(c *gin.Context) {
+		c.Set("userID", uuid.Must(uuid.Parse("90a12345-f12a-98c4-a456-513432930000")))
+		c.Next()
+	})
+
+	apiGroup := router.Group("/api/v1")
+	RegisterBlockRoutes(apiGroup, db, mockService)
+
+	t.Run("Reparent Children", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("DELETE", "/api/v1/blocks/123e4567-e89b-12d3-a456-426614174000?children=reparent", nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusNoContent, w.Code)
+	})
+
+	t.Run("Unknown Mode", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("DELETE", "/api/v1/blocks/123e4567-e89b-12d3-a456-426614174000?children=orphan", nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
 // Add new test for blocks with query parameters
 func TestGetBlocks(t *testing.T) {
 	router := gin.Default()
@@ -392,3 +550,73 @@ func TestGetBlocks(t *testing.T) {
 		assert.Contains(t, w.Body.String(), "Test Content")
 	})
 }
+
+func TestApplyBlockBatch(t *testing.T) {
+	router := gin.Default()
+	db := &database.Database{}
+	mockService := &MockBlockService{}
+
+	// Add mock middleware to set userID in context
+	router.Use(func(c *gin.Context) {
+		c.Set("userID", uuid.Must(uuid.Parse("90a12345-f12a-98c4-a456-513432930000")))
+		c.Next()
+	})
+
+	apiGroup := router.Group("/api/v1")
+	RegisterBlockRoutes(apiGroup, db, mockService)
+
+	t.Run("Valid Batch", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/notes/90a12345-f12a-98c4-a456-513432930000/blocks/batch", bytes.NewBuffer([]byte(`{
+			"operations": [
+				{"op": "create", "type": "text", "content": {"text": "pasted"}},
+				{"op": "move", "block_id": "123e4567-e89b-12d3-a456-426614174000", "order": 1500}
+			]
+		}`)))
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"batch_id"`)
+	})
+
+	t.Run("Missing Operations", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/notes/90a12345-f12a-98c4-a456-513432930000/blocks/batch", bytes.NewBuffer([]byte(`{}`)))
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Invalid Operation", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/notes/90a12345-f12a-98c4-a456-513432930000/blocks/batch", bytes.NewBuffer([]byte(`{
+			"operations": [{"op": "delete"}]
+		}`)))
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Schema Violation", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/notes/90a12345-f12a-98c4-a456-513432930000/blocks/batch", bytes.NewBuffer([]byte(`{
+			"operations": [{"op": "create", "type": "header", "content": {"text": "x"}, "metadata": {"level": "banana"}}]
+		}`)))
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+		var response struct {
+			BlockType string                `json:"block_type"`
+			Fields    []services.FieldError `json:"fields"`
+		}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, "header", response.BlockType)
+		assert.Equal(t, []services.FieldError{{Field: "metadata.level", Message: "must be an integer"}}, response.Fields)
+	})
+
+	t.Run("Note Not Found", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/notes/"+uuid.New().String()+"/blocks/batch", bytes.NewBuffer([]byte(`{
+			"operations": [{"op": "create", "type": "text", "content": {"text": "x"}}]
+		}`)))
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
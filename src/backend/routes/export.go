@@ -0,0 +1,89 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"owlistic-notes/owlistic/database"
+	"owlistic-notes/owlistic/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// RegisterExportRoutes registers the note and notebook export endpoints
+func RegisterExportRoutes(group *gin.RouterGroup, db *database.Database, exportService services.ExportServiceInterface) {
+	group.GET("/notes/:id/export", func(c *gin.Context) { ExportNote(c, db, exportService) })
+	group.GET("/notebooks/:id/export", func(c *gin.Context) { ExportNotebook(c, db, exportService) })
+}
+
+// ExportNote downloads a note rendered in the requested format
+func ExportNote(c *gin.Context, db *database.Database, exportService services.ExportServiceInterface) {
+	params, ok := exportParams(c)
+	if !ok {
+		return
+	}
+
+	file, err := exportService.ExportNote(db, c.Param("id"), params)
+	if err != nil {
+		if errors.Is(err, services.ErrNoteNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Note not found"})
+			return
+		}
+		handleExportError(c, err)
+		return
+	}
+
+	sendExportedFile(c, file)
+}
+
+// ExportNotebook downloads all notes of a notebook as a zip archive
+func ExportNotebook(c *gin.Context, db *database.Database, exportService services.ExportServiceInterface) {
+	params, ok := exportParams(c)
+	if !ok {
+		return
+	}
+
+	file, err := exportService.ExportNotebook(db, c.Param("id"), params)
+	if err != nil {
+		if errors.Is(err, services.ErrNotebookNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Notebook not found"})
+			return
+		}
+		handleExportError(c, err)
+		return
+	}
+
+	sendExportedFile(c, file)
+}
+
+// exportParams builds the service params from the request context
+func exportParams(c *gin.Context) (map[string]interface{}, bool) {
+	params := make(map[string]interface{})
+
+	userIDInterface, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return nil, false
+	}
+	params["user_id"] = userIDInterface.(uuid.UUID).String()
+	params["format"] = c.DefaultQuery("format", services.ExportFormatMarkdown)
+
+	return params, true
+}
+
+func handleExportError(c *gin.Context, err error) {
+	if errors.Is(err, services.ErrUnsupportedFormat) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported export format. Must be 'markdown'"})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
+
+// sendExportedFile writes the export as a file download
+func sendExportedFile(c *gin.Context, file services.ExportedFile) {
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename*=UTF-8''%s", url.PathEscape(file.FileName)))
+	c.Data(http.StatusOK, file.ContentType, file.Data)
+}
@@ -0,0 +1,85 @@
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"owlistic-notes/owlistic/database"
+	"owlistic-notes/owlistic/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+type MockExportService struct{}
+
+func (m *MockExportService) ExportNote(db *database.Database, id string, params map[string]interface{}) (services.ExportedFile, error) {
+	if params["format"] != services.ExportFormatMarkdown {
+		return services.ExportedFile{}, services.ErrUnsupportedFormat
+	}
+	if id != "123e4567-e89b-12d3-a456-426614174000" {
+		return services.ExportedFile{}, services.ErrNoteNotFound
+	}
+	return services.ExportedFile{
+		FileName:    "Test Note.md",
+		ContentType: "text/markdown; charset=utf-8",
+		Data:        []byte("# Test Note\n"),
+	}, nil
+}
+
+func (m *MockExportService) ExportNotebook(db *database.Database, id string, params map[string]interface{}) (services.ExportedFile, error) {
+	return services.ExportedFile{
+		FileName:    "Test Notebook.zip",
+		ContentType: "application/zip",
+		Data:        []byte("PK"),
+	}, nil
+}
+
+func TestExportRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	db := &database.Database{}
+
+	// Add mock middleware to set userID in context
+	router.Use(func(c *gin.Context) {
+		c.Set("userID", uuid.Must(uuid.Parse("90a12345-f12a-98c4-a456-513432930000")))
+		c.Next()
+	})
+
+	apiGroup := router.Group("/api/v1")
+	RegisterExportRoutes(apiGroup, db, &MockExportService{})
+
+	t.Run("Export Note", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/notes/123e4567-e89b-12d3-a456-426614174000/export", nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "text/markdown; charset=utf-8", w.Header().Get("Content-Type"))
+		assert.Equal(t, "attachment; filename*=UTF-8''Test%20Note.md", w.Header().Get("Content-Disposition"))
+		assert.Equal(t, "# Test Note\n", w.Body.String())
+	})
+
+	t.Run("Unsupported Format", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/notes/123e4567-e89b-12d3-a456-426614174000/export?format=pdf", nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Note Not Found", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/notes/"+uuid.New().String()+"/export", nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("Export Notebook", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/notebooks/"+uuid.New().String()+"/export?format=markdown", nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "application/zip", w.Header().Get("Content-Type"))
+	})
+}
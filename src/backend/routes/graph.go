@@ -0,0 +1,99 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"owlistic-notes/owlistic/database"
+	"owlistic-notes/owlistic/services"
+	"owlistic-notes/owlistic/utils/graph"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// RegisterGraphRoutes registers the note relationship graph endpoint
+func RegisterGraphRoutes(group *gin.RouterGroup, db *database.Database, graphService services.GraphServiceInterface) {
+	group.GET("/graph", func(c *gin.Context) { GetGraph(c, db, graphService) })
+}
+
+// GetGraph returns the graph of notes, notebooks and tags as JSON, GraphML or DOT
+func GetGraph(c *gin.Context, db *database.Database, graphService services.GraphServiceInterface) {
+	params, ok := graphParams(c)
+	if !ok {
+		return
+	}
+
+	format := c.DefaultQuery("format", services.GraphFormatJSON)
+	switch format {
+	case services.GraphFormatJSON, services.GraphFormatGraphML, services.GraphFormatDOT:
+	default:
+		handleGraphError(c, services.ErrUnsupportedFormat)
+		return
+	}
+
+	result, err := graphService.GetGraph(db, params)
+	if err != nil {
+		handleGraphError(c, err)
+		return
+	}
+
+	switch format {
+	case services.GraphFormatGraphML:
+		data, err := graph.GraphML(result)
+		if err != nil {
+			handleGraphError(c, err)
+			return
+		}
+		c.Data(http.StatusOK, "application/graphml+xml", data)
+	case services.GraphFormatDOT:
+		c.Data(http.StatusOK, "text/vnd.graphviz", graph.DOT(result))
+	default:
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// graphParams builds the service params from the request context and query
+func graphParams(c *gin.Context) (map[string]interface{}, bool) {
+	params := make(map[string]interface{})
+
+	userIDInterface, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return nil, false
+	}
+	params["user_id"] = userIDInterface.(uuid.UUID).String()
+
+	if notebookID := c.Query("notebook_id"); notebookID != "" {
+		params["notebook_id"] = notebookID
+	}
+	if noteID := c.Query("note_id"); noteID != "" {
+		params["note_id"] = noteID
+	}
+	if depthStr := c.Query("depth"); depthStr != "" {
+		depth, err := strconv.Atoi(depthStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid depth"})
+			return nil, false
+		}
+		params["depth"] = depth
+	}
+
+	return params, true
+}
+
+func handleGraphError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrUnsupportedFormat):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported graph format. Must be 'json', 'graphml' or 'dot'"})
+	case errors.Is(err, services.ErrInvalidInput):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid graph parameters"})
+	case errors.Is(err, services.ErrNoteNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Note not found"})
+	case errors.Is(err, services.ErrNotebookNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Notebook not found"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
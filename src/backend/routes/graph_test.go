@@ -0,0 +1,99 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"owlistic-notes/owlistic/database"
+	"owlistic-notes/owlistic/models"
+	"owlistic-notes/owlistic/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+type MockGraphService struct{}
+
+func (m *MockGraphService) GetGraph(db *database.Database, params map[string]interface{}) (models.Graph, error) {
+	if noteID, ok := params["note_id"].(string); ok && noteID != "123e4567-e89b-12d3-a456-426614174000" {
+		return models.Graph{}, services.ErrNoteNotFound
+	}
+	return models.Graph{
+		Nodes: []models.GraphNode{
+			{ID: "notebook:1", Type: models.GraphNotebookNode, Label: "Design"},
+			{ID: "note:1", Type: models.GraphNoteNode, Label: "Overview", Orphan: true},
+		},
+		Edges: []models.GraphEdge{
+			{Source: "notebook:1", Target: "note:1", Type: models.GraphContainsEdge},
+		},
+	}, nil
+}
+
+func TestGraphRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	db := &database.Database{}
+
+	// Add mock middleware to set userID in context
+	router.Use(func(c *gin.Context) {
+		c.Set("userID", uuid.Must(uuid.Parse("90a12345-f12a-98c4-a456-513432930000")))
+		c.Next()
+	})
+
+	apiGroup := router.Group("/api/v1")
+	RegisterGraphRoutes(apiGroup, db, &MockGraphService{})
+
+	t.Run("Get Graph as JSON", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/graph", nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var graph models.Graph
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &graph))
+		assert.Len(t, graph.Nodes, 2)
+		assert.Len(t, graph.Edges, 1)
+		assert.True(t, graph.Nodes[1].Orphan)
+	})
+
+	t.Run("Get Graph as GraphML", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/graph?format=graphml", nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "application/graphml+xml", w.Header().Get("Content-Type"))
+		assert.Contains(t, w.Body.String(), `<node id="note:1">`)
+	})
+
+	t.Run("Get Graph as DOT", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/graph?format=dot", nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"notebook:1" -> "note:1"`)
+	})
+
+	t.Run("Unsupported Format", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/graph?format=svg", nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Invalid Depth", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/graph?note_id=123e4567-e89b-12d3-a456-426614174000&depth=two", nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Unknown Start Note", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/graph?note_id="+uuid.New().String(), nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
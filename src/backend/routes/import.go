@@ -0,0 +1,86 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"owlistic-notes/owlistic/database"
+	"owlistic-notes/owlistic/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// maxImportFileSize limits the size of a single imported file
+const maxImportFileSize = 5 << 20
+
+// RegisterImportRoutes registers the notebook import endpoint
+func RegisterImportRoutes(group *gin.RouterGroup, db *database.Database, importService services.ImportServiceInterface) {
+	group.POST("/notebooks/:id/import", func(c *gin.Context) { ImportNotebook(c, db, importService) })
+}
+
+// ImportNotebook creates a note in the notebook for every uploaded Markdown file
+func ImportNotebook(c *gin.Context, db *database.Database, importService services.ImportServiceInterface) {
+	userIDInterface, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	params := map[string]interface{}{
+		"user_id": userIDInterface.(uuid.UUID).String(),
+	}
+
+	form, err := c.MultipartForm()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Expected a multipart form with one or more files"})
+		return
+	}
+
+	headers := append(form.File["files"], form.File["file"]...)
+	if len(headers) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No files provided"})
+		return
+	}
+
+	files := make([]services.ImportedFile, 0, len(headers))
+	for _, header := range headers {
+		if header.Size > maxImportFileSize {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("File %s exceeds the %d MB limit", header.Filename, maxImportFileSize>>20)})
+			return
+		}
+
+		f, err := header.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		data, err := io.ReadAll(f)
+		f.Close()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		files = append(files, services.ImportedFile{FileName: header.Filename, Data: data})
+	}
+
+	notes, err := importService.ImportMarkdown(db, c.Param("id"), files, params)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrNotebookNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Notebook not found"})
+		case errors.Is(err, services.ErrUnsupportedFormat):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Files must be UTF-8 encoded Markdown"})
+		case errors.Is(err, services.ErrInvalidInput):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, notes)
+}
@@ -0,0 +1,90 @@
+package routes
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"owlistic-notes/owlistic/database"
+	"owlistic-notes/owlistic/models"
+	"owlistic-notes/owlistic/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+type MockImportService struct{}
+
+func (m *MockImportService) ImportMarkdown(db *database.Database, notebookID string, files []services.ImportedFile, params map[string]interface{}) ([]models.Note, error) {
+	if notebookID != "123e4567-e89b-12d3-a456-426614174000" {
+		return nil, services.ErrNotebookNotFound
+	}
+
+	notes := make([]models.Note, 0, len(files))
+	for _, file := range files {
+		notes = append(notes, models.Note{ID: uuid.New(), Title: file.FileName})
+	}
+	return notes, nil
+}
+
+func newImportRequest(t *testing.T, url string, files map[string]string) *http.Request {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for name, content := range files {
+		part, err := writer.CreateFormFile("files", name)
+		assert.NoError(t, err)
+		part.Write([]byte(content))
+	}
+	writer.Close()
+
+	req, _ := http.NewRequest("POST", url, &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return req
+}
+
+func TestImportRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	db := &database.Database{}
+
+	// Add mock middleware to set userID in context
+	router.Use(func(c *gin.Context) {
+		c.Set("userID", uuid.Must(uuid.Parse("90a12345-f12a-98c4-a456-513432930000")))
+		c.Next()
+	})
+
+	apiGroup := router.Group("/api/v1")
+	RegisterImportRoutes(apiGroup, db, &MockImportService{})
+
+	t.Run("Import Files", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req := newImportRequest(t, "/api/v1/notebooks/123e4567-e89b-12d3-a456-426614174000/import", map[string]string{
+			"a.md": "# A\n",
+			"b.md": "# B\n",
+		})
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusCreated, w.Code)
+
+		var notes []models.Note
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &notes))
+		assert.Len(t, notes, 2)
+	})
+
+	t.Run("No Files", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req := newImportRequest(t, "/api/v1/notebooks/123e4567-e89b-12d3-a456-426614174000/import", nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Notebook Not Found", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req := newImportRequest(t, "/api/v1/notebooks/"+uuid.New().String()+"/import", map[string]string{"a.md": "text"})
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
@@ -0,0 +1,61 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+
+	"owlistic-notes/owlistic/database"
+	"owlistic-notes/owlistic/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// RegisterJournalRoutes registers the daily, weekly and monthly note endpoints
+func RegisterJournalRoutes(group *gin.RouterGroup, db *database.Database, journalService services.JournalServiceInterface) {
+	group.GET("/journal/:period", func(c *gin.Context) { GetPeriodicNote(c, db, journalService) })
+}
+
+// GetPeriodicNote returns the journal note for the period containing the
+// "date" query parameter, or today, creating it when needed. A created note
+// is answered with 201.
+func GetPeriodicNote(c *gin.Context, db *database.Database, journalService services.JournalServiceInterface) {
+	userIDInterface, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return
+	}
+
+	params := map[string]interface{}{
+		"user_id": userIDInterface.(uuid.UUID).String(),
+	}
+
+	note, created, err := journalService.GetPeriodicNote(db, c.Param("period"), c.Query("date"), params)
+	if err != nil {
+		handleJournalError(c, err)
+		return
+	}
+
+	if created {
+		c.JSON(http.StatusCreated, note)
+		return
+	}
+	c.JSON(http.StatusOK, note)
+}
+
+func handleJournalError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidInput):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrJournalNotSet):
+		c.JSON(http.StatusConflict, gin.H{"error": "Set a journal notebook in your preferences first"})
+	case errors.Is(err, services.ErrTemplateNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Journal template not found"})
+	case errors.Is(err, services.ErrNotebookNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Journal notebook not found"})
+	case errors.Is(err, services.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
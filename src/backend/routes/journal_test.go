@@ -0,0 +1,75 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"owlistic-notes/owlistic/database"
+	"owlistic-notes/owlistic/models"
+	"owlistic-notes/owlistic/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+type MockJournalService struct {
+	existing map[string]bool
+}
+
+func (m *MockJournalService) GetPeriodicNote(db *database.Database, period string, date string, params map[string]interface{}) (models.Note, bool, error) {
+	if period != "daily" {
+		return models.Note{}, false, fmt.Errorf("%w: period must be daily, weekly or monthly", services.ErrInvalidInput)
+	}
+	if date == "2000-01-01" {
+		return models.Note{}, false, services.ErrJournalNotSet
+	}
+	note := models.Note{ID: uuid.New(), Title: date}
+	return note, !m.existing[date], nil
+}
+
+func TestJournalRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	db := &database.Database{}
+
+	// Add mock middleware to set userID in context
+	router.Use(func(c *gin.Context) {
+		c.Set("userID", uuid.Must(uuid.Parse("90a12345-f12a-98c4-a456-513432930000")))
+		c.Next()
+	})
+
+	apiGroup := router.Group("/api/v1")
+	RegisterJournalRoutes(apiGroup, db, &MockJournalService{existing: map[string]bool{"2026-10-15": true}})
+
+	t.Run("Existing Daily Note", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/journal/daily?date=2026-10-15", nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"title":"2026-10-15"`)
+	})
+
+	t.Run("Created Daily Note", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/journal/daily?date=2026-10-16", nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusCreated, w.Code)
+	})
+
+	t.Run("Unknown Period", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/journal/yearly", nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("No Journal Notebook", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/journal/daily?date=2000-01-01", nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusConflict, w.Code)
+	})
+}
@@ -0,0 +1,74 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+
+	"owlistic-notes/owlistic/database"
+	"owlistic-notes/owlistic/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// RegisterNoteLinkRoutes registers the endpoints listing links between notes
+func RegisterNoteLinkRoutes(group *gin.RouterGroup, db *database.Database, noteLinkService services.NoteLinkServiceInterface) {
+	group.GET("/notes/:id/backlinks", func(c *gin.Context) { ListBacklinks(c, db, noteLinkService) })
+	group.GET("/notes/:id/links", func(c *gin.Context) { ListLinks(c, db, noteLinkService) })
+}
+
+// ListBacklinks lists the notes linking to a note
+func ListBacklinks(c *gin.Context, db *database.Database, noteLinkService services.NoteLinkServiceInterface) {
+	params, ok := noteLinkParams(c)
+	if !ok {
+		return
+	}
+
+	links, err := noteLinkService.ListBacklinks(db, c.Param("id"), params)
+	if err != nil {
+		handleNoteLinkError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, links)
+}
+
+// ListLinks lists the notes a note links to
+func ListLinks(c *gin.Context, db *database.Database, noteLinkService services.NoteLinkServiceInterface) {
+	params, ok := noteLinkParams(c)
+	if !ok {
+		return
+	}
+
+	links, err := noteLinkService.ListLinks(db, c.Param("id"), params)
+	if err != nil {
+		handleNoteLinkError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, links)
+}
+
+// noteLinkParams builds the service params from the request context
+func noteLinkParams(c *gin.Context) (map[string]interface{}, bool) {
+	userIDInterface, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return nil, false
+	}
+
+	return map[string]interface{}{
+		"user_id": userIDInterface.(uuid.UUID).String(),
+	}, true
+}
+
+func handleNoteLinkError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidInput):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid note ID"})
+	case errors.Is(err, services.ErrNoteNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Note not found"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
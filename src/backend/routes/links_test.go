@@ -0,0 +1,80 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"owlistic-notes/owlistic/database"
+	"owlistic-notes/owlistic/models"
+	"owlistic-notes/owlistic/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+type MockNoteLinkService struct{}
+
+func (m *MockNoteLinkService) ListBacklinks(db *database.Database, noteID string, params map[string]interface{}) ([]models.NoteLink, error) {
+	target, err := uuid.Parse(noteID)
+	if err != nil {
+		return nil, services.ErrInvalidInput
+	}
+	return []models.NoteLink{{ID: uuid.New(), SourceNoteID: uuid.New(), TargetNoteID: target, NoteTitle: "Index"}}, nil
+}
+
+func (m *MockNoteLinkService) ListLinks(db *database.Database, noteID string, params map[string]interface{}) ([]models.NoteLink, error) {
+	source, err := uuid.Parse(noteID)
+	if err != nil {
+		return nil, services.ErrInvalidInput
+	}
+	return []models.NoteLink{{ID: uuid.New(), SourceNoteID: source, TargetNoteID: uuid.New(), TargetDeleted: true, NoteTitle: "Old"}}, nil
+}
+
+func TestNoteLinkRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	db := &database.Database{}
+
+	// Add mock middleware to set userID in context
+	router.Use(func(c *gin.Context) {
+		c.Set("userID", uuid.Must(uuid.Parse("90a12345-f12a-98c4-a456-513432930000")))
+		c.Next()
+	})
+
+	apiGroup := router.Group("/api/v1")
+	RegisterNoteLinkRoutes(apiGroup, db, &MockNoteLinkService{})
+
+	noteID := "123e4567-e89b-12d3-a456-426614174000"
+
+	t.Run("List Backlinks", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/notes/"+noteID+"/backlinks", nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var links []models.NoteLink
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &links))
+		if assert.Len(t, links, 1) {
+			assert.Equal(t, noteID, links[0].TargetNoteID.String())
+			assert.Equal(t, "Index", links[0].NoteTitle)
+		}
+	})
+
+	t.Run("List Links", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/notes/"+noteID+"/links", nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"target_deleted":true`)
+	})
+
+	t.Run("Invalid Note ID", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/notes/abc/backlinks", nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
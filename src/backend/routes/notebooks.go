@@ -20,6 +20,7 @@ func RegisterNotebookRoutes(group *gin.RouterGroup, db *database.Database, noteb
 	group.GET("/notebooks/:id", func(c *gin.Context) { GetNotebookById(c, db, notebookService) })
 	group.PUT("/notebooks/:id", func(c *gin.Context) { UpdateNotebook(c, db, notebookService) })
 	group.DELETE("/notebooks/:id", func(c *gin.Context) { DeleteNotebook(c, db, notebookService) })
+	group.POST("/notebooks/:id/duplicate", func(c *gin.Context) { DuplicateNotebook(c, db, notebookService) })
 }
 
 func GetNotebooks(c *gin.Context, db *database.Database, notebookService services.NotebookServiceInterface) {
@@ -40,11 +41,32 @@ func GetNotebooks(c *gin.Context, db *database.Database, notebookService service
 		params["name"] = name
 	}
 
-	notebooks, err := notebookService.GetNotebooks(db, params)
+	// The user's own flags; archived notebooks only show with archived=true or all
+	for _, key := range []string{"archived", "pinned", "favourite"} {
+		if value := c.Query(key); value != "" {
+			params[key] = value
+		}
+	}
+
+	// tree=true nests notebooks under their parents
+	if c.Query("tree") == "true" {
+		params["tree"] = true
+	}
+
+	if !addListParams(c, params) {
+		return
+	}
+
+	notebooks, page, err := notebookService.GetNotebooks(db, params)
 	if err != nil {
+		if errors.Is(err, services.ErrInvalidInput) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	setPageHeaders(c, page)
 	c.JSON(http.StatusOK, notebooks)
 }
 
@@ -65,6 +87,10 @@ func CreateNotebook(c *gin.Context, db *database.Database, notebookService servi
 
 	notebook, err := notebookService.CreateNotebook(db, notebookData)
 	if err != nil {
+		if errors.Is(err, services.ErrInvalidInput) || errors.Is(err, services.ErrNotebookCycle) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -95,6 +121,7 @@ func GetNotebookById(c *gin.Context, db *database.Database, notebookService serv
 		return
 	}
 
+	setVersionETag(c, notebook.Version)
 	c.JSON(http.StatusOK, notebook)
 }
 
@@ -117,15 +144,27 @@ func UpdateNotebook(c *gin.Context, db *database.Database, notebookService servi
 	}
 	params["user_id"] = userIDInterface.(uuid.UUID).String()
 
+	if !expectVersion(c, notebookData) {
+		return
+	}
+
 	notebook, err := notebookService.UpdateNotebook(db, id, notebookData, params)
 	if err != nil {
+		if respondVersionConflict(c, err) {
+			return
+		}
 		if errors.Is(err, services.ErrNotebookNotFound) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Notebook not found"})
 			return
 		}
+		if errors.Is(err, services.ErrInvalidInput) || errors.Is(err, services.ErrNotebookCycle) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	setVersionETag(c, notebook.Version)
 	c.JSON(http.StatusOK, notebook)
 }
 
@@ -153,3 +192,35 @@ func DeleteNotebook(c *gin.Context, db *database.Database, notebookService servi
 	}
 	c.JSON(http.StatusNoContent, gin.H{})
 }
+
+// DuplicateNotebook deep-copies a notebook. The body may set the copy's "name".
+func DuplicateNotebook(c *gin.Context, db *database.Database, notebookService services.NotebookServiceInterface) {
+	id := c.Param("id")
+	notebookData := map[string]interface{}{}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&notebookData); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	userIDInterface, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	params := map[string]interface{}{
+		"user_id": userIDInterface.(uuid.UUID).String(),
+	}
+
+	notebook, err := notebookService.DuplicateNotebook(db, id, notebookData, params)
+	if err != nil {
+		if errors.Is(err, services.ErrNotebookNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Notebook not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, notebook)
+}
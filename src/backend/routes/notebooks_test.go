@@ -19,13 +19,13 @@ import (
 type MockNotebookService struct{}
 
 // Update GetNotebooks mock to properly handle the empty case
-func (m *MockNotebookService) GetNotebooks(db *database.Database, params map[string]interface{}) ([]models.Notebook, error) {
+func (m *MockNotebookService) GetNotebooks(db *database.Database, params map[string]interface{}) ([]models.Notebook, services.PageInfo, error) {
 	userID, hasUserID := params["user_id"].(string)
 	name, hasName := params["name"].(string)
 
 	// Empty case - user with no notebooks
 	if hasUserID && userID == "90a12345-f12a-98c4-a456-513432930001" {
-		return []models.Notebook{}, nil
+		return []models.Notebook{}, services.PageInfo{}, nil
 	}
 
 	// User with notebooks
@@ -46,10 +46,10 @@ func (m *MockNotebookService) GetNotebooks(db *database.Database, params map[str
 					filteredNotebooks = append(filteredNotebooks, notebook)
 				}
 			}
-			return filteredNotebooks, nil
+			return filteredNotebooks, services.PageInfo{Total: int64(len(filteredNotebooks))}, nil
 		}
 
-		return notebooks, nil
+		return notebooks, services.PageInfo{Total: int64(len(notebooks))}, nil
 	}
 
 	// Default case - all notebooks
@@ -74,10 +74,10 @@ func (m *MockNotebookService) GetNotebooks(db *database.Database, params map[str
 				filteredNotebooks = append(filteredNotebooks, notebook)
 			}
 		}
-		return filteredNotebooks, nil
+		return filteredNotebooks, services.PageInfo{Total: int64(len(filteredNotebooks))}, nil
 	}
 
-	return notebooks, nil
+	return notebooks, services.PageInfo{Total: int64(len(notebooks))}, nil
 }
 
 func (m *MockNotebookService) CreateNotebook(db *database.Database, notebookData map[string]interface{}) (models.Notebook, error) {
@@ -124,6 +124,10 @@ func (m *MockNotebookService) UpdateNotebook(db *database.Database, id string, u
 		return models.Notebook{}, errors.New("user_id must be provided in parameters")
 	}
 
+	if updatedData["parent_notebook_id"] == id {
+		return models.Notebook{}, services.ErrNotebookCycle
+	}
+
 	if id == "123e4567-e89b-12d3-a456-426614174000" {
 		return models.Notebook{
 			ID:     uuid.Must(uuid.Parse(id)),
@@ -336,3 +340,66 @@ func TestGetNotebooks(t *testing.T) {
 		assert.Contains(t, w.Body.String(), "Test Notebook")
 	})
 }
+
+func (m *MockNotebookService) DuplicateNotebook(db *database.Database, id string, notebookData map[string]interface{}, params map[string]interface{}) (models.Notebook, error) {
+	if id != "123e4567-e89b-12d3-a456-426614174000" {
+		return models.Notebook{}, services.ErrNotebookNotFound
+	}
+	return models.Notebook{
+		ID:    uuid.New(),
+		Name:  "Test Notebook (copy)",
+		Notes: []models.Note{{ID: uuid.New(), Title: "Test Note"}},
+	}, nil
+}
+
+func TestDuplicateNotebook(t *testing.T) {
+	router := gin.Default()
+	db := &database.Database{}
+
+	// Add mock middleware to set userID in context
+	router.Use(func(c *gin.Context) {
+		c.Set("userID", uuid.Must(uuid.Parse("90a12345-f12a-98c4-a456-513432930000")))
+		c.Next()
+	})
+
+	apiGroup := router.Group("/api/v1")
+	RegisterNotebookRoutes(apiGroup, db, &MockNotebookService{})
+
+	t.Run("Notebook Not Found", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/notebooks/123e4567-e89b-12d3-a456-426614174001/duplicate", nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("Notebook Duplicated", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/notebooks/123e4567-e89b-12d3-a456-426614174000/duplicate", nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Contains(t, w.Body.String(), "Test Notebook (copy)")
+	})
+}
+
+func TestNestNotebook(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	db := &database.Database{}
+
+	// Add mock middleware to set userID in context
+	router.Use(func(c *gin.Context) {
+		c.Set("userID", uuid.Must(uuid.Parse("90a12345-f12a-98c4-a456-513432930000")))
+		c.Next()
+	})
+
+	apiGroup := router.Group("/api/v1")
+	RegisterNotebookRoutes(apiGroup, db, &MockNotebookService{})
+
+	t.Run("Nested Under Itself", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("PUT", "/api/v1/notebooks/123e4567-e89b-12d3-a456-426614174000",
+			bytes.NewBufferString(`{"parent_notebook_id":"123e4567-e89b-12d3-a456-426614174000"}`))
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
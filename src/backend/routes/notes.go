@@ -3,6 +3,7 @@ package routes
 import (
 	"errors"
 	"net/http"
+	"strings"
 
 	"owlistic-notes/owlistic/database"
 	"owlistic-notes/owlistic/services"
@@ -20,6 +21,8 @@ func RegisterNoteRoutes(group *gin.RouterGroup, db *database.Database, noteServi
 	group.GET("/notes/:id", func(c *gin.Context) { GetNoteById(c, db, noteService) })
 	group.PUT("/notes/:id", func(c *gin.Context) { UpdateNote(c, db, noteService) })
 	group.DELETE("/notes/:id", func(c *gin.Context) { DeleteNote(c, db, noteService) })
+	group.POST("/notes/:id/duplicate", func(c *gin.Context) { DuplicateNote(c, db, noteService) })
+	group.POST("/notes/:id/move", func(c *gin.Context) { MoveNote(c, db, noteService) })
 }
 
 func CreateNote(c *gin.Context, db *database.Database, noteService services.NoteServiceInterface) {
@@ -73,6 +76,7 @@ func GetNoteById(c *gin.Context, db *database.Database, noteService services.Not
 		return
 	}
 
+	setVersionETag(c, note.Version)
 	c.JSON(http.StatusOK, note)
 }
 
@@ -95,18 +99,94 @@ func UpdateNote(c *gin.Context, db *database.Database, noteService services.Note
 	}
 	params["user_id"] = userIDInterface.(uuid.UUID).String()
 
+	if !expectVersion(c, noteData) {
+		return
+	}
+
 	updatedNote, err := noteService.UpdateNote(db, id, noteData, params)
 	if err != nil {
-		if errors.Is(err, services.ErrNoteNotFound) {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Note not found"})
+		if respondVersionConflict(c, err) {
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		handleNoteCopyError(c, err)
 		return
 	}
+	setVersionETag(c, updatedNote.Version)
 	c.JSON(http.StatusOK, updatedNote)
 }
 
+// DuplicateNote copies a note. The body may name the "notebook_id" to copy
+// into and the copy's "title".
+func DuplicateNote(c *gin.Context, db *database.Database, noteService services.NoteServiceInterface) {
+	id := c.Param("id")
+	noteData := map[string]interface{}{}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&noteData); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	userIDInterface, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return
+	}
+	params := map[string]interface{}{
+		"user_id": userIDInterface.(uuid.UUID).String(),
+	}
+
+	note, err := noteService.DuplicateNote(db, id, noteData, params)
+	if err != nil {
+		handleNoteCopyError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, note)
+}
+
+// MoveNote moves a note to the notebook given as "notebook_id"
+func MoveNote(c *gin.Context, db *database.Database, noteService services.NoteServiceInterface) {
+	id := c.Param("id")
+	var input struct {
+		NotebookID string `json:"notebook_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userIDInterface, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return
+	}
+	params := map[string]interface{}{
+		"user_id": userIDInterface.(uuid.UUID).String(),
+	}
+
+	note, err := noteService.MoveNote(db, id, input.NotebookID, params)
+	if err != nil {
+		handleNoteCopyError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, note)
+}
+
+// handleNoteCopyError reports errors of calls that may put a note into
+// another notebook
+func handleNoteCopyError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidInput):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrNoteNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Note not found"})
+	case errors.Is(err, services.ErrNotebookNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Notebook not found"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
 func DeleteNote(c *gin.Context, db *database.Database, noteService services.NoteServiceInterface) {
 	id := c.Param("id")
 
@@ -152,12 +232,38 @@ func GetNotes(c *gin.Context, db *database.Database, noteService services.NoteSe
 		params["title"] = title
 	}
 
-	notes, err := noteService.GetNotes(db, params)
+	// tags=a,b matches notes carrying all the tags, or any of them with tags_match=any
+	if tags := c.Query("tags"); tags != "" {
+		params["tags"] = strings.Split(tags, ",")
+		params["tags_match"] = c.DefaultQuery("tags_match", services.TagMatchAll)
+	}
+
+	// The user's own flags; archived notes only show with archived=true or all
+	for _, key := range []string{"archived", "pinned", "favourite"} {
+		if value := c.Query(key); value != "" {
+			params[key] = value
+		}
+	}
+
+	// blocks=none leaves blocks out, blocks=N returns the first N of each note
+	if blocks := c.Query("blocks"); blocks != "" {
+		params["blocks"] = blocks
+	}
+
+	if !addListParams(c, params) {
+		return
+	}
+
+	notes, page, err := noteService.GetNotes(db, params)
 	if err != nil {
+		if errors.Is(err, services.ErrInvalidInput) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Log how many notes were found
+	setPageHeaders(c, page)
 	c.JSON(http.StatusOK, notes)
 }
@@ -19,7 +19,7 @@ import (
 type MockNoteService struct{}
 
 // Add GetNotes method for query parameter support
-func (m *MockNoteService) GetNotes(db *database.Database, params map[string]interface{}) ([]models.Note, error) {
+func (m *MockNoteService) GetNotes(db *database.Database, params map[string]interface{}) ([]models.Note, services.PageInfo, error) {
 	userID, hasUserID := params["user_id"].(string)
 	notebookID, hasNotebookID := params["notebook_id"].(string)
 	title, hasTitle := params["title"].(string)
@@ -82,7 +82,7 @@ func (m *MockNoteService) GetNotes(db *database.Database, params map[string]inte
 		notes = filteredNotes
 	}
 
-	return notes, nil
+	return notes, services.PageInfo{Total: int64(len(notes))}, nil
 }
 
 func (m *MockNoteService) CreateNote(db *database.Database, noteData map[string]interface{}) (models.Note, error) {
@@ -490,3 +490,87 @@ func TestGetNotes(t *testing.T) {
 		assert.Contains(t, w.Body.String(), "Test Note")
 	})
 }
+
+func (m *MockNoteService) DuplicateNote(db *database.Database, id string, noteData map[string]interface{}, params map[string]interface{}) (models.Note, error) {
+	if id != "123e4567-e89b-12d3-a456-426614174000" {
+		return models.Note{}, services.ErrNoteNotFound
+	}
+
+	title, ok := noteData["title"].(string)
+	if !ok {
+		title = "Test Note (copy)"
+	}
+	return models.Note{ID: uuid.New(), Title: title}, nil
+}
+
+func (m *MockNoteService) MoveNote(db *database.Database, id string, notebookID string, params map[string]interface{}) (models.Note, error) {
+	if id != "123e4567-e89b-12d3-a456-426614174000" {
+		return models.Note{}, services.ErrNoteNotFound
+	}
+	if notebookID != "123e4567-e89b-12d3-a456-426614174001" {
+		return models.Note{}, services.ErrNotebookNotFound
+	}
+	return models.Note{ID: uuid.MustParse(id), NotebookID: uuid.MustParse(notebookID), Title: "Test Note"}, nil
+}
+
+func TestDuplicateAndMoveNote(t *testing.T) {
+	router := gin.Default()
+	db := &database.Database{}
+
+	// Add mock middleware to set userID in context
+	router.Use(func(c *gin.Context) {
+		c.Set("userID", uuid.Must(uuid.Parse("90a12345-f12a-98c4-a456-513432930000")))
+		c.Next()
+	})
+
+	apiGroup := router.Group("/api/v1")
+	RegisterNoteRoutes(apiGroup, db, &MockNoteService{})
+
+	t.Run("Duplicate Note", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/notes/123e4567-e89b-12d3-a456-426614174000/duplicate", nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Contains(t, w.Body.String(), "Test Note (copy)")
+	})
+
+	t.Run("Duplicate Note With Title", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/notes/123e4567-e89b-12d3-a456-426614174000/duplicate",
+			bytes.NewBufferString(`{"title": "Draft 2"}`))
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Contains(t, w.Body.String(), "Draft 2")
+	})
+
+	t.Run("Duplicate Unknown Note", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/notes/"+uuid.New().String()+"/duplicate", nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("Move Note", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/notes/123e4567-e89b-12d3-a456-426614174000/move",
+			bytes.NewBufferString(`{"notebook_id": "123e4567-e89b-12d3-a456-426614174001"}`))
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"notebook_id":"123e4567-e89b-12d3-a456-426614174001"`)
+	})
+
+	t.Run("Move Note Without Notebook", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/notes/123e4567-e89b-12d3-a456-426614174000/move", bytes.NewBufferString(`{}`))
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Move Note To Unknown Notebook", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/notes/123e4567-e89b-12d3-a456-426614174000/move",
+			bytes.NewBufferString(`{"notebook_id": "`+uuid.New().String()+`"}`))
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
@@ -0,0 +1,42 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"owlistic-notes/owlistic/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// addListParams copies the "sort", "order", "limit" and "cursor" query
+// parameters into params. It answers 400 and returns false for a limit that
+// is not a number.
+func addListParams(c *gin.Context, params map[string]interface{}) bool {
+	for _, key := range []string{"sort", "order", "cursor"} {
+		if value := c.Query(key); value != "" {
+			params[key] = value
+		}
+	}
+
+	if limit := c.Query("limit"); limit != "" {
+		value, err := strconv.Atoi(limit)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a number"})
+			return false
+		}
+		params["limit"] = value
+	}
+
+	return true
+}
+
+// setPageHeaders reports the total number of items and the cursor of the
+// next page, if there is one, alongside a listing
+func setPageHeaders(c *gin.Context, page services.PageInfo) {
+	c.Header("X-Total-Count", fmt.Sprintf("%d", page.Total))
+	if page.NextCursor != "" {
+		c.Header("X-Next-Cursor", page.NextCursor)
+	}
+}
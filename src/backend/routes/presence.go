@@ -0,0 +1,45 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+
+	"owlistic-notes/owlistic/database"
+	"owlistic-notes/owlistic/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// RegisterPresenceRoutes registers the endpoint listing who is on a note
+func RegisterPresenceRoutes(group *gin.RouterGroup, db *database.Database, presenceService services.PresenceServiceInterface) {
+	group.GET("/notes/:id/presence", func(c *gin.Context) { GetNotePresence(c, db, presenceService) })
+}
+
+// GetNotePresence returns the connections viewing a note right now
+func GetNotePresence(c *gin.Context, db *database.Database, presenceService services.PresenceServiceInterface) {
+	userIDInterface, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	params := map[string]interface{}{
+		"user_id": userIDInterface.(uuid.UUID).String(),
+	}
+
+	presence, err := presenceService.GetNotePresence(db, c.Param("id"), params)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidInput):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Note ID must be a UUID"})
+		case errors.Is(err, services.ErrUnauthorized):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, presence)
+}
@@ -0,0 +1,72 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"owlistic-notes/owlistic/database"
+	"owlistic-notes/owlistic/models"
+	"owlistic-notes/owlistic/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+type MockPresenceService struct {
+	services.PresenceServiceInterface
+	noteID uuid.UUID
+}
+
+func (m *MockPresenceService) GetNotePresence(db *database.Database, noteID string, params map[string]interface{}) ([]models.Presence, error) {
+	if noteID == "bad" {
+		return nil, services.ErrInvalidInput
+	}
+	if noteID != m.noteID.String() {
+		return nil, services.ErrUnauthorized
+	}
+	return []models.Presence{{ConnectionID: "conn", UserID: uuid.New(), NoteID: m.noteID, LastActive: time.Now()}}, nil
+}
+
+func TestPresenceRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	db := &database.Database{}
+	service := &MockPresenceService{noteID: uuid.New()}
+
+	// Add mock middleware to set userID in context
+	router.Use(func(c *gin.Context) {
+		c.Set("userID", uuid.Must(uuid.Parse("90a12345-f12a-98c4-a456-513432930000")))
+		c.Next()
+	})
+
+	RegisterPresenceRoutes(router.Group("/api/v1"), db, service)
+
+	t.Run("GetNotePresence", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/notes/"+service.noteID.String()+"/presence", nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		var presence []models.Presence
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &presence))
+		assert.Len(t, presence, 1)
+		assert.Equal(t, "conn", presence[0].ConnectionID)
+		assert.Nil(t, presence[0].BlockID)
+	})
+
+	t.Run("GetNotePresenceErrors", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/notes/bad/presence", nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		w = httptest.NewRecorder()
+		req, _ = http.NewRequest("GET", "/api/v1/notes/"+uuid.New().String()+"/presence", nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+}
@@ -0,0 +1,84 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+
+	"owlistic-notes/owlistic/database"
+	"owlistic-notes/owlistic/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// RegisterResourceStateRoutes registers the endpoints setting a user's
+// pinned, favourite and archived state of notes and notebooks
+func RegisterResourceStateRoutes(group *gin.RouterGroup, db *database.Database, stateService services.ResourceStateServiceInterface) {
+	group.PUT("/notes/:id/state", func(c *gin.Context) { UpdateNoteState(c, db, stateService) })
+	group.PUT("/notebooks/:id/state", func(c *gin.Context) { UpdateNotebookState(c, db, stateService) })
+}
+
+// UpdateNoteState sets any of "pinned", "pin_order", "favourite" and
+// "archived" for the note
+func UpdateNoteState(c *gin.Context, db *database.Database, stateService services.ResourceStateServiceInterface) {
+	stateData, params, ok := resourceStateRequest(c)
+	if !ok {
+		return
+	}
+
+	state, err := stateService.UpdateNoteState(db, c.Param("id"), stateData, params)
+	if err != nil {
+		handleResourceStateError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, state)
+}
+
+// UpdateNotebookState sets any of "pinned", "pin_order", "favourite" and
+// "archived" for the notebook
+func UpdateNotebookState(c *gin.Context, db *database.Database, stateService services.ResourceStateServiceInterface) {
+	stateData, params, ok := resourceStateRequest(c)
+	if !ok {
+		return
+	}
+
+	state, err := stateService.UpdateNotebookState(db, c.Param("id"), stateData, params)
+	if err != nil {
+		handleResourceStateError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, state)
+}
+
+func resourceStateRequest(c *gin.Context) (map[string]interface{}, map[string]interface{}, bool) {
+	var stateData map[string]interface{}
+	if err := c.ShouldBindJSON(&stateData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, nil, false
+	}
+
+	userIDInterface, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return nil, nil, false
+	}
+
+	return stateData, map[string]interface{}{
+		"user_id": userIDInterface.(uuid.UUID).String(),
+	}, true
+}
+
+func handleResourceStateError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidInput):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrNoteNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Note not found"})
+	case errors.Is(err, services.ErrNotebookNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Notebook not found"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,95 @@
+package routes
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"owlistic-notes/owlistic/database"
+	"owlistic-notes/owlistic/models"
+	"owlistic-notes/owlistic/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+type MockResourceStateService struct{}
+
+func (m *MockResourceStateService) UpdateNoteState(db *database.Database, noteID string, stateData map[string]interface{}, params map[string]interface{}) (models.ResourceState, error) {
+	if noteID == "missing" {
+		return models.ResourceState{}, services.ErrNoteNotFound
+	}
+	pinned, ok := stateData["pinned"].(bool)
+	if _, exists := stateData["pinned"]; exists && !ok {
+		return models.ResourceState{}, fmt.Errorf("%w: pinned must be true or false", services.ErrInvalidInput)
+	}
+	return models.ResourceState{ResourceType: models.NoteResource, Pinned: pinned, PinOrder: 1000}, nil
+}
+
+func (m *MockResourceStateService) UpdateNotebookState(db *database.Database, notebookID string, stateData map[string]interface{}, params map[string]interface{}) (models.ResourceState, error) {
+	if notebookID == "missing" {
+		return models.ResourceState{}, services.ErrNotebookNotFound
+	}
+	archived, _ := stateData["archived"].(bool)
+	return models.ResourceState{ResourceType: models.NotebookResource, Archived: archived}, nil
+}
+
+func TestResourceStateRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	db := &database.Database{}
+
+	// Add mock middleware to set userID in context
+	router.Use(func(c *gin.Context) {
+		c.Set("userID", uuid.Must(uuid.Parse("90a12345-f12a-98c4-a456-513432930000")))
+		c.Next()
+	})
+
+	apiGroup := router.Group("/api/v1")
+	RegisterResourceStateRoutes(apiGroup, db, &MockResourceStateService{})
+
+	t.Run("Pin Note", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("PUT", "/api/v1/notes/"+uuid.New().String()+"/state", bytes.NewBufferString(`{"pinned":true}`))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"pinned":true`)
+	})
+
+	t.Run("Invalid Note State", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("PUT", "/api/v1/notes/"+uuid.New().String()+"/state", bytes.NewBufferString(`{"pinned":"yes"}`))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Note Not Found", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("PUT", "/api/v1/notes/missing/state", bytes.NewBufferString(`{"favourite":true}`))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("Archive Notebook", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("PUT", "/api/v1/notebooks/"+uuid.New().String()+"/state", bytes.NewBufferString(`{"archived":true}`))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"archived":true`)
+	})
+
+	t.Run("Malformed Body", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("PUT", "/api/v1/notebooks/missing/state", bytes.NewBufferString(`{`))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
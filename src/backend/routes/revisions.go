@@ -0,0 +1,113 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+
+	"owlistic-notes/owlistic/database"
+	"owlistic-notes/owlistic/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// RegisterRevisionRoutes registers the note version history endpoints
+func RegisterRevisionRoutes(group *gin.RouterGroup, db *database.Database, revisionService services.RevisionServiceInterface) {
+	group.GET("/notes/:id/revisions", func(c *gin.Context) { ListRevisions(c, db, revisionService) })
+	group.GET("/notes/:id/revisions/:rev", func(c *gin.Context) { GetRevision(c, db, revisionService) })
+	group.POST("/notes/:id/revisions/:rev/restore", func(c *gin.Context) { RestoreRevision(c, db, revisionService) })
+	group.GET("/notes/:id/diff", func(c *gin.Context) { DiffRevisions(c, db, revisionService) })
+}
+
+func ListRevisions(c *gin.Context, db *database.Database, revisionService services.RevisionServiceInterface) {
+	params, ok := revisionParams(c)
+	if !ok {
+		return
+	}
+
+	revisions, err := revisionService.ListRevisions(db, c.Param("id"), params)
+	if err != nil {
+		handleRevisionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, revisions)
+}
+
+func GetRevision(c *gin.Context, db *database.Database, revisionService services.RevisionServiceInterface) {
+	params, ok := revisionParams(c)
+	if !ok {
+		return
+	}
+
+	revision, err := revisionService.GetRevision(db, c.Param("id"), c.Param("rev"), params)
+	if err != nil {
+		handleRevisionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, revision)
+}
+
+func RestoreRevision(c *gin.Context, db *database.Database, revisionService services.RevisionServiceInterface) {
+	params, ok := revisionParams(c)
+	if !ok {
+		return
+	}
+
+	note, err := revisionService.RestoreRevision(db, c.Param("id"), c.Param("rev"), params)
+	if err != nil {
+		handleRevisionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, note)
+}
+
+// DiffRevisions compares revision "from" with revision "to", or with the live note when "to" is omitted
+func DiffRevisions(c *gin.Context, db *database.Database, revisionService services.RevisionServiceInterface) {
+	params, ok := revisionParams(c)
+	if !ok {
+		return
+	}
+
+	from := c.Query("from")
+	if from == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Query parameter 'from' is required"})
+		return
+	}
+
+	result, err := revisionService.DiffRevisions(db, c.Param("id"), from, c.DefaultQuery("to", services.LiveRevision), params)
+	if err != nil {
+		handleRevisionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// revisionParams builds the service params from the request context
+func revisionParams(c *gin.Context) (map[string]interface{}, bool) {
+	userIDInterface, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return nil, false
+	}
+
+	return map[string]interface{}{
+		"user_id": userIDInterface.(uuid.UUID).String(),
+	}, true
+}
+
+func handleRevisionError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidInput):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Revision must be a positive number"})
+	case errors.Is(err, services.ErrRevisionNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Revision not found"})
+	case errors.Is(err, services.ErrNoteNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Note not found"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,116 @@
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"owlistic-notes/owlistic/database"
+	"owlistic-notes/owlistic/models"
+	"owlistic-notes/owlistic/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+type MockRevisionService struct{}
+
+func (m *MockRevisionService) ListRevisions(db *database.Database, noteID string, params map[string]interface{}) ([]models.NoteRevision, error) {
+	return []models.NoteRevision{{ID: uuid.New(), Revision: 1, Title: "Test Note"}}, nil
+}
+
+func (m *MockRevisionService) GetRevision(db *database.Database, noteID string, revision string, params map[string]interface{}) (models.NoteRevision, error) {
+	number, err := strconv.Atoi(revision)
+	if err != nil {
+		return models.NoteRevision{}, services.ErrInvalidInput
+	}
+	if number != 1 {
+		return models.NoteRevision{}, services.ErrRevisionNotFound
+	}
+	return models.NoteRevision{ID: uuid.New(), Revision: 1, Title: "Test Note"}, nil
+}
+
+func (m *MockRevisionService) RestoreRevision(db *database.Database, noteID string, revision string, params map[string]interface{}) (models.Note, error) {
+	if revision != "1" {
+		return models.Note{}, services.ErrRevisionNotFound
+	}
+	return models.Note{ID: uuid.Must(uuid.Parse(noteID)), Title: "Test Note"}, nil
+}
+
+func (m *MockRevisionService) DiffRevisions(db *database.Database, noteID string, from string, to string, params map[string]interface{}) (models.NoteDiff, error) {
+	if from != "1" {
+		return models.NoteDiff{}, services.ErrRevisionNotFound
+	}
+	if to != services.LiveRevision {
+		return models.NoteDiff{}, services.ErrInvalidInput
+	}
+	return models.NoteDiff{NoteID: uuid.Must(uuid.Parse(noteID)), From: 1}, nil
+}
+
+func TestRevisionRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	db := &database.Database{}
+
+	// Add mock middleware to set userID in context
+	router.Use(func(c *gin.Context) {
+		c.Set("userID", uuid.Must(uuid.Parse("90a12345-f12a-98c4-a456-513432930000")))
+		c.Next()
+	})
+
+	apiGroup := router.Group("/api/v1")
+	RegisterRevisionRoutes(apiGroup, db, &MockRevisionService{})
+
+	noteID := "123e4567-e89b-12d3-a456-426614174000"
+
+	t.Run("List Revisions", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/notes/"+noteID+"/revisions", nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("Get Revision", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/notes/"+noteID+"/revisions/1", nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("Invalid Revision", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/notes/"+noteID+"/revisions/abc", nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Restore Revision", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/notes/"+noteID+"/revisions/1/restore", nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("Restore Missing Revision", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/notes/"+noteID+"/revisions/9/restore", nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("Diff Against Live", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/notes/"+noteID+"/diff?from=1", nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("Diff Without From", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/notes/"+noteID+"/diff", nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
@@ -0,0 +1,66 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"owlistic-notes/owlistic/database"
+	"owlistic-notes/owlistic/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// RegisterSearchRoutes registers the full-text search endpoint
+func RegisterSearchRoutes(group *gin.RouterGroup, db *database.Database, searchService services.SearchServiceInterface) {
+	group.GET("/search", func(c *gin.Context) { Search(c, db, searchService) })
+}
+
+// Search runs a full-text search over the notes, blocks and tasks visible to the user
+func Search(c *gin.Context, db *database.Database, searchService services.SearchServiceInterface) {
+	params := make(map[string]interface{})
+
+	// Get user ID from context (set by AuthMiddleware)
+	userIDInterface, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	params["user_id"] = userIDInterface.(uuid.UUID).String()
+
+	query := c.Query("q")
+	if query == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Query parameter 'q' is required"})
+		return
+	}
+	params["query"] = query
+
+	if resourceType := c.Query("type"); resourceType != "" {
+		params["type"] = resourceType
+	}
+
+	if limit := c.Query("limit"); limit != "" {
+		if l, err := strconv.Atoi(limit); err == nil {
+			params["limit"] = l
+		}
+	}
+
+	if offset := c.Query("offset"); offset != "" {
+		if o, err := strconv.Atoi(offset); err == nil {
+			params["offset"] = o
+		}
+	}
+
+	results, err := searchService.Search(db, params)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidInput) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid search parameters"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, results)
+}
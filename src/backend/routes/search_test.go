@@ -0,0 +1,82 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"owlistic-notes/owlistic/database"
+	"owlistic-notes/owlistic/models"
+	"owlistic-notes/owlistic/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+type MockSearchService struct{}
+
+func (m *MockSearchService) Search(db *database.Database, params map[string]interface{}) ([]models.SearchResult, error) {
+	if _, ok := params["user_id"].(string); !ok {
+		return nil, services.ErrInvalidInput
+	}
+	if params["type"] == "notebook" {
+		return nil, services.ErrInvalidInput
+	}
+
+	blockID := uuid.Must(uuid.Parse("123e4567-e89b-12d3-a456-426614174001"))
+	return []models.SearchResult{
+		{
+			ResourceType: models.BlockResource,
+			ResourceID:   blockID,
+			NoteID:       uuid.Must(uuid.Parse("123e4567-e89b-12d3-a456-426614174000")),
+			BlockID:      &blockID,
+			Title:        "Test Note",
+			Snippets:     []string{"a <mark>" + params["query"].(string) + "</mark> match"},
+			Rank:         0.5,
+		},
+	}, nil
+}
+
+func TestSearch(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	db := &database.Database{}
+
+	// Add mock middleware to set userID in context
+	router.Use(func(c *gin.Context) {
+		c.Set("userID", uuid.Must(uuid.Parse("90a12345-f12a-98c4-a456-513432930000")))
+		c.Next()
+	})
+
+	apiGroup := router.Group("/api/v1")
+	RegisterSearchRoutes(apiGroup, db, &MockSearchService{})
+
+	t.Run("Missing Query", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/search", nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Invalid Type", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/search?q=roadmap&type=notebook", nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Success", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/search?q=roadmap&limit=5", nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var results []models.SearchResult
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &results))
+		assert.Len(t, results, 1)
+		assert.Equal(t, "123e4567-e89b-12d3-a456-426614174001", results[0].BlockID.String())
+		assert.Equal(t, []string{"a <mark>roadmap</mark> match"}, results[0].Snippets)
+	})
+}
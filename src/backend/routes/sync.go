@@ -0,0 +1,91 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"owlistic-notes/owlistic/database"
+	"owlistic-notes/owlistic/models"
+	"owlistic-notes/owlistic/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// RegisterSyncRoutes registers the endpoints clients coming back online use
+// to catch up on changes and send the ones they made meanwhile
+func RegisterSyncRoutes(group *gin.RouterGroup, db *database.Database, syncService services.SyncServiceInterface) {
+	group.GET("/sync", func(c *gin.Context) { PullChanges(c, db, syncService) })
+	group.POST("/sync", func(c *gin.Context) { PushChanges(c, db, syncService) })
+}
+
+// PullChanges returns a page of the changes since the "since" cursor
+func PullChanges(c *gin.Context, db *database.Database, syncService services.SyncServiceInterface) {
+	userIDInterface, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	params := map[string]interface{}{
+		"user_id": userIDInterface.(uuid.UUID).String(),
+		"since":   c.Query("since"),
+	}
+
+	if limit := c.Query("limit"); limit != "" {
+		value, err := strconv.Atoi(limit)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a number"})
+			return
+		}
+		params["limit"] = value
+	}
+
+	page, err := syncService.Pull(db, params)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidInput) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+// PushChanges applies the queued "mutations" and answers with a result for
+// each, in the same order. Conflicts and failures of single mutations don't
+// fail the request.
+func PushChanges(c *gin.Context, db *database.Database, syncService services.SyncServiceInterface) {
+	userIDInterface, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var input struct {
+		Mutations []models.SyncMutation `json:"mutations" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	params := map[string]interface{}{
+		"user_id": userIDInterface.(uuid.UUID).String(),
+	}
+
+	results, err := syncService.Push(db, input.Mutations, params)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidInput) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"results": results})
+}
@@ -0,0 +1,120 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"owlistic-notes/owlistic/database"
+	"owlistic-notes/owlistic/models"
+	"owlistic-notes/owlistic/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+type MockSyncService struct {
+	params    map[string]interface{}
+	mutations []models.SyncMutation
+}
+
+func (m *MockSyncService) Pull(db *database.Database, params map[string]interface{}) (models.SyncPage, error) {
+	m.params = params
+	if params["since"] == "bogus" {
+		return models.SyncPage{}, services.ErrInvalidInput
+	}
+	return models.SyncPage{
+		Changes: []models.SyncChange{{Type: "note", ID: uuid.New(), Deleted: true, Version: 3}},
+		Cursor:  "next",
+	}, nil
+}
+
+func (m *MockSyncService) Push(db *database.Database, mutations []models.SyncMutation, params map[string]interface{}) ([]models.SyncResult, error) {
+	m.mutations = mutations
+	results := make([]models.SyncResult, len(mutations))
+	for i, mutation := range mutations {
+		results[i] = models.SyncResult{ClientID: mutation.ClientID, Status: models.SyncApplied}
+		if mutation.ExpectedVersion != nil && *mutation.ExpectedVersion == 1 {
+			results[i] = models.SyncResult{ClientID: mutation.ClientID, Status: models.SyncConflict, Current: map[string]interface{}{"version": 2}}
+		}
+	}
+	return results, nil
+}
+
+func TestSyncRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	db := &database.Database{}
+	service := &MockSyncService{}
+
+	// Add mock middleware to set userID in context
+	router.Use(func(c *gin.Context) {
+		c.Set("userID", uuid.Must(uuid.Parse("90a12345-f12a-98c4-a456-513432930000")))
+		c.Next()
+	})
+
+	RegisterSyncRoutes(router.Group("/api/v1"), db, service)
+
+	t.Run("Pull", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/sync?since=abc&limit=50", nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "abc", service.params["since"])
+		assert.Equal(t, 50, service.params["limit"])
+		assert.Equal(t, "90a12345-f12a-98c4-a456-513432930000", service.params["user_id"])
+
+		var page models.SyncPage
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+		assert.Equal(t, "next", page.Cursor)
+		assert.Len(t, page.Changes, 1)
+		assert.True(t, page.Changes[0].Deleted)
+	})
+
+	t.Run("PullRejectsBadInput", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/sync?limit=many", nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		w = httptest.NewRecorder()
+		req, _ = http.NewRequest("GET", "/api/v1/sync?since=bogus", nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Push", func(t *testing.T) {
+		body := `{"mutations": [
+			{"client_id": "a", "type": "note", "op": "create", "data": {"title": "Offline"}},
+			{"client_id": "b", "type": "block", "op": "update", "id": "x", "expected_version": 1, "data": {"content": {}}}
+		]}`
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/sync", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Len(t, service.mutations, 2)
+		assert.Equal(t, "Offline", service.mutations[0].Data["title"])
+
+		var response struct {
+			Results []models.SyncResult `json:"results"`
+		}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, models.SyncApplied, response.Results[0].Status)
+		assert.Equal(t, models.SyncConflict, response.Results[1].Status)
+		assert.Equal(t, "b", response.Results[1].ClientID)
+	})
+
+	t.Run("PushWithoutMutations", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/sync", strings.NewReader(`{}`))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
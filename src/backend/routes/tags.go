@@ -0,0 +1,144 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+
+	"owlistic-notes/owlistic/database"
+	"owlistic-notes/owlistic/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// RegisterTagRoutes registers the tag management endpoints
+func RegisterTagRoutes(group *gin.RouterGroup, db *database.Database, tagService services.TagServiceInterface) {
+	group.GET("/tags", func(c *gin.Context) { ListTags(c, db, tagService) })
+	group.POST("/tags", func(c *gin.Context) { CreateTag(c, db, tagService) })
+	group.PUT("/tags/:id", func(c *gin.Context) { UpdateTag(c, db, tagService) })
+	group.DELETE("/tags/:id", func(c *gin.Context) { DeleteTag(c, db, tagService) })
+	group.POST("/tags/:id/merge", func(c *gin.Context) { MergeTag(c, db, tagService) })
+}
+
+func ListTags(c *gin.Context, db *database.Database, tagService services.TagServiceInterface) {
+	params, ok := tagParams(c)
+	if !ok {
+		return
+	}
+
+	tags, err := tagService.ListTags(db, params)
+	if err != nil {
+		handleTagError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, tags)
+}
+
+func CreateTag(c *gin.Context, db *database.Database, tagService services.TagServiceInterface) {
+	var tagData map[string]interface{}
+	if err := c.ShouldBindJSON(&tagData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	params, ok := tagParams(c)
+	if !ok {
+		return
+	}
+
+	tag, err := tagService.CreateTag(db, tagData, params)
+	if err != nil {
+		handleTagError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, tag)
+}
+
+// UpdateTag renames a tag on every note or changes its colour
+func UpdateTag(c *gin.Context, db *database.Database, tagService services.TagServiceInterface) {
+	var tagData map[string]interface{}
+	if err := c.ShouldBindJSON(&tagData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	params, ok := tagParams(c)
+	if !ok {
+		return
+	}
+
+	tag, err := tagService.UpdateTag(db, c.Param("id"), tagData, params)
+	if err != nil {
+		handleTagError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, tag)
+}
+
+// MergeTag replaces a tag with the tag given as "into" and deletes it
+func MergeTag(c *gin.Context, db *database.Database, tagService services.TagServiceInterface) {
+	var request struct {
+		Into string `json:"into" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	params, ok := tagParams(c)
+	if !ok {
+		return
+	}
+
+	tag, err := tagService.MergeTag(db, c.Param("id"), request.Into, params)
+	if err != nil {
+		handleTagError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, tag)
+}
+
+// DeleteTag removes a tag from every note
+func DeleteTag(c *gin.Context, db *database.Database, tagService services.TagServiceInterface) {
+	params, ok := tagParams(c)
+	if !ok {
+		return
+	}
+
+	if err := tagService.DeleteTag(db, c.Param("id"), params); err != nil {
+		handleTagError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusNoContent, gin.H{})
+}
+
+// tagParams builds the service params from the request context
+func tagParams(c *gin.Context) (map[string]interface{}, bool) {
+	userIDInterface, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return nil, false
+	}
+
+	return map[string]interface{}{
+		"user_id": userIDInterface.(uuid.UUID).String(),
+	}, true
+}
+
+func handleTagError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidInput):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tag"})
+	case errors.Is(err, services.ErrTagNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Tag not found"})
+	case errors.Is(err, services.ErrResourceExists):
+		c.JSON(http.StatusConflict, gin.H{"error": "A tag with that name already exists"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,144 @@
+package routes
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"owlistic-notes/owlistic/database"
+	"owlistic-notes/owlistic/models"
+	"owlistic-notes/owlistic/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+const testTagID = "123e4567-e89b-12d3-a456-426614174000"
+
+type MockTagService struct{}
+
+func (m *MockTagService) ListTags(db *database.Database, params map[string]interface{}) ([]models.Tag, error) {
+	return []models.Tag{{ID: uuid.MustParse(testTagID), Name: "design", Color: "#ff0000", NoteCount: 3}}, nil
+}
+
+func (m *MockTagService) CreateTag(db *database.Database, tagData map[string]interface{}, params map[string]interface{}) (models.Tag, error) {
+	name, _ := tagData["name"].(string)
+	if models.NormalizeTagName(name) == "" {
+		return models.Tag{}, services.ErrInvalidInput
+	}
+	return models.Tag{ID: uuid.New(), Name: models.NormalizeTagName(name)}, nil
+}
+
+func (m *MockTagService) UpdateTag(db *database.Database, id string, tagData map[string]interface{}, params map[string]interface{}) (models.Tag, error) {
+	if id != testTagID {
+		return models.Tag{}, services.ErrTagNotFound
+	}
+	if tagData["name"] == "ux" {
+		return models.Tag{}, services.ErrResourceExists
+	}
+	name, _ := tagData["name"].(string)
+	return models.Tag{ID: uuid.MustParse(id), Name: name}, nil
+}
+
+func (m *MockTagService) MergeTag(db *database.Database, id string, targetID string, params map[string]interface{}) (models.Tag, error) {
+	if id == targetID {
+		return models.Tag{}, services.ErrInvalidInput
+	}
+	return models.Tag{ID: uuid.MustParse(targetID), Name: "architecture"}, nil
+}
+
+func (m *MockTagService) DeleteTag(db *database.Database, id string, params map[string]interface{}) error {
+	if id != testTagID {
+		return services.ErrTagNotFound
+	}
+	return nil
+}
+
+func TestTagRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	db := &database.Database{}
+
+	// Add mock middleware to set userID in context
+	router.Use(func(c *gin.Context) {
+		c.Set("userID", uuid.Must(uuid.Parse("90a12345-f12a-98c4-a456-513432930000")))
+		c.Next()
+	})
+
+	apiGroup := router.Group("/api/v1")
+	RegisterTagRoutes(apiGroup, db, &MockTagService{})
+
+	t.Run("List Tags", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/tags", nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var tags []models.Tag
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &tags))
+		if assert.Len(t, tags, 1) {
+			assert.Equal(t, int64(3), tags[0].NoteCount)
+		}
+	})
+
+	t.Run("Create Tag", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/tags", bytes.NewBufferString(`{"name": "#release"}`))
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Contains(t, w.Body.String(), `"name":"release"`)
+	})
+
+	t.Run("Create Invalid Tag", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/tags", bytes.NewBufferString(`{"name": "two words"}`))
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Rename Tag", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("PUT", "/api/v1/tags/"+testTagID, bytes.NewBufferString(`{"name": "architecture"}`))
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("Rename Tag To Existing Name", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("PUT", "/api/v1/tags/"+testTagID, bytes.NewBufferString(`{"name": "ux"}`))
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusConflict, w.Code)
+	})
+
+	t.Run("Merge Tag", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/tags/"+testTagID+"/merge", bytes.NewBufferString(`{"into": "`+uuid.New().String()+`"}`))
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"name":"architecture"`)
+	})
+
+	t.Run("Merge Tag Without Target", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/tags/"+testTagID+"/merge", bytes.NewBufferString(`{}`))
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Delete Tag", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("DELETE", "/api/v1/tags/"+testTagID, nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusNoContent, w.Code)
+	})
+
+	t.Run("Delete Unknown Tag", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("DELETE", "/api/v1/tags/"+uuid.New().String(), nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
@@ -69,17 +69,30 @@ func GetTaskById(c *gin.Context, db *database.Database, taskService services.Tas
 		return
 	}
 
+	setVersionETag(c, task.Version)
 	c.JSON(http.StatusOK, task)
 }
 
 func UpdateTask(c *gin.Context, db *database.Database, taskService services.TaskServiceInterface) {
 	id := c.Param("id")
-	var task models.Task
-	if err := c.ShouldBindJSON(&task); err != nil {
+	var input struct {
+		models.Task
+		ExpectedVersion *int64 `json:"expected_version"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
+	expected, err := ifMatchVersion(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.ExpectedVersion != nil {
+		expected = input.ExpectedVersion
+	}
+
 	// Get user ID from context to verify ownership
 	userIDInterface, exists := c.Get("userID")
 	if !exists {
@@ -104,15 +117,19 @@ func UpdateTask(c *gin.Context, db *database.Database, taskService services.Task
 		return
 	}
 
-	updatedTask, err := taskService.UpdateTask(db, id, task)
+	updatedTask, err := taskService.UpdateTask(db, id, input.Task, expected)
 	if err != nil {
 		if errors.Is(err, services.ErrTaskNotFound) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
 			return
 		}
+		if respondVersionConflict(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	setVersionETag(c, updatedTask.Version)
 	c.JSON(http.StatusOK, updatedTask)
 }
 
@@ -187,10 +204,19 @@ func GetTasks(c *gin.Context, db *database.Database, taskService services.TaskSe
 		params["note_id"] = noteId
 	}
 
-	tasks, err := taskService.GetTasks(db, params)
+	if !addListParams(c, params) {
+		return
+	}
+
+	tasks, page, err := taskService.GetTasks(db, params)
 	if err != nil {
+		if errors.Is(err, services.ErrInvalidInput) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	setPageHeaders(c, page)
 	c.JSON(http.StatusOK, tasks)
 }
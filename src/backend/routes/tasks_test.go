@@ -18,7 +18,7 @@ import (
 type MockTaskService struct{}
 
 // Add GetTasks method for query parameter support
-func (m *MockTaskService) GetTasks(db *database.Database, params map[string]interface{}) ([]models.Task, error) {
+func (m *MockTaskService) GetTasks(db *database.Database, params map[string]interface{}) ([]models.Task, services.PageInfo, error) {
 	userID, hasUserID := params["user_id"].(string)
 	completed, hasCompleted := params["is_completed"].(string)
 
@@ -60,7 +60,7 @@ func (m *MockTaskService) GetTasks(db *database.Database, params map[string]inte
 		tasks = filteredTasks
 	}
 
-	return tasks, nil
+	return tasks, services.PageInfo{Total: int64(len(tasks))}, nil
 }
 
 func (m *MockTaskService) CreateTask(db *database.Database, taskData map[string]interface{}) (models.Task, error) {
@@ -101,7 +101,7 @@ func (m *MockTaskService) GetAllTasks(db *database.Database) ([]models.Task, err
 	}, nil
 }
 
-func (m *MockTaskService) UpdateTask(db *database.Database, id string, updatedData models.Task) (models.Task, error) {
+func (m *MockTaskService) UpdateTask(db *database.Database, id string, updatedData models.Task, expected *int64) (models.Task, error) {
 	if id == "123e4567-e89b-12d3-a456-426614174000" {
 		return models.Task{ID: uuid.Must(uuid.Parse(id)), Title: updatedData.Title}, nil
 	}
@@ -257,3 +257,34 @@ func TestGetTasks(t *testing.T) {
 		assert.Contains(t, w.Body.String(), "Test Task 2")
 	})
 }
+
+func TestGetTasksPaging(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	db := &database.Database{}
+
+	// Add mock middleware to set userID in context
+	router.Use(func(c *gin.Context) {
+		c.Set("userID", uuid.Must(uuid.Parse("90a12345-f12a-98c4-a456-513432930000")))
+		c.Next()
+	})
+
+	apiGroup := router.Group("/api/v1")
+	RegisterTaskRoutes(apiGroup, db, &MockTaskService{})
+
+	t.Run("Total Count Header", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/tasks?sort=title&limit=10", nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "2", w.Header().Get("X-Total-Count"))
+		assert.Empty(t, w.Header().Get("X-Next-Cursor"))
+	})
+
+	t.Run("Invalid Limit", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/tasks?limit=ten", nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
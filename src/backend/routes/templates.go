@@ -0,0 +1,167 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+
+	"owlistic-notes/owlistic/database"
+	"owlistic-notes/owlistic/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// RegisterTemplateRoutes registers the note template endpoints
+func RegisterTemplateRoutes(group *gin.RouterGroup, db *database.Database, templateService services.TemplateServiceInterface) {
+	group.GET("/templates", func(c *gin.Context) { ListTemplates(c, db, templateService) })
+	group.POST("/templates", func(c *gin.Context) { CreateTemplate(c, db, templateService) })
+	group.GET("/templates/:id", func(c *gin.Context) { GetTemplateById(c, db, templateService) })
+	group.PUT("/templates/:id", func(c *gin.Context) { UpdateTemplate(c, db, templateService) })
+	group.DELETE("/templates/:id", func(c *gin.Context) { DeleteTemplate(c, db, templateService) })
+
+	group.POST("/notebooks/:id/notes/from-template/:templateId", func(c *gin.Context) { CreateNoteFromTemplate(c, db, templateService) })
+}
+
+func ListTemplates(c *gin.Context, db *database.Database, templateService services.TemplateServiceInterface) {
+	params, ok := templateParams(c)
+	if !ok {
+		return
+	}
+
+	templates, err := templateService.ListTemplates(db, params)
+	if err != nil {
+		handleTemplateError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, templates)
+}
+
+func GetTemplateById(c *gin.Context, db *database.Database, templateService services.TemplateServiceInterface) {
+	params, ok := templateParams(c)
+	if !ok {
+		return
+	}
+
+	template, err := templateService.GetTemplateById(db, c.Param("id"), params)
+	if err != nil {
+		handleTemplateError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, template)
+}
+
+func CreateTemplate(c *gin.Context, db *database.Database, templateService services.TemplateServiceInterface) {
+	var templateData map[string]interface{}
+	if err := c.ShouldBindJSON(&templateData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	params, ok := templateParams(c)
+	if !ok {
+		return
+	}
+
+	template, err := templateService.CreateTemplate(db, templateData, params)
+	if err != nil {
+		handleTemplateError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, template)
+}
+
+func UpdateTemplate(c *gin.Context, db *database.Database, templateService services.TemplateServiceInterface) {
+	var templateData map[string]interface{}
+	if err := c.ShouldBindJSON(&templateData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	params, ok := templateParams(c)
+	if !ok {
+		return
+	}
+
+	template, err := templateService.UpdateTemplate(db, c.Param("id"), templateData, params)
+	if err != nil {
+		handleTemplateError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, template)
+}
+
+func DeleteTemplate(c *gin.Context, db *database.Database, templateService services.TemplateServiceInterface) {
+	params, ok := templateParams(c)
+	if !ok {
+		return
+	}
+
+	if err := templateService.DeleteTemplate(db, c.Param("id"), params); err != nil {
+		handleTemplateError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusNoContent, gin.H{})
+}
+
+// CreateNoteFromTemplate creates a note in the notebook from a template.
+// The body may answer the template's prompts in "values" and override its
+// "title"; an empty body is fine for templates without prompts.
+func CreateNoteFromTemplate(c *gin.Context, db *database.Database, templateService services.TemplateServiceInterface) {
+	noteData := map[string]interface{}{}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&noteData); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	params, ok := templateParams(c)
+	if !ok {
+		return
+	}
+
+	note, err := templateService.CreateNoteFromTemplate(db, c.Param("id"), c.Param("templateId"), noteData, params)
+	if err != nil {
+		handleTemplateError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, note)
+}
+
+// templateParams builds the service params from the request context
+func templateParams(c *gin.Context) (map[string]interface{}, bool) {
+	userIDInterface, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return nil, false
+	}
+
+	return map[string]interface{}{
+		"user_id": userIDInterface.(uuid.UUID).String(),
+	}, true
+}
+
+func handleTemplateError(c *gin.Context, err error) {
+	if respondBlockValidationError(c, err) {
+		return
+	}
+
+	switch {
+	case errors.Is(err, services.ErrInvalidInput), errors.Is(err, services.ErrInvalidBlockType):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrTemplateNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Template not found"})
+	case errors.Is(err, services.ErrNotebookNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Notebook not found"})
+	case errors.Is(err, services.ErrNoteNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Note not found"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,131 @@
+package routes
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"owlistic-notes/owlistic/database"
+	"owlistic-notes/owlistic/models"
+	"owlistic-notes/owlistic/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+const testTemplateID = "123e4567-e89b-12d3-a456-426614174000"
+
+type MockTemplateService struct{}
+
+func (m *MockTemplateService) ListTemplates(db *database.Database, params map[string]interface{}) ([]models.Template, error) {
+	return []models.Template{{ID: uuid.MustParse(testTemplateID), Name: "Standup", Prompts: []string{"Team"}}}, nil
+}
+
+func (m *MockTemplateService) GetTemplateById(db *database.Database, id string, params map[string]interface{}) (models.Template, error) {
+	if id != testTemplateID {
+		return models.Template{}, services.ErrTemplateNotFound
+	}
+	return models.Template{ID: uuid.MustParse(id), Name: "Standup"}, nil
+}
+
+func (m *MockTemplateService) CreateTemplate(db *database.Database, templateData map[string]interface{}, params map[string]interface{}) (models.Template, error) {
+	name, _ := templateData["name"].(string)
+	if name == "" {
+		return models.Template{}, fmt.Errorf("%w: name is required", services.ErrInvalidInput)
+	}
+	return models.Template{ID: uuid.New(), Name: name}, nil
+}
+
+func (m *MockTemplateService) UpdateTemplate(db *database.Database, id string, templateData map[string]interface{}, params map[string]interface{}) (models.Template, error) {
+	return m.GetTemplateById(db, id, params)
+}
+
+func (m *MockTemplateService) DeleteTemplate(db *database.Database, id string, params map[string]interface{}) error {
+	_, err := m.GetTemplateById(db, id, params)
+	return err
+}
+
+func (m *MockTemplateService) CreateNoteFromTemplate(db *database.Database, notebookID string, templateID string, noteData map[string]interface{}, params map[string]interface{}) (models.Note, error) {
+	if templateID != testTemplateID {
+		return models.Note{}, services.ErrTemplateNotFound
+	}
+	values, _ := noteData["values"].(map[string]interface{})
+	team, ok := values["Team"].(string)
+	if !ok {
+		return models.Note{}, fmt.Errorf("%w: missing value for prompt %q", services.ErrInvalidInput, "Team")
+	}
+	return models.Note{ID: uuid.New(), NotebookID: uuid.MustParse(notebookID), Title: team + " standup"}, nil
+}
+
+func TestTemplateRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	db := &database.Database{}
+
+	// Add mock middleware to set userID in context
+	router.Use(func(c *gin.Context) {
+		c.Set("userID", uuid.Must(uuid.Parse("90a12345-f12a-98c4-a456-513432930000")))
+		c.Next()
+	})
+
+	apiGroup := router.Group("/api/v1")
+	RegisterTemplateRoutes(apiGroup, db, &MockTemplateService{})
+
+	notebookID := uuid.New().String()
+
+	t.Run("List Templates", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/templates", nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"prompts":["Team"]`)
+	})
+
+	t.Run("Create Template", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/templates", bytes.NewBufferString(`{"name": "Incident"}`))
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusCreated, w.Code)
+	})
+
+	t.Run("Create Template Without Name", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/templates", bytes.NewBufferString(`{}`))
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Get Unknown Template", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/templates/"+uuid.New().String(), nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("Delete Template", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("DELETE", "/api/v1/templates/"+testTemplateID, nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusNoContent, w.Code)
+	})
+
+	t.Run("Create Note From Template", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/notebooks/"+notebookID+"/notes/from-template/"+testTemplateID,
+			bytes.NewBufferString(`{"values": {"Team": "Platform"}}`))
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Contains(t, w.Body.String(), `"title":"Platform standup"`)
+	})
+
+	t.Run("Create Note From Template Without Prompt Values", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/notebooks/"+notebookID+"/notes/from-template/"+testTemplateID, nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "Team")
+	})
+}
@@ -0,0 +1,66 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"owlistic-notes/owlistic/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ifMatchVersion reads the version an If-Match header names, nil when there
+// is no header or it matches any version
+func ifMatchVersion(c *gin.Context) (*int64, error) {
+	header := strings.TrimSpace(c.GetHeader("If-Match"))
+	if header == "" || header == "*" {
+		return nil, nil
+	}
+
+	tag := strings.Trim(strings.TrimPrefix(header, "W/"), `"`)
+	version, err := strconv.ParseInt(tag, 10, 64)
+	if err != nil {
+		return nil, errors.New("If-Match must name a single version")
+	}
+	return &version, nil
+}
+
+// expectVersion passes the version of an If-Match header on to the service
+// as the "expected_version" of the update data, unless the body already
+// names one. It answers 400 and returns false for a malformed header.
+func expectVersion(c *gin.Context, data map[string]interface{}) bool {
+	version, err := ifMatchVersion(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+
+	if _, exists := data["expected_version"]; !exists && version != nil {
+		data["expected_version"] = *version
+	}
+	return true
+}
+
+// setVersionETag tags the response with the version of the resource it
+// carries, for clients to send back in If-Match
+func setVersionETag(c *gin.Context, version int64) {
+	c.Header("ETag", `"`+strconv.FormatInt(version, 10)+`"`)
+}
+
+// respondVersionConflict answers 409 with the resource as the server has it
+// when the update was based on an outdated version, and reports whether it
+// did
+func respondVersionConflict(c *gin.Context, err error) bool {
+	var conflict *services.VersionConflictError
+	if !errors.As(err, &conflict) {
+		return false
+	}
+
+	c.JSON(http.StatusConflict, gin.H{
+		"error":   err.Error(),
+		"current": conflict.Current,
+	})
+	return true
+}
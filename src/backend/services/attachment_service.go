@@ -0,0 +1,496 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+
+	"owlistic-notes/owlistic/broker"
+	"owlistic-notes/owlistic/database"
+	"owlistic-notes/owlistic/models"
+	"owlistic-notes/owlistic/storage"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// maxFilenameLength bounds the stored name of an uploaded file
+const maxFilenameLength = 255
+
+type AttachmentServiceInterface interface {
+	UploadAttachment(db *database.Database, noteID string, filename string, file io.Reader, params map[string]interface{}) (models.Attachment, error)
+	// GetAttachment returns the attachment along with its content, which the
+	// caller must close
+	GetAttachment(db *database.Database, id string, params map[string]interface{}) (models.Attachment, io.ReadCloser, error)
+	ListAttachments(db *database.Database, noteID string, params map[string]interface{}) ([]models.Attachment, error)
+	DeleteAttachment(db *database.Database, id string, params map[string]interface{}) error
+	// DeleteUnusedBlobs removes the blobs of the given hashes no attachment
+	// refers to anymore
+	DeleteUnusedBlobs(db *database.Database, hashes []string)
+	// MaxSize is the largest upload accepted, in bytes
+	MaxSize() int64
+}
+
+type AttachmentService struct {
+	store   storage.Store
+	maxSize int64
+	// mediaTypes lists the accepted media types; "image/*" accepts a whole
+	// family
+	mediaTypes []string
+}
+
+// UploadAttachment stores file as an attachment of the note. The media type
+// is sniffed from the content rather than trusted from the client.
+func (s *AttachmentService) UploadAttachment(db *database.Database, noteID string, filename string, file io.Reader, params map[string]interface{}) (models.Attachment, error) {
+	userIDStr, ok := params["user_id"].(string)
+	if !ok {
+		return models.Attachment{}, errors.New("user_id must be provided in parameters")
+	}
+
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return models.Attachment{}, ErrInvalidInput
+	}
+
+	note, err := findAttachmentNote(db, noteID)
+	if err != nil {
+		return models.Attachment{}, err
+	}
+
+	hasAccess, err := RoleServiceInstance.HasNoteAccess(db, userIDStr, noteID, "editor")
+	if err != nil {
+		return models.Attachment{}, err
+	}
+
+	if !hasAccess {
+		return models.Attachment{}, errors.New("not authorized to add attachments to this note")
+	}
+
+	// The content is spooled to disk to learn its size and hash before it
+	// reaches the store
+	spool, err := os.CreateTemp("", "attachment-*")
+	if err != nil {
+		return models.Attachment{}, err
+	}
+	defer os.Remove(spool.Name())
+	defer spool.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(spool, hash), io.LimitReader(file, s.maxSize+1))
+	if err != nil {
+		return models.Attachment{}, err
+	}
+	if size > s.maxSize {
+		return models.Attachment{}, fmt.Errorf("%w: the limit is %d bytes", ErrAttachmentTooLarge, s.maxSize)
+	}
+	if size == 0 {
+		return models.Attachment{}, fmt.Errorf("%w: file is empty", ErrInvalidInput)
+	}
+
+	head := make([]byte, 512)
+	n, err := spool.ReadAt(head, 0)
+	if err != nil && err != io.EOF {
+		return models.Attachment{}, err
+	}
+	contentType := http.DetectContentType(head[:n])
+	if !s.allows(contentType) {
+		return models.Attachment{}, fmt.Errorf("%w: %s", ErrAttachmentMediaType, contentType)
+	}
+
+	key := hex.EncodeToString(hash.Sum(nil))
+	attachment := models.Attachment{
+		ID:          uuid.New(),
+		UserID:      userID,
+		NoteID:      note.ID,
+		Filename:    cleanFilename(filename),
+		ContentType: contentType,
+		Size:        size,
+		Hash:        key,
+	}
+
+	tx := db.DB.Begin()
+	if tx.Error != nil {
+		return models.Attachment{}, tx.Error
+	}
+
+	// The blob can't be cleaned up between finding it stored and the new
+	// attachment referring to it
+	if err := lockBlob(tx, key); err != nil {
+		tx.Rollback()
+		return models.Attachment{}, err
+	}
+
+	exists, err := s.store.Exists(key)
+	if err != nil {
+		tx.Rollback()
+		return models.Attachment{}, err
+	}
+	if !exists {
+		if _, err := spool.Seek(0, io.SeekStart); err != nil {
+			tx.Rollback()
+			return models.Attachment{}, err
+		}
+		if err := s.store.Put(key, spool, size, contentType); err != nil {
+			tx.Rollback()
+			return models.Attachment{}, err
+		}
+	}
+
+	if err := tx.Create(&attachment).Error; err != nil {
+		tx.Rollback()
+		return models.Attachment{}, err
+	}
+
+	if err := createEvent(tx, string(broker.AttachmentCreated), "attachment", map[string]interface{}{
+		"attachment_id": attachment.ID.String(),
+		"note_id":       note.ID.String(),
+		"user_id":       userIDStr,
+		"filename":      attachment.Filename,
+		"content_type":  attachment.ContentType,
+		"size":          attachment.Size,
+	}); err != nil {
+		tx.Rollback()
+		return models.Attachment{}, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return models.Attachment{}, err
+	}
+
+	return attachment, nil
+}
+
+// GetAttachment opens an attachment for anyone who can view its note
+func (s *AttachmentService) GetAttachment(db *database.Database, id string, params map[string]interface{}) (models.Attachment, io.ReadCloser, error) {
+	attachment, err := s.findAttachment(db, id, params, "viewer")
+	if err != nil {
+		return models.Attachment{}, nil, err
+	}
+
+	content, err := s.store.Get(attachment.Hash)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			log.Printf("Blob %s of attachment %s is missing", attachment.Hash, attachment.ID)
+			return models.Attachment{}, nil, ErrAttachmentNotFound
+		}
+		return models.Attachment{}, nil, err
+	}
+
+	return attachment, content, nil
+}
+
+// ListAttachments returns the attachments of a note, oldest first
+func (s *AttachmentService) ListAttachments(db *database.Database, noteID string, params map[string]interface{}) ([]models.Attachment, error) {
+	userIDStr, ok := params["user_id"].(string)
+	if !ok {
+		return nil, errors.New("user_id must be provided in parameters")
+	}
+
+	note, err := findAttachmentNote(db, noteID)
+	if err != nil {
+		return nil, err
+	}
+
+	hasAccess, err := RoleServiceInstance.HasNoteAccess(db, userIDStr, noteID, "viewer")
+	if err != nil {
+		return nil, err
+	}
+
+	if !hasAccess {
+		return nil, errors.New("not authorized to access this note")
+	}
+
+	var attachments []models.Attachment
+	if err := db.DB.Where("note_id = ?", note.ID).Order("created_at").Find(&attachments).Error; err != nil {
+		return nil, err
+	}
+
+	return attachments, nil
+}
+
+// DeleteAttachment removes an attachment. Its blob goes too unless another
+// attachment has the same content.
+func (s *AttachmentService) DeleteAttachment(db *database.Database, id string, params map[string]interface{}) error {
+	attachment, err := s.findAttachment(db, id, params, "editor")
+	if err != nil {
+		return err
+	}
+
+	tx := db.DB.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+
+	if err := tx.Delete(&models.Attachment{}, "id = ?", attachment.ID).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := createEvent(tx, string(broker.AttachmentDeleted), "attachment", map[string]interface{}{
+		"attachment_id": attachment.ID.String(),
+		"note_id":       attachment.NoteID.String(),
+		"user_id":       params["user_id"],
+	}); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return err
+	}
+
+	s.DeleteUnusedBlobs(db, []string{attachment.Hash})
+	return nil
+}
+
+// DeleteUnusedBlobs runs after the attachments are gone, so failures only
+// leave a stray blob behind and are logged rather than returned
+func (s *AttachmentService) DeleteUnusedBlobs(db *database.Database, hashes []string) {
+	seen := make(map[string]bool, len(hashes))
+	for _, hash := range hashes {
+		if seen[hash] {
+			continue
+		}
+		seen[hash] = true
+
+		if err := s.deleteUnusedBlob(db, hash); err != nil {
+			log.Printf("Failed to delete blob %s: %v", hash, err)
+		}
+	}
+}
+
+// deleteUnusedBlob removes the blob unless an attachment refers to it,
+// holding back uploads of the same content meanwhile
+func (s *AttachmentService) deleteUnusedBlob(db *database.Database, hash string) error {
+	tx := db.DB.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+	defer tx.Rollback()
+
+	if err := lockBlob(tx, hash); err != nil {
+		return err
+	}
+
+	var count int64
+	if err := tx.Model(&models.Attachment{}).Where("hash = ?", hash).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	if err := s.store.Delete(hash); err != nil {
+		return err
+	}
+	return tx.Commit().Error
+}
+
+// blockAttachmentID returns the attachment an image or file block shows
+func blockAttachmentID(content map[string]interface{}) (string, bool) {
+	id, ok := content["attachment_id"].(string)
+	return id, ok && id != ""
+}
+
+// checkBlockAttachment rejects a block showing an attachment that is not
+// one of its note's
+func checkBlockAttachment(tx *gorm.DB, block models.Block) error {
+	id, ok := blockAttachmentID(block.Content)
+	if !ok {
+		return nil
+	}
+
+	var count int64
+	if err := tx.Model(&models.Attachment{}).Where("id = ? AND note_id = ?", id, block.NoteID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return &BlockValidationError{
+			BlockType: block.Type,
+			Fields:    []FieldError{{Field: "content.attachment_id", Message: "is not an attachment of this note"}},
+		}
+	}
+	return nil
+}
+
+// copyAttachments gives note copies of the attachments, sharing their
+// blobs, and returns the IDs of the copies by those of the originals
+func copyAttachments(tx *gorm.DB, attachments []models.Attachment, note models.Note) (map[string]string, error) {
+	copies := make(map[string]string, len(attachments))
+	for _, attachment := range attachments {
+		attachmentCopy := attachment
+		attachmentCopy.ID = uuid.New()
+		attachmentCopy.UserID = note.UserID
+		attachmentCopy.NoteID = note.ID
+		attachmentCopy.CreatedAt = time.Time{}
+		if err := tx.Create(&attachmentCopy).Error; err != nil {
+			return nil, err
+		}
+		copies[attachment.ID.String()] = attachmentCopy.ID.String()
+	}
+	return copies, nil
+}
+
+// copyBlockAttachments copies the attachments of the source note that its
+// blocks show to note
+func copyBlockAttachments(tx *gorm.DB, blocks []models.Block, sourceNoteID uuid.UUID, note models.Note) (map[string]string, error) {
+	var ids []string
+	for _, block := range blocks {
+		if id, ok := blockAttachmentID(block.Content); ok {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	var attachments []models.Attachment
+	if err := tx.Where("id IN ? AND note_id = ?", ids, sourceNoteID).Find(&attachments).Error; err != nil {
+		return nil, err
+	}
+	return copyAttachments(tx, attachments, note)
+}
+
+// repointAttachment returns the content showing the copy of its attachment
+func repointAttachment(content models.BlockContent, copies map[string]string) models.BlockContent {
+	id, ok := blockAttachmentID(content)
+	if !ok || copies[id] == "" {
+		return content
+	}
+
+	repointed := make(models.BlockContent, len(content))
+	for key, value := range content {
+		repointed[key] = value
+	}
+	repointed["attachment_id"] = copies[id]
+	return repointed
+}
+
+// lockBlob serialises the uploads and clean-ups of a blob until tx ends
+func lockBlob(tx *gorm.DB, hash string) error {
+	return tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", hash).Error
+}
+
+// findAttachment loads an attachment the user holds the role on its note for
+func (s *AttachmentService) findAttachment(db *database.Database, id string, params map[string]interface{}, role string) (models.Attachment, error) {
+	userIDStr, ok := params["user_id"].(string)
+	if !ok {
+		return models.Attachment{}, errors.New("user_id must be provided in parameters")
+	}
+
+	attachmentID, err := uuid.Parse(id)
+	if err != nil {
+		return models.Attachment{}, ErrAttachmentNotFound
+	}
+
+	var attachment models.Attachment
+	if err := db.DB.First(&attachment, "id = ?", attachmentID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return models.Attachment{}, ErrAttachmentNotFound
+		}
+		return models.Attachment{}, err
+	}
+
+	hasAccess, err := RoleServiceInstance.HasNoteAccess(db, userIDStr, attachment.NoteID.String(), role)
+	if err != nil {
+		return models.Attachment{}, err
+	}
+
+	if !hasAccess {
+		return models.Attachment{}, errors.New("not authorized to access this attachment")
+	}
+
+	return attachment, nil
+}
+
+// allows tells whether the sniffed media type is accepted
+func (s *AttachmentService) allows(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	for _, allowed := range s.mediaTypes {
+		if allowed == mediaType || (strings.HasSuffix(allowed, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(allowed, "*"))) {
+			return true
+		}
+	}
+	return false
+}
+
+// findAttachmentNote returns the note attachments are added to or listed
+// for; notes in the trash are not found
+func findAttachmentNote(db *database.Database, noteID string) (models.Note, error) {
+	id, err := uuid.Parse(noteID)
+	if err != nil {
+		return models.Note{}, ErrNoteNotFound
+	}
+
+	var note models.Note
+	if err := db.DB.Select("id").First(&note, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return models.Note{}, ErrNoteNotFound
+		}
+		return models.Note{}, err
+	}
+	return note, nil
+}
+
+// cleanFilename keeps the last path element of an uploaded file's name,
+// without control characters
+func cleanFilename(filename string) string {
+	filename = filepath.Base(strings.ReplaceAll(filename, "\\", "/"))
+	filename = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, filename)
+
+	if filename == "." || filename == "/" || strings.TrimSpace(filename) == "" {
+		return "attachment"
+	}
+	if len(filename) > maxFilenameLength {
+		filename = strings.ToValidUTF8(filename[:maxFilenameLength], "")
+	}
+	return filename
+}
+
+// deleteUnusedAttachmentBlobs hands the hashes of deleted attachments to
+// the attachment service, when there is one
+func deleteUnusedAttachmentBlobs(db *database.Database, hashes []string) {
+	if AttachmentServiceInstance != nil && len(hashes) > 0 {
+		AttachmentServiceInstance.DeleteUnusedBlobs(db, hashes)
+	}
+}
+
+// MaxSize returns the largest upload accepted, in bytes
+func (s *AttachmentService) MaxSize() int64 {
+	return s.maxSize
+}
+
+// NewAttachmentService creates a new instance of AttachmentService keeping
+// blobs in store. Uploads larger than maxSize bytes or with a media type not
+// in mediaTypes are refused.
+func NewAttachmentService(store storage.Store, maxSize int64, mediaTypes []string) AttachmentServiceInterface {
+	allowed := make([]string, 0, len(mediaTypes))
+	for _, mediaType := range mediaTypes {
+		if mediaType = strings.TrimSpace(mediaType); mediaType != "" {
+			allowed = append(allowed, mediaType)
+		}
+	}
+	return &AttachmentService{store: store, maxSize: maxSize, mediaTypes: allowed}
+}
+
+// Don't initialize here, will be set properly in main.go
+var AttachmentServiceInstance AttachmentServiceInterface
@@ -0,0 +1,250 @@
+package services
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"owlistic-notes/owlistic/models"
+	"owlistic-notes/owlistic/storage"
+	"owlistic-notes/owlistic/testutils"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+// pngHeader is enough of a PNG file for its media type to be sniffed
+var pngHeader = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+func TestUploadAttachment_StoresBlobOnce(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	userID := uuid.New()
+	noteID := uuid.New()
+
+	previous := RoleServiceInstance
+	RoleServiceInstance = &graphAccessStub{notes: map[string]bool{noteID.String(): true}}
+	defer func() { RoleServiceInstance = previous }()
+
+	store, err := storage.NewLocalStore(t.TempDir())
+	assert.NoError(t, err)
+	service := NewAttachmentService(store, 1<<20, []string{"image/*", " application/pdf"})
+
+	sum := sha256.Sum256(pngHeader)
+	hash := hex.EncodeToString(sum[:])
+
+	for i := 0; i < 2; i++ {
+		mock.ExpectQuery("SELECT \"id\" FROM \"notes\" WHERE").
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(noteID.String()))
+		mock.ExpectBegin()
+		mock.ExpectExec("SELECT pg_advisory_xact_lock\\(hashtext\\(\\$1\\)\\)").
+			WithArgs(hash).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery("INSERT INTO \"attachments\"").
+			WithArgs(userID, noteID, "photo.png", "image/png", int64(len(pngHeader)), hash, sqlmock.AnyArg()).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(uuid.New(), nil))
+		mock.ExpectQuery("INSERT INTO \"events\"").
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(uuid.New()))
+		mock.ExpectCommit()
+
+		attachment, err := service.UploadAttachment(db, noteID.String(), "C:\\Users\\sam\\photo.png",
+			bytes.NewReader(pngHeader), map[string]interface{}{"user_id": userID.String()})
+		assert.NoError(t, err)
+		assert.Equal(t, hash, attachment.Hash)
+		assert.Equal(t, "photo.png", attachment.Filename)
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	blob, err := store.Get(hash)
+	if assert.NoError(t, err) {
+		data, _ := io.ReadAll(blob)
+		blob.Close()
+		assert.Equal(t, pngHeader, data)
+	}
+}
+
+func TestUploadAttachment_Limits(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	noteID := uuid.New()
+	params := map[string]interface{}{"user_id": uuid.New().String()}
+
+	previous := RoleServiceInstance
+	RoleServiceInstance = &graphAccessStub{notes: map[string]bool{noteID.String(): true}}
+	defer func() { RoleServiceInstance = previous }()
+
+	store, err := storage.NewLocalStore(t.TempDir())
+	assert.NoError(t, err)
+	service := NewAttachmentService(store, 16, []string{"image/*"})
+
+	for i := 0; i < 3; i++ {
+		mock.ExpectQuery("SELECT \"id\" FROM \"notes\" WHERE").
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(noteID.String()))
+	}
+
+	_, err = service.UploadAttachment(db, noteID.String(), "big.png", bytes.NewReader(append(pngHeader, make([]byte, 16)...)), params)
+	assert.ErrorIs(t, err, ErrAttachmentTooLarge)
+
+	// The name says image but the content is text
+	_, err = service.UploadAttachment(db, noteID.String(), "fake.png", strings.NewReader("hello"), params)
+	assert.ErrorIs(t, err, ErrAttachmentMediaType)
+
+	_, err = service.UploadAttachment(db, noteID.String(), "empty.png", strings.NewReader(""), params)
+	assert.ErrorIs(t, err, ErrInvalidInput)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDeleteAttachment_KeepsSharedBlob(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	noteID := uuid.New()
+	attachmentID := uuid.New()
+	hash := strings.Repeat("ab", 32)
+
+	previous := RoleServiceInstance
+	RoleServiceInstance = &graphAccessStub{notes: map[string]bool{noteID.String(): true}}
+	defer func() { RoleServiceInstance = previous }()
+
+	store, err := storage.NewLocalStore(t.TempDir())
+	assert.NoError(t, err)
+	assert.NoError(t, store.Put(hash, strings.NewReader("data"), 4, "text/plain"))
+	service := NewAttachmentService(store, 1<<20, []string{"text/plain"})
+
+	mock.ExpectQuery("SELECT \\* FROM \"attachments\" WHERE id = (.+)").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "note_id", "hash"}).
+			AddRow(attachmentID.String(), noteID.String(), hash))
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM \"attachments\" WHERE id = (.+)").
+		WithArgs(attachmentID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("INSERT INTO \"events\"").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(uuid.New()))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectExec("SELECT pg_advisory_xact_lock").
+		WithArgs(hash).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT count\\(\\*\\) FROM \"attachments\" WHERE hash = (.+)").
+		WithArgs(hash).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectRollback()
+
+	err = service.DeleteAttachment(db, attachmentID.String(), map[string]interface{}{"user_id": uuid.New().String()})
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	exists, _ := store.Exists(hash)
+	assert.True(t, exists)
+
+	// The clean-up takes the same lock as uploads of the blob
+	mock.ExpectBegin()
+	mock.ExpectExec("SELECT pg_advisory_xact_lock").
+		WithArgs(hash).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT count\\(\\*\\) FROM \"attachments\" WHERE hash = (.+)").
+		WithArgs(hash).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectCommit()
+	service.DeleteUnusedBlobs(db, []string{hash, hash})
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	exists, _ = store.Exists(hash)
+	assert.False(t, exists)
+}
+
+func TestGetAttachment_NoAccess(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	previous := RoleServiceInstance
+	RoleServiceInstance = &graphAccessStub{}
+	defer func() { RoleServiceInstance = previous }()
+
+	store, err := storage.NewLocalStore(t.TempDir())
+	assert.NoError(t, err)
+	service := NewAttachmentService(store, 1<<20, nil)
+
+	mock.ExpectQuery("SELECT \\* FROM \"attachments\" WHERE id = (.+)").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "note_id", "hash"}).
+			AddRow(uuid.New().String(), uuid.New().String(), strings.Repeat("ab", 32)))
+
+	_, _, err = service.GetAttachment(db, uuid.New().String(), map[string]interface{}{"user_id": uuid.New().String()})
+	assert.Error(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	_, _, err = service.GetAttachment(db, "not-an-id", map[string]interface{}{"user_id": uuid.New().String()})
+	assert.ErrorIs(t, err, ErrAttachmentNotFound)
+}
+
+func TestCheckBlockAttachment(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	noteID := uuid.New()
+	attachmentID := uuid.New().String()
+	block := models.Block{NoteID: noteID, Type: models.ImageBlock, Content: models.BlockContent{"attachment_id": attachmentID}}
+
+	mock.ExpectQuery("SELECT count\\(\\*\\) FROM \"attachments\" WHERE id = \\$1 AND note_id = \\$2").
+		WithArgs(attachmentID, noteID).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	assert.NoError(t, checkBlockAttachment(db.DB, block))
+
+	// An attachment of another note, or none at all, is refused
+	mock.ExpectQuery("SELECT count\\(\\*\\) FROM \"attachments\" WHERE id = \\$1 AND note_id = \\$2").
+		WithArgs(attachmentID, noteID).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	err := checkBlockAttachment(db.DB, block)
+	var validationErr *BlockValidationError
+	if assert.ErrorAs(t, err, &validationErr) {
+		assert.Equal(t, "content.attachment_id", validationErr.Fields[0].Field)
+	}
+
+	// Blocks without attachments need no query
+	assert.NoError(t, checkBlockAttachment(db.DB, models.Block{NoteID: noteID, Content: models.BlockContent{"text": "hi"}}))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCopyBlockAttachments(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	sourceID := uuid.New()
+	attachmentID := uuid.New()
+	hash := strings.Repeat("cd", 32)
+	note := models.Note{ID: uuid.New(), UserID: uuid.New()}
+	blocks := []models.Block{
+		{Type: models.ImageBlock, Content: models.BlockContent{"attachment_id": attachmentID.String()}},
+		{Type: models.TextBlock, Content: models.BlockContent{"text": "caption"}},
+	}
+
+	mock.ExpectQuery("SELECT \\* FROM \"attachments\" WHERE id IN \\(\\$1\\) AND note_id = \\$2").
+		WithArgs(attachmentID.String(), sourceID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "note_id", "filename", "content_type", "size", "hash"}).
+			AddRow(attachmentID.String(), uuid.New().String(), sourceID.String(), "photo.png", "image/png", 12, hash))
+	// The copy shares the blob
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO \"attachments\"").
+		WithArgs(note.UserID, note.ID, "photo.png", "image/png", int64(12), hash, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"created_at"}).AddRow(time.Now()))
+	mock.ExpectCommit()
+
+	copies, err := copyBlockAttachments(db.DB, blocks, sourceID, note)
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	repointed := repointAttachment(blocks[0].Content, copies)
+	assert.NotEqual(t, attachmentID.String(), repointed["attachment_id"])
+	assert.Equal(t, copies[attachmentID.String()], repointed["attachment_id"])
+	// The original block keeps its attachment
+	assert.Equal(t, attachmentID.String(), blocks[0].Content["attachment_id"])
+	assert.Equal(t, blocks[1].Content, repointAttachment(blocks[1].Content, copies))
+}
@@ -0,0 +1,438 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	"owlistic-notes/owlistic/models"
+
+	"github.com/google/uuid"
+)
+
+// FieldKind is the JSON type expected for a block field
+type FieldKind string
+
+const (
+	FieldString  FieldKind = "string"
+	FieldInteger FieldKind = "integer"
+	FieldNumber  FieldKind = "number"
+	FieldBoolean FieldKind = "boolean"
+	FieldArray   FieldKind = "array"
+	FieldObject  FieldKind = "object"
+)
+
+// FieldSchema describes a single content or metadata field. A null value
+// is treated the same as a missing one.
+type FieldSchema struct {
+	Kind     FieldKind
+	Required bool
+	// Enum restricts string fields to a fixed set of values
+	Enum []string
+	// Items describes the elements of array fields
+	Items *FieldSchema
+	// Check runs after the kind check and returns a description of the
+	// problem with the value, or an empty string when it is valid
+	Check func(value interface{}) string
+}
+
+// BlockSchema describes the content and metadata of a block type. Keys not
+// listed are accepted as is, since the editor and the sync handler keep
+// their own bookkeeping in metadata.
+type BlockSchema struct {
+	Content  map[string]FieldSchema
+	Metadata map[string]FieldSchema
+	// Check validates rules spanning several fields, after every field passed
+	Check func(content models.BlockContent, metadata models.BlockMetadata) []FieldError
+	// AllowsChildren lets blocks of this type be the parent of other blocks
+	AllowsChildren bool
+}
+
+// FieldError names an offending field, such as "metadata.level"
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// BlockValidationError lists every field of a block that violates the
+// schema of its type
+type BlockValidationError struct {
+	BlockType models.BlockType
+	Fields    []FieldError
+}
+
+func (e *BlockValidationError) Error() string {
+	messages := make([]string, len(e.Fields))
+	for i, field := range e.Fields {
+		messages[i] = field.Field + " " + field.Message
+	}
+	return fmt.Sprintf("invalid %s block: %s", e.BlockType, strings.Join(messages, "; "))
+}
+
+func (e *BlockValidationError) Unwrap() error {
+	return ErrInvalidBlockContent
+}
+
+// maxBlockTypeLength matches the width of the blocks.type column
+const maxBlockTypeLength = 20
+
+// BlockSchemaRegistry holds the schema of every block type the server accepts
+type BlockSchemaRegistry struct {
+	mu      sync.RWMutex
+	schemas map[models.BlockType]BlockSchema
+}
+
+// NewBlockSchemaRegistry creates a registry with the built-in block types
+func NewBlockSchemaRegistry() *BlockSchemaRegistry {
+	registry := &BlockSchemaRegistry{schemas: make(map[models.BlockType]BlockSchema)}
+	for blockType, schema := range builtinBlockSchemas() {
+		registry.schemas[blockType] = schema
+	}
+	return registry
+}
+
+// Register adds a new block type. Existing types, built-in ones included,
+// cannot be replaced.
+func (r *BlockSchemaRegistry) Register(blockType models.BlockType, schema BlockSchema) error {
+	if blockType == "" || len(blockType) > maxBlockTypeLength {
+		return fmt.Errorf("%w: block type must be between 1 and %d characters", ErrInvalidInput, maxBlockTypeLength)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.schemas[blockType]; exists {
+		return fmt.Errorf("%w: block type %s", ErrResourceExists, blockType)
+	}
+	r.schemas[blockType] = schema
+	return nil
+}
+
+// Lookup returns the schema registered for a block type
+func (r *BlockSchemaRegistry) Lookup(blockType models.BlockType) (BlockSchema, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	schema, ok := r.schemas[blockType]
+	return schema, ok
+}
+
+// Types returns the registered block types in alphabetical order
+func (r *BlockSchemaRegistry) Types() []models.BlockType {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	types := make([]models.BlockType, 0, len(r.schemas))
+	for blockType := range r.schemas {
+		types = append(types, blockType)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+	return types
+}
+
+// Validate checks a block against the schema of its type and returns a
+// *BlockValidationError naming every offending field
+func (r *BlockSchemaRegistry) Validate(blockType models.BlockType, content models.BlockContent, metadata models.BlockMetadata) error {
+	schema, ok := r.Lookup(blockType)
+	if !ok {
+		return &BlockValidationError{
+			BlockType: blockType,
+			Fields:    []FieldError{{Field: "type", Message: "is not a registered block type"}},
+		}
+	}
+
+	fields := validateFields("content", content, schema.Content)
+	fields = append(fields, validateFields("metadata", metadata, schema.Metadata)...)
+	if len(fields) == 0 && schema.Check != nil {
+		fields = schema.Check(content, metadata)
+	}
+
+	if len(fields) > 0 {
+		return &BlockValidationError{BlockType: blockType, Fields: fields}
+	}
+	return nil
+}
+
+// validateFields checks the values of a content or metadata map in key order
+func validateFields(prefix string, values map[string]interface{}, fields map[string]FieldSchema) []FieldError {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var errs []FieldError
+	for _, key := range keys {
+		field := fields[key]
+		value := values[key]
+		if value == nil {
+			if field.Required {
+				errs = append(errs, FieldError{Field: prefix + "." + key, Message: "is required"})
+			}
+			continue
+		}
+		errs = append(errs, validateValue(prefix+"."+key, value, field)...)
+	}
+	return errs
+}
+
+// validateValue checks a single value, descending into array elements
+func validateValue(name string, value interface{}, field FieldSchema) []FieldError {
+	if !hasKind(value, field.Kind) {
+		return []FieldError{{Field: name, Message: "must be " + kindDescription(field.Kind)}}
+	}
+
+	if len(field.Enum) > 0 {
+		text, _ := value.(string)
+		allowed := false
+		for _, option := range field.Enum {
+			allowed = allowed || text == option
+		}
+		if !allowed {
+			return []FieldError{{Field: name, Message: "must be one of " + strings.Join(field.Enum, ", ")}}
+		}
+	}
+
+	if field.Check != nil {
+		if message := field.Check(value); message != "" {
+			return []FieldError{{Field: name, Message: message}}
+		}
+	}
+
+	var errs []FieldError
+	if items, ok := value.([]interface{}); ok && field.Items != nil {
+		for i, item := range items {
+			errs = append(errs, validateValue(fmt.Sprintf("%s[%d]", name, i), item, *field.Items)...)
+		}
+	}
+	return errs
+}
+
+// hasKind reports whether a value decoded from JSON, or set by the server,
+// has the expected kind
+func hasKind(value interface{}, kind FieldKind) bool {
+	switch kind {
+	case FieldString:
+		_, ok := value.(string)
+		return ok
+	case FieldBoolean:
+		_, ok := value.(bool)
+		return ok
+	case FieldNumber:
+		_, ok := numberValue(value)
+		return ok
+	case FieldInteger:
+		number, ok := numberValue(value)
+		return ok && number == math.Trunc(number)
+	case FieldArray:
+		_, ok := value.([]interface{})
+		return ok
+	case FieldObject:
+		_, ok := value.(map[string]interface{})
+		return ok
+	}
+	return true
+}
+
+func kindDescription(kind FieldKind) string {
+	switch kind {
+	case FieldInteger, FieldArray, FieldObject:
+		return "an " + string(kind)
+	}
+	return "a " + string(kind)
+}
+
+// numberValue reads a number decoded from JSON or set by the server
+func numberValue(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	default:
+		return 0, false
+	}
+}
+
+// intRange checks that an integer field lies within [min, max]
+func intRange(min, max int) func(interface{}) string {
+	return func(value interface{}) string {
+		number, _ := numberValue(value)
+		if number < float64(min) || number > float64(max) {
+			return fmt.Sprintf("must be between %d and %d", min, max)
+		}
+		return ""
+	}
+}
+
+func positive(value interface{}) string {
+	if number, _ := numberValue(value); number <= 0 {
+		return "must be positive"
+	}
+	return ""
+}
+
+// imageURL accepts http, https and relative URLs, keeping script URLs out
+func imageURL(value interface{}) string {
+	text := value.(string)
+	parsed, err := url.Parse(text)
+	if text == "" || err != nil || (parsed.Scheme != "" && parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return "must be an http, https or relative URL"
+	}
+	return ""
+}
+
+func attachmentReference(value interface{}) string {
+	if _, err := uuid.Parse(value.(string)); err != nil {
+		return "must be an attachment ID"
+	}
+	return ""
+}
+
+// checkImageSource requires an image to be shown from a URL or an attachment
+func checkImageSource(content models.BlockContent, metadata models.BlockMetadata) []FieldError {
+	if content["url"] == nil && content["attachment_id"] == nil {
+		return []FieldError{{Field: "content.url", Message: "is required unless content.attachment_id is set"}}
+	}
+	return nil
+}
+
+func noteReference(value interface{}) string {
+	if _, err := uuid.Parse(value.(string)); err != nil {
+		return "must be a note ID"
+	}
+	return ""
+}
+
+// checkSpan requires note links in text to name the note they point to
+func checkSpan(value interface{}) string {
+	span := value.(map[string]interface{})
+	if span["type"] != models.NoteLinkSpan {
+		return ""
+	}
+	if id, ok := span["note_id"].(string); !ok || noteReference(id) != "" {
+		return "note link must have a note_id"
+	}
+	return ""
+}
+
+// maxTableCells bounds the size of a single table block
+const maxTableCells = 10000
+
+// checkTable requires a non-empty grid with the same number of cells in every row
+func checkTable(content models.BlockContent, metadata models.BlockMetadata) []FieldError {
+	rows := content["rows"].([]interface{})
+	if len(rows) == 0 {
+		return []FieldError{{Field: "content.rows", Message: "must contain at least one row"}}
+	}
+
+	columns := len(rows[0].([]interface{}))
+	for i, row := range rows {
+		if cells := len(row.([]interface{})); cells == 0 || cells != columns {
+			return []FieldError{{Field: fmt.Sprintf("content.rows[%d]", i), Message: fmt.Sprintf("must have %d cells", columns)}}
+		}
+	}
+
+	if len(rows)*columns > maxTableCells {
+		return []FieldError{{Field: "content.rows", Message: fmt.Sprintf("must have at most %d cells", maxTableCells)}}
+	}
+	return nil
+}
+
+// builtinBlockSchemas returns the schemas of the block types the editor ships with
+func builtinBlockSchemas() map[models.BlockType]BlockSchema {
+	// Most blocks hold editable text with inline formatting spans
+	textBlock := func(metadata map[string]FieldSchema) BlockSchema {
+		if metadata == nil {
+			metadata = map[string]FieldSchema{}
+		}
+		metadata["spans"] = FieldSchema{Kind: FieldArray, Items: &FieldSchema{Kind: FieldObject, Check: checkSpan}}
+		return BlockSchema{
+			Content:  map[string]FieldSchema{"text": {Kind: FieldString, Required: true}},
+			Metadata: metadata,
+		}
+	}
+	listStyle := FieldSchema{Kind: FieldString, Enum: []string{"ordered", "unordered"}}
+
+	// List items, tasks and toggles can hold nested blocks
+	nestable := func(schema BlockSchema) BlockSchema {
+		schema.AllowsChildren = true
+		return schema
+	}
+
+	return map[models.BlockType]BlockSchema{
+		models.TextBlock: textBlock(nil),
+		models.TaskBlock: nestable(textBlock(map[string]FieldSchema{
+			"is_completed": {Kind: FieldBoolean},
+			"task_id":      {Kind: FieldString},
+		})),
+		models.HeadingBlock: textBlock(map[string]FieldSchema{
+			"level": {Kind: FieldInteger, Check: intRange(1, 6)},
+		}),
+		models.ListItemBlock: nestable(textBlock(map[string]FieldSchema{
+			"item_type": listStyle,
+			"listType":  listStyle,
+		})),
+		models.HorizontalRuleBlock: {},
+		models.CodeBlock: {
+			Content:  map[string]FieldSchema{"text": {Kind: FieldString, Required: true}},
+			Metadata: map[string]FieldSchema{"language": {Kind: FieldString}},
+		},
+		models.QuoteBlock: textBlock(nil),
+		models.ImageBlock: {
+			Content: map[string]FieldSchema{
+				"url":           {Kind: FieldString, Check: imageURL},
+				"attachment_id": {Kind: FieldString, Check: attachmentReference},
+				"alt":           {Kind: FieldString},
+			},
+			Metadata: map[string]FieldSchema{
+				"width":  {Kind: FieldInteger, Check: positive},
+				"height": {Kind: FieldInteger, Check: positive},
+			},
+			Check: checkImageSource,
+		},
+		models.FileBlock: {
+			Content: map[string]FieldSchema{
+				"attachment_id": {Kind: FieldString, Required: true, Check: attachmentReference},
+				"name":          {Kind: FieldString},
+			},
+		},
+		models.TableBlock: {
+			Content: map[string]FieldSchema{
+				"rows": {Kind: FieldArray, Required: true, Items: &FieldSchema{
+					Kind:  FieldArray,
+					Items: &FieldSchema{Kind: FieldString},
+				}},
+			},
+			Metadata: map[string]FieldSchema{"header_row": {Kind: FieldBoolean}},
+			Check:    checkTable,
+		},
+		models.CalloutBlock: textBlock(map[string]FieldSchema{
+			"variant": {Kind: FieldString, Enum: []string{"info", "success", "warning", "error"}},
+			"icon":    {Kind: FieldString},
+		}),
+		models.ToggleBlock: nestable(textBlock(map[string]FieldSchema{
+			"collapsed": {Kind: FieldBoolean},
+		})),
+		models.NoteLinkBlock: {
+			Content: map[string]FieldSchema{
+				"note_id": {Kind: FieldString, Required: true, Check: noteReference},
+				"text":    {Kind: FieldString},
+			},
+		},
+	}
+}
+
+// validateBlock checks a block against the schema registered for its type
+func validateBlock(blockType models.BlockType, content models.BlockContent, metadata models.BlockMetadata) error {
+	return BlockSchemaRegistryInstance.Validate(blockType, content, metadata)
+}
+
+// BlockSchemaRegistryInstance is the registry enforced by BlockService.
+// Plugins register their block types here during startup.
+var BlockSchemaRegistryInstance = NewBlockSchemaRegistry()
@@ -0,0 +1,233 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"owlistic-notes/owlistic/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateBlock(t *testing.T) {
+	testCases := []struct {
+		name      string
+		blockType models.BlockType
+		content   models.BlockContent
+		metadata  models.BlockMetadata
+		// fields lists the offending fields, nil when the block is valid
+		fields []string
+	}{
+		{
+			name:      "Unknown type",
+			blockType: "video",
+			content:   models.BlockContent{"text": "clip"},
+			fields:    []string{"type"},
+		},
+		{
+			name:      "Text with bookkeeping metadata",
+			blockType: models.TextBlock,
+			content:   models.BlockContent{"text": "hello"},
+			metadata:  models.BlockMetadata{"_sync_source": "block", "spans": []interface{}{}},
+		},
+		{
+			name:      "Non string text",
+			blockType: models.TextBlock,
+			content:   models.BlockContent{"text": 42.0},
+			fields:    []string{"content.text"},
+		},
+		{
+			name:      "Task without text",
+			blockType: models.TaskBlock,
+			content:   models.BlockContent{},
+			metadata:  models.BlockMetadata{"is_completed": "yes"},
+			fields:    []string{"content.text", "metadata.is_completed"},
+		},
+		{
+			name:      "Heading level set by the importer",
+			blockType: models.HeadingBlock,
+			content:   models.BlockContent{"text": "Title"},
+			metadata:  models.BlockMetadata{"level": 2},
+		},
+		{
+			name:      "Heading level banana",
+			blockType: models.HeadingBlock,
+			content:   models.BlockContent{"text": "Title"},
+			metadata:  models.BlockMetadata{"level": "banana"},
+			fields:    []string{"metadata.level"},
+		},
+		{
+			name:      "Heading level out of range",
+			blockType: models.HeadingBlock,
+			content:   models.BlockContent{"text": "Title"},
+			metadata:  models.BlockMetadata{"level": float64(7)},
+			fields:    []string{"metadata.level"},
+		},
+		{
+			name:      "Null metadata is ignored",
+			blockType: models.HeadingBlock,
+			content:   models.BlockContent{"text": "Title"},
+			metadata:  models.BlockMetadata{"level": nil},
+		},
+		{
+			name:      "Malformed spans",
+			blockType: models.TextBlock,
+			content:   models.BlockContent{"text": "bold"},
+			metadata:  models.BlockMetadata{"spans": []interface{}{"bold"}},
+			fields:    []string{"metadata.spans[0]"},
+		},
+		{
+			name:      "Unknown list style",
+			blockType: models.ListItemBlock,
+			content:   models.BlockContent{"text": "item"},
+			metadata:  models.BlockMetadata{"item_type": "dotted"},
+			fields:    []string{"metadata.item_type"},
+		},
+		{
+			name:      "Code with language",
+			blockType: models.CodeBlock,
+			content:   models.BlockContent{"text": "SELECT 1;"},
+			metadata:  models.BlockMetadata{"language": "sql"},
+		},
+		{
+			name:      "Image with dimensions",
+			blockType: models.ImageBlock,
+			content:   models.BlockContent{"url": "https://example.com/a.png", "alt": "diagram"},
+			metadata:  models.BlockMetadata{"width": float64(640), "height": float64(480)},
+		},
+		{
+			name:      "Image with script URL and fractional width",
+			blockType: models.ImageBlock,
+			content:   models.BlockContent{"url": "javascript:alert(1)"},
+			metadata:  models.BlockMetadata{"width": 10.5},
+			fields:    []string{"content.url", "metadata.width"},
+		},
+		{
+			name:      "Image from an attachment",
+			blockType: models.ImageBlock,
+			content:   models.BlockContent{"attachment_id": "8d9ac5d4-1c5e-4d57-9a4e-6f0cb5a3c1e2"},
+		},
+		{
+			name:      "Image without a source",
+			blockType: models.ImageBlock,
+			content:   models.BlockContent{"alt": "diagram"},
+			fields:    []string{"content.url"},
+		},
+		{
+			name:      "File with a bad attachment",
+			blockType: models.FileBlock,
+			content:   models.BlockContent{"attachment_id": "report.pdf", "name": "report.pdf"},
+			fields:    []string{"content.attachment_id"},
+		},
+		{
+			name:      "Table",
+			blockType: models.TableBlock,
+			content: models.BlockContent{"rows": []interface{}{
+				[]interface{}{"key", "value"},
+				[]interface{}{"a", "1"},
+			}},
+			metadata: models.BlockMetadata{"header_row": true},
+		},
+		{
+			name:      "Ragged table",
+			blockType: models.TableBlock,
+			content: models.BlockContent{"rows": []interface{}{
+				[]interface{}{"key", "value"},
+				[]interface{}{"a"},
+			}},
+			fields: []string{"content.rows[1]"},
+		},
+		{
+			name:      "Table with non string cell",
+			blockType: models.TableBlock,
+			content:   models.BlockContent{"rows": []interface{}{[]interface{}{"a", 1.0}}},
+			fields:    []string{"content.rows[0][1]"},
+		},
+		{
+			name:      "Callout with unknown variant",
+			blockType: models.CalloutBlock,
+			content:   models.BlockContent{"text": "careful"},
+			metadata:  models.BlockMetadata{"variant": "shouting"},
+			fields:    []string{"metadata.variant"},
+		},
+		{
+			name:      "Collapsed toggle",
+			blockType: models.ToggleBlock,
+			content:   models.BlockContent{"text": "More"},
+			metadata:  models.BlockMetadata{"collapsed": true},
+		},
+		{
+			name:      "Toggle with non boolean collapsed",
+			blockType: models.ToggleBlock,
+			content:   models.BlockContent{"text": "More"},
+			metadata:  models.BlockMetadata{"collapsed": "yes"},
+			fields:    []string{"metadata.collapsed"},
+		},
+		{
+			name:      "Note link",
+			blockType: models.NoteLinkBlock,
+			content:   models.BlockContent{"note_id": "9fe002da-ccea-462d-99d8-2df3c9e09407", "text": "Reading list"},
+		},
+		{
+			name:      "Note link to a title",
+			blockType: models.NoteLinkBlock,
+			content:   models.BlockContent{"note_id": "Reading list"},
+			fields:    []string{"content.note_id"},
+		},
+		{
+			name:      "Note link span without a note",
+			blockType: models.TextBlock,
+			content:   models.BlockContent{"text": "see here"},
+			metadata: models.BlockMetadata{"spans": []interface{}{
+				map[string]interface{}{"type": models.NoteLinkSpan, "start": 4.0, "end": 8.0},
+			}},
+			fields: []string{"metadata.spans[0]"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateBlock(tc.blockType, tc.content, tc.metadata)
+			if tc.fields == nil {
+				assert.NoError(t, err)
+				return
+			}
+
+			assert.ErrorIs(t, err, ErrInvalidBlockContent)
+
+			var validationErr *BlockValidationError
+			if assert.True(t, errors.As(err, &validationErr)) {
+				var fields []string
+				for _, field := range validationErr.Fields {
+					fields = append(fields, field.Field)
+				}
+				assert.Equal(t, tc.fields, fields)
+			}
+		})
+	}
+}
+
+func TestBlockSchemaRegistry_Register(t *testing.T) {
+	registry := NewBlockSchemaRegistry()
+
+	// Built-in types can't be replaced
+	err := registry.Register(models.TextBlock, BlockSchema{})
+	assert.ErrorIs(t, err, ErrResourceExists)
+
+	// Type names must fit the blocks.type column
+	err = registry.Register("a-block-type-name-that-is-too-long", BlockSchema{})
+	assert.ErrorIs(t, err, ErrInvalidInput)
+
+	err = registry.Register("mermaid", BlockSchema{
+		Content: map[string]FieldSchema{"source": {Kind: FieldString, Required: true}},
+	})
+	assert.NoError(t, err)
+	assert.Contains(t, registry.Types(), models.BlockType("mermaid"))
+
+	assert.NoError(t, registry.Validate("mermaid", models.BlockContent{"source": "graph TD"}, nil))
+	assert.ErrorIs(t, registry.Validate("mermaid", models.BlockContent{}, nil), ErrInvalidBlockContent)
+
+	// Registering on one registry leaves the others alone
+	_, found := NewBlockSchemaRegistry().Lookup("mermaid")
+	assert.False(t, found)
+}
@@ -13,6 +13,8 @@ import (
 	"owlistic-notes/owlistic/models"
 
 	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type BlockServiceInterface interface {
@@ -22,10 +24,20 @@ type BlockServiceInterface interface {
 	DeleteBlock(db *database.Database, id string, params map[string]interface{}) error
 	ListBlocksByNote(db *database.Database, noteID string, params map[string]interface{}) ([]models.Block, error)
 	GetBlocks(db *database.Database, params map[string]interface{}) ([]models.Block, error)
+	ApplyBatch(db *database.Database, noteID string, operations []BlockOperation, params map[string]interface{}) (BlockBatchResult, error)
 }
 
 type BlockService struct{}
 
+// blockOrderGap is the spacing between appended blocks, leaving plenty of
+// room for fractional inserts in between
+const blockOrderGap = 1000.0
+
+// minBlockOrderGap is the smallest gap allowed between neighbouring blocks
+// before the note is renumbered, well above where float midpoints stop
+// being distinct
+const minBlockOrderGap = 1e-6
+
 func (s *BlockService) CreateBlock(db *database.Database, blockData map[string]interface{}, params map[string]interface{}) (models.Block, error) {
 	tx := db.DB.Begin()
 	if tx.Error != nil {
@@ -67,6 +79,18 @@ func (s *BlockService) CreateBlock(db *database.Database, blockData map[string]i
 		return models.Block{}, ErrInvalidInput
 	}
 
+	noteID, err := uuid.Parse(noteIDStr)
+	if err != nil {
+		tx.Rollback()
+		return models.Block{}, ErrInvalidInput
+	}
+
+	parentID, err := resolveParentBlock(tx, noteID, uuid.Nil, models.BlockType(blockType), blockData["parent_block_id"])
+	if err != nil {
+		tx.Rollback()
+		return models.Block{}, err
+	}
+
 	// Handle order value conversion from different types to float64
 	var orderValue float64
 	if orderInterface, exists := blockData["order"]; exists {
@@ -87,19 +111,13 @@ func (s *BlockService) CreateBlock(db *database.Database, blockData map[string]i
 			orderValue = 0 // Default value for unknown types
 		}
 	} else {
-		// If no order provided, get the highest current order and add 1000
-		// This gives plenty of space for future inserts
-		var maxOrder float64
-		err := db.DB.Table("blocks").
-			Where("note_id = ?", noteIDStr).
-			Select("COALESCE(MAX(\"order\"), 0)").
-			Row().Scan(&maxOrder)
-
+		// If no order provided, append after the highest order among its siblings
+		maxOrder, err := siblingMaxOrder(db.DB, noteID, parentID)
 		if err != nil {
 			tx.Rollback()
 			return models.Block{}, err
 		}
-		orderValue = maxOrder + 1000.0
+		orderValue = maxOrder + blockOrderGap
 	}
 
 	// Process content based on input type
@@ -122,14 +140,20 @@ func (s *BlockService) CreateBlock(db *database.Database, blockData map[string]i
 		metadata["block_id"] = blockID
 	}
 
+	if err := validateBlock(models.BlockType(blockType), content, metadata); err != nil {
+		tx.Rollback()
+		return models.Block{}, err
+	}
+
 	block := models.Block{
-		ID:       blockID,
-		NoteID:   uuid.Must(uuid.Parse(noteIDStr)),
-		UserID:   userID,
-		Type:     models.BlockType(blockType),
-		Content:  content,
-		Metadata: metadata,
-		Order:    orderValue, // Use the float order value
+		ID:            blockID,
+		NoteID:        noteID,
+		UserID:        userID,
+		ParentBlockID: parentID,
+		Type:          models.BlockType(blockType),
+		Content:       content,
+		Metadata:      metadata,
+		Order:         orderValue, // Use the float order value
 	}
 
 	if err := tx.Create(&block).Error; err != nil {
@@ -137,18 +161,25 @@ func (s *BlockService) CreateBlock(db *database.Database, blockData map[string]i
 		return models.Block{}, err
 	}
 
+	if err := checkBlockAttachment(tx, block); err != nil {
+		tx.Rollback()
+		return models.Block{}, err
+	}
+
+	if err := syncNoteLinks(tx, block, nil); err != nil {
+		tx.Rollback()
+		return models.Block{}, err
+	}
+
+	if err := syncNoteTags(tx, block); err != nil {
+		tx.Rollback()
+		return models.Block{}, err
+	}
+
 	event, err := models.NewEvent(
 		string(broker.BlockCreated),
 		"block",
-		map[string]interface{}{
-			"block_id":   block.ID.String(),
-			"note_id":    block.NoteID.String(),
-			"user_id":    block.UserID.String(),
-			"block_type": string(block.Type),
-			"order":      block.Order,
-			"content":    block.Content,
-			"metadata":   block.Metadata,
-		},
+		blockCreatedEventData(block),
 	)
 
 	if err != nil {
@@ -161,6 +192,24 @@ func (s *BlockService) CreateBlock(db *database.Database, blockData map[string]i
 		return models.Block{}, err
 	}
 
+	// Only explicit orders can squeeze a block between its neighbours
+	if _, exists := blockData["order"]; exists {
+		orders, err := rebalanceBlockOrders(tx, block.NoteID)
+		if err != nil {
+			tx.Rollback()
+			return models.Block{}, err
+		}
+		if order, moved := orders[block.ID]; moved {
+			block.Order = order
+			block.Version++
+		}
+	}
+
+	if _, err := createNoteRevision(tx, block.NoteID, userID); err != nil {
+		tx.Rollback()
+		return models.Block{}, err
+	}
+
 	if err := tx.Commit().Error; err != nil {
 		tx.Rollback()
 		return models.Block{}, err
@@ -169,6 +218,306 @@ func (s *BlockService) CreateBlock(db *database.Database, blockData map[string]i
 	return block, nil
 }
 
+// rebalanceBlockOrders renumbers groups of sibling blocks of a note with
+// blockOrderGap spacing once any two neighbours in the group are closer
+// than minBlockOrderGap. Every moved block gets a block.updated event
+// carrying its new order and version. It returns the new orders by block ID, or nil
+// when no rebalancing was needed.
+func rebalanceBlockOrders(tx *gorm.DB, noteID uuid.UUID) (map[uuid.UUID]float64, error) {
+	var blocks []models.Block
+	if err := tx.Select("id", "note_id", "user_id", "parent_block_id", "order", "version").
+		Where("note_id = ?", noteID).
+		Order("\"order\" asc, created_at asc").
+		Find(&blocks).Error; err != nil {
+		return nil, err
+	}
+
+	// Orders only have to be distinct among siblings
+	var parents []uuid.UUID
+	siblings := make(map[uuid.UUID][]models.Block)
+	for _, block := range blocks {
+		parent := uuid.Nil
+		if block.ParentBlockID != nil {
+			parent = *block.ParentBlockID
+		}
+		if _, seen := siblings[parent]; !seen {
+			parents = append(parents, parent)
+		}
+		siblings[parent] = append(siblings[parent], block)
+	}
+
+	var orders map[uuid.UUID]float64
+	for _, parent := range parents {
+		group := siblings[parent]
+
+		crowded := false
+		for i := 1; i < len(group); i++ {
+			if group[i].Order-group[i-1].Order < minBlockOrderGap {
+				crowded = true
+				break
+			}
+		}
+		if !crowded {
+			continue
+		}
+
+		if orders == nil {
+			orders = make(map[uuid.UUID]float64)
+		}
+		for i, block := range group {
+			order := float64(i+1) * blockOrderGap
+			if block.Order == order {
+				continue
+			}
+
+			if err := tx.Model(&models.Block{}).Where("id = ?", block.ID).Updates(map[string]interface{}{
+				"order":   order,
+				"version": block.Version + 1,
+			}).Error; err != nil {
+				return nil, err
+			}
+			orders[block.ID] = order
+
+			if err := createEvent(tx, string(broker.BlockUpdated), "block", map[string]interface{}{
+				"block_id":   block.ID.String(),
+				"note_id":    block.NoteID.String(),
+				"user_id":    block.UserID.String(),
+				"order":      order,
+				"version":    block.Version + 1,
+				"updated_at": time.Now().UTC(),
+				"rebalanced": true,
+			}); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if orders != nil {
+		log.Printf("Rebalanced order of %d blocks in note %s", len(orders), noteID)
+	}
+	return orders, nil
+}
+
+// maxBlockDepth bounds how deeply blocks can be nested
+const maxBlockDepth = 16
+
+// resolveParentBlock checks the requested parent of a block and returns its
+// ID, or nil for a root block. The parent must be a block of the same note
+// whose type allows children. blockID is the block being moved, so that it
+// can't be nested into its own subtree; it is uuid.Nil for new blocks.
+func resolveParentBlock(tx *gorm.DB, noteID, blockID uuid.UUID, blockType models.BlockType, value interface{}) (*uuid.UUID, error) {
+	if value == nil || value == "" {
+		return nil, nil
+	}
+
+	text, ok := value.(string)
+	parentID, err := uuid.Parse(text)
+	if !ok || err != nil {
+		return nil, parentBlockError(blockType, "must be a block ID")
+	}
+
+	var parent models.Block
+	if err := tx.Select("id", "parent_block_id", "type").
+		First(&parent, "id = ? AND note_id = ?", parentID, noteID).Error; err != nil {
+		return nil, parentBlockError(blockType, "must be a block of the same note")
+	}
+
+	if schema, _ := BlockSchemaRegistryInstance.Lookup(parent.Type); !schema.AllowsChildren {
+		return nil, parentBlockError(blockType, fmt.Sprintf("cannot be a %s block", parent.Type))
+	}
+
+	// Walk up from the new parent to the root of the note
+	ancestor := parent
+	for depth := 1; ; depth++ {
+		if ancestor.ID == blockID {
+			return nil, parentBlockError(blockType, "cannot be the block itself or one of its descendants")
+		}
+		if ancestor.ParentBlockID == nil {
+			break
+		}
+		if depth >= maxBlockDepth {
+			return nil, parentBlockError(blockType, fmt.Sprintf("cannot be nested more than %d levels deep", maxBlockDepth))
+		}
+
+		var next models.Block
+		if err := tx.Select("id", "parent_block_id").First(&next, "id = ?", *ancestor.ParentBlockID).Error; err != nil {
+			return nil, err
+		}
+		ancestor = next
+	}
+
+	return &parent.ID, nil
+}
+
+func parentBlockError(blockType models.BlockType, message string) error {
+	return &BlockValidationError{
+		BlockType: blockType,
+		Fields:    []FieldError{{Field: "parent_block_id", Message: message}},
+	}
+}
+
+// siblingMaxOrder returns the highest order among the children of parentID,
+// or among the root blocks of the note when parentID is nil
+func siblingMaxOrder(db *gorm.DB, noteID uuid.UUID, parentID *uuid.UUID) (float64, error) {
+	query := db.Table("blocks").Where("note_id = ? AND deleted_at IS NULL", noteID)
+	if parentID == nil {
+		query = query.Where("parent_block_id IS NULL")
+	} else {
+		query = query.Where("parent_block_id = ?", *parentID)
+	}
+
+	var maxOrder float64
+	err := query.Select("COALESCE(MAX(\"order\"), 0)").Row().Scan(&maxOrder)
+	return maxOrder, err
+}
+
+// Ways of handling the children of a deleted block
+const (
+	DeleteChildrenCascade  = "cascade"
+	DeleteChildrenReparent = "reparent"
+)
+
+// deleteBlockChildren handles the descendants of a block that is being
+// deleted: with DeleteChildrenCascade they are deleted along with it, with
+// DeleteChildrenReparent its children take its place among its siblings.
+// extra is added to every event payload. It returns the IDs of the blocks
+// that were deleted or moved.
+func deleteBlockChildren(tx *gorm.DB, block models.Block, mode string, extra map[string]interface{}) ([]uuid.UUID, error) {
+	var blocks []models.Block
+	if err := tx.Select("id", "note_id", "user_id", "parent_block_id", "order", "version").
+		Where("note_id = ?", block.NoteID).
+		Order("\"order\" asc").
+		Find(&blocks).Error; err != nil {
+		return nil, err
+	}
+
+	children := make(map[uuid.UUID][]models.Block)
+	for _, candidate := range blocks {
+		if candidate.ParentBlockID != nil {
+			children[*candidate.ParentBlockID] = append(children[*candidate.ParentBlockID], candidate)
+		}
+	}
+
+	if len(children[block.ID]) == 0 {
+		return nil, nil
+	}
+
+	if mode == DeleteChildrenReparent {
+		return reparentChildren(tx, block, blocks, children[block.ID], extra)
+	}
+
+	// Collect the whole subtree, parents before their children
+	var subtree []models.Block
+	pending := children[block.ID]
+	for len(pending) > 0 {
+		next := pending[0]
+		pending = append(pending[1:], children[next.ID]...)
+		subtree = append(subtree, next)
+	}
+
+	ids := make([]uuid.UUID, len(subtree))
+	for i, descendant := range subtree {
+		ids[i] = descendant.ID
+	}
+	if err := tx.Where("id IN ?", ids).Delete(&models.Block{}).Error; err != nil {
+		return nil, err
+	}
+
+	if err := removeNoteLinks(tx, ids); err != nil {
+		return nil, err
+	}
+
+	for _, descendant := range subtree {
+		data := map[string]interface{}{
+			"block_id": descendant.ID.String(),
+			"note_id":  descendant.NoteID.String(),
+			"user_id":  descendant.UserID.String(),
+		}
+		for key, value := range extra {
+			data[key] = value
+		}
+		if err := createEvent(tx, string(broker.BlockDeleted), "block", data); err != nil {
+			return nil, err
+		}
+	}
+
+	return ids, nil
+}
+
+// reparentChildren moves the children of a deleted block up one level,
+// spreading them over the gap between the block and its next sibling
+func reparentChildren(tx *gorm.DB, block models.Block, blocks []models.Block, children []models.Block, extra map[string]interface{}) ([]uuid.UUID, error) {
+	gap := blockOrderGap
+	for _, sibling := range blocks {
+		if sibling.ID != block.ID && sameParent(sibling.ParentBlockID, block.ParentBlockID) && sibling.Order > block.Order {
+			gap = (sibling.Order - block.Order) / float64(len(children))
+			break
+		}
+	}
+
+	ids := make([]uuid.UUID, len(children))
+	for i, child := range children {
+		order := block.Order + gap*float64(i)
+		if err := tx.Model(&models.Block{}).Where("id = ?", child.ID).Updates(map[string]interface{}{
+			"parent_block_id": parentBlockIDValue(block.ParentBlockID),
+			"order":           order,
+			"version":         child.Version + 1,
+		}).Error; err != nil {
+			return nil, err
+		}
+		ids[i] = child.ID
+
+		data := map[string]interface{}{
+			"block_id":        child.ID.String(),
+			"note_id":         child.NoteID.String(),
+			"user_id":         child.UserID.String(),
+			"parent_block_id": parentBlockIDValue(block.ParentBlockID),
+			"order":           order,
+			"version":         child.Version + 1,
+			"updated_at":      time.Now().UTC(),
+		}
+		for key, value := range extra {
+			data[key] = value
+		}
+		if err := createEvent(tx, string(broker.BlockUpdated), "block", data); err != nil {
+			return nil, err
+		}
+	}
+
+	return ids, nil
+}
+
+// blockCreatedEventData builds the payload of a block.created event
+func blockCreatedEventData(block models.Block) map[string]interface{} {
+	return map[string]interface{}{
+		"block_id":        block.ID.String(),
+		"note_id":         block.NoteID.String(),
+		"user_id":         block.UserID.String(),
+		"block_type":      string(block.Type),
+		"parent_block_id": parentBlockIDValue(block.ParentBlockID),
+		"order":           block.Order,
+		"version":         block.Version,
+		"content":         block.Content,
+		"metadata":        block.Metadata,
+	}
+}
+
+// parentBlockIDValue renders a parent block ID for event payloads, nil for root blocks
+func parentBlockIDValue(parentID *uuid.UUID) interface{} {
+	if parentID == nil {
+		return nil
+	}
+	return parentID.String()
+}
+
+// sameParent reports whether two optional parent block IDs are equal
+func sameParent(a, b *uuid.UUID) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
 func (s *BlockService) GetBlockById(db *database.Database, id string, params map[string]interface{}) (models.Block, error) {
 	// Get user ID from params for permission check
 	userIDStr, ok := params["user_id"].(string)
@@ -206,12 +555,20 @@ func (s *BlockService) UpdateBlock(db *database.Database, id string, blockData m
 		return models.Block{}, errors.New("user_id must be provided in parameters")
 	}
 
-	// Get block to determine the note ID
+	expected, err := expectedVersion(blockData)
+	if err != nil {
+		tx.Rollback()
+		return models.Block{}, err
+	}
+
+	// Get block to determine the note ID, locked so its version can't move
+	// until the update is committed
 	var block models.Block
-	if err := tx.First(&block, "id = ?", id).Error; err != nil {
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&block, "id = ?", id).Error; err != nil {
 		tx.Rollback()
 		return models.Block{}, ErrBlockNotFound
 	}
+	previousLinks := block.GetLinkedNoteIDs()
 
 	// Check if user has editor access to the parent note using the new method
 	hasAccess, err := RoleServiceInstance.HasBlockAccess(db, userIDStr, id, "editor")
@@ -225,10 +582,17 @@ func (s *BlockService) UpdateBlock(db *database.Database, id string, blockData m
 		return models.Block{}, errors.New("not authorized to update this block")
 	}
 
+	if err := checkVersion(expected, block.Version, block); err != nil {
+		tx.Rollback()
+		return models.Block{}, err
+	}
+	blockData["version"] = block.Version + 1
+
 	eventData := map[string]interface{}{
 		"block_id":   block.ID.String(),
 		"note_id":    block.NoteID.String(),
 		"user_id":    block.UserID.String(),
+		"version":    block.Version + 1,
 		"updated_at": time.Now().UTC(),
 	}
 
@@ -259,6 +623,55 @@ func (s *BlockService) UpdateBlock(db *database.Database, id string, blockData m
 		eventData["type"] = blockType
 	}
 
+	// Moving a block under another parent carries its subtree along, and
+	// appends it after its new siblings unless an order is given
+	if parentValue, exists := blockData["parent_block_id"]; exists {
+		parentID, err := resolveParentBlock(tx, block.NoteID, block.ID, block.Type, parentValue)
+		if err != nil {
+			tx.Rollback()
+			return models.Block{}, err
+		}
+
+		blockData["parent_block_id"] = parentBlockIDValue(parentID)
+		eventData["parent_block_id"] = parentBlockIDValue(parentID)
+
+		if _, hasOrder := blockData["order"]; !hasOrder && !sameParent(parentID, block.ParentBlockID) {
+			maxOrder, err := siblingMaxOrder(tx, block.NoteID, parentID)
+			if err != nil {
+				tx.Rollback()
+				return models.Block{}, err
+			}
+			blockData["order"] = maxOrder + blockOrderGap
+		}
+	}
+
+	if order, exists := blockData["order"]; exists {
+		eventData["order"] = order
+	}
+
+	// Validate the block as it will look once the update is applied
+	updatedType := block.Type
+	if blockType, exists := blockData["type"]; exists {
+		typeName, ok := blockType.(string)
+		if !ok {
+			tx.Rollback()
+			return models.Block{}, ErrInvalidBlockType
+		}
+		updatedType = models.BlockType(typeName)
+	}
+	updatedContent := block.Content
+	if content, ok := blockData["content"].(models.BlockContent); ok {
+		updatedContent = content
+	}
+	updatedMetadata := block.Metadata
+	if metadata, ok := blockData["metadata"].(models.BlockMetadata); ok {
+		updatedMetadata = metadata
+	}
+	if err := validateBlock(updatedType, updatedContent, updatedMetadata); err != nil {
+		tx.Rollback()
+		return models.Block{}, err
+	}
+
 	// Create the event
 	event, err := models.NewEvent(
 		string(broker.BlockUpdated), // Use standard event type
@@ -288,6 +701,44 @@ func (s *BlockService) UpdateBlock(db *database.Database, id string, blockData m
 		return models.Block{}, err
 	}
 
+	if err := checkBlockAttachment(tx, block); err != nil {
+		tx.Rollback()
+		return models.Block{}, err
+	}
+
+	if err := syncNoteLinks(tx, block, previousLinks); err != nil {
+		tx.Rollback()
+		return models.Block{}, err
+	}
+
+	if err := syncNoteTags(tx, block); err != nil {
+		tx.Rollback()
+		return models.Block{}, err
+	}
+
+	if _, exists := blockData["order"]; exists {
+		orders, err := rebalanceBlockOrders(tx, block.NoteID)
+		if err != nil {
+			tx.Rollback()
+			return models.Block{}, err
+		}
+		if order, moved := orders[block.ID]; moved {
+			block.Order = order
+			block.Version++
+		}
+	}
+
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		tx.Rollback()
+		return models.Block{}, ErrInvalidInput
+	}
+
+	if _, err := createNoteRevision(tx, block.NoteID, userID); err != nil {
+		tx.Rollback()
+		return models.Block{}, err
+	}
+
 	if err := tx.Commit().Error; err != nil {
 		tx.Rollback()
 		return models.Block{}, err
@@ -329,6 +780,16 @@ func (s *BlockService) DeleteBlock(db *database.Database, id string, params map[
 		return errors.New("not authorized to delete this block")
 	}
 
+	// Nested blocks are deleted along with the block unless asked to move up
+	childrenMode, _ := params["children"].(string)
+	if childrenMode == "" {
+		childrenMode = DeleteChildrenCascade
+	}
+	if childrenMode != DeleteChildrenCascade && childrenMode != DeleteChildrenReparent {
+		tx.Rollback()
+		return ErrInvalidInput
+	}
+
 	// With proper ON DELETE CASCADE constraints, deleting the block
 	// will automatically delete its tasks
 	if err := tx.Delete(&block).Error; err != nil {
@@ -336,6 +797,26 @@ func (s *BlockService) DeleteBlock(db *database.Database, id string, params map[
 		return err
 	}
 
+	affected, err := deleteBlockChildren(tx, block, childrenMode, nil)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if len(block.GetLinkedNoteIDs()) > 0 {
+		if err := removeNoteLinks(tx, []uuid.UUID{block.ID}); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	if childrenMode == DeleteChildrenReparent && len(affected) > 0 {
+		if _, err := rebalanceBlockOrders(tx, block.NoteID); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
 	// Create an event entry instead of directly publishing
 	event, err := models.NewEvent(
 		string(broker.BlockDeleted), // Use standard event type
@@ -357,6 +838,17 @@ func (s *BlockService) DeleteBlock(db *database.Database, id string, params map[
 		return err
 	}
 
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		tx.Rollback()
+		return ErrInvalidInput
+	}
+
+	if _, err := createNoteRevision(tx, block.NoteID, userID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
 	if err := tx.Commit().Error; err != nil {
 		tx.Rollback()
 		return err
@@ -386,7 +878,12 @@ func (s *BlockService) ListBlocksByNote(db *database.Database, noteID string, pa
 	if err := db.DB.Where("note_id = ?", noteID).Order("\"order\" asc").Find(&blocks).Error; err != nil {
 		return nil, err
 	}
-	return blocks, nil
+
+	// Nested blocks are returned under their parents, or flattened in page order
+	if tree, _ := params["tree"].(bool); tree {
+		return models.BuildBlockTree(blocks), nil
+	}
+	return models.SortBlocksDepthFirst(blocks), nil
 }
 
 func (s *BlockService) GetBlocks(db *database.Database, params map[string]interface{}) ([]models.Block, error) {
@@ -509,6 +1006,488 @@ func (s *BlockService) GetBlocks(db *database.Database, params map[string]interf
 	return blocks, nil
 }
 
+// Batch operation kinds
+const (
+	BlockOpCreate = "create"
+	BlockOpUpdate = "update"
+	BlockOpDelete = "delete"
+	BlockOpMove   = "move"
+)
+
+// maxBatchOperations bounds the number of operations applied in one batch
+const maxBatchOperations = 500
+
+// BlockOperation is a single step of a batch applied to the blocks of a note.
+// Creates may carry a client generated block_id so that later operations in
+// the same batch can refer to the new block. An empty parent_block_id moves
+// a block back to the top level; deletes take a children mode.
+type BlockOperation struct {
+	Op            string                 `json:"op"`
+	BlockID       string                 `json:"block_id,omitempty"`
+	ParentBlockID *string                `json:"parent_block_id,omitempty"`
+	Type          string                 `json:"type,omitempty"`
+	Content       map[string]interface{} `json:"content,omitempty"`
+	Metadata      map[string]interface{} `json:"metadata,omitempty"`
+	Order         *float64               `json:"order,omitempty"`
+	Children      string                 `json:"children,omitempty"`
+	// ExpectedVersion makes an update fail with a conflict when the block
+	// has changed since the client read it
+	ExpectedVersion *int64 `json:"expected_version,omitempty"`
+}
+
+// BlockOperationResult is the outcome of one batch operation
+type BlockOperationResult struct {
+	Op      string        `json:"op"`
+	BlockID uuid.UUID     `json:"block_id"`
+	Block   *models.Block `json:"block,omitempty"`
+}
+
+// BlockBatchResult is the outcome of a batch. Every event written by the
+// batch carries its batch_id so clients can recognise their own changes.
+type BlockBatchResult struct {
+	BatchID uuid.UUID              `json:"batch_id"`
+	Results []BlockOperationResult `json:"results"`
+}
+
+// blockBatch holds the state of a batch while it is being applied
+type blockBatch struct {
+	tx     *gorm.DB
+	id     uuid.UUID
+	noteID uuid.UUID
+	userID uuid.UUID
+	// maxOrders caches the highest order among the children of each parent,
+	// uuid.Nil standing for the top level of the note
+	maxOrders map[uuid.UUID]float64
+	blocks    map[uuid.UUID]*models.Block
+	deleted   map[uuid.UUID]bool
+	// reordered is set once an operation places a block at an explicit order
+	reordered bool
+}
+
+// ApplyBatch applies an ordered list of block operations to a note in a
+// single transaction, so that either all of them or none are applied
+func (s *BlockService) ApplyBatch(db *database.Database, noteID string, operations []BlockOperation, params map[string]interface{}) (BlockBatchResult, error) {
+	if len(operations) == 0 || len(operations) > maxBatchOperations {
+		return BlockBatchResult{}, ErrInvalidInput
+	}
+
+	userIDStr, ok := params["user_id"].(string)
+	if !ok {
+		return BlockBatchResult{}, errors.New("user_id must be provided in parameters")
+	}
+
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return BlockBatchResult{}, ErrInvalidInput
+	}
+
+	noteUUID, err := uuid.Parse(noteID)
+	if err != nil {
+		return BlockBatchResult{}, ErrInvalidInput
+	}
+
+	// A single access check covers every operation, each block is verified to belong to the note
+	hasAccess, err := RoleServiceInstance.HasNoteAccess(db, userIDStr, noteID, "editor")
+	if err != nil {
+		return BlockBatchResult{}, err
+	}
+
+	if !hasAccess {
+		return BlockBatchResult{}, errors.New("not authorized to edit blocks of this note")
+	}
+
+	tx := db.DB.Begin()
+	if tx.Error != nil {
+		return BlockBatchResult{}, tx.Error
+	}
+
+	var note models.Note
+	if err := tx.First(&note, "id = ?", noteUUID).Error; err != nil {
+		tx.Rollback()
+		return BlockBatchResult{}, ErrNoteNotFound
+	}
+
+	batch := &blockBatch{
+		tx:        tx,
+		id:        uuid.New(),
+		noteID:    noteUUID,
+		userID:    userID,
+		maxOrders: make(map[uuid.UUID]float64),
+		blocks:    make(map[uuid.UUID]*models.Block),
+		deleted:   make(map[uuid.UUID]bool),
+	}
+
+	result := BlockBatchResult{
+		BatchID: batch.id,
+		Results: make([]BlockOperationResult, 0, len(operations)),
+	}
+
+	for i, operation := range operations {
+		opResult, err := batch.apply(operation)
+		if err != nil {
+			tx.Rollback()
+			return BlockBatchResult{}, fmt.Errorf("operation %d (%s): %w", i, operation.Op, err)
+		}
+		result.Results = append(result.Results, opResult)
+	}
+
+	if batch.reordered {
+		orders, err := rebalanceBlockOrders(tx, noteUUID)
+		if err != nil {
+			tx.Rollback()
+			return BlockBatchResult{}, err
+		}
+		for i := range result.Results {
+			if block := result.Results[i].Block; block != nil {
+				if order, moved := orders[block.ID]; moved {
+					block.Order = order
+					block.Version++
+				}
+			}
+		}
+	}
+
+	if _, err := createNoteRevision(tx, noteUUID, userID); err != nil {
+		tx.Rollback()
+		return BlockBatchResult{}, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		tx.Rollback()
+		return BlockBatchResult{}, err
+	}
+
+	return result, nil
+}
+
+// apply performs a single batch operation and writes its event
+func (b *blockBatch) apply(operation BlockOperation) (BlockOperationResult, error) {
+	switch operation.Op {
+	case BlockOpCreate:
+		return b.create(operation)
+	case BlockOpUpdate:
+		return b.update(operation)
+	case BlockOpDelete:
+		return b.delete(operation)
+	case BlockOpMove:
+		if operation.Order == nil && operation.ParentBlockID == nil {
+			return BlockOperationResult{}, ErrInvalidInput
+		}
+		return b.update(BlockOperation{
+			Op:            BlockOpMove,
+			BlockID:       operation.BlockID,
+			ParentBlockID: operation.ParentBlockID,
+			Order:         operation.Order,
+		})
+	default:
+		return BlockOperationResult{}, ErrInvalidInput
+	}
+}
+
+func (b *blockBatch) create(operation BlockOperation) (BlockOperationResult, error) {
+	if operation.Type == "" {
+		return BlockOperationResult{}, ErrInvalidBlockType
+	}
+
+	if operation.Content == nil {
+		return BlockOperationResult{}, ErrInvalidInput
+	}
+
+	blockID := uuid.New()
+	if operation.BlockID != "" {
+		id, err := uuid.Parse(operation.BlockID)
+		if err != nil {
+			return BlockOperationResult{}, ErrInvalidInput
+		}
+		blockID = id
+	}
+
+	var parentID *uuid.UUID
+	if operation.ParentBlockID != nil {
+		var err error
+		parentID, err = resolveParentBlock(b.tx, b.noteID, uuid.Nil, models.BlockType(operation.Type), *operation.ParentBlockID)
+		if err != nil {
+			return BlockOperationResult{}, err
+		}
+	}
+
+	var order float64
+	if operation.Order != nil {
+		order = *operation.Order
+		b.reordered = true
+	} else {
+		maxOrder, err := b.siblingMaxOrder(parentID)
+		if err != nil {
+			return BlockOperationResult{}, err
+		}
+		order = maxOrder + blockOrderGap
+	}
+
+	metadata := models.BlockMetadata{}
+	if operation.Metadata != nil {
+		metadata = models.BlockMetadata(operation.Metadata)
+		metadata["_sync_source"] = "block"
+		metadata["block_id"] = blockID
+	}
+
+	if err := validateBlock(models.BlockType(operation.Type), operation.Content, metadata); err != nil {
+		return BlockOperationResult{}, err
+	}
+
+	block := &models.Block{
+		ID:            blockID,
+		NoteID:        b.noteID,
+		UserID:        b.userID,
+		ParentBlockID: parentID,
+		Type:          models.BlockType(operation.Type),
+		Content:       models.BlockContent(operation.Content),
+		Metadata:      metadata,
+		Order:         order,
+	}
+
+	if err := b.tx.Create(block).Error; err != nil {
+		return BlockOperationResult{}, err
+	}
+
+	if err := checkBlockAttachment(b.tx, *block); err != nil {
+		return BlockOperationResult{}, err
+	}
+
+	if err := syncNoteLinks(b.tx, *block, nil); err != nil {
+		return BlockOperationResult{}, err
+	}
+
+	if err := syncNoteTags(b.tx, *block); err != nil {
+		return BlockOperationResult{}, err
+	}
+
+	b.placed(block)
+	b.blocks[block.ID] = block
+
+	data := blockCreatedEventData(*block)
+	data["batch_id"] = b.id.String()
+	if err := createEvent(b.tx, string(broker.BlockCreated), "block", data); err != nil {
+		return BlockOperationResult{}, err
+	}
+
+	return b.result(operation.Op, block), nil
+}
+
+func (b *blockBatch) update(operation BlockOperation) (BlockOperationResult, error) {
+	block, err := b.load(operation.BlockID)
+	if err != nil {
+		return BlockOperationResult{}, err
+	}
+	if err := checkVersion(operation.ExpectedVersion, block.Version, *block); err != nil {
+		return BlockOperationResult{}, err
+	}
+	previousLinks := block.GetLinkedNoteIDs()
+
+	updates := map[string]interface{}{}
+	eventData := map[string]interface{}{
+		"block_id":   block.ID.String(),
+		"note_id":    block.NoteID.String(),
+		"user_id":    block.UserID.String(),
+		"updated_at": time.Now().UTC(),
+		"batch_id":   b.id.String(),
+	}
+
+	if operation.Type != "" {
+		block.Type = models.BlockType(operation.Type)
+		updates["type"] = block.Type
+		eventData["type"] = operation.Type
+	}
+	if operation.Content != nil {
+		block.Content = models.BlockContent(operation.Content)
+		updates["content"] = block.Content
+		eventData["content"] = block.Content
+	}
+	if operation.Metadata != nil {
+		block.Metadata = models.BlockMetadata(operation.Metadata)
+		updates["metadata"] = block.Metadata
+		eventData["metadata"] = block.Metadata
+	}
+	if operation.ParentBlockID != nil {
+		parentID, err := resolveParentBlock(b.tx, b.noteID, block.ID, block.Type, *operation.ParentBlockID)
+		if err != nil {
+			return BlockOperationResult{}, err
+		}
+
+		// A block moved under a new parent goes last unless an order is given
+		if !sameParent(parentID, block.ParentBlockID) && operation.Order == nil {
+			maxOrder, err := b.siblingMaxOrder(parentID)
+			if err != nil {
+				return BlockOperationResult{}, err
+			}
+			block.Order = maxOrder + blockOrderGap
+			updates["order"] = block.Order
+			eventData["order"] = block.Order
+		}
+
+		block.ParentBlockID = parentID
+		updates["parent_block_id"] = parentBlockIDValue(parentID)
+		eventData["parent_block_id"] = parentBlockIDValue(parentID)
+	}
+	if operation.Order != nil {
+		block.Order = *operation.Order
+		updates["order"] = block.Order
+		eventData["order"] = block.Order
+		b.reordered = true
+	}
+
+	if len(updates) == 0 {
+		return BlockOperationResult{}, ErrInvalidInput
+	}
+
+	if err := validateBlock(block.Type, block.Content, block.Metadata); err != nil {
+		return BlockOperationResult{}, err
+	}
+
+	block.Version++
+	updates["version"] = block.Version
+	eventData["version"] = block.Version
+
+	if err := b.tx.Model(block).Updates(updates).Error; err != nil {
+		return BlockOperationResult{}, err
+	}
+
+	if err := checkBlockAttachment(b.tx, *block); err != nil {
+		return BlockOperationResult{}, err
+	}
+
+	if err := syncNoteLinks(b.tx, *block, previousLinks); err != nil {
+		return BlockOperationResult{}, err
+	}
+
+	if err := syncNoteTags(b.tx, *block); err != nil {
+		return BlockOperationResult{}, err
+	}
+
+	b.placed(block)
+
+	if err := createEvent(b.tx, string(broker.BlockUpdated), "block", eventData); err != nil {
+		return BlockOperationResult{}, err
+	}
+
+	return b.result(operation.Op, block), nil
+}
+
+func (b *blockBatch) delete(operation BlockOperation) (BlockOperationResult, error) {
+	block, err := b.load(operation.BlockID)
+	if err != nil {
+		return BlockOperationResult{}, err
+	}
+
+	mode := operation.Children
+	if mode == "" {
+		mode = DeleteChildrenCascade
+	}
+	if mode != DeleteChildrenCascade && mode != DeleteChildrenReparent {
+		return BlockOperationResult{}, ErrInvalidInput
+	}
+
+	if err := b.tx.Delete(block).Error; err != nil {
+		return BlockOperationResult{}, err
+	}
+	b.deleted[block.ID] = true
+
+	affected, err := deleteBlockChildren(b.tx, *block, mode, map[string]interface{}{"batch_id": b.id.String()})
+	if err != nil {
+		return BlockOperationResult{}, err
+	}
+
+	if len(block.GetLinkedNoteIDs()) > 0 {
+		if err := removeNoteLinks(b.tx, []uuid.UUID{block.ID}); err != nil {
+			return BlockOperationResult{}, err
+		}
+	}
+	for _, id := range affected {
+		if mode == DeleteChildrenCascade {
+			b.deleted[id] = true
+		} else {
+			// Moved children are reloaded if a later operation needs them
+			delete(b.blocks, id)
+			b.reordered = true
+		}
+	}
+	if len(affected) > 0 {
+		// Sibling groups changed, recompute their highest orders on demand
+		b.maxOrders = make(map[uuid.UUID]float64)
+	}
+
+	if err := createEvent(b.tx, string(broker.BlockDeleted), "block", map[string]interface{}{
+		"block_id": block.ID.String(),
+		"note_id":  block.NoteID.String(),
+		"user_id":  block.UserID.String(),
+		"batch_id": b.id.String(),
+	}); err != nil {
+		return BlockOperationResult{}, err
+	}
+
+	return BlockOperationResult{Op: operation.Op, BlockID: block.ID}, nil
+}
+
+// siblingMaxOrder returns the highest order among the children of parentID
+func (b *blockBatch) siblingMaxOrder(parentID *uuid.UUID) (float64, error) {
+	key := uuid.Nil
+	if parentID != nil {
+		key = *parentID
+	}
+
+	if maxOrder, ok := b.maxOrders[key]; ok {
+		return maxOrder, nil
+	}
+
+	maxOrder, err := siblingMaxOrder(b.tx, b.noteID, parentID)
+	if err != nil {
+		return 0, err
+	}
+	b.maxOrders[key] = maxOrder
+	return maxOrder, nil
+}
+
+// placed records the position of a block so that later appends go after it
+func (b *blockBatch) placed(block *models.Block) {
+	key := uuid.Nil
+	if block.ParentBlockID != nil {
+		key = *block.ParentBlockID
+	}
+
+	if maxOrder, ok := b.maxOrders[key]; ok && block.Order > maxOrder {
+		b.maxOrders[key] = block.Order
+	}
+}
+
+// load returns a block of the batch's note, including blocks created earlier in the batch
+func (b *blockBatch) load(id string) (*models.Block, error) {
+	blockID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, ErrInvalidInput
+	}
+
+	if b.deleted[blockID] {
+		return nil, ErrBlockNotFound
+	}
+
+	if block, ok := b.blocks[blockID]; ok {
+		return block, nil
+	}
+
+	var block models.Block
+	if err := b.tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&block, "id = ? AND note_id = ?", blockID, b.noteID).Error; err != nil {
+		return nil, ErrBlockNotFound
+	}
+
+	b.blocks[blockID] = &block
+	return &block, nil
+}
+
+// result snapshots the block so later operations don't alter earlier results
+func (b *blockBatch) result(op string, block *models.Block) BlockOperationResult {
+	copied := *block
+	return BlockOperationResult{Op: op, BlockID: block.ID, Block: &copied}
+}
+
 // NewBlockService creates a new instance of BlockService
 func NewBlockService() BlockServiceInterface {
 	return &BlockService{}
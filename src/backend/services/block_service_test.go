@@ -1,12 +1,14 @@
 package services
 
 import (
+	"errors"
 	"regexp"
 	"testing"
 	"time"
 
 	"owlistic-notes/owlistic/database"
 	"owlistic-notes/owlistic/models"
+	"owlistic-notes/owlistic/testutils"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/google/uuid"
@@ -338,3 +340,291 @@ func TestGetBlocks_Success(t *testing.T) {
 	assert.Equal(t, "Test Content 2", blocks[1].Content["text"])
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
+
+func TestApplyBatch_Success(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	userID := uuid.New()
+	noteID := uuid.New()
+	existingID := uuid.New()
+	removedID := uuid.New()
+	now := time.Now()
+
+	mock.ExpectQuery("SELECT count\\(\\*\\) FROM \"roles\"").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT (.+) FROM \"notes\" WHERE id = (.+)").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "title"}).
+			AddRow(noteID.String(), userID.String(), "Pasted"))
+	mock.ExpectQuery("SELECT COALESCE\\(MAX\\(\"order\"\\), 0\\) FROM \"blocks\"").
+		WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(2000))
+
+	// create
+	mock.ExpectQuery("INSERT INTO \"blocks\"").
+		WillReturnRows(sqlmock.NewRows([]string{"created_at", "updated_at"}).AddRow(now, now))
+	expectEventInsert(mock, "block.created")
+
+	// move
+	mock.ExpectQuery("SELECT (.+) FROM \"blocks\" WHERE \\(id = (.+) AND note_id = (.+)\\)").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "note_id", "type", "content", "metadata", "order"}).
+			AddRow(existingID.String(), userID.String(), noteID.String(), "text", []byte(`{"text":"a"}`), []byte(`{}`), 1000))
+	mock.ExpectExec("UPDATE \"blocks\" SET (.+)").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectEventInsert(mock, "block.updated")
+
+	// delete
+	mock.ExpectQuery("SELECT (.+) FROM \"blocks\" WHERE \\(id = (.+) AND note_id = (.+)\\)").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "note_id", "type", "content", "metadata", "order"}).
+			AddRow(removedID.String(), userID.String(), noteID.String(), "text", []byte(`{"text":"b"}`), []byte(`{}`), 2000))
+	mock.ExpectExec("UPDATE \"blocks\" SET \"deleted_at\"=(.+)").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	// The deleted block has no children
+	mock.ExpectQuery("SELECT \"id\",\"note_id\",\"user_id\",\"parent_block_id\",\"order\",\"version\" FROM \"blocks\" WHERE note_id = (.+) ORDER BY \"order\" asc").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "note_id", "user_id", "parent_block_id", "order"}).
+			AddRow(existingID.String(), noteID.String(), userID.String(), nil, 500))
+	expectEventInsert(mock, "block.deleted")
+
+	// The move leaves enough room between neighbours, so nothing is renumbered
+	mock.ExpectQuery("SELECT \"id\",\"note_id\",\"user_id\",\"parent_block_id\",\"order\",\"version\" FROM \"blocks\" WHERE note_id = (.+) ORDER BY \"order\" asc, created_at asc").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "note_id", "user_id", "parent_block_id", "order"}).
+			AddRow(existingID.String(), noteID.String(), userID.String(), nil, 500).
+			AddRow(uuid.New().String(), noteID.String(), userID.String(), nil, 3000))
+
+	// The whole batch is recorded as one revision
+	mock.ExpectQuery("SELECT (.+) FROM \"notes\" WHERE id = (.+)").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "title"}).
+			AddRow(noteID.String(), userID.String(), "Pasted"))
+	mock.ExpectQuery("SELECT (.+) FROM \"blocks\" WHERE \"blocks\".\"note_id\" = (.+)").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "note_id"}))
+	mock.ExpectQuery("SELECT \"id\",\"revision\",\"user_id\",\"created_at\" FROM \"note_revisions\" WHERE note_id = (.+) ORDER BY revision DESC LIMIT").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "revision", "user_id", "created_at"}).
+			AddRow(uuid.New().String(), 1, uuid.New().String(), now))
+	mock.ExpectQuery("INSERT INTO \"note_revisions\"").
+		WillReturnRows(sqlmock.NewRows([]string{"created_at"}).AddRow(now))
+
+	mock.ExpectCommit()
+
+	order := 500.0
+	service := &BlockService{}
+	result, err := service.ApplyBatch(db, noteID.String(), []BlockOperation{
+		{Op: BlockOpCreate, Type: "text", Content: map[string]interface{}{"text": "pasted"}},
+		{Op: BlockOpMove, BlockID: existingID.String(), Order: &order},
+		{Op: BlockOpDelete, BlockID: removedID.String()},
+	}, map[string]interface{}{
+		"user_id": userID.String(),
+	})
+
+	assert.NoError(t, err)
+	if assert.Len(t, result.Results, 3) {
+		assert.Equal(t, 3000.0, result.Results[0].Block.Order)
+		assert.Equal(t, 500.0, result.Results[1].Block.Order)
+		assert.Equal(t, removedID, result.Results[2].BlockID)
+		assert.Nil(t, result.Results[2].Block)
+	}
+	assert.NotEqual(t, uuid.Nil, result.BatchID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestApplyBatch_RollsBackOnFailure(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	userID := uuid.New()
+	noteID := uuid.New()
+	now := time.Now()
+
+	mock.ExpectQuery("SELECT count\\(\\*\\) FROM \"roles\"").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT (.+) FROM \"notes\" WHERE id = (.+)").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "title"}).
+			AddRow(noteID.String(), userID.String(), "Pasted"))
+	mock.ExpectQuery("SELECT COALESCE\\(MAX\\(\"order\"\\), 0\\) FROM \"blocks\"").
+		WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(0))
+
+	mock.ExpectQuery("INSERT INTO \"blocks\"").
+		WillReturnRows(sqlmock.NewRows([]string{"created_at", "updated_at"}).AddRow(now, now))
+	expectEventInsert(mock, "block.created")
+
+	// The second operation targets a block outside the note
+	mock.ExpectQuery("SELECT (.+) FROM \"blocks\" WHERE \\(id = (.+) AND note_id = (.+)\\)").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectRollback()
+
+	service := &BlockService{}
+	_, err := service.ApplyBatch(db, noteID.String(), []BlockOperation{
+		{Op: BlockOpCreate, Type: "text", Content: map[string]interface{}{"text": "first"}},
+		{Op: BlockOpDelete, BlockID: uuid.New().String()},
+	}, map[string]interface{}{
+		"user_id": userID.String(),
+	})
+
+	assert.ErrorIs(t, err, ErrBlockNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestApplyBatch_VersionConflict(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	userID := uuid.New()
+	noteID := uuid.New()
+	blockID := uuid.New()
+
+	mock.ExpectQuery("SELECT count\\(\\*\\) FROM \"roles\"").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT (.+) FROM \"notes\" WHERE id = (.+)").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "title"}).
+			AddRow(noteID.String(), userID.String(), "Shared"))
+
+	// Someone else saved the block twice since the client read version 3
+	mock.ExpectQuery("SELECT (.+) FROM \"blocks\" WHERE \\(id = (.+) AND note_id = (.+)\\) (.+) FOR UPDATE").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "note_id", "type", "content", "metadata", "order", "version"}).
+			AddRow(blockID.String(), userID.String(), noteID.String(), "text", []byte(`{"text":"theirs"}`), []byte(`{}`), 1000, 5))
+	mock.ExpectRollback()
+
+	expected := int64(3)
+	service := &BlockService{}
+	_, err := service.ApplyBatch(db, noteID.String(), []BlockOperation{
+		{Op: BlockOpUpdate, BlockID: blockID.String(), Content: map[string]interface{}{"text": "mine"}, ExpectedVersion: &expected},
+	}, map[string]interface{}{
+		"user_id": userID.String(),
+	})
+
+	assert.ErrorIs(t, err, ErrVersionConflict)
+	var conflict *VersionConflictError
+	if assert.ErrorAs(t, err, &conflict) {
+		current := conflict.Current.(models.Block)
+		assert.Equal(t, int64(5), current.Version)
+		assert.Equal(t, "theirs", current.Content["text"])
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestApplyBatch_InvalidOperation(t *testing.T) {
+	service := &BlockService{}
+	_, err := service.ApplyBatch(&database.Database{}, uuid.New().String(), nil, map[string]interface{}{
+		"user_id": uuid.New().String(),
+	})
+	assert.ErrorIs(t, err, ErrInvalidInput)
+}
+
+func TestApplyBatch_RebalancesCrowdedOrders(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	userID := uuid.New()
+	noteID := uuid.New()
+	firstID := uuid.New()
+	movedID := uuid.New()
+	lastID := uuid.New()
+	now := time.Now()
+
+	mock.ExpectQuery("SELECT count\\(\\*\\) FROM \"roles\"").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT (.+) FROM \"notes\" WHERE id = (.+)").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "title"}).
+			AddRow(noteID.String(), userID.String(), "Crowded"))
+	mock.ExpectQuery("SELECT (.+) FROM \"blocks\" WHERE \\(id = (.+) AND note_id = (.+)\\)").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "note_id", "type", "content", "metadata", "order"}).
+			AddRow(movedID.String(), userID.String(), noteID.String(), "text", []byte(`{"text":"squeezed"}`), []byte(`{}`), 1001))
+	mock.ExpectExec("UPDATE \"blocks\" SET (.+)").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectEventInsert(mock, "block.updated")
+
+	// The moved block ends up a hair away from its neighbour
+	mock.ExpectQuery("SELECT \"id\",\"note_id\",\"user_id\",\"parent_block_id\",\"order\",\"version\" FROM \"blocks\" WHERE note_id = (.+)").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "note_id", "user_id", "parent_block_id", "order", "version"}).
+			AddRow(firstID.String(), noteID.String(), userID.String(), nil, 1000, 1).
+			AddRow(movedID.String(), noteID.String(), userID.String(), nil, 1000.0000000001, 2).
+			AddRow(lastID.String(), noteID.String(), userID.String(), nil, 1001, 4))
+
+	// The first block already sits at its rebalanced order
+	mock.ExpectExec("UPDATE \"blocks\" SET \"order\"=(.+),\"version\"=(.+)").
+		WithArgs(2000.0, int64(3), sqlmock.AnyArg(), movedID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectEventInsert(mock, "block.updated")
+	mock.ExpectExec("UPDATE \"blocks\" SET \"order\"=(.+),\"version\"=(.+)").
+		WithArgs(3000.0, int64(5), sqlmock.AnyArg(), lastID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectEventInsert(mock, "block.updated")
+
+	mock.ExpectQuery("SELECT (.+) FROM \"notes\" WHERE id = (.+)").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "title"}).
+			AddRow(noteID.String(), userID.String(), "Crowded"))
+	mock.ExpectQuery("SELECT (.+) FROM \"blocks\" WHERE \"blocks\".\"note_id\" = (.+)").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "note_id"}))
+	mock.ExpectQuery("SELECT \"id\",\"revision\",\"user_id\",\"created_at\" FROM \"note_revisions\" WHERE note_id = (.+) ORDER BY revision DESC LIMIT").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "revision", "user_id", "created_at"}).
+			AddRow(uuid.New().String(), 1, uuid.New().String(), now))
+	mock.ExpectQuery("INSERT INTO \"note_revisions\"").
+		WillReturnRows(sqlmock.NewRows([]string{"created_at"}).AddRow(now))
+
+	mock.ExpectCommit()
+
+	order := 1000.0000000001
+	service := &BlockService{}
+	result, err := service.ApplyBatch(db, noteID.String(), []BlockOperation{
+		{Op: BlockOpMove, BlockID: movedID.String(), Order: &order},
+	}, map[string]interface{}{
+		"user_id": userID.String(),
+	})
+
+	assert.NoError(t, err)
+	if assert.Len(t, result.Results, 1) {
+		assert.Equal(t, 2000.0, result.Results[0].Block.Order)
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestResolveParentBlock(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	noteID := uuid.New()
+	blockID := uuid.New()
+	parentID := uuid.New()
+
+	// Top level
+	parent, err := resolveParentBlock(db.DB, noteID, blockID, models.TextBlock, "")
+	assert.NoError(t, err)
+	assert.Nil(t, parent)
+
+	// Nesting under a list item
+	mock.ExpectQuery("SELECT (.+) FROM \"blocks\" WHERE \\(id = (.+) AND note_id = (.+)\\)").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "parent_block_id", "type"}).
+			AddRow(parentID.String(), nil, "listItem"))
+	parent, err = resolveParentBlock(db.DB, noteID, blockID, models.TextBlock, parentID.String())
+	assert.NoError(t, err)
+	assert.Equal(t, &parentID, parent)
+
+	// Paragraphs can't hold children
+	mock.ExpectQuery("SELECT (.+) FROM \"blocks\" WHERE \\(id = (.+) AND note_id = (.+)\\)").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "parent_block_id", "type"}).
+			AddRow(parentID.String(), nil, "text"))
+	_, err = resolveParentBlock(db.DB, noteID, blockID, models.TextBlock, parentID.String())
+	assert.ErrorIs(t, err, ErrInvalidBlockContent)
+
+	// Moving a block under its own child
+	mock.ExpectQuery("SELECT (.+) FROM \"blocks\" WHERE \\(id = (.+) AND note_id = (.+)\\)").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "parent_block_id", "type"}).
+			AddRow(parentID.String(), blockID.String(), "toggle"))
+	mock.ExpectQuery("SELECT (.+) FROM \"blocks\" WHERE id = (.+)").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "parent_block_id"}).
+			AddRow(blockID.String(), nil))
+	_, err = resolveParentBlock(db.DB, noteID, blockID, models.ListItemBlock, parentID.String())
+
+	var validationErr *BlockValidationError
+	if assert.True(t, errors.As(err, &validationErr)) {
+		assert.Equal(t, "parent_block_id", validationErr.Fields[0].Field)
+	}
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
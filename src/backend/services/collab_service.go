@@ -0,0 +1,441 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"owlistic-notes/owlistic/broker"
+	"owlistic-notes/owlistic/database"
+	"owlistic-notes/owlistic/models"
+	"owlistic-notes/owlistic/utils/ot"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// CollabServiceInterface merges the edits several clients make to the text
+// of a block at the same time. Clients join a block's session, send their
+// edits as operations on the revision they know, and get back the edits of
+// the others, transformed to apply on top of their own.
+type CollabServiceInterface interface {
+	JoinBlock(db *database.Database, blockID string, params map[string]interface{}) (models.BlockDocument, error)
+	ApplyBlockOperation(db *database.Database, blockID string, session string, revision int, operation ot.Operation, params map[string]interface{}) (models.BlockOperation, error)
+	LeaveBlock(db *database.Database, blockID string, params map[string]interface{}) error
+}
+
+// CollabService keeps the sessions in memory, so all clients editing a block
+// must be connected to the same server
+type CollabService struct {
+	mu        sync.Mutex
+	documents map[uuid.UUID]*blockDocument
+}
+
+// blockDocument is the session of one block. Its lock is taken after the
+// service's, never before.
+type blockDocument struct {
+	mu      sync.Mutex
+	doc     *ot.Document
+	session string
+	noteID  uuid.UUID
+	// clients maps the connections that joined to whether they may edit
+	clients map[string]bool
+	// closed documents were replaced or left by everyone
+	closed bool
+}
+
+// errStaleDocument reports that the stored text moved on without the session
+var errStaleDocument = errors.New("stored block text changed outside the session")
+
+// collabParams reads the user and the client connection from params
+func collabParams(params map[string]interface{}) (uuid.UUID, string, error) {
+	userIDStr, ok := params["user_id"].(string)
+	if !ok {
+		return uuid.Nil, "", errors.New("user_id must be provided in parameters")
+	}
+
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return uuid.Nil, "", ErrInvalidInput
+	}
+
+	clientID, ok := params["client_id"].(string)
+	if !ok || clientID == "" {
+		return uuid.Nil, "", errors.New("client_id must be provided in parameters")
+	}
+
+	return userID, clientID, nil
+}
+
+// blockText returns the editable text of a block. Only blocks whose schema
+// has a "text" string can be edited together.
+func blockText(block models.Block) (string, error) {
+	schema, _ := BlockSchemaRegistryInstance.Lookup(block.Type)
+	if field, ok := schema.Content["text"]; !ok || field.Kind != FieldString {
+		return "", fmt.Errorf("%w: %s blocks have no text to edit together", ErrInvalidInput, block.Type)
+	}
+
+	text, _ := block.Content["text"].(string)
+	return text, nil
+}
+
+// JoinBlock adds the client to the block's session, starting one from the
+// stored text if needed. Clients with viewer access follow the edits of the
+// others; editors may make their own.
+func (s *CollabService) JoinBlock(db *database.Database, blockID string, params map[string]interface{}) (models.BlockDocument, error) {
+	userID, clientID, err := collabParams(params)
+	if err != nil {
+		return models.BlockDocument{}, err
+	}
+
+	id, err := uuid.Parse(blockID)
+	if err != nil {
+		return models.BlockDocument{}, ErrBlockNotFound
+	}
+
+	var block models.Block
+	if err := db.DB.First(&block, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return models.BlockDocument{}, ErrBlockNotFound
+		}
+		return models.BlockDocument{}, err
+	}
+
+	text, err := blockText(block)
+	if err != nil {
+		return models.BlockDocument{}, err
+	}
+
+	hasAccess, err := RoleServiceInstance.HasBlockAccess(db, userID.String(), blockID, "viewer")
+	if err != nil {
+		return models.BlockDocument{}, err
+	}
+
+	if !hasAccess {
+		return models.BlockDocument{}, errors.New("not authorized to access this block")
+	}
+
+	canEdit, err := RoleServiceInstance.HasBlockAccess(db, userID.String(), blockID, "editor")
+	if err != nil {
+		return models.BlockDocument{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	document := s.documents[id]
+	if document != nil {
+		document.mu.Lock()
+		if document.doc.Text != text {
+			// The block was changed through the API since; the clients of
+			// the old session learn so on their next operation
+			document.closed = true
+			document.mu.Unlock()
+			document = nil
+		}
+	}
+
+	if document == nil {
+		document = &blockDocument{
+			doc:     ot.NewDocument(text, ot.DefaultHistory),
+			session: uuid.New().String(),
+			noteID:  block.NoteID,
+			clients: make(map[string]bool),
+		}
+		document.mu.Lock()
+		s.documents[id] = document
+	}
+	defer document.mu.Unlock()
+
+	document.clients[clientID] = canEdit
+
+	return models.BlockDocument{
+		BlockID:  id,
+		NoteID:   document.noteID,
+		Session:  document.session,
+		Revision: document.doc.Revision,
+		Text:     document.doc.Text,
+	}, nil
+}
+
+// ApplyBlockOperation merges an operation the client made at revision of
+// the session into the block and stores the resulting text. The returned
+// operation applies on top of what the other clients had at the previous
+// revision. ErrCollabResync tells the client to join again.
+func (s *CollabService) ApplyBlockOperation(db *database.Database, blockID string, session string, revision int, operation ot.Operation, params map[string]interface{}) (models.BlockOperation, error) {
+	userID, clientID, err := collabParams(params)
+	if err != nil {
+		return models.BlockOperation{}, err
+	}
+
+	id, err := uuid.Parse(blockID)
+	if err != nil {
+		return models.BlockOperation{}, ErrBlockNotFound
+	}
+
+	s.mu.Lock()
+	document := s.documents[id]
+	s.mu.Unlock()
+
+	if document == nil || document.session != session {
+		return models.BlockOperation{}, ErrCollabResync
+	}
+
+	result, err := s.applyOperation(db, id, document, clientID, revision, operation)
+	if errors.Is(err, errStaleDocument) {
+		s.forget(id, document)
+		return models.BlockOperation{}, fmt.Errorf("%w: %v", ErrCollabResync, err)
+	}
+	if err != nil {
+		return models.BlockOperation{}, err
+	}
+
+	result.UserID = userID
+	return result, nil
+}
+
+func (s *CollabService) applyOperation(db *database.Database, id uuid.UUID, document *blockDocument, clientID string, revision int, operation ot.Operation) (models.BlockOperation, error) {
+	document.mu.Lock()
+	defer document.mu.Unlock()
+
+	canEdit, joined := document.clients[clientID]
+	if document.closed || !joined {
+		return models.BlockOperation{}, ErrCollabResync
+	}
+
+	if !canEdit {
+		return models.BlockOperation{}, errors.New("not authorized to update this block")
+	}
+
+	rebased, err := document.doc.Rebase(revision, operation)
+	if errors.Is(err, ot.ErrRevision) {
+		return models.BlockOperation{}, fmt.Errorf("%w: %v", ErrCollabResync, err)
+	}
+	if err != nil {
+		return models.BlockOperation{}, fmt.Errorf("%w: %v", ErrInvalidInput, err)
+	}
+
+	text, err := rebased.Apply(document.doc.Text)
+	if err != nil {
+		return models.BlockOperation{}, fmt.Errorf("%w: %v", ErrInvalidInput, err)
+	}
+
+	if err := saveBlockText(db, id, document.doc.Text, text, rebased); err != nil {
+		return models.BlockOperation{}, err
+	}
+
+	if err := document.doc.Commit(rebased); err != nil {
+		return models.BlockOperation{}, err
+	}
+
+	return models.BlockOperation{
+		BlockID:   id,
+		NoteID:    document.noteID,
+		Session:   document.session,
+		Revision:  document.doc.Revision,
+		Operation: rebased,
+	}, nil
+}
+
+// saveBlockText stores the text an operation produced, moving the
+// formatting spans along. Edits are stored one by one without events; the
+// block.updated event and the note revision follow when the session ends.
+func saveBlockText(db *database.Database, id uuid.UUID, previous string, text string, operation ot.Operation) error {
+	tx := db.DB.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+
+	var block models.Block
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&block, "id = ?", id).Error; err != nil {
+		tx.Rollback()
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errStaleDocument
+		}
+		return err
+	}
+
+	if stored, _ := block.Content["text"].(string); stored != previous {
+		tx.Rollback()
+		return errStaleDocument
+	}
+	previousLinks := block.GetLinkedNoteIDs()
+
+	content := make(models.BlockContent, len(block.Content)+1)
+	for key, value := range block.Content {
+		content[key] = value
+	}
+	content["text"] = text
+	metadata := shiftSpans(block.Metadata, operation)
+
+	if err := validateBlock(block.Type, content, metadata); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Model(&block).Updates(map[string]interface{}{
+		"content":  content,
+		"metadata": metadata,
+		"version":  block.Version + 1,
+	}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	block.Content, block.Metadata = content, metadata
+	if err := syncNoteLinks(tx, block, previousLinks); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// shiftSpans moves the formatting spans of a block with an edit of its text.
+// Text typed at either end of a span stays outside of it, and spans whose
+// text was deleted are dropped.
+func shiftSpans(metadata models.BlockMetadata, operation ot.Operation) models.BlockMetadata {
+	spans, ok := metadata["spans"].([]interface{})
+	if !ok {
+		return metadata
+	}
+
+	shifted := make([]interface{}, 0, len(spans))
+	for _, value := range spans {
+		span, ok := value.(map[string]interface{})
+		if !ok {
+			shifted = append(shifted, value)
+			continue
+		}
+		start, startOk := numberValue(span["start"])
+		end, endOk := numberValue(span["end"])
+		if !startOk || !endOk {
+			shifted = append(shifted, value)
+			continue
+		}
+
+		newStart := operation.TransformIndex(int(start), true)
+		newEnd := operation.TransformIndex(int(end), false)
+		if newEnd <= newStart {
+			continue
+		}
+
+		moved := make(map[string]interface{}, len(span))
+		for key, field := range span {
+			moved[key] = field
+		}
+		moved["start"], moved["end"] = newStart, newEnd
+		shifted = append(shifted, moved)
+	}
+
+	result := make(models.BlockMetadata, len(metadata))
+	for key, value := range metadata {
+		result[key] = value
+	}
+	result["spans"] = shifted
+	return result
+}
+
+// LeaveBlock removes the client from the block's session. When the last
+// client leaves a session that changed the block, the block.updated event
+// goes out, inline tags are picked up and the note gets a revision.
+func (s *CollabService) LeaveBlock(db *database.Database, blockID string, params map[string]interface{}) error {
+	userID, clientID, err := collabParams(params)
+	if err != nil {
+		return err
+	}
+
+	id, err := uuid.Parse(blockID)
+	if err != nil {
+		return ErrBlockNotFound
+	}
+
+	s.mu.Lock()
+	document := s.documents[id]
+	if document == nil {
+		s.mu.Unlock()
+		return nil
+	}
+
+	document.mu.Lock()
+	delete(document.clients, clientID)
+	finished := len(document.clients) == 0
+	changed := document.doc.Revision > 0 && !document.closed
+	if finished {
+		document.closed = true
+		delete(s.documents, id)
+	}
+	document.mu.Unlock()
+	s.mu.Unlock()
+
+	if !finished || !changed {
+		return nil
+	}
+	return finishBlockSession(db, id, userID)
+}
+
+// finishBlockSession does the bookkeeping the edits of a session skipped
+func finishBlockSession(db *database.Database, id uuid.UUID, userID uuid.UUID) error {
+	tx := db.DB.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+
+	var block models.Block
+	if err := tx.First(&block, "id = ?", id).Error; err != nil {
+		tx.Rollback()
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	if err := syncNoteTags(tx, block); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := createEvent(tx, string(broker.BlockUpdated), "block", map[string]interface{}{
+		"block_id":   block.ID.String(),
+		"note_id":    block.NoteID.String(),
+		"user_id":    userID.String(),
+		"content":    block.Content,
+		"metadata":   block.Metadata,
+		"version":    block.Version,
+		"updated_at": time.Now().UTC(),
+	}); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if _, err := createNoteRevision(tx, block.NoteID, userID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// forget drops a session whose document no longer matches the block
+func (s *CollabService) forget(id uuid.UUID, document *blockDocument) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	document.mu.Lock()
+	document.closed = true
+	document.mu.Unlock()
+
+	if s.documents[id] == document {
+		delete(s.documents, id)
+	}
+}
+
+// NewCollabService creates a new instance of CollabService
+func NewCollabService() CollabServiceInterface {
+	return &CollabService{documents: make(map[uuid.UUID]*blockDocument)}
+}
+
+// Don't initialize here, will be set properly in main.go
+var CollabServiceInstance CollabServiceInterface
@@ -0,0 +1,174 @@
+package services
+
+import (
+	"testing"
+
+	"owlistic-notes/owlistic/database"
+	"owlistic-notes/owlistic/testutils"
+	"owlistic-notes/owlistic/utils/ot"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+// collabAccessStub lets everyone view blocks and the listed users edit them
+type collabAccessStub struct {
+	RoleServiceInterface
+	editors map[string]bool
+}
+
+func (s *collabAccessStub) HasBlockAccess(db *database.Database, userID string, blockID string, requiredRole string) (bool, error) {
+	return requiredRole == "viewer" || s.editors[userID], nil
+}
+
+func collabBlockRows(blockID, noteID uuid.UUID, content string, metadata string) *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "note_id", "type", "content", "metadata"}).
+		AddRow(blockID.String(), noteID.String(), "text", []byte(content), []byte(metadata))
+}
+
+// expectBlockTextSaved expects the stored content and metadata to be
+// replaced with the saved ones
+func expectBlockTextSaved(mock sqlmock.Sqlmock, blockID, noteID uuid.UUID, stored, metadata, saved, savedMetadata string) {
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT \\* FROM \"blocks\" WHERE id = (.+) FOR UPDATE").
+		WillReturnRows(collabBlockRows(blockID, noteID, stored, metadata))
+	mock.ExpectExec("UPDATE \"blocks\" SET \"content\"=\\$1,\"metadata\"=\\$2,\"version\"=\\$3,\"updated_at\"=\\$4 WHERE").
+		WithArgs([]byte(saved), []byte(savedMetadata), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+}
+
+func TestCollab_ConcurrentClientsConverge(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	blockID := uuid.New()
+	noteID := uuid.New()
+	alice, bob := uuid.New().String(), uuid.New().String()
+
+	previous := RoleServiceInstance
+	RoleServiceInstance = &collabAccessStub{editors: map[string]bool{alice: true, bob: true}}
+	defer func() { RoleServiceInstance = previous }()
+
+	service := NewCollabService()
+	aliceParams := map[string]interface{}{"user_id": alice, "client_id": "alice-conn"}
+	bobParams := map[string]interface{}{"user_id": bob, "client_id": "bob-conn"}
+
+	for i := 0; i < 2; i++ {
+		mock.ExpectQuery("SELECT \\* FROM \"blocks\" WHERE id = (.+)").
+			WillReturnRows(collabBlockRows(blockID, noteID, `{"text":"Hello world"}`,
+				`{"spans":[{"start":6,"end":11,"type":"bold"}]}`))
+	}
+	aliceDoc, err := service.JoinBlock(db, blockID.String(), aliceParams)
+	assert.NoError(t, err)
+	bobDoc, err := service.JoinBlock(db, blockID.String(), bobParams)
+	assert.NoError(t, err)
+	assert.Equal(t, aliceDoc.Session, bobDoc.Session)
+
+	aliceClient := ot.NewClient(aliceDoc.Text, aliceDoc.Revision)
+	bobClient := ot.NewClient(bobDoc.Text, bobDoc.Revision)
+
+	// Both edit revision 0 at the same time
+	aliceOp, _, _ := aliceClient.Edit(ot.Operation{}.Retain(5).Insert(",").Retain(6))
+	bobOp, _, _ := bobClient.Edit(ot.Operation{}.Retain(6).Insert("dear ").Retain(5).Insert("!"))
+
+	expectBlockTextSaved(mock, blockID, noteID,
+		`{"text":"Hello world"}`, `{"spans":[{"start":6,"end":11,"type":"bold"}]}`,
+		`{"text":"Hello, world"}`, `{"spans":[{"end":12,"start":7,"type":"bold"}]}`)
+	fromAlice, err := service.ApplyBlockOperation(db, blockID.String(), aliceDoc.Session, 0, aliceOp, aliceParams)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, fromAlice.Revision)
+
+	expectBlockTextSaved(mock, blockID, noteID,
+		`{"text":"Hello, world"}`, `{"spans":[{"start":7,"end":12,"type":"bold"}]}`,
+		`{"text":"Hello, dear world!"}`, `{"spans":[{"end":17,"start":12,"type":"bold"}]}`)
+	fromBob, err := service.ApplyBlockOperation(db, blockID.String(), bobDoc.Session, 0, bobOp, bobParams)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, fromBob.Revision)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	// Each client gets its acknowledgement and the other's operation, in
+	// either order
+	assert.NoError(t, bobClient.Receive(fromAlice.Operation))
+	bobClient.Ack()
+	aliceClient.Ack()
+	assert.NoError(t, aliceClient.Receive(fromBob.Operation))
+
+	assert.Equal(t, "Hello, dear world!", aliceClient.Text)
+	assert.Equal(t, aliceClient.Text, bobClient.Text)
+	assert.Equal(t, 2, aliceClient.Revision)
+	assert.Equal(t, 2, bobClient.Revision)
+}
+
+func TestCollab_Resync(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	blockID := uuid.New()
+	noteID := uuid.New()
+	editor, viewer := uuid.New().String(), uuid.New().String()
+
+	previous := RoleServiceInstance
+	RoleServiceInstance = &collabAccessStub{editors: map[string]bool{editor: true}}
+	defer func() { RoleServiceInstance = previous }()
+
+	service := NewCollabService()
+	editorParams := map[string]interface{}{"user_id": editor, "client_id": "editor-conn"}
+	viewerParams := map[string]interface{}{"user_id": viewer, "client_id": "viewer-conn"}
+
+	for i := 0; i < 2; i++ {
+		mock.ExpectQuery("SELECT \\* FROM \"blocks\" WHERE id = (.+)").
+			WillReturnRows(collabBlockRows(blockID, noteID, `{"text":"abc"}`, `{}`))
+	}
+	doc, err := service.JoinBlock(db, blockID.String(), editorParams)
+	assert.NoError(t, err)
+	_, err = service.JoinBlock(db, blockID.String(), viewerParams)
+	assert.NoError(t, err)
+
+	op := ot.Operation{}.Retain(3).Insert("d")
+	_, err = service.ApplyBlockOperation(db, blockID.String(), doc.Session, 0, op, viewerParams)
+	assert.EqualError(t, err, "not authorized to update this block")
+
+	_, err = service.ApplyBlockOperation(db, blockID.String(), "old-session", 0, op, editorParams)
+	assert.ErrorIs(t, err, ErrCollabResync)
+
+	_, err = service.ApplyBlockOperation(db, blockID.String(), doc.Session, 0, ot.Operation{}.Retain(5), editorParams)
+	assert.ErrorIs(t, err, ErrInvalidInput)
+
+	// The block was changed through the API meanwhile
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT \\* FROM \"blocks\" WHERE id = (.+) FOR UPDATE").
+		WillReturnRows(collabBlockRows(blockID, noteID, `{"text":"xyz"}`, `{}`))
+	mock.ExpectRollback()
+	_, err = service.ApplyBlockOperation(db, blockID.String(), doc.Session, 0, op, editorParams)
+	assert.ErrorIs(t, err, ErrCollabResync)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	// Joining again starts a new session from the stored text
+	mock.ExpectQuery("SELECT \\* FROM \"blocks\" WHERE id = (.+)").
+		WillReturnRows(collabBlockRows(blockID, noteID, `{"text":"xyz"}`, `{}`))
+	rejoined, err := service.JoinBlock(db, blockID.String(), editorParams)
+	assert.NoError(t, err)
+	assert.NotEqual(t, doc.Session, rejoined.Session)
+	assert.Equal(t, "xyz", rejoined.Text)
+
+	// Leaving without edits needs no bookkeeping
+	assert.NoError(t, service.LeaveBlock(db, blockID.String(), editorParams))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestShiftSpans(t *testing.T) {
+	metadata := map[string]interface{}{
+		"spans": []interface{}{
+			map[string]interface{}{"start": float64(0), "end": float64(2), "type": "bold"},
+			map[string]interface{}{"start": float64(4), "end": float64(6), "type": "italic"},
+		},
+	}
+
+	// "abcdef": type at the end of the bold span, delete "ef"
+	shifted := shiftSpans(metadata, ot.Operation{}.Retain(2).Insert("XY").Retain(2).Delete(2))
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"start": 0, "end": 2, "type": "bold"},
+	}, shifted["spans"])
+}
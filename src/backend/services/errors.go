@@ -19,17 +19,37 @@ var (
 	ErrUnauthorized       = errors.New("unauthorized")
 
 	// Resource-specific errors
-	ErrUserNotFound      = errors.New("user not found")
-	ErrNoteNotFound      = errors.New("note not found")
-	ErrBlockNotFound     = errors.New("block not found")
-	ErrNotebookNotFound  = errors.New("notebook not found")
-	ErrTaskNotFound      = errors.New("task not found")
-	ErrEventNotFound     = errors.New("event not found")
-	ErrUserAlreadyExists = errors.New("user with that email already exists")
+	ErrUserNotFound       = errors.New("user not found")
+	ErrNoteNotFound       = errors.New("note not found")
+	ErrBlockNotFound      = errors.New("block not found")
+	ErrNotebookNotFound   = errors.New("notebook not found")
+	ErrTaskNotFound       = errors.New("task not found")
+	ErrEventNotFound      = errors.New("event not found")
+	ErrRevisionNotFound   = errors.New("revision not found")
+	ErrTagNotFound        = errors.New("tag not found")
+	ErrTemplateNotFound   = errors.New("template not found")
+	ErrJournalNotSet      = errors.New("no journal notebook set in preferences")
+	ErrNotebookCycle      = errors.New("notebook cannot be nested under itself or its descendants")
+	ErrAttachmentNotFound = errors.New("attachment not found")
+	ErrUserAlreadyExists  = errors.New("user with that email already exists")
 
 	// Type errors
-	ErrInvalidBlockType = errors.New("invalid block type")
+	ErrInvalidBlockType    = errors.New("invalid block type")
+	ErrInvalidBlockContent = errors.New("invalid block content")
+	ErrUnsupportedFormat   = errors.New("unsupported format")
+
+	// Attachment upload errors
+	ErrAttachmentTooLarge  = errors.New("attachment is too large")
+	ErrAttachmentMediaType = errors.New("attachment media type is not allowed")
+
+	// ErrVersionConflict is wrapped by VersionConflictError when an update
+	// was based on an outdated version
+	ErrVersionConflict = errors.New("resource was changed by someone else")
 
 	// Connection errors
 	ErrWebSocketConnection = errors.New("websocket connection error")
+
+	// ErrCollabResync asks a client to join a block's editing session again
+	// and start over from the text it gets
+	ErrCollabResync = errors.New("block editing session out of sync")
 )
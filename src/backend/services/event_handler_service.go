@@ -8,6 +8,8 @@ import (
 	"owlistic-notes/owlistic/broker"
 	"owlistic-notes/owlistic/database"
 	"owlistic-notes/owlistic/models"
+
+	"gorm.io/gorm"
 )
 
 type EventHandlerServiceInterface interface {
@@ -71,6 +73,10 @@ func (s *EventHandlerService) ProcessPendingEvents() {
 			return
 		}
 
+		if err := sequenceEvents(s.db.DB); err != nil {
+			log.Printf("Error sequencing events: %v", err)
+		}
+
 		var events []models.Event
 		if err := s.db.DB.Where("dispatched = ?", false).Find(&events).Error; err != nil {
 			log.Printf("Error fetching events: %v", err)
@@ -104,6 +110,10 @@ func (s *EventHandlerService) dispatchEvent(event models.Event) error {
 	// Determine resource type and ID based on entity
 	var resourceType, resourceId string
 	resourceType = event.Entity // Default resource type to entity
+	if event.Entity == "attachment" {
+		// Attachments are as visible as their note, so access is checked on it
+		resourceType = "note"
+	}
 
 	// Extract resource IDs
 	if noteId, exists := dataMap["note_id"]; exists {
@@ -141,6 +151,9 @@ func (s *EventHandlerService) dispatchEvent(event models.Event) error {
 	// Create StandardMessage with "event" as type and event.Event as the event name
 	message := models.NewStandardMessage(models.EventMessage, event.Event, dataMap).
 		WithResource(resourceType, resourceId)
+	if version, ok := dataMap["version"].(float64); ok {
+		message.WithVersion(int64(version))
+	}
 
 	// Publish the event using the StandardMessage format
 	jsonData, err := json.Marshal(message)
@@ -162,13 +175,47 @@ func (s *EventHandlerService) dispatchEvent(event models.Event) error {
 	}).Error
 }
 
+// eventSequenceLock names the advisory lock serializing sequenceEvents
+const eventSequenceLock = "events.sequence"
+
+// sequenceEvents numbers the committed events that have no sequence yet,
+// oldest first. Servers take turns, so numbers are handed out in the order
+// they become visible: once a number can be read, every lower one can be
+// too, which lets the sync feed page by it.
+func sequenceEvents(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", eventSequenceLock).Error; err != nil {
+			return err
+		}
+
+		return tx.Exec(`WITH pending AS (
+				SELECT id, row_number() OVER (ORDER BY timestamp, id) AS position
+				FROM events WHERE sequence IS NULL
+			), last AS (
+				SELECT COALESCE(MAX(sequence), 0) AS sequence FROM events
+			)
+			UPDATE events SET sequence = last.sequence + pending.position
+			FROM pending, last
+			WHERE events.id = pending.id`).Error
+	})
+}
+
+// createEvent stores an outbox event within the given transaction
+func createEvent(tx *gorm.DB, eventType string, entity string, data map[string]interface{}) error {
+	event, err := models.NewEvent(eventType, entity, data)
+	if err != nil {
+		return err
+	}
+	return tx.Create(event).Error
+}
+
 func getTopicForEvent(entity string) string {
 	switch entity {
 	case "user":
 		return broker.UserSubject
 	case "notebook":
 		return broker.NotebookSubject
-	case "note":
+	case "note", "attachment":
 		return broker.NoteSubject
 	case "block":
 		return broker.BlockSubject
@@ -1,6 +1,7 @@
 package services
 
 import (
+	"encoding/json"
 	"testing"
 	"time"
 
@@ -8,6 +9,7 @@ import (
 	"owlistic-notes/owlistic/models"
 	"owlistic-notes/owlistic/testutils"
 
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -27,6 +29,11 @@ func (m *MockProducer) PublishMessage(topic string, value string) error {
 	return args.Error(0)
 }
 
+func (m *MockProducer) Notify(topic string, value string) error {
+	args := m.Called(topic, value)
+	return args.Error(0)
+}
+
 func (m *MockProducer) CreateTopics(streamName string, topics []string) error {
 	args := m.Called(topics)
 	return args.Error(0)
@@ -96,3 +103,88 @@ func TestEventHandlerService_Lifecycle(t *testing.T) {
 	service.Stop() // Should be no-op
 	assert.False(t, service.(*EventHandlerService).isRunning)
 }
+
+func TestEventHandlerService_DispatchCarriesVersion(t *testing.T) {
+	db, dbMock, close := testutils.SetupMockDB()
+	defer close()
+
+	blockID := uuid.New()
+	var published models.StandardMessage
+	mockProducer := NewMockProducer()
+	mockProducer.On("PublishMessage", mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) {
+			assert.NoError(t, json.Unmarshal([]byte(args.String(1)), &published))
+		}).
+		Return(nil)
+
+	dbMock.ExpectBegin()
+	dbMock.ExpectExec("UPDATE \"events\" SET").
+		WillReturnResult(testutils.NewResult(1, 1))
+	dbMock.ExpectCommit()
+
+	event, err := models.NewEvent("block.updated", "block", map[string]interface{}{
+		"block_id": blockID.String(),
+		"version":  7,
+	})
+	assert.NoError(t, err)
+
+	service := &EventHandlerService{db: db, producer: mockProducer}
+	assert.NoError(t, service.dispatchEvent(*event))
+
+	assert.Equal(t, blockID.String(), published.ResourceID)
+	assert.Equal(t, int64(7), published.ResourceVersion)
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
+
+func TestEventHandlerService_DispatchAttachmentAsNote(t *testing.T) {
+	db, dbMock, close := testutils.SetupMockDB()
+	defer close()
+
+	noteID := uuid.New()
+	var topic string
+	var published models.StandardMessage
+	mockProducer := NewMockProducer()
+	mockProducer.On("PublishMessage", mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) {
+			topic = args.String(0)
+			assert.NoError(t, json.Unmarshal([]byte(args.String(1)), &published))
+		}).
+		Return(nil)
+
+	dbMock.ExpectBegin()
+	dbMock.ExpectExec("UPDATE \"events\" SET").
+		WillReturnResult(testutils.NewResult(1, 1))
+	dbMock.ExpectCommit()
+
+	event, err := models.NewEvent("attachment.created", "attachment", map[string]interface{}{
+		"attachment_id": uuid.New().String(),
+		"note_id":       noteID.String(),
+		"filename":      "secret.pdf",
+	})
+	assert.NoError(t, err)
+
+	service := &EventHandlerService{db: db, producer: mockProducer}
+	assert.NoError(t, service.dispatchEvent(*event))
+
+	assert.Equal(t, "note", topic)
+	assert.Equal(t, "note", published.ResourceType)
+	assert.Equal(t, noteID.String(), published.ResourceID)
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
+
+func TestSequenceEvents(t *testing.T) {
+	db, dbMock, close := testutils.SetupMockDB()
+	defer close()
+
+	// Numbering waits its turn and continues after the highest number
+	dbMock.ExpectBegin()
+	dbMock.ExpectExec(`SELECT pg_advisory_xact_lock\(hashtext\(\$1\)\)`).
+		WithArgs(eventSequenceLock).
+		WillReturnResult(testutils.NewResult(0, 1))
+	dbMock.ExpectExec(`UPDATE events SET sequence = last.sequence \+ pending.position`).
+		WillReturnResult(testutils.NewResult(0, 3))
+	dbMock.ExpectCommit()
+
+	assert.NoError(t, sequenceEvents(db.DB))
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
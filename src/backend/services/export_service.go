@@ -0,0 +1,179 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+
+	"owlistic-notes/owlistic/database"
+	"owlistic-notes/owlistic/models"
+	"owlistic-notes/owlistic/utils/markdown"
+
+	"gorm.io/gorm"
+)
+
+// ExportFormatMarkdown is the only export format currently supported
+const ExportFormatMarkdown = "markdown"
+
+// ExportedFile is a rendered export ready to be sent to the client
+type ExportedFile struct {
+	FileName    string
+	ContentType string
+	Data        []byte
+}
+
+type ExportServiceInterface interface {
+	ExportNote(db *database.Database, id string, params map[string]interface{}) (ExportedFile, error)
+	ExportNotebook(db *database.Database, id string, params map[string]interface{}) (ExportedFile, error)
+}
+
+type ExportService struct{}
+
+// ExportNote renders a single note to a Markdown file
+func (s *ExportService) ExportNote(db *database.Database, id string, params map[string]interface{}) (ExportedFile, error) {
+	if err := validateExportFormat(params); err != nil {
+		return ExportedFile{}, err
+	}
+
+	userIDStr, ok := params["user_id"].(string)
+	if !ok {
+		return ExportedFile{}, errors.New("user_id must be provided in parameters")
+	}
+
+	hasAccess, err := RoleServiceInstance.HasNoteAccess(db, userIDStr, id, "viewer")
+	if err != nil {
+		return ExportedFile{}, err
+	}
+
+	if !hasAccess {
+		return ExportedFile{}, errors.New("not authorized to export this note")
+	}
+
+	var note models.Note
+	if err := db.DB.Preload("Blocks", func(db *gorm.DB) *gorm.DB {
+		return db.Order("\"blocks\".\"order\" ASC")
+	}).First(&note, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ExportedFile{}, ErrNoteNotFound
+		}
+		return ExportedFile{}, err
+	}
+
+	return ExportedFile{
+		FileName:    exportFileName(note.Title, "Untitled Note") + ".md",
+		ContentType: "text/markdown; charset=utf-8",
+		Data:        []byte(markdown.RenderNote(note)),
+	}, nil
+}
+
+// ExportNotebook renders every note of a notebook to Markdown and bundles them into a zip archive
+func (s *ExportService) ExportNotebook(db *database.Database, id string, params map[string]interface{}) (ExportedFile, error) {
+	if err := validateExportFormat(params); err != nil {
+		return ExportedFile{}, err
+	}
+
+	userIDStr, ok := params["user_id"].(string)
+	if !ok {
+		return ExportedFile{}, errors.New("user_id must be provided in parameters")
+	}
+
+	hasAccess, err := RoleServiceInstance.HasNotebookAccess(db, userIDStr, id, "viewer")
+	if err != nil {
+		return ExportedFile{}, err
+	}
+
+	if !hasAccess {
+		return ExportedFile{}, errors.New("not authorized to export this notebook")
+	}
+
+	var notebook models.Notebook
+	if err := db.DB.First(&notebook, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ExportedFile{}, ErrNotebookNotFound
+		}
+		return ExportedFile{}, err
+	}
+
+	var notes []models.Note
+	if err := db.DB.Preload("Blocks", func(db *gorm.DB) *gorm.DB {
+		return db.Order("\"blocks\".\"order\" ASC")
+	}).Where("notebook_id = ?", id).Order("created_at ASC").Find(&notes).Error; err != nil {
+		return ExportedFile{}, err
+	}
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	usedNames := make(map[string]int)
+
+	for _, note := range notes {
+		name := exportFileName(note.Title, "Untitled Note")
+
+		// Disambiguate notes sharing the same title
+		usedNames[strings.ToLower(name)]++
+		if count := usedNames[strings.ToLower(name)]; count > 1 {
+			name = fmt.Sprintf("%s (%d)", name, count)
+		}
+
+		w, err := archive.Create(name + ".md")
+		if err != nil {
+			return ExportedFile{}, err
+		}
+
+		if _, err := w.Write([]byte(markdown.RenderNote(note))); err != nil {
+			return ExportedFile{}, err
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		return ExportedFile{}, err
+	}
+
+	return ExportedFile{
+		FileName:    exportFileName(notebook.Name, "Untitled Notebook") + ".zip",
+		ContentType: "application/zip",
+		Data:        buf.Bytes(),
+	}, nil
+}
+
+// validateExportFormat checks the requested format, defaulting to Markdown
+func validateExportFormat(params map[string]interface{}) error {
+	format, _ := params["format"].(string)
+	if format != "" && format != ExportFormatMarkdown {
+		return ErrUnsupportedFormat
+	}
+	return nil
+}
+
+// exportFileName turns a title into a file name that is safe on common file systems
+func exportFileName(title string, fallback string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r < 0x20:
+			return -1
+		case strings.ContainsRune(`/\:*?"<>|`, r):
+			return '-'
+		}
+		return r
+	}, title)
+
+	name = strings.Trim(strings.TrimSpace(name), ".")
+	if name == "" {
+		return fallback
+	}
+
+	// Keep file names well under common 255 byte limits
+	if runes := []rune(name); len(runes) > 100 {
+		name = strings.TrimSpace(string(runes[:100]))
+	}
+	return name
+}
+
+// NewExportService creates a new instance of ExportService
+func NewExportService() ExportServiceInterface {
+	return &ExportService{}
+}
+
+// Don't initialize here, will be set properly in main.go
+var ExportServiceInstance ExportServiceInterface
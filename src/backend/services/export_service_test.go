@@ -0,0 +1,63 @@
+package services
+
+import (
+	"testing"
+
+	"owlistic-notes/owlistic/testutils"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportNote_Success(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	userID := uuid.New()
+	noteID := uuid.New()
+
+	// Admin users pass the access check immediately
+	mock.ExpectQuery("SELECT count\\(\\*\\) FROM \"roles\"").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+	mock.ExpectQuery("SELECT (.+) FROM \"notes\" WHERE id = (.+)").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "title"}).
+			AddRow(noteID.String(), userID.String(), "Release: v1/v2"))
+
+	mock.ExpectQuery("SELECT (.+) FROM \"blocks\" WHERE \"blocks\".\"note_id\" = (.+) ORDER BY \"blocks\".\"order\" ASC").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "note_id", "type", "content", "metadata", "order"}).
+			AddRow(uuid.New().String(), noteID.String(), "header", []byte(`{"text":"Checklist"}`), []byte(`{"level":2}`), 1).
+			AddRow(uuid.New().String(), noteID.String(), "task", []byte(`{"text":"Tag release"}`), []byte(`{"is_completed":true}`), 2))
+
+	service := &ExportService{}
+	file, err := service.ExportNote(db, noteID.String(), map[string]interface{}{
+		"user_id": userID.String(),
+		"format":  "markdown",
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "Release- v1-v2.md", file.FileName)
+	assert.Equal(t, "# Release: v1/v2\n\n## Checklist\n\n- [x] Tag release\n", string(file.Data))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestExportNote_UnsupportedFormat(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	service := &ExportService{}
+	_, err := service.ExportNote(db, uuid.New().String(), map[string]interface{}{
+		"user_id": uuid.New().String(),
+		"format":  "pdf",
+	})
+
+	assert.ErrorIs(t, err, ErrUnsupportedFormat)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestExportFileName(t *testing.T) {
+	assert.Equal(t, "Meeting notes", exportFileName("  Meeting notes  ", "Untitled"))
+	assert.Equal(t, "a-b-c", exportFileName("a/b\\c", "Untitled"))
+	assert.Equal(t, "Untitled", exportFileName("..", "Untitled"))
+}
@@ -0,0 +1,273 @@
+package services
+
+import (
+	"errors"
+	"sort"
+
+	"owlistic-notes/owlistic/database"
+	"owlistic-notes/owlistic/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Graph export formats
+const (
+	GraphFormatJSON    = "json"
+	GraphFormatGraphML = "graphml"
+	GraphFormatDOT     = "dot"
+)
+
+// maxGraphDepth bounds the number of hops around a starting note
+const maxGraphDepth = 10
+
+type GraphServiceInterface interface {
+	GetGraph(db *database.Database, params map[string]interface{}) (models.Graph, error)
+}
+
+type GraphService struct{}
+
+// graphTag is a single tag of a note as returned by unnest
+type graphTag struct {
+	NoteID uuid.UUID
+	Tag    string
+}
+
+// GetGraph builds the graph of the notes the user can view, with their
+// notebooks, tags and the links between them. It can be limited to the
+// notes of one notebook and the notebooks nested in it ("notebook_id") and
+// to the nodes at most "depth" hops away from a starting note ("note_id",
+// depth defaults to 1).
+func (s *GraphService) GetGraph(db *database.Database, params map[string]interface{}) (models.Graph, error) {
+	userIDStr, ok := params["user_id"].(string)
+	if !ok {
+		return models.Graph{}, errors.New("user_id must be provided in parameters")
+	}
+
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return models.Graph{}, ErrInvalidInput
+	}
+
+	// The notebooks the graph is limited to, nil for all of them
+	var scope *gorm.DB
+	notebookID, _ := params["notebook_id"].(string)
+	if notebookID != "" {
+		parsedNotebookID, err := uuid.Parse(notebookID)
+		if err != nil {
+			return models.Graph{}, ErrInvalidInput
+		}
+
+		hasAccess, err := RoleServiceInstance.HasNotebookAccess(db, userIDStr, notebookID, "viewer")
+		if err != nil {
+			return models.Graph{}, err
+		}
+		if !hasAccess {
+			return models.Graph{}, errors.New("not authorized to access this notebook")
+		}
+		scope = notebookSubtreeQuery(db.DB, []uuid.UUID{parsedNotebookID})
+	}
+
+	startNoteID, _ := params["note_id"].(string)
+	depth, hasDepth := params["depth"].(int)
+	if startNoteID == "" {
+		if hasDepth {
+			return models.Graph{}, ErrInvalidInput
+		}
+	} else {
+		if _, err := uuid.Parse(startNoteID); err != nil {
+			return models.Graph{}, ErrInvalidInput
+		}
+		if !hasDepth {
+			depth = 1
+		}
+		if depth < 0 || depth > maxGraphDepth {
+			return models.Graph{}, ErrInvalidInput
+		}
+	}
+
+	notes, err := visibleGraphNotes(db, userID, scope)
+	if err != nil {
+		return models.Graph{}, err
+	}
+
+	graph := models.Graph{Nodes: []models.GraphNode{}, Edges: []models.GraphEdge{}}
+	if len(notes) > 0 {
+		if graph, err = buildGraph(db, userID, notes, scope); err != nil {
+			return models.Graph{}, err
+		}
+	}
+
+	if startNoteID != "" {
+		start := graphNoteID(uuid.MustParse(startNoteID))
+		found := false
+		for _, node := range graph.Nodes {
+			found = found || node.ID == start
+		}
+		if !found {
+			return models.Graph{}, ErrNoteNotFound
+		}
+		graph = graph.Within(start, depth)
+	}
+
+	return graph, nil
+}
+
+// visibleGraphNotes returns the notes the user can view, optionally only
+// those in the notebooks of scope
+func visibleGraphNotes(db *database.Database, userID uuid.UUID, scope *gorm.DB) ([]models.Note, error) {
+	query := db.DB.Select("id", "notebook_id", "title").Where("id IN (?)", viewableNotes(db.DB, userID))
+	if scope != nil {
+		query = query.Where("notebook_id IN (?)", scope)
+	}
+
+	var notes []models.Note
+	if err := query.Order("title ASC, id ASC").Find(&notes).Error; err != nil {
+		return nil, err
+	}
+	return notes, nil
+}
+
+// buildGraph adds the notebooks, tags and links of the given notes. The
+// notebooks the notes are nested in are added too, within scope unless that
+// is nil, so the graph shows the hierarchy. Notebooks the user can't view
+// are left out along with their edges.
+func buildGraph(db *database.Database, userID uuid.UUID, notes []models.Note, scope *gorm.DB) (models.Graph, error) {
+	noteIDs := make([]uuid.UUID, len(notes))
+	notebookSet := make(map[uuid.UUID]bool)
+	var notebookIDs []uuid.UUID
+	for i, note := range notes {
+		noteIDs[i] = note.ID
+		if !notebookSet[note.NotebookID] {
+			notebookSet[note.NotebookID] = true
+			notebookIDs = append(notebookIDs, note.NotebookID)
+		}
+	}
+
+	notebookQuery := db.DB.Select("id", "name", "parent_notebook_id").
+		Where("id IN (?) AND id IN (?)", notebookLineageQuery(db.DB, notebookIDs), viewableNotebooks(db.DB, userID))
+	if scope != nil {
+		notebookQuery = notebookQuery.Where("id IN (?)", scope)
+	}
+
+	var notebooks []models.Notebook
+	if err := notebookQuery.Order("name ASC, id ASC").Find(&notebooks).Error; err != nil {
+		return models.Graph{}, err
+	}
+
+	var tags []graphTag
+	if err := db.DB.Model(&models.Note{}).Select("id AS note_id, unnest(tags) AS tag").
+		Where("id IN ?", noteIDs).Scan(&tags).Error; err != nil {
+		return models.Graph{}, err
+	}
+
+	var links []models.NoteLink
+	if err := db.DB.Select("source_note_id", "target_note_id").
+		Where("source_note_id IN ? AND target_note_id IN ? AND source_deleted = ? AND target_deleted = ?",
+			noteIDs, noteIDs, false, false).
+		Find(&links).Error; err != nil {
+		return models.Graph{}, err
+	}
+
+	graph := models.Graph{Nodes: []models.GraphNode{}, Edges: []models.GraphEdge{}}
+
+	visibleNotebooks := make(map[uuid.UUID]bool)
+	for _, notebook := range notebooks {
+		visibleNotebooks[notebook.ID] = true
+		graph.Nodes = append(graph.Nodes, models.GraphNode{
+			ID:    graphNotebookID(notebook.ID),
+			Type:  models.GraphNotebookNode,
+			Label: notebook.Name,
+		})
+	}
+
+	for _, notebook := range notebooks {
+		if notebook.ParentNotebookID != nil && visibleNotebooks[*notebook.ParentNotebookID] {
+			graph.Edges = append(graph.Edges, models.GraphEdge{
+				Source: graphNotebookID(*notebook.ParentNotebookID),
+				Target: graphNotebookID(notebook.ID),
+				Type:   models.GraphContainsEdge,
+			})
+		}
+	}
+
+	// A note linked in either direction is not an orphan
+	linked := make(map[uuid.UUID]bool)
+	type notePair struct{ source, target uuid.UUID }
+	seenLinks := make(map[notePair]bool)
+	var references []models.GraphEdge
+	for _, link := range links {
+		pair := notePair{link.SourceNoteID, link.TargetNoteID}
+		if seenLinks[pair] {
+			continue
+		}
+		seenLinks[pair] = true
+		linked[link.SourceNoteID] = true
+		linked[link.TargetNoteID] = true
+		references = append(references, models.GraphEdge{
+			Source: graphNoteID(link.SourceNoteID),
+			Target: graphNoteID(link.TargetNoteID),
+			Type:   models.GraphReferenceEdge,
+		})
+	}
+
+	for _, note := range notes {
+		graph.Nodes = append(graph.Nodes, models.GraphNode{
+			ID:     graphNoteID(note.ID),
+			Type:   models.GraphNoteNode,
+			Label:  note.Title,
+			Orphan: !linked[note.ID],
+		})
+		if visibleNotebooks[note.NotebookID] {
+			graph.Edges = append(graph.Edges, models.GraphEdge{
+				Source: graphNotebookID(note.NotebookID),
+				Target: graphNoteID(note.ID),
+				Type:   models.GraphContainsEdge,
+			})
+		}
+	}
+
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].Tag < tags[j].Tag })
+	seenTags := make(map[string]bool)
+	for _, tag := range tags {
+		if tag.Tag == "" {
+			continue
+		}
+		if !seenTags[tag.Tag] {
+			seenTags[tag.Tag] = true
+			graph.Nodes = append(graph.Nodes, models.GraphNode{
+				ID:    graphTagID(tag.Tag),
+				Type:  models.GraphTagNode,
+				Label: tag.Tag,
+			})
+		}
+		graph.Edges = append(graph.Edges, models.GraphEdge{
+			Source: graphNoteID(tag.NoteID),
+			Target: graphTagID(tag.Tag),
+			Type:   models.GraphTagEdge,
+		})
+	}
+
+	graph.Edges = append(graph.Edges, references...)
+	return graph, nil
+}
+
+func graphNoteID(id uuid.UUID) string {
+	return string(models.GraphNoteNode) + ":" + id.String()
+}
+
+func graphNotebookID(id uuid.UUID) string {
+	return string(models.GraphNotebookNode) + ":" + id.String()
+}
+
+func graphTagID(tag string) string {
+	return string(models.GraphTagNode) + ":" + tag
+}
+
+// NewGraphService creates a new instance of GraphService
+func NewGraphService() GraphServiceInterface {
+	return &GraphService{}
+}
+
+// Don't initialize here, will be set properly in main.go
+var GraphServiceInstance GraphServiceInterface
@@ -0,0 +1,157 @@
+package services
+
+import (
+	"testing"
+
+	"owlistic-notes/owlistic/database"
+	"owlistic-notes/owlistic/models"
+	"owlistic-notes/owlistic/testutils"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+// graphAccessStub grants viewer access to a fixed set of notes and notebooks
+type graphAccessStub struct {
+	RoleServiceInterface
+	notes     map[string]bool
+	notebooks map[string]bool
+}
+
+func (s *graphAccessStub) HasNoteAccess(db *database.Database, userID string, noteID string, requiredRole string) (bool, error) {
+	return s.notes[noteID], nil
+}
+
+func (s *graphAccessStub) HasNotebookAccess(db *database.Database, userID string, notebookID string, requiredRole string) (bool, error) {
+	return s.notebooks[notebookID], nil
+}
+
+func TestGetGraph(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	userID := uuid.New()
+	notebookID := uuid.New()
+	specsID := uuid.New()
+	hiddenNotebookID := uuid.New()
+	overviewID := uuid.New()
+	detailsID := uuid.New()
+	scratchID := uuid.New()
+	privateID := uuid.New()
+
+	// Visibility is worked out by the queries: the private note and the
+	// hidden notebook don't come back
+	mock.ExpectQuery("SELECT \"id\",\"notebook_id\",\"title\" FROM \"notes\" WHERE id IN \\(SELECT id FROM notes WHERE user_id = (.+) OR notebook_id IN \\(WITH RECURSIVE viewable_notebooks").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "notebook_id", "title"}).
+			AddRow(detailsID.String(), specsID.String(), "Details").
+			AddRow(overviewID.String(), notebookID.String(), "Overview").
+			AddRow(scratchID.String(), hiddenNotebookID.String(), "Scratch"))
+	// The notebooks of the notes come with the ones they are nested in
+	mock.ExpectQuery("SELECT \"id\",\"name\",\"parent_notebook_id\" FROM \"notebooks\" WHERE \\(id IN \\(WITH RECURSIVE lineage (.+) AND id IN \\(WITH RECURSIVE viewable_notebooks").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "parent_notebook_id"}).
+			AddRow(notebookID.String(), "Design", nil).
+			AddRow(specsID.String(), "Specs", notebookID.String()))
+	mock.ExpectQuery("SELECT id AS note_id, unnest\\(tags\\) AS tag FROM \"notes\"").
+		WillReturnRows(sqlmock.NewRows([]string{"note_id", "tag"}).
+			AddRow(overviewID.String(), "arch").
+			AddRow(detailsID.String(), "arch"))
+	mock.ExpectQuery("SELECT \"source_note_id\",\"target_note_id\" FROM \"note_links\" WHERE").
+		WillReturnRows(sqlmock.NewRows([]string{"source_note_id", "target_note_id"}).
+			AddRow(overviewID.String(), detailsID.String()).
+			AddRow(overviewID.String(), detailsID.String()))
+
+	service := &GraphService{}
+	graph, err := service.GetGraph(db, map[string]interface{}{"user_id": userID.String()})
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	nodes := make(map[string]models.GraphNode)
+	for _, node := range graph.Nodes {
+		nodes[node.ID] = node
+	}
+	assert.Len(t, nodes, 6)
+	assert.Contains(t, nodes, "notebook:"+notebookID.String())
+	assert.Contains(t, nodes, "notebook:"+specsID.String())
+	assert.NotContains(t, nodes, "notebook:"+hiddenNotebookID.String())
+	assert.NotContains(t, nodes, "note:"+privateID.String())
+	assert.Contains(t, nodes, "tag:arch")
+	assert.False(t, nodes["note:"+overviewID.String()].Orphan)
+	assert.True(t, nodes["note:"+scratchID.String()].Orphan)
+
+	counts := make(map[models.GraphEdgeType]int)
+	for _, edge := range graph.Edges {
+		counts[edge.Type]++
+	}
+	assert.Equal(t, 3, counts[models.GraphContainsEdge])
+	assert.Contains(t, graph.Edges, models.GraphEdge{
+		Source: "notebook:" + notebookID.String(),
+		Target: "notebook:" + specsID.String(),
+		Type:   models.GraphContainsEdge,
+	})
+	assert.Equal(t, 2, counts[models.GraphTagEdge])
+	assert.Equal(t, 1, counts[models.GraphReferenceEdge])
+}
+
+func TestGetGraph_NotebookIncludesNestedNotebooks(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	userID := uuid.New()
+	notebookID := uuid.New()
+	specsID := uuid.New()
+	detailsID := uuid.New()
+
+	previous := RoleServiceInstance
+	RoleServiceInstance = &graphAccessStub{notebooks: map[string]bool{notebookID.String(): true}}
+	defer func() { RoleServiceInstance = previous }()
+
+	// The notes of the notebooks nested in the one asked for are included
+	mock.ExpectQuery("SELECT \"id\",\"notebook_id\",\"title\" FROM \"notes\" WHERE id IN (.+) AND notebook_id IN \\(WITH RECURSIVE subtree").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "notebook_id", "title"}).
+			AddRow(detailsID.String(), specsID.String(), "Details"))
+	// The notebooks above the one asked for stay out
+	mock.ExpectQuery("SELECT \"id\",\"name\",\"parent_notebook_id\" FROM \"notebooks\" WHERE (.+) AND id IN \\(WITH RECURSIVE subtree").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "parent_notebook_id"}).
+			AddRow(notebookID.String(), "Design", nil).
+			AddRow(specsID.String(), "Specs", notebookID.String()))
+	mock.ExpectQuery("SELECT id AS note_id, unnest\\(tags\\) AS tag FROM \"notes\"").
+		WillReturnRows(sqlmock.NewRows([]string{"note_id", "tag"}))
+	mock.ExpectQuery("SELECT \"source_note_id\",\"target_note_id\" FROM \"note_links\" WHERE").
+		WillReturnRows(sqlmock.NewRows([]string{"source_note_id", "target_note_id"}))
+
+	service := &GraphService{}
+	graph, err := service.GetGraph(db, map[string]interface{}{
+		"user_id":     userID.String(),
+		"notebook_id": notebookID.String(),
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	assert.Len(t, graph.Nodes, 3)
+	assert.ElementsMatch(t, []models.GraphEdge{
+		{Source: "notebook:" + notebookID.String(), Target: "notebook:" + specsID.String(), Type: models.GraphContainsEdge},
+		{Source: "notebook:" + specsID.String(), Target: "note:" + detailsID.String(), Type: models.GraphContainsEdge},
+	}, graph.Edges)
+}
+
+func TestGetGraph_InvalidParams(t *testing.T) {
+	service := &GraphService{}
+	userID := uuid.New().String()
+
+	_, err := service.GetGraph(&database.Database{}, map[string]interface{}{})
+	assert.Error(t, err)
+
+	_, err = service.GetGraph(&database.Database{}, map[string]interface{}{"user_id": userID, "notebook_id": "abc"})
+	assert.ErrorIs(t, err, ErrInvalidInput)
+
+	_, err = service.GetGraph(&database.Database{}, map[string]interface{}{"user_id": userID, "depth": 2})
+	assert.ErrorIs(t, err, ErrInvalidInput)
+
+	_, err = service.GetGraph(&database.Database{}, map[string]interface{}{
+		"user_id": userID,
+		"note_id": uuid.New().String(),
+		"depth":   maxGraphDepth + 1,
+	})
+	assert.ErrorIs(t, err, ErrInvalidInput)
+}
@@ -0,0 +1,150 @@
+package services
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"owlistic-notes/owlistic/broker"
+	"owlistic-notes/owlistic/database"
+	"owlistic-notes/owlistic/models"
+	"owlistic-notes/owlistic/utils/markdown"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ImportedFile is an uploaded file to be turned into a note
+type ImportedFile struct {
+	FileName string
+	Data     []byte
+}
+
+type ImportServiceInterface interface {
+	ImportMarkdown(db *database.Database, notebookID string, files []ImportedFile, params map[string]interface{}) ([]models.Note, error)
+}
+
+type ImportService struct{}
+
+// ImportMarkdown creates one note per Markdown file in the given notebook.
+// All notes are created in a single transaction so a bad file imports nothing.
+func (s *ImportService) ImportMarkdown(db *database.Database, notebookID string, files []ImportedFile, params map[string]interface{}) ([]models.Note, error) {
+	if len(files) == 0 {
+		return nil, ErrInvalidInput
+	}
+
+	userIDStr, ok := params["user_id"].(string)
+	if !ok {
+		return nil, errors.New("user_id must be provided in parameters")
+	}
+
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return nil, ErrInvalidInput
+	}
+
+	for _, file := range files {
+		if !utf8.Valid(file.Data) {
+			return nil, ErrUnsupportedFormat
+		}
+	}
+
+	hasAccess, err := RoleServiceInstance.HasNotebookAccess(db, userIDStr, notebookID, "editor")
+	if err != nil {
+		return nil, err
+	}
+
+	if !hasAccess {
+		return nil, errors.New("not authorized to import into this notebook")
+	}
+
+	var notebook models.Notebook
+	if err := db.DB.First(&notebook, "id = ?", notebookID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotebookNotFound
+		}
+		return nil, err
+	}
+
+	tx := db.DB.Begin()
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+
+	notes := make([]models.Note, 0, len(files))
+	for _, file := range files {
+		note, err := importMarkdownNote(tx, notebook.ID, userID, file)
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		notes = append(notes, note)
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	return notes, nil
+}
+
+// importMarkdownNote creates a note with its parsed blocks through
+// createNoteTx, emitting the same events as BlockService.CreateBlock too
+func importMarkdownNote(tx *gorm.DB, notebookID uuid.UUID, userID uuid.UUID, file ImportedFile) (models.Note, error) {
+	doc := markdown.Parse(string(file.Data))
+
+	title := strings.TrimSpace(doc.Title)
+	if title == "" {
+		base := filepath.Base(filepath.ToSlash(file.FileName))
+		title = strings.TrimSpace(strings.TrimSuffix(base, filepath.Ext(base)))
+	}
+
+	note := models.Note{
+		ID:         uuid.New(),
+		UserID:     userID,
+		NotebookID: notebookID,
+		Title:      title,
+	}
+
+	// Every note starts with at least one block, as in CreateNote
+	blocks := doc.Blocks
+	if len(blocks) == 0 {
+		blocks = []models.Block{{Type: models.TextBlock, Content: models.BlockContent{"text": ""}}}
+	}
+
+	for i := range blocks {
+		block := &blocks[i]
+		block.ID = uuid.New()
+		block.Order = float64(i+1) * blockOrderGap
+		if block.Metadata == nil {
+			block.Metadata = models.BlockMetadata{}
+		}
+		block.Metadata["_sync_source"] = "block"
+		block.Metadata["block_id"] = block.ID
+	}
+
+	// Inline #tags of the imported blocks become the note's tags
+	note, err := createNoteTx(tx, note, blocks, nil)
+	if err != nil {
+		return models.Note{}, err
+	}
+
+	// Block events let the sync handler create tasks for imported task blocks
+	for _, block := range note.Blocks {
+		if err := createEvent(tx, string(broker.BlockCreated), "block", blockCreatedEventData(block)); err != nil {
+			return models.Note{}, err
+		}
+	}
+
+	return note, nil
+}
+
+// NewImportService creates a new instance of ImportService
+func NewImportService() ImportServiceInterface {
+	return &ImportService{}
+}
+
+// Don't initialize here, will be set properly in main.go
+var ImportServiceInstance ImportServiceInterface
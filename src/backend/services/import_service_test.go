@@ -0,0 +1,86 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"owlistic-notes/owlistic/models"
+	"owlistic-notes/owlistic/testutils"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImportMarkdown_Success(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	userID := uuid.New()
+	notebookID := uuid.New()
+	now := time.Now()
+
+	// Admin users pass the access check immediately
+	mock.ExpectQuery("SELECT count\\(\\*\\) FROM \"roles\"").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+	mock.ExpectQuery("SELECT (.+) FROM \"notebooks\" WHERE id = (.+)").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name"}).
+			AddRow(notebookID.String(), userID.String(), "Wiki"))
+
+	mock.ExpectBegin()
+
+	mock.ExpectQuery(`INSERT INTO "notes"`).
+		WithArgs(userID.String(), notebookID.String(), "Runbook", nil, 1, nil, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"created_at", "updated_at"}).AddRow(now, now))
+
+	mock.ExpectExec(`INSERT INTO "roles"`).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	for i := 0; i < 2; i++ {
+		mock.ExpectQuery(`INSERT INTO "blocks"`).
+			WillReturnRows(sqlmock.NewRows([]string{"created_at", "updated_at"}).AddRow(now, now))
+	}
+
+	for _, eventName := range []string{"note.created", "block.created", "block.created"} {
+		mock.ExpectQuery(`INSERT INTO "events"`).
+			WithArgs(eventName, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), "pending", false, nil, sqlmock.AnyArg()).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(uuid.New().String()))
+	}
+
+	mock.ExpectCommit()
+
+	service := &ImportService{}
+	notes, err := service.ImportMarkdown(db, notebookID.String(), []ImportedFile{
+		{FileName: "wiki/Runbook.md", Data: []byte("## Deploy\n\n- [x] Tag release\n")},
+	}, map[string]interface{}{
+		"user_id": userID.String(),
+	})
+
+	assert.NoError(t, err)
+	if assert.Len(t, notes, 1) {
+		assert.Equal(t, "Runbook", notes[0].Title)
+		if assert.Len(t, notes[0].Blocks, 2) {
+			assert.Equal(t, models.HeadingBlock, notes[0].Blocks[0].Type)
+			assert.Equal(t, models.TaskBlock, notes[0].Blocks[1].Type)
+			assert.Equal(t, 2*blockOrderGap, notes[0].Blocks[1].Order)
+			assert.Equal(t, true, notes[0].Blocks[1].Metadata["is_completed"])
+		}
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestImportMarkdown_InvalidEncoding(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	service := &ImportService{}
+	_, err := service.ImportMarkdown(db, uuid.New().String(), []ImportedFile{
+		{FileName: "binary.md", Data: []byte{0xff, 0xfe, 0x00}},
+	}, map[string]interface{}{
+		"user_id": uuid.New().String(),
+	})
+
+	assert.ErrorIs(t, err, ErrUnsupportedFormat)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,380 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"owlistic-notes/owlistic/broker"
+	"owlistic-notes/owlistic/database"
+	"owlistic-notes/owlistic/models"
+	"owlistic-notes/owlistic/utils/dateformat"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type JournalServiceInterface interface {
+	GetPeriodicNote(db *database.Database, period string, date string, params map[string]interface{}) (models.Note, bool, error)
+}
+
+type JournalService struct{}
+
+// journalSettings are the journal preferences of a user for one period.
+// They live in User.Preferences as
+//
+//	"timezone": "Europe/Berlin",
+//	"journal": {
+//	  "notebook_id": "...",
+//	  "daily":  {"title_format": "dddd, MMMM D", "template_id": "...", "roll_forward_tasks": true},
+//	  "weekly": {...}, "monthly": {...}
+//	}
+type journalSettings struct {
+	NotebookID       string
+	Location         *time.Location
+	TitleFormat      string
+	TemplateID       string
+	RollForwardTasks bool
+}
+
+// GetPeriodicNote returns the user's journal note for the period containing
+// date (YYYY-MM-DD, today in the user's timezone when empty), creating it in
+// the journal notebook if there is none yet. The boolean reports whether the
+// note was created.
+func (s *JournalService) GetPeriodicNote(db *database.Database, period string, date string, params map[string]interface{}) (models.Note, bool, error) {
+	userIDStr, ok := params["user_id"].(string)
+	if !ok {
+		return models.Note{}, false, errors.New("user_id must be provided in parameters")
+	}
+
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return models.Note{}, false, ErrInvalidInput
+	}
+
+	journalPeriod, ok := models.ParseJournalPeriod(period)
+	if !ok {
+		return models.Note{}, false, fmt.Errorf("%w: period must be daily, weekly or monthly", ErrInvalidInput)
+	}
+
+	var user models.User
+	if err := db.DB.First(&user, "id = ?", userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return models.Note{}, false, ErrUserNotFound
+		}
+		return models.Note{}, false, err
+	}
+
+	settings, err := userJournalSettings(user.Preferences, journalPeriod)
+	if err != nil {
+		return models.Note{}, false, err
+	}
+
+	day := time.Now().In(settings.Location)
+	if date != "" {
+		day, err = time.ParseInLocation("2006-01-02", date, settings.Location)
+		if err != nil {
+			return models.Note{}, false, fmt.Errorf("%w: date must be YYYY-MM-DD", ErrInvalidInput)
+		}
+	}
+	start := journalPeriod.Start(day)
+
+	noteID, err := journalNoteID(db.DB, userID, journalPeriod, start)
+	if err != nil {
+		return models.Note{}, false, err
+	}
+
+	if noteID != uuid.Nil {
+		note, err := NoteServiceInstance.GetNoteById(db, noteID.String(), params)
+		// A note that was deleted or trashed is replaced by a new one
+		if !errors.Is(err, ErrNoteNotFound) {
+			return note, false, err
+		}
+	}
+
+	pending, err := newJournalNote(db, settings, start, userID)
+	if err != nil {
+		return models.Note{}, false, err
+	}
+
+	// Tasks are only taken from a note the user may still edit
+	previousID := uuid.Nil
+	if journalPeriod == models.JournalDaily && settings.RollForwardTasks {
+		previousID, err = journalNoteID(db.DB, userID, journalPeriod, start.AddDate(0, 0, -1))
+		if err != nil {
+			return models.Note{}, false, err
+		}
+
+		if previousID != uuid.Nil {
+			hasAccess, err := RoleServiceInstance.HasNoteAccess(db, userIDStr, previousID.String(), "editor")
+			if err != nil {
+				return models.Note{}, false, err
+			}
+			if !hasAccess {
+				previousID = uuid.Nil
+			}
+		}
+	}
+
+	tx := db.DB.Begin()
+	if tx.Error != nil {
+		return models.Note{}, false, tx.Error
+	}
+
+	note, err := pending.create(tx)
+	if err != nil {
+		tx.Rollback()
+		return models.Note{}, false, err
+	}
+
+	// Only the entry seen above is replaced. When a concurrent request has
+	// recorded its note first, nothing is written and that note is returned.
+	entry := models.JournalEntry{
+		ID:     uuid.New(),
+		UserID: userID,
+		Period: journalPeriod,
+		Date:   start.Format("2006-01-02"),
+		NoteID: note.ID,
+	}
+	result := tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "period"}, {Name: "date"}},
+		Where:     clause.Where{Exprs: []clause.Expression{clause.Eq{Column: clause.Column{Table: "journal_entries", Name: "note_id"}, Value: noteID}}},
+		DoUpdates: clause.AssignmentColumns([]string{"note_id"}),
+	}).Create(&entry)
+	if result.Error != nil {
+		tx.Rollback()
+		return models.Note{}, false, result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+
+		noteID, err := journalNoteID(db.DB, userID, journalPeriod, start)
+		if err != nil {
+			return models.Note{}, false, err
+		}
+		note, err := NoteServiceInstance.GetNoteById(db, noteID.String(), params)
+		return note, false, err
+	}
+
+	if previousID != uuid.Nil {
+		if err := rollForwardTasks(tx, previousID, note.ID, userID); err != nil {
+			tx.Rollback()
+			return models.Note{}, false, err
+		}
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		tx.Rollback()
+		return models.Note{}, false, err
+	}
+
+	note, err = NoteServiceInstance.GetNoteById(db, note.ID.String(), params)
+	return note, true, err
+}
+
+// userJournalSettings reads the journal preferences for the period
+func userJournalSettings(preferences models.UserPreferences, period models.JournalPeriod) (journalSettings, error) {
+	settings := journalSettings{
+		Location:    time.UTC,
+		TitleFormat: period.DefaultTitleFormat(),
+	}
+
+	if timezone, _ := preferences["timezone"].(string); timezone != "" {
+		location, err := time.LoadLocation(timezone)
+		if err != nil {
+			return journalSettings{}, fmt.Errorf("%w: unknown timezone %q", ErrInvalidInput, timezone)
+		}
+		settings.Location = location
+	}
+
+	journal, _ := preferences["journal"].(map[string]interface{})
+	settings.NotebookID, _ = journal["notebook_id"].(string)
+
+	periodSettings, _ := journal[string(period)].(map[string]interface{})
+	if format, _ := periodSettings["title_format"].(string); format != "" {
+		settings.TitleFormat = format
+	}
+	settings.TemplateID, _ = periodSettings["template_id"].(string)
+	settings.RollForwardTasks, _ = periodSettings["roll_forward_tasks"].(bool)
+
+	return settings, nil
+}
+
+// journalNoteID returns the note recorded for the period starting at start,
+// or uuid.Nil if there is none
+func journalNoteID(db *gorm.DB, userID uuid.UUID, period models.JournalPeriod, start time.Time) (uuid.UUID, error) {
+	var entry models.JournalEntry
+	err := db.Where("user_id = ? AND period = ? AND date = ?", userID, period, start.Format("2006-01-02")).
+		First(&entry).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return uuid.Nil, nil
+	}
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return entry.NoteID, nil
+}
+
+// newJournalNote prepares the note for the period starting at start in
+// the journal notebook, from the period's template if one is set
+func newJournalNote(db *database.Database, settings journalSettings, start time.Time, userID uuid.UUID) (templateNote, error) {
+	if settings.NotebookID == "" {
+		return templateNote{}, ErrJournalNotSet
+	}
+
+	title := dateformat.Format(start, settings.TitleFormat)
+
+	if settings.TemplateID != "" {
+		return newTemplateNote(db, settings.NotebookID, settings.TemplateID, map[string]interface{}{
+			"title": title,
+			"date":  start.Format("2006-01-02"),
+		}, userID)
+	}
+
+	notebookID, err := uuid.Parse(settings.NotebookID)
+	if err != nil {
+		return templateNote{}, fmt.Errorf("%w: journal notebook_id must be a UUID", ErrInvalidInput)
+	}
+
+	hasAccess, err := RoleServiceInstance.HasNotebookAccess(db, userID.String(), settings.NotebookID, "editor")
+	if err != nil {
+		return templateNote{}, err
+	}
+
+	if !hasAccess {
+		return templateNote{}, errors.New("not authorized to add notes to this notebook")
+	}
+
+	// Without a template the note starts with an empty block, as in CreateNote
+	return templateNote{note: models.Note{
+		ID:         uuid.New(),
+		UserID:     userID,
+		NotebookID: notebookID,
+		Title:      title,
+	}}, nil
+}
+
+// rollForwardTasks moves the unfinished task blocks of one note, with the
+// blocks nested under them, to the end of another. The blocks keep their
+// IDs and their tasks follow them, so due dates and descriptions stay.
+func rollForwardTasks(tx *gorm.DB, fromNoteID, toNoteID uuid.UUID, userID uuid.UUID) error {
+	var blocks []models.Block
+	if err := tx.Where("note_id = ?", fromNoteID).Order("\"order\" asc").Find(&blocks).Error; err != nil {
+		return err
+	}
+
+	moved := make(map[uuid.UUID]bool)
+	var rolled []models.Block
+	for _, block := range models.SortBlocksDepthFirst(blocks) {
+		unfinished := block.Type == models.TaskBlock && !block.IsTaskCompleted()
+		if unfinished || (block.ParentBlockID != nil && moved[*block.ParentBlockID]) {
+			moved[block.ID] = true
+			rolled = append(rolled, block)
+		}
+	}
+
+	if len(rolled) == 0 {
+		return nil
+	}
+
+	maxOrder, err := siblingMaxOrder(tx, toNoteID, nil)
+	if err != nil {
+		return err
+	}
+
+	blockIDs := make([]string, 0, len(rolled))
+	for _, block := range rolled {
+		block.NoteID = toNoteID
+		block.Version++
+
+		updates := map[string]interface{}{
+			"note_id": toNoteID,
+			"version": block.Version,
+		}
+		eventData := map[string]interface{}{
+			"block_id":   block.ID.String(),
+			"note_id":    toNoteID.String(),
+			"user_id":    block.UserID.String(),
+			"version":    block.Version,
+			"updated_at": time.Now().UTC(),
+		}
+
+		// The outermost moved blocks go after the blocks the note starts
+		// with; nested ones stay under their moved parents
+		if block.ParentBlockID == nil || !moved[*block.ParentBlockID] {
+			maxOrder += blockOrderGap
+			block.ParentBlockID = nil
+			block.Order = maxOrder
+
+			updates["parent_block_id"] = nil
+			updates["order"] = block.Order
+			eventData["parent_block_id"] = nil
+			eventData["order"] = block.Order
+		}
+
+		if err := tx.Model(&models.Block{}).Where("id = ?", block.ID).Updates(updates).Error; err != nil {
+			return err
+		}
+
+		if err := createEvent(tx, string(broker.BlockUpdated), "block", eventData); err != nil {
+			return err
+		}
+
+		// Links and inline tags now come from the new note
+		if err := syncNoteLinks(tx, block, block.GetLinkedNoteIDs()); err != nil {
+			return err
+		}
+
+		if err := syncNoteTags(tx, block); err != nil {
+			return err
+		}
+		blockIDs = append(blockIDs, block.ID.String())
+	}
+
+	var tasks []models.Task
+	if err := tx.Where("metadata->>'block_id' IN ?", blockIDs).Find(&tasks).Error; err != nil {
+		return err
+	}
+
+	for _, task := range tasks {
+		if task.Metadata == nil {
+			task.Metadata = models.TaskMetadata{}
+		}
+		task.Metadata["note_id"] = toNoteID.String()
+		task.Version++
+
+		if err := tx.Model(&models.Task{}).Where("id = ?", task.ID).Updates(map[string]interface{}{
+			"note_id":  toNoteID,
+			"metadata": task.Metadata,
+			"version":  task.Version,
+		}).Error; err != nil {
+			return err
+		}
+
+		if err := createEvent(tx, string(broker.TaskUpdated), "task", map[string]interface{}{
+			"task_id":      task.ID.String(),
+			"user_id":      task.UserID.String(),
+			"note_id":      toNoteID.String(),
+			"block_id":     task.Metadata["block_id"],
+			"title":        task.Title,
+			"is_completed": task.IsCompleted,
+			"version":      task.Version,
+		}); err != nil {
+			return err
+		}
+	}
+
+	// Losing the tasks is an edit of the note they left, recorded as one
+	_, err = createNoteRevision(tx, fromNoteID, userID)
+	return err
+}
+
+// NewJournalService creates a new instance of JournalService
+func NewJournalService() JournalServiceInterface {
+	return &JournalService{}
+}
+
+// Don't initialize here, will be set properly in main.go
+var JournalServiceInstance JournalServiceInterface
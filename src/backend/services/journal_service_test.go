@@ -0,0 +1,241 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"owlistic-notes/owlistic/database"
+	"owlistic-notes/owlistic/models"
+	"owlistic-notes/owlistic/testutils"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+// journalNoteStub serves the note asked for by ID
+type journalNoteStub struct {
+	NoteServiceInterface
+	notes map[uuid.UUID]models.Note
+}
+
+func (s *journalNoteStub) GetNoteById(db *database.Database, id string, params map[string]interface{}) (models.Note, error) {
+	note, ok := s.notes[uuid.MustParse(id)]
+	if !ok {
+		return models.Note{}, ErrNoteNotFound
+	}
+	return note, nil
+}
+
+func journalUserRows(userID uuid.UUID, preferences string) *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "username", "preferences"}).
+		AddRow(userID.String(), "sam", []byte(preferences))
+}
+
+func journalEntryRows(userID uuid.UUID, period models.JournalPeriod, date string, noteID uuid.UUID) *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "user_id", "period", "date", "note_id"}).
+		AddRow(uuid.New().String(), userID.String(), string(period), date, noteID.String())
+}
+
+// expectJournalNote expects the plain journal note to be written
+func expectJournalNote(mock sqlmock.Sqlmock, now time.Time) {
+	mock.ExpectQuery(`INSERT INTO "notes"`).
+		WillReturnRows(sqlmock.NewRows([]string{"created_at", "updated_at"}).AddRow(now, now))
+	mock.ExpectExec(`INSERT INTO "roles"`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`INSERT INTO "blocks"`).
+		WillReturnRows(sqlmock.NewRows([]string{"created_at", "updated_at"}).AddRow(now, now))
+	expectEventInsert(mock, "note.created")
+	expectEventInsert(mock, "block.created")
+}
+
+func TestGetPeriodicNote_Existing(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	userID := uuid.New()
+	noteID := uuid.New()
+
+	previous := NoteServiceInstance
+	NoteServiceInstance = &journalNoteStub{notes: map[uuid.UUID]models.Note{noteID: {ID: noteID, Title: "2026-W42"}}}
+	defer func() { NoteServiceInstance = previous }()
+
+	mock.ExpectQuery("SELECT \\* FROM \"users\" WHERE id = (.+)").
+		WillReturnRows(journalUserRows(userID, `{"timezone":"Europe/Berlin"}`))
+	// Friday 16th belongs to the week starting Monday 12th
+	mock.ExpectQuery("SELECT \\* FROM \"journal_entries\" WHERE").
+		WithArgs(userID, models.JournalWeekly, "2026-10-12", 1).
+		WillReturnRows(journalEntryRows(userID, models.JournalWeekly, "2026-10-12", noteID))
+
+	service := &JournalService{}
+	note, created, err := service.GetPeriodicNote(db, "weekly", "2026-10-16", map[string]interface{}{"user_id": userID.String()})
+
+	assert.NoError(t, err)
+	assert.False(t, created)
+	assert.Equal(t, noteID, note.ID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetPeriodicNote_CreatesAndRollsTasksForward(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	userID := uuid.New()
+	notebookID := uuid.New()
+	yesterdayNoteID := uuid.New()
+	openTaskID := uuid.New()
+	nestedID := uuid.New()
+	taskID := uuid.New()
+	now := time.Now()
+
+	// The note is served once it is committed
+	var created models.Note
+	previousRoles, previousNotes := RoleServiceInstance, NoteServiceInstance
+	RoleServiceInstance = &graphAccessStub{
+		notes:     map[string]bool{yesterdayNoteID.String(): true},
+		notebooks: map[string]bool{notebookID.String(): true},
+	}
+	NoteServiceInstance = &journalCreatedStub{created: &created}
+	defer func() { RoleServiceInstance, NoteServiceInstance = previousRoles, previousNotes }()
+
+	mock.ExpectQuery("SELECT \\* FROM \"users\" WHERE id = (.+)").
+		WillReturnRows(journalUserRows(userID, `{"journal":{"notebook_id":"`+notebookID.String()+
+			`","daily":{"title_format":"dddd, MMMM D","roll_forward_tasks":true}}}`))
+	mock.ExpectQuery("SELECT \\* FROM \"journal_entries\" WHERE").
+		WithArgs(userID, models.JournalDaily, "2026-10-16", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery("SELECT \\* FROM \"journal_entries\" WHERE").
+		WithArgs(userID, models.JournalDaily, "2026-10-15", 1).
+		WillReturnRows(journalEntryRows(userID, models.JournalDaily, "2026-10-15", yesterdayNoteID))
+
+	mock.ExpectBegin()
+	expectJournalNote(mock, now)
+	mock.ExpectQuery(`INSERT INTO "journal_entries" (.+) ON CONFLICT \("user_id","period","date"\) DO UPDATE SET "note_id"="excluded"."note_id" WHERE "journal_entries"."note_id" = (.+) RETURNING`).
+		WillReturnRows(sqlmock.NewRows([]string{"created_at"}).AddRow(now))
+
+	// The open task moves with its nested block; the finished one stays
+	blockColumns := []string{"id", "note_id", "user_id", "parent_block_id", "type", "content", "metadata", "order", "version"}
+	mock.ExpectQuery(`SELECT \* FROM "blocks" WHERE note_id = \$1`).
+		WithArgs(yesterdayNoteID).
+		WillReturnRows(sqlmock.NewRows(blockColumns).
+			AddRow(openTaskID.String(), yesterdayNoteID.String(), userID.String(), nil, "task",
+				[]byte(`{"text":"Ship it"}`), []byte(`{"is_completed":false,"task_id":"`+taskID.String()+`"}`), 1000.0, 4).
+			AddRow(nestedID.String(), yesterdayNoteID.String(), userID.String(), openTaskID.String(), "text",
+				[]byte(`{"text":"Notes"}`), []byte(`{}`), 1000.0, 2).
+			AddRow(uuid.New().String(), yesterdayNoteID.String(), userID.String(), nil, "task",
+				[]byte(`{"text":"Done"}`), []byte(`{"is_completed":true}`), 2000.0, 1).
+			AddRow(uuid.New().String(), yesterdayNoteID.String(), userID.String(), nil, "text",
+				[]byte(`{"text":"Diary"}`), []byte(`{}`), 3000.0, 1))
+	mock.ExpectQuery(`SELECT COALESCE\(MAX\("order"\), 0\) FROM "blocks"`).
+		WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(1000.0))
+
+	// Blocks keep their IDs; the outermost one goes after the empty block
+	mock.ExpectExec(`UPDATE "blocks" SET "note_id"=\$1,"order"=\$2,"parent_block_id"=\$3,"version"=\$4,"updated_at"=\$5 WHERE id = \$6`).
+		WithArgs(sqlmock.AnyArg(), 2000.0, nil, int64(5), sqlmock.AnyArg(), openTaskID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectEventInsert(mock, "block.updated")
+	mock.ExpectExec(`UPDATE "blocks" SET "note_id"=\$1,"version"=\$2,"updated_at"=\$3 WHERE id = \$4`).
+		WithArgs(sqlmock.AnyArg(), int64(3), sqlmock.AnyArg(), nestedID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectEventInsert(mock, "block.updated")
+
+	// The task follows its block with its due date untouched
+	mock.ExpectQuery(`SELECT \* FROM "tasks" WHERE metadata->>'block_id' IN \(\$1,\$2\)`).
+		WithArgs(openTaskID.String(), nestedID.String()).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "note_id", "title", "due_date", "metadata", "version"}).
+			AddRow(taskID.String(), userID.String(), yesterdayNoteID.String(), "Ship it", "2026-10-20",
+				[]byte(`{"block_id":"`+openTaskID.String()+`","note_id":"`+yesterdayNoteID.String()+`"}`), 2))
+	mock.ExpectExec(`UPDATE "tasks" SET "metadata"=\$1,"note_id"=\$2,"version"=\$3,"updated_at"=\$4 WHERE id = \$5`).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), int64(3), sqlmock.AnyArg(), taskID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectEventInsert(mock, "task.updated")
+
+	mock.ExpectQuery("SELECT (.+) FROM \"notes\" WHERE id = (.+) FOR UPDATE").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "title"}).
+			AddRow(yesterdayNoteID.String(), userID.String(), "Thursday, October 15"))
+	mock.ExpectQuery("SELECT (.+) FROM \"blocks\" WHERE \"blocks\".\"note_id\" = (.+)").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "note_id"}))
+	mock.ExpectQuery("SELECT \"id\",\"revision\",\"user_id\",\"created_at\" FROM \"note_revisions\"").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "revision", "user_id", "created_at"}))
+	mock.ExpectQuery("INSERT INTO \"note_revisions\"").
+		WillReturnRows(sqlmock.NewRows([]string{"created_at"}).AddRow(now))
+	mock.ExpectCommit()
+
+	service := &JournalService{}
+	note, wasCreated, err := service.GetPeriodicNote(db, "daily", "2026-10-16", map[string]interface{}{"user_id": userID.String()})
+
+	assert.NoError(t, err)
+	assert.True(t, wasCreated)
+	assert.NoError(t, mock.ExpectationsWereMet())
+	assert.Equal(t, created.ID, note.ID)
+}
+
+// journalCreatedStub serves any note, recording the ID asked for
+type journalCreatedStub struct {
+	NoteServiceInterface
+	created *models.Note
+}
+
+func (s *journalCreatedStub) GetNoteById(db *database.Database, id string, params map[string]interface{}) (models.Note, error) {
+	s.created.ID = uuid.MustParse(id)
+	return *s.created, nil
+}
+
+func TestGetPeriodicNote_ConcurrentRequest(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	userID := uuid.New()
+	notebookID := uuid.New()
+	winnerID := uuid.New()
+	now := time.Now()
+
+	previousRoles, previousNotes := RoleServiceInstance, NoteServiceInstance
+	RoleServiceInstance = &graphAccessStub{notebooks: map[string]bool{notebookID.String(): true}}
+	NoteServiceInstance = &journalNoteStub{notes: map[uuid.UUID]models.Note{winnerID: {ID: winnerID}}}
+	defer func() { RoleServiceInstance, NoteServiceInstance = previousRoles, previousNotes }()
+
+	mock.ExpectQuery("SELECT \\* FROM \"users\" WHERE id = (.+)").
+		WillReturnRows(journalUserRows(userID, `{"journal":{"notebook_id":"`+notebookID.String()+`"}}`))
+	mock.ExpectQuery("SELECT \\* FROM \"journal_entries\" WHERE").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	// Another request recorded its note first, so this one is dropped
+	mock.ExpectBegin()
+	expectJournalNote(mock, now)
+	mock.ExpectQuery(`INSERT INTO "journal_entries" (.+) ON CONFLICT (.+) DO UPDATE (.+) WHERE "journal_entries"."note_id" = (.+) RETURNING`).
+		WillReturnRows(sqlmock.NewRows([]string{"created_at"}))
+	mock.ExpectRollback()
+	mock.ExpectQuery("SELECT \\* FROM \"journal_entries\" WHERE").
+		WithArgs(userID, models.JournalMonthly, "2026-10-01", 1).
+		WillReturnRows(journalEntryRows(userID, models.JournalMonthly, "2026-10-01", winnerID))
+
+	service := &JournalService{}
+	note, created, err := service.GetPeriodicNote(db, "monthly", "2026-10-16", map[string]interface{}{"user_id": userID.String()})
+
+	assert.NoError(t, err)
+	assert.False(t, created)
+	assert.Equal(t, winnerID, note.ID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetPeriodicNote_NoJournalNotebook(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	userID := uuid.New()
+
+	mock.ExpectQuery("SELECT \\* FROM \"users\" WHERE id = (.+)").
+		WillReturnRows(journalUserRows(userID, `{}`))
+	mock.ExpectQuery("SELECT \\* FROM \"journal_entries\" WHERE").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	service := &JournalService{}
+	_, _, err := service.GetPeriodicNote(db, "monthly", "", map[string]interface{}{"user_id": userID.String()})
+
+	assert.ErrorIs(t, err, ErrJournalNotSet)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	_, _, err = service.GetPeriodicNote(db, "yearly", "", map[string]interface{}{"user_id": userID.String()})
+	assert.ErrorIs(t, err, ErrInvalidInput)
+}
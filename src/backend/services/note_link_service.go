@@ -0,0 +1,188 @@
+package services
+
+import (
+	"errors"
+
+	"owlistic-notes/owlistic/database"
+	"owlistic-notes/owlistic/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type NoteLinkServiceInterface interface {
+	ListBacklinks(db *database.Database, noteID string, params map[string]interface{}) ([]models.NoteLink, error)
+	ListLinks(db *database.Database, noteID string, params map[string]interface{}) ([]models.NoteLink, error)
+}
+
+type NoteLinkService struct{}
+
+// ListBacklinks returns the links pointing at a note from notes the user can view.
+// Links from notes in the trash are left out.
+func (s *NoteLinkService) ListBacklinks(db *database.Database, noteID string, params map[string]interface{}) ([]models.NoteLink, error) {
+	userIDStr, err := noteLinkAccess(db, noteID, params)
+	if err != nil {
+		return nil, err
+	}
+
+	query, err := visibleNoteLinks(db, userIDStr, "note_links.source_note_id")
+	if err != nil {
+		return nil, err
+	}
+
+	links := []models.NoteLink{}
+	if err := query.
+		Select("note_links.*, notes.title AS note_title").
+		Joins("JOIN notes ON notes.id = note_links.source_note_id").
+		Where("note_links.target_note_id = ? AND note_links.source_deleted = ?", noteID, false).
+		Order("notes.title ASC, note_links.created_at ASC").
+		Find(&links).Error; err != nil {
+		return nil, err
+	}
+
+	return links, nil
+}
+
+// ListLinks returns the links going out of a note to notes the user can view.
+// Links to notes in the trash are kept and marked with target_deleted.
+func (s *NoteLinkService) ListLinks(db *database.Database, noteID string, params map[string]interface{}) ([]models.NoteLink, error) {
+	userIDStr, err := noteLinkAccess(db, noteID, params)
+	if err != nil {
+		return nil, err
+	}
+
+	query, err := visibleNoteLinks(db, userIDStr, "note_links.target_note_id")
+	if err != nil {
+		return nil, err
+	}
+
+	links := []models.NoteLink{}
+	if err := query.
+		Select("note_links.*, notes.title AS note_title").
+		Joins("JOIN notes ON notes.id = note_links.target_note_id").
+		Where("note_links.source_note_id = ?", noteID).
+		Order("notes.title ASC, note_links.created_at ASC").
+		Find(&links).Error; err != nil {
+		return nil, err
+	}
+
+	return links, nil
+}
+
+// noteLinkAccess checks that the user can view the note whose links are listed
+func noteLinkAccess(db *database.Database, noteID string, params map[string]interface{}) (string, error) {
+	userIDStr, ok := params["user_id"].(string)
+	if !ok {
+		return "", errors.New("user_id must be provided in parameters")
+	}
+
+	if _, err := uuid.Parse(noteID); err != nil {
+		return "", ErrInvalidInput
+	}
+
+	hasAccess, err := RoleServiceInstance.HasNoteAccess(db, userIDStr, noteID, "viewer")
+	if err != nil {
+		return "", err
+	}
+
+	if !hasAccess {
+		return "", errors.New("not authorized to access links of this note")
+	}
+
+	return userIDStr, nil
+}
+
+// visibleNoteLinks selects the links whose other end, in column, the user
+// can view, so that titles of notes shared with someone else don't leak
+// through links. Admins see all of them.
+func visibleNoteLinks(db *database.Database, userIDStr string, column string) (*gorm.DB, error) {
+	query := db.DB.Model(&models.NoteLink{})
+
+	admin, err := RoleServiceInstance.HasSystemRole(db, userIDStr, string(models.AdminRole))
+	if err != nil {
+		return nil, err
+	}
+	if admin {
+		return query, nil
+	}
+
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return nil, ErrInvalidInput
+	}
+	return query.Where(column+" IN (?)", viewableNotes(db.DB, userID)), nil
+}
+
+// syncNoteLinks rewrites the links of a block after it was created or
+// changed. previous holds the notes the block linked to before the change,
+// so blocks that never held a link cost no queries.
+func syncNoteLinks(tx *gorm.DB, block models.Block, previous []uuid.UUID) error {
+	targets := block.GetLinkedNoteIDs()
+	if len(targets) == 0 && len(previous) == 0 {
+		return nil
+	}
+
+	if err := removeNoteLinks(tx, []uuid.UUID{block.ID}); err != nil {
+		return err
+	}
+
+	if len(targets) == 0 {
+		return nil
+	}
+
+	// Links to unknown notes are dropped, links into the trash are kept as deleted
+	var notes []models.Note
+	if err := tx.Unscoped().Select("id", "deleted_at").
+		Where("id IN ? AND id <> ?", targets, block.NoteID).
+		Find(&notes).Error; err != nil {
+		return err
+	}
+
+	if len(notes) == 0 {
+		return nil
+	}
+
+	links := make([]models.NoteLink, len(notes))
+	for i, note := range notes {
+		links[i] = models.NoteLink{
+			ID:            uuid.New(),
+			SourceNoteID:  block.NoteID,
+			SourceBlockID: block.ID,
+			TargetNoteID:  note.ID,
+			TargetDeleted: note.DeletedAt.Valid,
+		}
+	}
+
+	return tx.Create(&links).Error
+}
+
+// removeNoteLinks drops the links held by deleted blocks
+func removeNoteLinks(tx *gorm.DB, blockIDs []uuid.UUID) error {
+	return tx.Where("source_block_id IN ?", blockIDs).Delete(&models.NoteLink{}).Error
+}
+
+// setNoteLinksDeleted marks the links from and to notes as moved into or out
+// of the trash
+func setNoteLinksDeleted(tx *gorm.DB, noteIDs []uuid.UUID, deleted bool) error {
+	if len(noteIDs) == 0 {
+		return nil
+	}
+
+	if err := tx.Model(&models.NoteLink{}).
+		Where("source_note_id IN ?", noteIDs).
+		Update("source_deleted", deleted).Error; err != nil {
+		return err
+	}
+
+	return tx.Model(&models.NoteLink{}).
+		Where("target_note_id IN ?", noteIDs).
+		Update("target_deleted", deleted).Error
+}
+
+// NewNoteLinkService creates a new instance of NoteLinkService
+func NewNoteLinkService() NoteLinkServiceInterface {
+	return &NoteLinkService{}
+}
+
+// Don't initialize here, will be set properly in main.go
+var NoteLinkServiceInstance NoteLinkServiceInterface
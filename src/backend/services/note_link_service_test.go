@@ -0,0 +1,136 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"owlistic-notes/owlistic/database"
+	"owlistic-notes/owlistic/models"
+	"owlistic-notes/owlistic/testutils"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+// noteAccessStub grants viewer access to a fixed set of notes
+type noteAccessStub struct {
+	RoleServiceInterface
+	notes map[string]bool
+}
+
+func (s *noteAccessStub) HasNoteAccess(db *database.Database, userID string, noteID string, requiredRole string) (bool, error) {
+	return s.notes[noteID], nil
+}
+
+func (s *noteAccessStub) HasSystemRole(db *database.Database, userID string, requiredRole string) (bool, error) {
+	return false, nil
+}
+
+func TestSyncNoteLinks(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	noteID := uuid.New()
+	linkedID := uuid.New()
+	trashedID := uuid.New()
+	block := models.Block{
+		ID:      uuid.New(),
+		NoteID:  noteID,
+		Type:    models.TextBlock,
+		Content: models.BlockContent{"text": "see both"},
+		Metadata: models.BlockMetadata{"spans": []interface{}{
+			map[string]interface{}{"type": models.NoteLinkSpan, "start": 4.0, "end": 8.0, "note_id": linkedID.String()},
+			map[string]interface{}{"type": "bold", "start": 0.0, "end": 3.0},
+			map[string]interface{}{"type": models.NoteLinkSpan, "start": 0.0, "end": 3.0, "note_id": trashedID.String()},
+		}},
+	}
+
+	mock.ExpectBegin()
+	tx := db.DB.Begin()
+
+	mock.ExpectExec("DELETE FROM \"note_links\" WHERE source_block_id IN").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT \"id\",\"deleted_at\" FROM \"notes\" WHERE id IN (.+) AND id <> (.+)").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "deleted_at"}).
+			AddRow(linkedID.String(), nil).
+			AddRow(trashedID.String(), time.Now()))
+	mock.ExpectQuery("INSERT INTO \"note_links\"").
+		WithArgs(
+			noteID, block.ID, linkedID, false, false, sqlmock.AnyArg(),
+			noteID, block.ID, trashedID, false, true, sqlmock.AnyArg(),
+		).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).
+			AddRow(uuid.New().String(), time.Now()).
+			AddRow(uuid.New().String(), time.Now()))
+
+	assert.NoError(t, syncNoteLinks(tx, block, nil))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSyncNoteLinks_WithoutLinks(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	block := models.Block{ID: uuid.New(), NoteID: uuid.New(), Type: models.TextBlock, Content: models.BlockContent{"text": "plain"}}
+
+	mock.ExpectBegin()
+	tx := db.DB.Begin()
+
+	// Blocks that never held a link don't touch the links table
+	assert.NoError(t, syncNoteLinks(tx, block, nil))
+
+	// Removing the last link clears the block's links
+	mock.ExpectExec("DELETE FROM \"note_links\" WHERE source_block_id IN").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.NoError(t, syncNoteLinks(tx, block, []uuid.UUID{uuid.New()}))
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestListBacklinks_HidesInaccessibleNotes(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	userID := uuid.New()
+	noteID := uuid.New()
+	sharedID := uuid.New()
+
+	previous := RoleServiceInstance
+	RoleServiceInstance = &noteAccessStub{notes: map[string]bool{noteID.String(): true}}
+	defer func() { RoleServiceInstance = previous }()
+
+	// The query leaves out links from notes the user can't view
+	mock.ExpectQuery("SELECT note_links.\\*, notes.title AS note_title FROM \"note_links\" JOIN notes ON notes.id = note_links.source_note_id WHERE note_links.source_note_id IN \\(SELECT id FROM notes WHERE user_id = (.+) AND \\(note_links.target_note_id = (.+) AND note_links.source_deleted = (.+)\\)").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "source_note_id", "source_block_id", "target_note_id", "note_title"}).
+			AddRow(uuid.New().String(), sharedID.String(), uuid.New().String(), noteID.String(), "Shared"))
+
+	service := &NoteLinkService{}
+	links, err := service.ListBacklinks(db, noteID.String(), map[string]interface{}{
+		"user_id": userID.String(),
+	})
+
+	assert.NoError(t, err)
+	if assert.Len(t, links, 1) {
+		assert.Equal(t, sharedID, links[0].SourceNoteID)
+		assert.Equal(t, "Shared", links[0].NoteTitle)
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestListLinks_RequiresAccess(t *testing.T) {
+	previous := RoleServiceInstance
+	RoleServiceInstance = &noteAccessStub{}
+	defer func() { RoleServiceInstance = previous }()
+
+	service := &NoteLinkService{}
+	_, err := service.ListLinks(&database.Database{}, uuid.New().String(), map[string]interface{}{
+		"user_id": uuid.New().String(),
+	})
+	assert.Error(t, err)
+
+	_, err = service.ListLinks(&database.Database{}, "not-a-note", map[string]interface{}{
+		"user_id": uuid.New().String(),
+	})
+	assert.ErrorIs(t, err, ErrInvalidInput)
+}
@@ -2,6 +2,7 @@ package services
 
 import (
 	"errors"
+	"fmt"
 	"log"
 	"time"
 
@@ -12,6 +13,7 @@ import (
 	"github.com/google/uuid"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type NoteServiceInterface interface {
@@ -21,7 +23,9 @@ type NoteServiceInterface interface {
 	DeleteNote(db *database.Database, id string, params map[string]interface{}) error
 	ListNotesByUser(db *database.Database, userID string) ([]models.Note, error)
 	GetAllNotes(db *database.Database) ([]models.Note, error)
-	GetNotes(db *database.Database, params map[string]interface{}) ([]models.Note, error)
+	GetNotes(db *database.Database, params map[string]interface{}) ([]models.Note, PageInfo, error)
+	DuplicateNote(db *database.Database, id string, noteData map[string]interface{}, params map[string]interface{}) (models.Note, error)
+	MoveNote(db *database.Database, id string, notebookID string, params map[string]interface{}) (models.Note, error)
 }
 
 type NoteService struct{}
@@ -82,85 +86,117 @@ func (s *NoteService) CreateNote(db *database.Database, noteData map[string]inte
 		return models.Note{}, errors.New("notebook not found")
 	}
 
+	tags, err := parseTagNames(noteData["tags"])
+	if err != nil {
+		tx.Rollback()
+		return models.Note{}, err
+	}
+
 	// Create note
 	title, _ := noteData["title"].(string)
-	noteID := uuid.New()
-
 	note := models.Note{
-		ID:         noteID,
+		ID:         uuid.New(),
 		UserID:     userID,
 		NotebookID: notebookID,
 		Title:      title,
+		Tags:       tags,
 	}
 
-	if err := tx.Create(&note).Error; err != nil {
+	// Create at least one initial empty block for the note
+	block := models.Block{
+		ID:      uuid.New(),
+		Type:    models.TextBlock,
+		Content: models.BlockContent{"text": ""},
+		Order:   1,
+	}
+
+	if _, err := createNoteTx(tx, note, []models.Block{block}, nil); err != nil {
 		tx.Rollback()
 		return models.Note{}, err
 	}
 
+	if err := tx.Commit().Error; err != nil {
+		return models.Note{}, err
+	}
+
+	// Reload note with its blocks
+	var completeNote models.Note
+	if err := db.DB.Preload("Blocks").First(&completeNote, "id = ?", note.ID).Error; err != nil {
+		return models.Note{}, err
+	}
+
+	return completeNote, nil
+}
+
+// createNoteTx creates the note inside tx with its owner role and blocks
+// and records the note.created event, with extra added to its data. The
+// blocks get the note's ID and owner and are inserted in the order given,
+// so parents have to come before their children. Their inline #tags are
+// added to the note's tags.
+func createNoteTx(tx *gorm.DB, note models.Note, blocks []models.Block, extra map[string]interface{}) (models.Note, error) {
+	for i := range blocks {
+		blocks[i].NoteID = note.ID
+		blocks[i].UserID = note.UserID
+		for _, name := range blocks[i].GetInlineTags() {
+			note.Tags = addTagName(note.Tags, name)
+		}
+	}
+	note.Blocks = nil
+
+	if err := tx.Create(&note).Error; err != nil {
+		return models.Note{}, err
+	}
+
+	if err := ensureTags(tx, note.UserID, note.Tags); err != nil {
+		return models.Note{}, err
+	}
+
 	// Assign owner role to the creator
 	role := models.Role{
 		ID:           uuid.New(),
-		UserID:       userID,
+		UserID:       note.UserID,
 		ResourceID:   note.ID,
 		ResourceType: models.NoteResource,
 		Role:         models.OwnerRole,
 	}
 
 	if err := tx.Create(&role).Error; err != nil {
-		tx.Rollback()
 		return models.Note{}, err
 	}
 
-	// Create at least one initial empty block for the note
-	blockID := uuid.New()
-	block := models.Block{
-		ID:      blockID,
-		NoteID:  noteID,
-		UserID:  userID,
-		Type:    models.TextBlock,
-		Content: models.BlockContent{"text": ""},
-		Order:   1,
-	}
-
-	if err := tx.Create(&block).Error; err != nil {
-		tx.Rollback()
-		return models.Note{}, err
-	}
+	blockIDs := make([]string, 0, len(blocks))
+	for i := range blocks {
+		if err := tx.Create(&blocks[i]).Error; err != nil {
+			return models.Note{}, err
+		}
 
-	// Create event for note creation
-	event, err := models.NewEvent(
-		string(broker.NoteCreated),
-		"note",
-		map[string]interface{}{
-			"note_id":     note.ID.String(),
-			"notebook_id": note.NotebookID.String(),
-			"title":       note.Title,
-			"blocks":      []string{block.ID.String()},
-		},
-	)
+		if err := checkBlockAttachment(tx, blocks[i]); err != nil {
+			return models.Note{}, err
+		}
 
-	if err != nil {
-		tx.Rollback()
-		return models.Note{}, err
+		if err := syncNoteLinks(tx, blocks[i], nil); err != nil {
+			return models.Note{}, err
+		}
+		blockIDs = append(blockIDs, blocks[i].ID.String())
 	}
 
-	if err := tx.Create(event).Error; err != nil {
-		tx.Rollback()
-		return models.Note{}, err
+	data := map[string]interface{}{
+		"note_id":     note.ID.String(),
+		"notebook_id": note.NotebookID.String(),
+		"title":       note.Title,
+		"tags":        note.Tags,
+		"blocks":      blockIDs,
 	}
-
-	if err := tx.Commit().Error; err != nil {
-		return models.Note{}, err
+	for key, value := range extra {
+		data[key] = value
 	}
 
-	// Reload note with its blocks
-	var completeNote models.Note
-	if err := db.DB.Preload("Blocks").First(&completeNote, "id = ?", note.ID).Error; err != nil {
+	if err := createEvent(tx, string(broker.NoteCreated), "note", data); err != nil {
 		return models.Note{}, err
 	}
 
-	return completeNote, nil
+	note.Blocks = blocks
+	return note, nil
 }
 
 func (s *NoteService) GetNoteById(db *database.Database, id string, params map[string]interface{}) (models.Note, error) {
@@ -206,6 +242,12 @@ func (s *NoteService) UpdateNote(db *database.Database, id string, noteData map[
 		return models.Note{}, errors.New("user_id must be provided in parameters")
 	}
 
+	expected, err := expectedVersion(noteData)
+	if err != nil {
+		tx.Rollback()
+		return models.Note{}, err
+	}
+
 	// Check if user has editor rights using the new method
 	hasAccess, err := RoleServiceInstance.HasNoteAccess(db, userIDStr, id, "editor")
 	if err != nil {
@@ -219,39 +261,46 @@ func (s *NoteService) UpdateNote(db *database.Database, id string, noteData map[
 	}
 
 	var note models.Note
-	if err := tx.First(&note, "id = ?", id).Error; err != nil {
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&note, "id = ?", id).Error; err != nil {
 		tx.Rollback()
 		return models.Note{}, ErrNoteNotFound
 	}
 
+	if err := checkVersion(expected, note.Version, note); err != nil {
+		tx.Rollback()
+		return models.Note{}, err
+	}
+
 	// Update note fields
 	if title, ok := noteData["title"].(string); ok {
 		note.Title = title
 	}
 
-	if notebookIDStr, ok := noteData["notebook_id"].(string); ok {
-		notebookID, err := uuid.Parse(notebookIDStr)
+	var movedTaskIDs []string
+	if notebookIDStr, ok := noteData["notebook_id"].(string); ok && notebookIDStr != note.NotebookID.String() {
+		movedTaskIDs, err = moveNote(tx, db, &note, notebookIDStr, userIDStr)
 		if err != nil {
 			tx.Rollback()
-			return models.Note{}, errors.New("notebook_id must be a valid UUID")
+			return models.Note{}, err
 		}
+	}
 
-		// Verify notebook exists
-		var notebookCount int64
-		if err := tx.Model(&models.Notebook{}).Where("id = ?", notebookID).Count(&notebookCount).Error; err != nil {
+	if tagsValue, exists := noteData["tags"]; exists {
+		tags, err := parseTagNames(tagsValue)
+		if err != nil {
 			tx.Rollback()
 			return models.Note{}, err
 		}
 
-		if notebookCount == 0 {
+		if err := ensureTags(tx, note.UserID, tags); err != nil {
 			tx.Rollback()
-			return models.Note{}, errors.New("notebook not found")
+			return models.Note{}, err
 		}
-
-		note.NotebookID = notebookID
+		note.Tags = tags
 	}
 
 	note.UpdatedAt = time.Now()
+	note.Version++
 
 	if err := tx.Save(&note).Error; err != nil {
 		tx.Rollback()
@@ -259,14 +308,14 @@ func (s *NoteService) UpdateNote(db *database.Database, id string, noteData map[
 	}
 
 	// Create event for note update
+	eventData := noteTagsEventData(note)
+	if movedTaskIDs != nil {
+		eventData["task_ids"] = movedTaskIDs
+	}
 	event, err := models.NewEvent(
 		string(broker.NoteUpdated),
 		"note",
-		map[string]interface{}{
-			"note_id":     note.ID.String(),
-			"notebook_id": note.NotebookID.String(),
-			"title":       note.Title,
-		},
+		eventData,
 	)
 
 	if err != nil {
@@ -279,6 +328,17 @@ func (s *NoteService) UpdateNote(db *database.Database, id string, noteData map[
 		return models.Note{}, err
 	}
 
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		tx.Rollback()
+		return models.Note{}, ErrInvalidInput
+	}
+
+	if _, err := createNoteRevision(tx, note.ID, userID); err != nil {
+		tx.Rollback()
+		return models.Note{}, err
+	}
+
 	if err := tx.Commit().Error; err != nil {
 		return models.Note{}, err
 	}
@@ -339,6 +399,12 @@ func (s *NoteService) DeleteNote(db *database.Database, id string, params map[st
 		return err
 	}
 
+	// Links from and to the note stay around while it is in the trash
+	if err := setNoteLinksDeleted(tx, []uuid.UUID{note.ID}, true); err != nil {
+		tx.Rollback()
+		return err
+	}
+
 	// Create event for note deletion
 	event, err := models.NewEvent(
 		string(broker.NoteDeleted),
@@ -366,6 +432,243 @@ func (s *NoteService) DeleteNote(db *database.Database, id string, params map[st
 	return nil
 }
 
+// DuplicateNote copies a note with its blocks and tasks into "notebook_id",
+// or the note's own notebook when none is given. The caller owns the copy;
+// roles others hold on the original are not carried over.
+func (s *NoteService) DuplicateNote(db *database.Database, id string, noteData map[string]interface{}, params map[string]interface{}) (models.Note, error) {
+	userIDStr, ok := params["user_id"].(string)
+	if !ok {
+		return models.Note{}, errors.New("user_id must be provided in parameters")
+	}
+
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return models.Note{}, ErrInvalidInput
+	}
+
+	hasAccess, err := RoleServiceInstance.HasNoteAccess(db, userIDStr, id, "viewer")
+	if err != nil {
+		return models.Note{}, err
+	}
+
+	if !hasAccess {
+		return models.Note{}, errors.New("not authorized to access this note")
+	}
+
+	tx := db.DB.Begin()
+	if tx.Error != nil {
+		return models.Note{}, tx.Error
+	}
+
+	var note models.Note
+	if err := tx.First(&note, "id = ?", id).Error; err != nil {
+		tx.Rollback()
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return models.Note{}, ErrNoteNotFound
+		}
+		return models.Note{}, err
+	}
+
+	notebookIDStr := note.NotebookID.String()
+	if override, ok := noteData["notebook_id"].(string); ok && override != "" {
+		notebookIDStr = override
+	}
+
+	notebookID, err := noteDestination(tx, db, notebookIDStr, userIDStr)
+	if err != nil {
+		tx.Rollback()
+		return models.Note{}, err
+	}
+
+	title := note.Title + " (copy)"
+	if override, ok := noteData["title"].(string); ok && override != "" {
+		title = override
+	}
+
+	duplicate, err := copyNote(tx, note, notebookID, userID, title)
+	if err != nil {
+		tx.Rollback()
+		return models.Note{}, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return models.Note{}, err
+	}
+
+	return duplicate, nil
+}
+
+// MoveNote moves a note to another notebook, taking its tasks along
+func (s *NoteService) MoveNote(db *database.Database, id string, notebookID string, params map[string]interface{}) (models.Note, error) {
+	if notebookID == "" {
+		return models.Note{}, fmt.Errorf("%w: notebook_id is required", ErrInvalidInput)
+	}
+	return s.UpdateNote(db, id, map[string]interface{}{"notebook_id": notebookID}, params)
+}
+
+// noteDestination checks that the user may put notes into the notebook
+func noteDestination(tx *gorm.DB, db *database.Database, notebookIDStr string, userIDStr string) (uuid.UUID, error) {
+	notebookID, err := uuid.Parse(notebookIDStr)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("%w: notebook_id must be a valid UUID", ErrInvalidInput)
+	}
+
+	var notebookCount int64
+	if err := tx.Model(&models.Notebook{}).Where("id = ?", notebookID).Count(&notebookCount).Error; err != nil {
+		return uuid.Nil, err
+	}
+
+	if notebookCount == 0 {
+		return uuid.Nil, ErrNotebookNotFound
+	}
+
+	hasAccess, err := RoleServiceInstance.HasNotebookAccess(db, userIDStr, notebookIDStr, "editor")
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	if !hasAccess {
+		return uuid.Nil, errors.New("not authorized to add notes to this notebook")
+	}
+
+	return notebookID, nil
+}
+
+// moveNote puts the note into another notebook. Tasks belong to their note
+// and so follow it; they are marked updated so that task lists refresh, and
+// their IDs are returned for the note.updated event.
+func moveNote(tx *gorm.DB, db *database.Database, note *models.Note, notebookIDStr string, userIDStr string) ([]string, error) {
+	notebookID, err := noteDestination(tx, db, notebookIDStr, userIDStr)
+	if err != nil {
+		return nil, err
+	}
+
+	taskIDs := []string{}
+	if err := tx.Model(&models.Task{}).Where("note_id = ?", note.ID).Pluck("id", &taskIDs).Error; err != nil {
+		return nil, err
+	}
+
+	if len(taskIDs) > 0 {
+		if err := tx.Model(&models.Task{}).Where("id IN ?", taskIDs).Update("updated_at", time.Now()).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	note.NotebookID = notebookID
+	return taskIDs, nil
+}
+
+// copyNote copies a note with its blocks and tasks into a notebook, owned
+// by ownerID. Nested blocks and the links between task blocks and their
+// tasks point at the copies.
+func copyNote(tx *gorm.DB, source models.Note, notebookID uuid.UUID, ownerID uuid.UUID, title string) (models.Note, error) {
+	var blocks []models.Block
+	if err := tx.Where("note_id = ?", source.ID).Order("\"order\" asc").Find(&blocks).Error; err != nil {
+		return models.Note{}, err
+	}
+
+	var tasks []models.Task
+	if err := tx.Where("note_id = ?", source.ID).Find(&tasks).Error; err != nil {
+		return models.Note{}, err
+	}
+
+	note := models.Note{
+		ID:         uuid.New(),
+		UserID:     ownerID,
+		NotebookID: notebookID,
+		Title:      title,
+		Tags:       source.Tags,
+	}
+
+	// The copy keeps showing its attachments once the original is purged
+	attachmentIDs, err := copyBlockAttachments(tx, blocks, source.ID, note)
+	if err != nil {
+		return models.Note{}, err
+	}
+
+	blockIDs := make(map[string]uuid.UUID, len(blocks))
+	for _, block := range blocks {
+		blockIDs[block.ID.String()] = uuid.New()
+	}
+	taskIDs := make(map[string]uuid.UUID, len(tasks))
+	for _, task := range tasks {
+		taskIDs[task.ID.String()] = uuid.New()
+	}
+
+	// Parents are inserted before their children
+	copies := make([]models.Block, 0, len(blocks))
+	for _, block := range models.SortBlocksDepthFirst(blocks) {
+		metadata := models.BlockMetadata{}
+		for key, value := range block.Metadata {
+			metadata[key] = value
+		}
+		if taskID, ok := metadata["task_id"].(string); ok {
+			if copyID, exists := taskIDs[taskID]; exists {
+				metadata["task_id"] = copyID.String()
+			} else {
+				delete(metadata, "task_id")
+			}
+		}
+
+		blockCopy := models.Block{
+			ID:       blockIDs[block.ID.String()],
+			Type:     block.Type,
+			Content:  repointAttachment(block.Content, attachmentIDs),
+			Metadata: metadata,
+			Order:    block.Order,
+		}
+		if block.ParentBlockID != nil {
+			parentID := blockIDs[block.ParentBlockID.String()]
+			blockCopy.ParentBlockID = &parentID
+		}
+		copies = append(copies, blockCopy)
+	}
+
+	note, err = createNoteTx(tx, note, copies, map[string]interface{}{
+		"source_note_id": source.ID.String(),
+	})
+	if err != nil {
+		return models.Note{}, err
+	}
+
+	taskCopies := make([]models.Task, 0, len(tasks))
+	for _, task := range tasks {
+		metadata := models.TaskMetadata{}
+		for key, value := range task.Metadata {
+			metadata[key] = value
+		}
+		if blockID, ok := metadata["block_id"].(string); ok {
+			if copyID, exists := blockIDs[blockID]; exists {
+				metadata["block_id"] = copyID.String()
+			} else {
+				delete(metadata, "block_id")
+			}
+		}
+		if _, ok := metadata["note_id"]; ok {
+			metadata["note_id"] = note.ID.String()
+		}
+
+		taskCopies = append(taskCopies, models.Task{
+			ID:          taskIDs[task.ID.String()],
+			UserID:      ownerID,
+			NoteID:      note.ID,
+			Title:       task.Title,
+			Description: task.Description,
+			IsCompleted: task.IsCompleted,
+			DueDate:     task.DueDate,
+			Metadata:    metadata,
+		})
+	}
+
+	if len(taskCopies) > 0 {
+		if err := tx.Create(&taskCopies).Error; err != nil {
+			return models.Note{}, err
+		}
+	}
+
+	return note, nil
+}
+
 func (s *NoteService) ListNotesByUser(db *database.Database, userID string) ([]models.Note, error) {
 	var notes []models.Note
 	if err := db.DB.Where("user_id = ?", userID).Find(&notes).Error; err != nil {
@@ -383,14 +686,24 @@ func (s *NoteService) GetAllNotes(db *database.Database) ([]models.Note, error)
 }
 
 // GetNotes retrieves notes based on query parameters with access control
-func (s *NoteService) GetNotes(db *database.Database, params map[string]interface{}) ([]models.Note, error) {
+func (s *NoteService) GetNotes(db *database.Database, params map[string]interface{}) ([]models.Note, PageInfo, error) {
 	var notes []models.Note
-	query := db.DB
+	query := db.DB.Model(&models.Note{})
 
 	// Always filter by user_id if provided - this is critical for RBAC
 	userID, ok := params["user_id"].(string)
 	if !ok || userID == "" {
-		return nil, errors.New("user_id is required for security reasons")
+		return nil, PageInfo{}, errors.New("user_id is required for security reasons")
+	}
+
+	page, err := parseListPage(params, "updated_at", "created_at", "title")
+	if err != nil {
+		return nil, PageInfo{}, err
+	}
+
+	blocksPreview, err := parseBlocksPreview(params)
+	if err != nil {
+		return nil, PageInfo{}, err
 	}
 
 	// Log for debugging
@@ -408,58 +721,113 @@ func (s *NoteService) GetNotes(db *database.Database, params map[string]interfac
 		query = query.Where("title LIKE ?", "%"+title+"%")
 	}
 
+	// Notes carrying all of the tags, or any of them
+	if tagsValue, ok := params["tags"].([]string); ok && len(tagsValue) > 0 {
+		tags, err := parseTagNames(tagsValue)
+		if err != nil {
+			return nil, PageInfo{}, err
+		}
+
+		switch params["tags_match"] {
+		case nil, "", TagMatchAll:
+			query = query.Where("tags @> ?::text[]", tags)
+		case TagMatchAny:
+			query = query.Where("tags && ?::text[]", tags)
+		default:
+			return nil, PageInfo{}, ErrInvalidInput
+		}
+	}
+
+	// Archived notes are left out unless asked for
+	stateScope, err := resourceStateScope(userID, models.NoteResource, params)
+	if err != nil {
+		return nil, PageInfo{}, err
+	}
+	query = query.Scopes(stateScope)
+
 	// Include or exclude deleted notes
-	query = query.Where("deleted_at IS NULL")
+	query = query.Where("deleted_at IS NULL").Session(&gorm.Session{})
+
+	var info PageInfo
+	if err := query.Count(&info.Total).Error; err != nil {
+		return nil, PageInfo{}, err
+	}
+
+	// Pinned notes come first, then the requested order
+	keys, err := page.keys("notes", userID)
+	if err != nil {
+		return nil, PageInfo{}, err
+	}
 
 	// Execute the query
-	if err := query.Find(&notes).Error; err != nil {
+	if err := page.apply(query, keys).Find(&notes).Error; err != nil {
 		log.Printf("Error executing note query: %v", err)
-		return nil, err
+		return nil, PageInfo{}, err
 	}
 
-	log.Printf("Found %d notes directly owned by user %s", len(notes), userID)
-
-	// Find notes where the user has explicit roles (using our new role service methods)
-	// var allRoles []models.Role
-	// roleParams := map[string]interface{}{
-	// 	"user_id":       userID,
-	// 	"resource_type": string(models.NoteResource),
-	// }
-	// sharedNotes, err := RoleServiceInstance.GetRoles(db, roleParams)
-	// if err != nil {
-	// 	log.Printf("Error finding role-based notes: %v", err)
-	// } else {
-	// 	for _, role := range sharedNotes {
-	// 		// Skip notes that the user already owns
-	// 		var isOwned bool
-	// 		for _, note := range notes {
-	// 			if note.ID == role.ResourceID {
-	// 				isOwned = true
-	// 				break
-	// 			}
-	// 		}
-
-	// 		if !isOwned {
-	// 			var sharedNote models.Note
-	// 			if err := db.DB.Where("id = ? AND deleted_at IS NULL", role.ResourceID).First(&sharedNote).Error; err == nil {
-	// 				notes = append(notes, sharedNote)
-	// 			}
-	// 		}
-	// 	}
-	// 	log.Printf("Found %d additional notes where user has an explicit role", len(notes)-len(allRoles))
-	// }
-
-	// Load blocks for each note
+	noteIDs := make([]uuid.UUID, len(notes))
 	for i := range notes {
-		if err := db.DB.Model(&notes[i]).Association("Blocks").Find(&notes[i].Blocks); err != nil {
-			log.Printf("Failed to load blocks for note %s: %v", notes[i].ID, err)
-		}
+		noteIDs[i] = notes[i].ID
+	}
+	states, err := loadResourceStates(db.DB, userID, noteIDs)
+	if err != nil {
+		return nil, PageInfo{}, err
+	}
+	for i := range notes {
+		notes[i].State = states[notes[i].ID]
+	}
+
+	var count int
+	count, info.NextCursor = page.trim(len(notes), func(i int) listItem {
+		return listItem{ID: notes[i].ID, State: notes[i].State, CreatedAt: notes[i].CreatedAt, UpdatedAt: notes[i].UpdatedAt, Title: notes[i].Title}
+	})
+	notes = notes[:count]
+
+	log.Printf("Found %d of %d notes directly owned by user %s", len(notes), info.Total, userID)
 
-		// Sort the blocks by order field
-		db.DB.Model(&models.Block{}).Where("note_id = ?", notes[i].ID).Order("\"order\" ASC").Find(&notes[i].Blocks)
+	if err := loadNoteBlocks(db.DB, notes, blocksPreview); err != nil {
+		log.Printf("Failed to load blocks of notes: %v", err)
+		return nil, PageInfo{}, err
 	}
 
-	return notes, nil
+	return notes, info, nil
+}
+
+// loadNoteBlocks fills in the blocks of the notes with one query, in block
+// order: all of them, none (preview 0), or the first preview of each note
+func loadNoteBlocks(db *gorm.DB, notes []models.Note, preview int) error {
+	if preview == 0 || len(notes) == 0 {
+		return nil
+	}
+
+	noteIDs := make([]uuid.UUID, len(notes))
+	for i := range notes {
+		noteIDs[i] = notes[i].ID
+	}
+
+	var blocks []models.Block
+	query := db.Where("note_id IN ?", noteIDs)
+	if preview > 0 {
+		ranked := db.Model(&models.Block{}).
+			Select("*, ROW_NUMBER() OVER (PARTITION BY note_id ORDER BY \"order\" ASC) AS position").
+			Where("note_id IN ?", noteIDs)
+		query = db.Table("(?) AS ranked", ranked).Where("position <= ?", preview)
+	}
+	if err := query.Order("\"order\" ASC").Find(&blocks).Error; err != nil {
+		return err
+	}
+
+	byNote := make(map[uuid.UUID][]models.Block, len(notes))
+	for _, block := range blocks {
+		byNote[block.NoteID] = append(byNote[block.NoteID], block)
+	}
+	for i := range notes {
+		notes[i].Blocks = byNote[notes[i].ID]
+		if notes[i].Blocks == nil {
+			notes[i].Blocks = []models.Block{}
+		}
+	}
+	return nil
 }
 
 // NewNoteService creates a new instance of NoteService
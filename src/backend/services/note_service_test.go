@@ -4,6 +4,7 @@ import (
 	"testing"
 	"time"
 
+	"owlistic-notes/owlistic/models"
 	"owlistic-notes/owlistic/testutils"
 
 	sqlmock "github.com/DATA-DOG/go-sqlmock"
@@ -144,6 +145,35 @@ func TestUpdateNote_Success(t *testing.T) {
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
+func TestUpdateNote_VersionConflict(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	noteID := uuid.New()
+	userID := uuid.New()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT count\\(\\*\\) FROM \"roles\"").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectQuery("SELECT \\* FROM \"notes\" WHERE id = (.+) FOR UPDATE").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "user_id", "version"}).
+			AddRow(noteID.String(), "Their Title", userID.String(), 4))
+	mock.ExpectRollback()
+
+	service := &NoteService{}
+	_, err := service.UpdateNote(db, noteID.String(), map[string]interface{}{
+		"title":            "My Title",
+		"expected_version": float64(3),
+	}, map[string]interface{}{"user_id": userID.String()})
+
+	var conflict *VersionConflictError
+	if assert.ErrorAs(t, err, &conflict) {
+		assert.Equal(t, int64(3), conflict.Expected)
+		assert.Equal(t, "Their Title", conflict.Current.(models.Note).Title)
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
 func TestGetNoteById_NotFound(t *testing.T) {
 	db, mock, close := testutils.SetupMockDB()
 	defer close()
@@ -225,3 +255,97 @@ func TestListNotesByUser_Success(t *testing.T) {
 	assert.NotEmpty(t, notes)
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
+
+func TestDuplicateNote_Success(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	userID := uuid.New()
+	noteID := uuid.New()
+	notebookID := uuid.New()
+	taskBlockID := uuid.New()
+	childBlockID := uuid.New()
+	taskID := uuid.New()
+
+	previous := RoleServiceInstance
+	RoleServiceInstance = &graphAccessStub{
+		notes:     map[string]bool{noteID.String(): true},
+		notebooks: map[string]bool{notebookID.String(): true},
+	}
+	defer func() { RoleServiceInstance = previous }()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT \* FROM "notes" WHERE id = \$1`).
+		WithArgs(noteID.String(), 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "notebook_id", "title"}).
+			AddRow(noteID, uuid.New(), notebookID, "Plan"))
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "notebooks" WHERE id = \$1`).
+		WithArgs(notebookID).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectQuery(`SELECT \* FROM "blocks" WHERE note_id = \$1`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "note_id", "parent_block_id", "type", "content", "metadata", "order"}).
+			AddRow(childBlockID, noteID, taskBlockID, "text", []byte(`{"text":"Details"}`), []byte(`{}`), 1000.0).
+			AddRow(taskBlockID, noteID, nil, "task", []byte(`{"text":"Ship"}`), []byte(`{"task_id":"`+taskID.String()+`"}`), 1000.0))
+	mock.ExpectQuery(`SELECT \* FROM "tasks" WHERE note_id = \$1`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "note_id", "title", "metadata"}).
+			AddRow(taskID, noteID, "Ship", []byte(`{"block_id":"`+taskBlockID.String()+`"}`)))
+	mock.ExpectQuery(`INSERT INTO "notes"`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(uuid.New()))
+	mock.ExpectExec(`INSERT INTO "roles"`).
+		WithArgs(sqlmock.AnyArg(), userID, sqlmock.AnyArg(), "note", "owner", sqlmock.AnyArg(), sqlmock.AnyArg(), nil).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery(`INSERT INTO "blocks"`).WillReturnRows(sqlmock.NewRows([]string{"created_at"}).AddRow(time.Now()))
+	mock.ExpectQuery(`INSERT INTO "blocks"`).WillReturnRows(sqlmock.NewRows([]string{"created_at"}).AddRow(time.Now()))
+	mock.ExpectQuery(`INSERT INTO "events"`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(uuid.New()))
+	mock.ExpectQuery(`INSERT INTO "tasks"`).WillReturnRows(sqlmock.NewRows([]string{"created_at"}).AddRow(time.Now()))
+	mock.ExpectCommit()
+
+	service := &NoteService{}
+	note, err := service.DuplicateNote(db, noteID.String(), map[string]interface{}{},
+		map[string]interface{}{"user_id": userID.String()})
+
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+	assert.Equal(t, "Plan (copy)", note.Title)
+	assert.Equal(t, userID, note.UserID)
+
+	// Parents come first, and the copies point at each other
+	if assert.Len(t, note.Blocks, 2) {
+		taskCopy, childCopy := note.Blocks[0], note.Blocks[1]
+		assert.NotEqual(t, taskBlockID, taskCopy.ID)
+		assert.Equal(t, taskCopy.ID, *childCopy.ParentBlockID)
+		assert.NotEqual(t, taskID.String(), taskCopy.Metadata["task_id"])
+		assert.NotEmpty(t, taskCopy.Metadata["task_id"])
+	}
+}
+
+func TestMoveNote_RequiresEditorOnDestination(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	userID := uuid.New()
+	noteID := uuid.New()
+	destinationID := uuid.New()
+
+	previous := RoleServiceInstance
+	RoleServiceInstance = &graphAccessStub{notes: map[string]bool{noteID.String(): true}}
+	defer func() { RoleServiceInstance = previous }()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT \* FROM "notes" WHERE id = \$1`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "notebook_id", "title"}).
+			AddRow(noteID, userID, uuid.New(), "Plan"))
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "notebooks" WHERE id = \$1`).
+		WithArgs(destinationID).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectRollback()
+
+	service := &NoteService{}
+	_, err := service.MoveNote(db, noteID.String(), destinationID.String(),
+		map[string]interface{}{"user_id": userID.String()})
+
+	assert.EqualError(t, err, "not authorized to add notes to this notebook")
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	_, err = service.MoveNote(db, noteID.String(), "", map[string]interface{}{"user_id": userID.String()})
+	assert.ErrorIs(t, err, ErrInvalidInput)
+}
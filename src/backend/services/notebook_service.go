@@ -11,6 +11,8 @@ import (
 	"owlistic-notes/owlistic/models"
 
 	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type NotebookServiceInterface interface {
@@ -20,7 +22,8 @@ type NotebookServiceInterface interface {
 	DeleteNotebook(db *database.Database, id string, params map[string]interface{}) error
 	ListNotebooksByUser(db *database.Database, userID string) ([]models.Notebook, error)
 	GetAllNotebooks(db *database.Database) ([]models.Notebook, error)
-	GetNotebooks(db *database.Database, params map[string]interface{}) ([]models.Notebook, error)
+	GetNotebooks(db *database.Database, params map[string]interface{}) ([]models.Notebook, PageInfo, error)
+	DuplicateNotebook(db *database.Database, id string, notebookData map[string]interface{}, params map[string]interface{}) (models.Notebook, error)
 }
 
 type NotebookService struct{}
@@ -62,11 +65,18 @@ func (s *NotebookService) CreateNotebook(db *database.Database, notebookData map
 	description, _ := notebookData["description"].(string)
 	notebookID := uuid.New()
 
+	parentID, err := notebookParent(db, notebookID, notebookData["parent_notebook_id"], userIDStr)
+	if err != nil {
+		tx.Rollback()
+		return models.Notebook{}, err
+	}
+
 	notebook := models.Notebook{
-		ID:          notebookID,
-		UserID:      userID,
-		Name:        name,
-		Description: description,
+		ID:               notebookID,
+		UserID:           userID,
+		Name:             name,
+		Description:      description,
+		ParentNotebookID: parentID,
 	}
 
 	if err := tx.Create(&notebook).Error; err != nil {
@@ -93,9 +103,11 @@ func (s *NotebookService) CreateNotebook(db *database.Database, notebookData map
 		string(broker.NotebookCreated),
 		"notebook",
 		map[string]interface{}{
-			"notebook_id": notebook.ID.String(),
-			"name":        notebook.Name,
-			"description": notebook.Description,
+			"notebook_id":        notebook.ID.String(),
+			"name":               notebook.Name,
+			"description":        notebook.Description,
+			"parent_notebook_id": notebook.ParentNotebookID,
+			"version":            notebook.Version,
 		},
 	)
 
@@ -153,6 +165,12 @@ func (s *NotebookService) UpdateNotebook(db *database.Database, id string, noteb
 		return models.Notebook{}, errors.New("user_id must be provided in parameters")
 	}
 
+	expected, err := expectedVersion(notebookData)
+	if err != nil {
+		tx.Rollback()
+		return models.Notebook{}, err
+	}
+
 	// Check if user has editor rights
 	hasAccess, err := RoleServiceInstance.HasNotebookAccess(db, userIDStr, id, "editor")
 	if err != nil {
@@ -166,11 +184,16 @@ func (s *NotebookService) UpdateNotebook(db *database.Database, id string, noteb
 	}
 
 	var notebook models.Notebook
-	if err := tx.First(&notebook, "id = ?", id).Error; err != nil {
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&notebook, "id = ?", id).Error; err != nil {
 		tx.Rollback()
 		return models.Notebook{}, ErrNotebookNotFound
 	}
 
+	if err := checkVersion(expected, notebook.Version, notebook); err != nil {
+		tx.Rollback()
+		return models.Notebook{}, err
+	}
+
 	// Update notebook fields
 	if name, ok := notebookData["name"].(string); ok {
 		notebook.Name = name
@@ -180,7 +203,18 @@ func (s *NotebookService) UpdateNotebook(db *database.Database, id string, noteb
 		notebook.Description = description
 	}
 
+	// A null or empty parent_notebook_id moves the notebook to the top
+	if value, exists := notebookData["parent_notebook_id"]; exists {
+		parentID, err := notebookParent(db, notebook.ID, value, userIDStr)
+		if err != nil {
+			tx.Rollback()
+			return models.Notebook{}, err
+		}
+		notebook.ParentNotebookID = parentID
+	}
+
 	notebook.UpdatedAt = time.Now()
+	notebook.Version++
 
 	if err := tx.Save(&notebook).Error; err != nil {
 		tx.Rollback()
@@ -192,9 +226,10 @@ func (s *NotebookService) UpdateNotebook(db *database.Database, id string, noteb
 		string(broker.NotebookUpdated),
 		"notebook",
 		map[string]interface{}{
-			"notebook_id": notebook.ID.String(),
-			"name":        notebook.Name,
-			"description": notebook.Description,
+			"notebook_id":        notebook.ID.String(),
+			"name":               notebook.Name,
+			"description":        notebook.Description,
+			"parent_notebook_id": notebook.ParentNotebookID,
 		},
 	)
 
@@ -261,13 +296,39 @@ func (s *NotebookService) DeleteNotebook(db *database.Database, id string, param
 		return errors.New("not authorized to delete this notebook")
 	}
 
-	if err := tx.Exec("UPDATE notes SET deleted_at = NOW() WHERE notebook_id = ?", id).Error; err != nil {
+	// Nested notebooks go to the trash along with it. They share its
+	// deletion time, so restoring it brings them back but not notebooks
+	// trashed on their own before.
+	subtree, err := notebookSubtree(tx, []uuid.UUID{notebook.ID})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	var notebookIDs []uuid.UUID
+	if err := tx.Model(&models.Notebook{}).Where("id IN ?", subtree).Pluck("id", &notebookIDs).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	var noteIDs []uuid.UUID
+	if err := tx.Model(&models.Note{}).Where("notebook_id IN ?", notebookIDs).Pluck("id", &noteIDs).Error; err != nil {
 		tx.Rollback()
 		return err
 	}
 
-	// Soft delete notebook (gorm will handle this)
-	if err := tx.Delete(&notebook).Error; err != nil {
+	deletedAt := time.Now()
+	if err := tx.Exec("UPDATE notes SET deleted_at = ? WHERE notebook_id IN ? AND deleted_at IS NULL", deletedAt, notebookIDs).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := setNoteLinksDeleted(tx, noteIDs, true); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Exec("UPDATE notebooks SET deleted_at = ? WHERE id IN ? AND deleted_at IS NULL", deletedAt, notebookIDs).Error; err != nil {
 		tx.Rollback()
 		return err
 	}
@@ -277,7 +338,8 @@ func (s *NotebookService) DeleteNotebook(db *database.Database, id string, param
 		string(broker.NotebookDeleted),
 		"notebook",
 		map[string]interface{}{
-			"notebook_id": notebook.ID.String(),
+			"notebook_id":  notebook.ID.String(),
+			"notebook_ids": notebookIDs,
 		},
 	)
 
@@ -298,6 +360,153 @@ func (s *NotebookService) DeleteNotebook(db *database.Database, id string, param
 	return nil
 }
 
+// DuplicateNotebook copies a notebook with its nested notebooks, their
+// notes and the notes' blocks and tasks. The caller owns the copy and
+// everything in it; roles others hold on the original are not carried over.
+// Notebooks in the trash are left out along with what is nested under them.
+func (s *NotebookService) DuplicateNotebook(db *database.Database, id string, notebookData map[string]interface{}, params map[string]interface{}) (models.Notebook, error) {
+	userIDStr, ok := params["user_id"].(string)
+	if !ok {
+		return models.Notebook{}, errors.New("user_id must be provided in parameters")
+	}
+
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return models.Notebook{}, ErrInvalidInput
+	}
+
+	hasAccess, err := RoleServiceInstance.HasNotebookAccess(db, userIDStr, id, "viewer")
+	if err != nil {
+		return models.Notebook{}, err
+	}
+
+	if !hasAccess {
+		return models.Notebook{}, errors.New("not authorized to access this notebook")
+	}
+
+	tx := db.DB.Begin()
+	if tx.Error != nil {
+		return models.Notebook{}, tx.Error
+	}
+
+	var notebook models.Notebook
+	if err := tx.First(&notebook, "id = ?", id).Error; err != nil {
+		tx.Rollback()
+		return models.Notebook{}, ErrNotebookNotFound
+	}
+
+	name := notebook.Name + " (copy)"
+	if override, ok := notebookData["name"].(string); ok && override != "" {
+		name = override
+	}
+
+	duplicate, err := copyNotebook(tx, notebook, nil, userID, name)
+	if err != nil {
+		tx.Rollback()
+		return models.Notebook{}, err
+	}
+
+	subtree, err := notebookSubtree(tx, []uuid.UUID{notebook.ID})
+	if err != nil {
+		tx.Rollback()
+		return models.Notebook{}, err
+	}
+
+	var nested []models.Notebook
+	if err := tx.Where("id IN ? AND id <> ?", subtree, notebook.ID).Order("created_at ASC").Find(&nested).Error; err != nil {
+		tx.Rollback()
+		return models.Notebook{}, err
+	}
+
+	children := make(map[uuid.UUID][]models.Notebook)
+	for _, child := range nested {
+		children[*child.ParentNotebookID] = append(children[*child.ParentNotebookID], child)
+	}
+
+	// Parents are copied before their children, so a child whose parent is
+	// in the trash is never reached
+	var copyChildren func(sourceID uuid.UUID, parent *models.Notebook) error
+	copyChildren = func(sourceID uuid.UUID, parent *models.Notebook) error {
+		parentID := parent.ID
+		for _, child := range children[sourceID] {
+			childCopy, err := copyNotebook(tx, child, &parentID, userID, child.Name)
+			if err != nil {
+				return err
+			}
+			if err := copyChildren(child.ID, &childCopy); err != nil {
+				return err
+			}
+			parent.Children = append(parent.Children, childCopy)
+		}
+		return nil
+	}
+
+	if err := copyChildren(notebook.ID, &duplicate); err != nil {
+		tx.Rollback()
+		return models.Notebook{}, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return models.Notebook{}, err
+	}
+
+	return duplicate, nil
+}
+
+// copyNotebook creates a copy of source owned by ownerID under parentID,
+// with copies of its notes
+func copyNotebook(tx *gorm.DB, source models.Notebook, parentID *uuid.UUID, ownerID uuid.UUID, name string) (models.Notebook, error) {
+	duplicate := models.Notebook{
+		ID:               uuid.New(),
+		UserID:           ownerID,
+		Name:             name,
+		Description:      source.Description,
+		ParentNotebookID: parentID,
+	}
+
+	if err := tx.Create(&duplicate).Error; err != nil {
+		return models.Notebook{}, err
+	}
+
+	role := models.Role{
+		ID:           uuid.New(),
+		UserID:       ownerID,
+		ResourceID:   duplicate.ID,
+		ResourceType: models.NotebookResource,
+		Role:         models.OwnerRole,
+	}
+
+	if err := tx.Create(&role).Error; err != nil {
+		return models.Notebook{}, err
+	}
+
+	if err := createEvent(tx, string(broker.NotebookCreated), "notebook", map[string]interface{}{
+		"notebook_id":        duplicate.ID.String(),
+		"name":               duplicate.Name,
+		"description":        duplicate.Description,
+		"parent_notebook_id": duplicate.ParentNotebookID,
+		"source_notebook_id": source.ID.String(),
+	}); err != nil {
+		return models.Notebook{}, err
+	}
+
+	var notes []models.Note
+	if err := tx.Where("notebook_id = ?", source.ID).Order("created_at ASC").Find(&notes).Error; err != nil {
+		return models.Notebook{}, err
+	}
+
+	duplicate.Notes = make([]models.Note, 0, len(notes))
+	for _, note := range notes {
+		noteCopy, err := copyNote(tx, note, duplicate.ID, ownerID, note.Title)
+		if err != nil {
+			return models.Notebook{}, err
+		}
+		duplicate.Notes = append(duplicate.Notes, noteCopy)
+	}
+
+	return duplicate, nil
+}
+
 func (s *NotebookService) ListNotebooksByUser(db *database.Database, userID string) ([]models.Notebook, error) {
 	var notebooks []models.Notebook
 	if err := db.DB.Where("user_id = ?", userID).Find(&notebooks).Error; err != nil {
@@ -314,14 +523,14 @@ func (s *NotebookService) GetAllNotebooks(db *database.Database) ([]models.Noteb
 	return notebooks, nil
 }
 
-func (s *NotebookService) GetNotebooks(db *database.Database, params map[string]interface{}) ([]models.Notebook, error) {
+func (s *NotebookService) GetNotebooks(db *database.Database, params map[string]interface{}) ([]models.Notebook, PageInfo, error) {
 	var notebooks []models.Notebook
-	query := db.DB
+	query := db.DB.Model(&models.Notebook{})
 
 	// More robust handling of user_id parameter
 	userIDValue, userIDExists := params["user_id"]
 	if !userIDExists {
-		return nil, errors.New("user_id parameter is missing")
+		return nil, PageInfo{}, errors.New("user_id parameter is missing")
 	}
 
 	var userIDStr string
@@ -335,63 +544,83 @@ func (s *NotebookService) GetNotebooks(db *database.Database, params map[string]
 	case uuid.UUID:
 		userIDStr = v.String()
 	default:
-		return nil, fmt.Errorf("user_id has invalid type: %T", userIDValue)
+		return nil, PageInfo{}, fmt.Errorf("user_id has invalid type: %T", userIDValue)
 	}
 
 	if userIDStr == "" {
-		return nil, errors.New("user_id cannot be empty")
+		return nil, PageInfo{}, errors.New("user_id cannot be empty")
 	}
 
-	// Apply user filter - only do this once
-	query = query.Where("user_id = ?", userIDStr)
+	page, err := parseListPage(params, "updated_at", "created_at", "name")
+	if err != nil {
+		return nil, PageInfo{}, err
+	}
+
+	// Notebooks the user owns, has been given an explicit role on, or that
+	// are nested under one they have a role on
+	query = query.Where(`(user_id = ? OR id IN (WITH RECURSIVE shared AS (
+			SELECT resource_id AS id FROM roles WHERE user_id = ? AND resource_type = ? AND deleted_at IS NULL
+			UNION
+			SELECT notebooks.id FROM notebooks JOIN shared ON notebooks.parent_notebook_id = shared.id
+		) SELECT id FROM shared))`,
+		userIDStr, userIDStr, models.NotebookResource)
 
 	// Apply other filters
 	if name, ok := params["name"].(string); ok && name != "" {
 		query = query.Where("name LIKE ?", "%"+name+"%")
 	}
 
+	// Archived notebooks are left out unless asked for
+	stateScope, err := resourceStateScope(userIDStr, models.NotebookResource, params)
+	if err != nil {
+		return nil, PageInfo{}, err
+	}
+	query = query.Scopes(stateScope)
+
 	// Include or exclude deleted notebooks
-	query = query.Where("deleted_at IS NULL")
+	query = query.Where("deleted_at IS NULL").Session(&gorm.Session{})
 
-	if err := query.Find(&notebooks).Error; err != nil {
-		return nil, err
+	var info PageInfo
+	if err := query.Count(&info.Total).Error; err != nil {
+		return nil, PageInfo{}, err
 	}
 
-	log.Printf("Found %d notebooks directly owned by user %s", len(notebooks), userIDStr)
+	// Pinned notebooks come first, then the requested order
+	keys, err := page.keys("notebooks", userIDStr)
+	if err != nil {
+		return nil, PageInfo{}, err
+	}
 
-	// Also find notebooks where the user has been given an explicit role
-	roleParams := map[string]interface{}{
-		"user_id":       userIDStr,
-		"resource_type": string(models.NotebookResource),
+	if err := page.apply(query, keys).Find(&notebooks).Error; err != nil {
+		return nil, PageInfo{}, err
 	}
 
-	sharedRoles, err := RoleServiceInstance.GetRoles(db, roleParams)
+	notebookIDs := make([]uuid.UUID, len(notebooks))
+	for i := range notebooks {
+		notebookIDs[i] = notebooks[i].ID
+	}
+	states, err := loadResourceStates(db.DB, userIDStr, notebookIDs)
 	if err != nil {
-		log.Printf("Error finding role-based notebooks: %v", err)
-	} else {
-		for _, role := range sharedRoles {
-			// Skip notebooks the user already owns
-			var isOwned bool
-			for _, notebook := range notebooks {
-				if notebook.ID == role.ResourceID {
-					isOwned = true
-					break
-				}
-			}
+		return nil, PageInfo{}, err
+	}
+	for i := range notebooks {
+		notebooks[i].State = states[notebooks[i].ID]
+	}
 
-			if !isOwned {
-				var sharedNotebook models.Notebook
-				if err := db.DB.Where("id = ? AND deleted_at IS NULL", role.ResourceID).
-					First(&sharedNotebook).Error; err == nil {
-					notebooks = append(notebooks, sharedNotebook)
-				}
-			}
-		}
-		log.Printf("Found %d additional notebooks where user has an explicit role",
-			len(sharedRoles)-len(notebooks))
+	var count int
+	count, info.NextCursor = page.trim(len(notebooks), func(i int) listItem {
+		return listItem{ID: notebooks[i].ID, State: notebooks[i].State, CreatedAt: notebooks[i].CreatedAt, UpdatedAt: notebooks[i].UpdatedAt, Title: notebooks[i].Name}
+	})
+	notebooks = notebooks[:count]
+
+	log.Printf("Found %d of %d notebooks of user %s", len(notebooks), info.Total, userIDStr)
+
+	// tree=true nests the notebooks of the page under their parents
+	if tree, _ := params["tree"].(bool); tree {
+		notebooks = notebookTree(notebooks)
 	}
 
-	return notebooks, nil
+	return notebooks, info, nil
 }
 
 // NewNotebookService creates a new instance of NotebookService
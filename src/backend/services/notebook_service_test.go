@@ -4,6 +4,7 @@ import (
 	"testing"
 	"time"
 
+	"owlistic-notes/owlistic/database"
 	"owlistic-notes/owlistic/testutils"
 
 	sqlmock "github.com/DATA-DOG/go-sqlmock"
@@ -222,3 +223,69 @@ func TestListNotebooksByUser_Success(t *testing.T) {
 	assert.Equal(t, 2, len(notebooks))
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
+
+// notebookAccessStub grants access to every notebook
+type notebookAccessStub struct {
+	RoleServiceInterface
+}
+
+func (s *notebookAccessStub) HasNotebookAccess(db *database.Database, userID string, notebookID string, requiredRole string) (bool, error) {
+	return true, nil
+}
+
+// expectNotebookCopy expects a notebook without notes to be copied
+func expectNotebookCopy(mock sqlmock.Sqlmock, name string) {
+	mock.ExpectQuery(`INSERT INTO "notebooks"`).
+		WithArgs(sqlmock.AnyArg(), name, "", sqlmock.AnyArg(), nil, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at"}).AddRow(uuid.New().String(), time.Now(), time.Now()))
+	mock.ExpectExec(`INSERT INTO "roles"`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`INSERT INTO "events"`).
+		WithArgs("notebook.created", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), "pending", false, nil, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(uuid.New().String()))
+	mock.ExpectQuery(`SELECT \* FROM "notes" WHERE notebook_id = \$1`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+}
+
+func TestDuplicateNotebook_CopiesNestedNotebooks(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	userID := uuid.New()
+	notebookID := uuid.New()
+	childID := uuid.New()
+	trashedID := uuid.New()
+
+	previous := RoleServiceInstance
+	RoleServiceInstance = &notebookAccessStub{}
+	defer func() { RoleServiceInstance = previous }()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT \* FROM "notebooks" WHERE id = \$1`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name"}).
+			AddRow(notebookID.String(), userID.String(), "Projects"))
+	expectNotebookCopy(mock, "Projects (copy)")
+
+	// The trashed notebook is not listed, so what is under it stays behind
+	mock.ExpectQuery(`WITH RECURSIVE subtree`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).
+			AddRow(notebookID.String()).AddRow(childID.String()).AddRow(trashedID.String()).AddRow(uuid.New().String()))
+	mock.ExpectQuery(`SELECT \* FROM "notebooks" WHERE \(id IN \(\$1,\$2,\$3,\$4\) AND id <> \$5\)`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "parent_notebook_id"}).
+			AddRow(childID.String(), userID.String(), "Owl", notebookID.String()).
+			AddRow(uuid.New().String(), userID.String(), "Archive", trashedID.String()))
+	expectNotebookCopy(mock, "Owl")
+	mock.ExpectCommit()
+
+	service := &NotebookService{}
+	duplicate, err := service.DuplicateNotebook(db, notebookID.String(), map[string]interface{}{}, map[string]interface{}{"user_id": userID.String()})
+
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+	assert.Equal(t, "Projects (copy)", duplicate.Name)
+	assert.Nil(t, duplicate.ParentNotebookID)
+	if assert.Len(t, duplicate.Children, 1) {
+		assert.Equal(t, "Owl", duplicate.Children[0].Name)
+		assert.Equal(t, duplicate.ID, *duplicate.Children[0].ParentNotebookID)
+	}
+}
@@ -0,0 +1,174 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+
+	"owlistic-notes/owlistic/database"
+	"owlistic-notes/owlistic/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// notebookAncestors returns the notebook followed by its parent, its
+// parent's parent and so on up to the top. Trashed notebooks are part of the
+// chain.
+func notebookAncestors(db *gorm.DB, notebookID uuid.UUID) ([]uuid.UUID, error) {
+	var chain []uuid.UUID
+	err := db.Raw(`WITH RECURSIVE chain AS (
+			SELECT id, parent_notebook_id, 0 AS depth FROM notebooks WHERE id = ?
+			UNION ALL
+			SELECT notebooks.id, notebooks.parent_notebook_id, chain.depth + 1
+			FROM notebooks JOIN chain ON notebooks.id = chain.parent_notebook_id
+			WHERE chain.depth < ?
+		)
+		SELECT id FROM chain ORDER BY depth`, notebookID, models.MaxNotebookDepth).
+		Scan(&chain).Error
+	return chain, err
+}
+
+// notebookSubtree returns the notebooks nested under the given ones at any
+// depth, the given ones included. Trashed notebooks are part of the subtree.
+func notebookSubtree(db *gorm.DB, notebookIDs []uuid.UUID) ([]uuid.UUID, error) {
+	var subtree []uuid.UUID
+	err := notebookSubtreeQuery(db, notebookIDs).Scan(&subtree).Error
+	return subtree, err
+}
+
+// notebookSubtreeQuery selects the IDs notebookSubtree returns, for use as a
+// subquery
+func notebookSubtreeQuery(db *gorm.DB, notebookIDs []uuid.UUID) *gorm.DB {
+	return db.Raw(`WITH RECURSIVE subtree AS (
+			SELECT id FROM notebooks WHERE id IN ?
+			UNION
+			SELECT notebooks.id FROM notebooks JOIN subtree ON notebooks.parent_notebook_id = subtree.id
+		)
+		SELECT id FROM subtree`, notebookIDs)
+}
+
+// notebookLineageQuery selects the IDs of the given notebooks and of all
+// their ancestors, for use as a subquery
+func notebookLineageQuery(db *gorm.DB, notebookIDs []uuid.UUID) *gorm.DB {
+	return db.Raw(`WITH RECURSIVE lineage AS (
+			SELECT id, parent_notebook_id FROM notebooks WHERE id IN ?
+			UNION
+			SELECT notebooks.id, notebooks.parent_notebook_id
+			FROM notebooks JOIN lineage ON notebooks.id = lineage.parent_notebook_id
+		)
+		SELECT id FROM lineage`, notebookIDs)
+}
+
+// notebookHeight returns how many levels the notebook and the notebooks
+// nested under it take up, 1 for a notebook without children
+func notebookHeight(db *gorm.DB, notebookID uuid.UUID) (int, error) {
+	var height int
+	err := db.Raw(`WITH RECURSIVE subtree AS (
+			SELECT id, 1 AS depth FROM notebooks WHERE id = ?
+			UNION ALL
+			SELECT notebooks.id, subtree.depth + 1
+			FROM notebooks JOIN subtree ON notebooks.parent_notebook_id = subtree.id
+			WHERE subtree.depth < ?
+		)
+		SELECT COALESCE(MAX(depth), 1) FROM subtree`, notebookID, models.MaxNotebookDepth).
+		Scan(&height).Error
+	return height, err
+}
+
+// notebookParent checks the "parent_notebook_id" of notebookData for the
+// notebook with the given id, uuid.Nil for a new one. The user needs editor
+// access to the parent, the notebook can't end up under itself and its
+// subtree has to stay within models.MaxNotebookDepth. A nil
+// result moves the notebook to the top.
+func notebookParent(db *database.Database, notebookID uuid.UUID, value interface{}, userIDStr string) (*uuid.UUID, error) {
+	if value == nil || value == "" {
+		return nil, nil
+	}
+
+	parentIDStr, ok := value.(string)
+	if !ok {
+		return nil, fmt.Errorf("%w: parent_notebook_id must be a notebook ID", ErrInvalidInput)
+	}
+
+	parentID, err := uuid.Parse(parentIDStr)
+	if err != nil {
+		return nil, fmt.Errorf("%w: parent_notebook_id must be a notebook ID", ErrInvalidInput)
+	}
+
+	var parent models.Notebook
+	if err := db.DB.Select("id").First(&parent, "id = ?", parentID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: parent notebook not found", ErrInvalidInput)
+		}
+		return nil, err
+	}
+
+	hasAccess, err := RoleServiceInstance.HasNotebookAccess(db, userIDStr, parentIDStr, "editor")
+	if err != nil {
+		return nil, err
+	}
+
+	if !hasAccess {
+		return nil, errors.New("not authorized to add notebooks to this notebook")
+	}
+
+	ancestors, err := notebookAncestors(db.DB, parentID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ancestorID := range ancestors {
+		if ancestorID == notebookID {
+			return nil, ErrNotebookCycle
+		}
+	}
+
+	// A moved notebook brings the notebooks nested under it along
+	height := 1
+	if notebookID != uuid.Nil {
+		height, err = notebookHeight(db.DB, notebookID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(ancestors)+height > models.MaxNotebookDepth {
+		return nil, fmt.Errorf("%w: notebooks can be nested at most %d deep", ErrInvalidInput, models.MaxNotebookDepth)
+	}
+
+	return &parentID, nil
+}
+
+// notebookTree nests the notebooks under their parents. Notebooks whose
+// parent is not among them stay at the top, in their original order.
+func notebookTree(notebooks []models.Notebook) []models.Notebook {
+	listed := make(map[uuid.UUID]bool, len(notebooks))
+	children := make(map[uuid.UUID][]models.Notebook)
+	for _, notebook := range notebooks {
+		listed[notebook.ID] = true
+	}
+
+	var roots []models.Notebook
+	for _, notebook := range notebooks {
+		if notebook.ParentNotebookID != nil && listed[*notebook.ParentNotebookID] {
+			children[*notebook.ParentNotebookID] = append(children[*notebook.ParentNotebookID], notebook)
+		} else {
+			roots = append(roots, notebook)
+		}
+	}
+
+	var attach func(level []models.Notebook) []models.Notebook
+	attach = func(level []models.Notebook) []models.Notebook {
+		for i := range level {
+			level[i].Children = attach(children[level[i].ID])
+		}
+		return level
+	}
+
+	// Notebooks caught in a cycle have no way up to a root and are dropped
+	tree := attach(roots)
+	if tree == nil {
+		tree = []models.Notebook{}
+	}
+	return tree
+}
@@ -0,0 +1,153 @@
+package services
+
+import (
+	"testing"
+
+	"owlistic-notes/owlistic/models"
+	"owlistic-notes/owlistic/testutils"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNotebookTree(t *testing.T) {
+	team, project, area, other := uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	hidden := uuid.New()
+
+	tree := notebookTree([]models.Notebook{
+		{ID: area, Name: "Area", ParentNotebookID: &project},
+		{ID: team, Name: "Team"},
+		{ID: project, Name: "Project", ParentNotebookID: &team},
+		{ID: other, Name: "Shared", ParentNotebookID: &hidden},
+	})
+
+	if assert.Len(t, tree, 2) {
+		assert.Equal(t, "Team", tree[0].Name)
+		assert.Equal(t, "Shared", tree[1].Name)
+		if assert.Len(t, tree[0].Children, 1) && assert.Len(t, tree[0].Children[0].Children, 1) {
+			assert.Equal(t, "Area", tree[0].Children[0].Children[0].Name)
+		}
+	}
+
+	assert.Equal(t, []models.Notebook{}, notebookTree(nil))
+}
+
+func TestNotebookParent_RejectsCycle(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	notebookID := uuid.New()
+	childID := uuid.New()
+
+	previous := RoleServiceInstance
+	RoleServiceInstance = &graphAccessStub{notebooks: map[string]bool{childID.String(): true}}
+	defer func() { RoleServiceInstance = previous }()
+
+	mock.ExpectQuery("SELECT \"id\" FROM \"notebooks\" WHERE id = (.+)").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(childID.String()))
+	mock.ExpectQuery("WITH RECURSIVE chain AS").
+		WithArgs(childID, models.MaxNotebookDepth).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(childID.String()).AddRow(notebookID.String()))
+
+	_, err := notebookParent(db, notebookID, childID.String(), uuid.New().String())
+
+	assert.ErrorIs(t, err, ErrNotebookCycle)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestNotebookParent_RejectsDeepSubtree(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	notebookID := uuid.New()
+	parentID := uuid.New()
+
+	previous := RoleServiceInstance
+	RoleServiceInstance = &graphAccessStub{notebooks: map[string]bool{parentID.String(): true}}
+	defer func() { RoleServiceInstance = previous }()
+
+	// The parent sits 31 levels deep
+	chain := sqlmock.NewRows([]string{"id"}).AddRow(parentID.String())
+	for i := 1; i < models.MaxNotebookDepth-1; i++ {
+		chain.AddRow(uuid.New().String())
+	}
+
+	mock.ExpectQuery("SELECT \"id\" FROM \"notebooks\" WHERE id = (.+)").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(parentID.String()))
+	mock.ExpectQuery("WITH RECURSIVE chain AS").
+		WithArgs(parentID, models.MaxNotebookDepth).
+		WillReturnRows(chain)
+	// The moved notebook has a child of its own
+	mock.ExpectQuery("WITH RECURSIVE subtree AS").
+		WithArgs(notebookID, models.MaxNotebookDepth).
+		WillReturnRows(sqlmock.NewRows([]string{"coalesce"}).AddRow(2))
+
+	_, err := notebookParent(db, notebookID, parentID.String(), uuid.New().String())
+
+	assert.ErrorIs(t, err, ErrInvalidInput)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestNotebookParent(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	parentID := uuid.New()
+
+	previous := RoleServiceInstance
+	RoleServiceInstance = &graphAccessStub{notebooks: map[string]bool{parentID.String(): true}}
+	defer func() { RoleServiceInstance = previous }()
+
+	mock.ExpectQuery("SELECT \"id\" FROM \"notebooks\" WHERE id = (.+)").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(parentID.String()))
+	mock.ExpectQuery("WITH RECURSIVE chain AS").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(parentID.String()))
+
+	parent, err := notebookParent(db, uuid.Nil, parentID.String(), uuid.New().String())
+
+	assert.NoError(t, err)
+	if assert.NotNil(t, parent) {
+		assert.Equal(t, parentID, *parent)
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	// Clearing the parent moves the notebook to the top
+	parent, err = notebookParent(db, uuid.New(), nil, uuid.New().String())
+	assert.NoError(t, err)
+	assert.Nil(t, parent)
+
+	_, err = notebookParent(db, uuid.New(), "team", uuid.New().String())
+	assert.ErrorIs(t, err, ErrInvalidInput)
+}
+
+func TestHasAccess_InheritsFromAncestorNotebooks(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	userID := uuid.New()
+	noteID := uuid.New()
+	areaID, projectID, teamID := uuid.New(), uuid.New(), uuid.New()
+
+	mock.ExpectQuery("SELECT count\\(\\*\\) FROM \"roles\"").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery("SELECT \\* FROM \"roles\" WHERE \\(user_id = (.+) AND resource_id = (.+) AND resource_type = (.+)").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery("SELECT notebook_id, user_id FROM \"notes\"").
+		WillReturnRows(sqlmock.NewRows([]string{"notebook_id", "user_id"}).AddRow(areaID.String(), uuid.New().String()))
+	mock.ExpectQuery("WITH RECURSIVE chain AS").
+		WithArgs(areaID, models.MaxNotebookDepth).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).
+			AddRow(areaID.String()).AddRow(projectID.String()).AddRow(teamID.String()))
+	// The role on the team notebook two levels up applies
+	mock.ExpectQuery("SELECT \\* FROM \"roles\" WHERE \\(user_id = (.+) AND resource_id IN (.+)").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "resource_id", "resource_type", "role"}).
+			AddRow(uuid.New().String(), userID.String(), teamID.String(), "notebook", "editor"))
+
+	service := &RoleService{}
+	hasAccess, err := service.HasAccess(db, userID, noteID, models.NoteResource, models.EditorRole)
+
+	assert.NoError(t, err)
+	assert.True(t, hasAccess)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
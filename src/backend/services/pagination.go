@@ -0,0 +1,263 @@
+package services
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"owlistic-notes/owlistic/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Listing sort directions
+const (
+	SortAsc  = "asc"
+	SortDesc = "desc"
+)
+
+// maxPageSize bounds the number of items returned in one page
+const maxPageSize = 500
+
+// PageInfo describes a page of a listing: how many items match the filters
+// in all, and the cursor fetching the page after it, empty on the last page
+type PageInfo struct {
+	Total      int64  `json:"total"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// listPage is a parsed "sort", "order", "limit" and "cursor" request. A limit
+// of 0 returns every item after the cursor.
+type listPage struct {
+	sort  string
+	desc  bool
+	limit int
+	after *listCursor
+}
+
+// listCursor marks the last item of a page by its sort keys. It is handed
+// out base64 encoded and only fits a listing sorted the same way.
+type listCursor struct {
+	Sort     string    `json:"s"`
+	Desc     bool      `json:"d,omitempty"`
+	Pinned   bool      `json:"p,omitempty"`
+	PinOrder float64   `json:"o,omitempty"`
+	Value    string    `json:"v"`
+	ID       uuid.UUID `json:"id"`
+}
+
+// listItem is the part of a listed item its cursor is made of
+type listItem struct {
+	ID        uuid.UUID
+	State     *models.ResourceState
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Title     string
+}
+
+// sortKey is one expression of an ORDER BY, with the value the cursor
+// holds for it
+type sortKey struct {
+	expr  string
+	args  []interface{}
+	desc  bool
+	value interface{}
+}
+
+// parseListPage reads the paging parameters. columns lists the accepted
+// sort fields; dates sort newest first and text A to Z unless "order" says
+// otherwise.
+func parseListPage(params map[string]interface{}, columns ...string) (listPage, error) {
+	page := listPage{sort: "updated_at"}
+
+	if sortField, _ := params["sort"].(string); sortField != "" {
+		valid := false
+		for _, column := range columns {
+			valid = valid || column == sortField
+		}
+		if !valid {
+			return listPage{}, fmt.Errorf("%w: sort must be one of %s", ErrInvalidInput, strings.Join(columns, ", "))
+		}
+		page.sort = sortField
+	}
+
+	switch order, _ := params["order"].(string); order {
+	case "":
+		page.desc = page.sortsByTime()
+	case SortAsc:
+	case SortDesc:
+		page.desc = true
+	default:
+		return listPage{}, fmt.Errorf("%w: order must be asc or desc", ErrInvalidInput)
+	}
+
+	if limit, ok := params["limit"].(int); ok {
+		if limit < 0 {
+			return listPage{}, fmt.Errorf("%w: limit must not be negative", ErrInvalidInput)
+		}
+		page.limit = min(limit, maxPageSize)
+	}
+
+	if encoded, _ := params["cursor"].(string); encoded != "" {
+		cursor, err := decodeListCursor(encoded)
+		if err != nil || cursor.Sort != page.sort || cursor.Desc != page.desc {
+			return listPage{}, fmt.Errorf("%w: cursor does not fit this listing", ErrInvalidInput)
+		}
+		page.after = &cursor
+	}
+
+	return page, nil
+}
+
+func (p listPage) sortsByTime() bool {
+	return p.sort == "created_at" || p.sort == "updated_at"
+}
+
+// keys returns the ORDER BY of the listing over table. Given a user, the
+// items that user pinned come first, in pin order. The id breaks ties so
+// every item has a single place.
+func (p listPage) keys(table string, userID string) ([]sortKey, error) {
+	var keys []sortKey
+	var cursor listCursor
+	if p.after != nil {
+		cursor = *p.after
+	}
+
+	if userID != "" {
+		pinned := "SELECT %s FROM resource_states WHERE resource_states.user_id = ? AND resource_states.resource_id = " +
+			table + ".id AND resource_states.pinned"
+		keys = append(keys,
+			sortKey{expr: "EXISTS (" + fmt.Sprintf(pinned, "1") + ")", args: []interface{}{userID}, desc: true, value: cursor.Pinned},
+			sortKey{expr: "COALESCE((" + fmt.Sprintf(pinned, "pin_order") + "), 0)", args: []interface{}{userID}, value: cursor.PinOrder},
+		)
+	}
+
+	var value interface{} = cursor.Value
+	if p.after != nil && p.sortsByTime() {
+		at, err := time.Parse(time.RFC3339Nano, cursor.Value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: cursor does not fit this listing", ErrInvalidInput)
+		}
+		value = at
+	}
+
+	return append(keys,
+		sortKey{expr: table + "." + p.sort, desc: p.desc, value: value},
+		sortKey{expr: table + ".id", desc: p.desc, value: cursor.ID},
+	), nil
+}
+
+// apply orders the query, skips to the cursor and limits it to one item
+// past the page, which tells whether there is a next page
+func (p listPage) apply(query *gorm.DB, keys []sortKey) *gorm.DB {
+	if p.after != nil {
+		condition, args := keysetCondition(keys)
+		query = query.Where(condition, args...)
+	}
+
+	var orderBy []string
+	var orderArgs []interface{}
+	for _, key := range keys {
+		direction := "ASC"
+		if key.desc {
+			direction = "DESC"
+		}
+		orderBy = append(orderBy, key.expr+" "+direction)
+		orderArgs = append(orderArgs, key.args...)
+	}
+	query = query.Order(clause.OrderBy{Expression: clause.Expr{
+		SQL:                strings.Join(orderBy, ", "),
+		Vars:               orderArgs,
+		WithoutParentheses: true,
+	}})
+
+	if p.limit > 0 {
+		query = query.Limit(p.limit + 1)
+	}
+	return query
+}
+
+// trim cuts the extra item apply fetched and returns the cursor of the page
+// after, if there is one
+func (p listPage) trim(count int, last func(i int) listItem) (int, string) {
+	if p.limit == 0 || count <= p.limit {
+		return count, ""
+	}
+	return p.limit, p.cursorAfter(last(p.limit - 1))
+}
+
+// cursorAfter encodes the cursor of the page following item
+func (p listPage) cursorAfter(item listItem) string {
+	cursor := listCursor{Sort: p.sort, Desc: p.desc, ID: item.ID}
+	if item.State != nil && item.State.Pinned {
+		cursor.Pinned, cursor.PinOrder = true, item.State.PinOrder
+	}
+
+	switch p.sort {
+	case "created_at":
+		cursor.Value = item.CreatedAt.Format(time.RFC3339Nano)
+	case "updated_at":
+		cursor.Value = item.UpdatedAt.Format(time.RFC3339Nano)
+	default:
+		cursor.Value = item.Title
+	}
+
+	encoded, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(encoded)
+}
+
+func decodeListCursor(encoded string) (listCursor, error) {
+	var cursor listCursor
+	decoded, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return cursor, err
+	}
+	err = json.Unmarshal(decoded, &cursor)
+	return cursor, err
+}
+
+// keysetCondition selects the rows sorting after the cursor values of keys:
+// (k1 > v1) OR (k1 = v1 AND k2 > v2) OR ..., with < for descending keys
+func keysetCondition(keys []sortKey) (string, []interface{}) {
+	var alternatives []string
+	var args []interface{}
+	for i, key := range keys {
+		var terms []string
+		for _, equal := range keys[:i] {
+			terms = append(terms, equal.expr+" = ?")
+			args = append(append(args, equal.args...), equal.value)
+		}
+
+		operator := " > ?"
+		if key.desc {
+			operator = " < ?"
+		}
+		terms = append(terms, key.expr+operator)
+		args = append(append(args, key.args...), key.value)
+
+		alternatives = append(alternatives, "("+strings.Join(terms, " AND ")+")")
+	}
+	return "(" + strings.Join(alternatives, " OR ") + ")", args
+}
+
+// parseBlocksPreview reads how many blocks to load with each note: "all"
+// (-1) by default, "none" (0), or a number of leading blocks
+func parseBlocksPreview(params map[string]interface{}) (int, error) {
+	switch blocks, _ := params["blocks"].(string); blocks {
+	case "", "all":
+		return -1, nil
+	case "none":
+		return 0, nil
+	default:
+		count, err := strconv.Atoi(blocks)
+		if err != nil || count < 1 {
+			return 0, fmt.Errorf("%w: blocks must be all, none or a positive number", ErrInvalidInput)
+		}
+		return count, nil
+	}
+}
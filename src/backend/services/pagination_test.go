@@ -0,0 +1,163 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"owlistic-notes/owlistic/models"
+	"owlistic-notes/owlistic/testutils"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseListPage(t *testing.T) {
+	page, err := parseListPage(map[string]interface{}{}, "updated_at", "title")
+	assert.NoError(t, err)
+	assert.Equal(t, "updated_at", page.sort)
+	assert.True(t, page.desc)
+
+	page, err = parseListPage(map[string]interface{}{"sort": "title", "limit": 5000}, "updated_at", "title")
+	assert.NoError(t, err)
+	assert.False(t, page.desc)
+	assert.Equal(t, maxPageSize, page.limit)
+
+	for _, params := range []map[string]interface{}{
+		{"sort": "size"},
+		{"order": "sideways"},
+		{"limit": -1},
+		{"cursor": "not a cursor"},
+	} {
+		_, err = parseListPage(params, "updated_at", "title")
+		assert.ErrorIs(t, err, ErrInvalidInput, "%v", params)
+	}
+}
+
+func TestListCursor_RoundTrip(t *testing.T) {
+	page := listPage{sort: "updated_at", desc: true, limit: 2}
+	id := uuid.New()
+	at := time.Date(2026, 10, 16, 9, 30, 0, 123456000, time.UTC)
+
+	cursor := page.cursorAfter(listItem{ID: id, UpdatedAt: at, State: &models.ResourceState{Pinned: true, PinOrder: 2000}})
+
+	next, err := parseListPage(map[string]interface{}{"cursor": cursor}, "updated_at")
+	assert.NoError(t, err)
+	if assert.NotNil(t, next.after) {
+		assert.Equal(t, id, next.after.ID)
+		assert.True(t, next.after.Pinned)
+		assert.Equal(t, 2000.0, next.after.PinOrder)
+	}
+
+	keys, err := next.keys("notes", "user")
+	assert.NoError(t, err)
+	assert.Len(t, keys, 4)
+	assert.Equal(t, at, keys[2].value)
+
+	// A cursor of one order doesn't fit another
+	_, err = parseListPage(map[string]interface{}{"cursor": cursor, "order": SortAsc}, "updated_at")
+	assert.ErrorIs(t, err, ErrInvalidInput)
+}
+
+func TestKeysetCondition(t *testing.T) {
+	condition, args := keysetCondition([]sortKey{
+		{expr: "pinned(?)", args: []interface{}{"u"}, desc: true, value: true},
+		{expr: "title", value: "b"},
+		{expr: "id", value: "x"},
+	})
+
+	assert.Equal(t, "((pinned(?) < ?) OR (pinned(?) = ? AND title > ?) OR (pinned(?) = ? AND title = ? AND id > ?))", condition)
+	assert.Equal(t, []interface{}{"u", true, "u", true, "b", "u", true, "b", "x"}, args)
+}
+
+func TestParseBlocksPreview(t *testing.T) {
+	for value, expected := range map[string]int{"": -1, "all": -1, "none": 0, "3": 3} {
+		count, err := parseBlocksPreview(map[string]interface{}{"blocks": value})
+		assert.NoError(t, err)
+		assert.Equal(t, expected, count, value)
+	}
+
+	_, err := parseBlocksPreview(map[string]interface{}{"blocks": "0"})
+	assert.ErrorIs(t, err, ErrInvalidInput)
+}
+
+func TestGetTasks_Paginated(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	userID := uuid.New()
+	first, second, third := uuid.New(), uuid.New(), uuid.New()
+
+	mock.ExpectQuery("SELECT count\\(\\*\\) FROM \"tasks\" WHERE user_id = (.+) AND deleted_at IS NULL").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+	mock.ExpectQuery("SELECT \\* FROM \"tasks\" WHERE (.+) ORDER BY tasks.title ASC, tasks.id ASC LIMIT \\$2").
+		WithArgs(userID.String(), 3).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title"}).
+			AddRow(first.String(), "Alpha").
+			AddRow(second.String(), "Beta").
+			AddRow(third.String(), "Gamma"))
+
+	service := &TaskService{}
+	tasks, page, err := service.GetTasks(db, map[string]interface{}{
+		"user_id": userID.String(),
+		"sort":    "title",
+		"limit":   2,
+	})
+
+	assert.NoError(t, err)
+	assert.Len(t, tasks, 2)
+	assert.Equal(t, int64(3), page.Total)
+	assert.NotEmpty(t, page.NextCursor)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	// The next page starts after Beta
+	mock.ExpectQuery("SELECT count\\(\\*\\) FROM \"tasks\"").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+	mock.ExpectQuery("SELECT \\* FROM \"tasks\" WHERE (.+)\\(tasks.title > \\$2\\) OR \\(tasks.title = \\$3 AND tasks.id > \\$4\\)\\)").
+		WithArgs(userID.String(), "Beta", "Beta", second, 3).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title"}).AddRow(third.String(), "Gamma"))
+
+	tasks, page, err = service.GetTasks(db, map[string]interface{}{
+		"user_id": userID.String(),
+		"sort":    "title",
+		"limit":   2,
+		"cursor":  page.NextCursor,
+	})
+
+	assert.NoError(t, err)
+	assert.Len(t, tasks, 1)
+	assert.Empty(t, page.NextCursor)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetNotes_BlocksPreview(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	userID := uuid.New()
+	noteID := uuid.New()
+
+	mock.ExpectQuery("SELECT count\\(\\*\\) FROM \"notes\"").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectQuery("SELECT \\* FROM \"notes\" WHERE (.+) ORDER BY EXISTS (.+) DESC, COALESCE(.+) ASC, notes.updated_at DESC, notes.id DESC").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title"}).AddRow(noteID.String(), "Plans"))
+	mock.ExpectQuery("SELECT \\* FROM \"resource_states\"").
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}))
+	mock.ExpectQuery("SELECT \\* FROM \\(SELECT \\*, ROW_NUMBER\\(\\) OVER \\(PARTITION BY note_id ORDER BY \"order\" ASC\\) AS position FROM \"blocks\" (.+)\\) AS ranked WHERE position <= (.+)").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "note_id", "order"}).
+			AddRow(uuid.New().String(), noteID.String(), 1).
+			AddRow(uuid.New().String(), noteID.String(), 2))
+
+	service := &NoteService{}
+	notes, page, err := service.GetNotes(db, map[string]interface{}{
+		"user_id": userID.String(),
+		"blocks":  "2",
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), page.Total)
+	if assert.Len(t, notes, 1) {
+		assert.Len(t, notes[0].Blocks, 2)
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
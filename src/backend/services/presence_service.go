@@ -0,0 +1,273 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"owlistic-notes/owlistic/broker"
+	"owlistic-notes/owlistic/database"
+	"owlistic-notes/owlistic/models"
+
+	"github.com/google/uuid"
+)
+
+// PresenceServiceInterface tracks which connections are viewing which note
+// and where their cursors are. The connections of this server are set and
+// removed here; Apply takes in the changes other servers share through the
+// broker. The methods changing entries return the presence events to tell
+// the other viewers about.
+type PresenceServiceInterface interface {
+	GetNotePresence(db *database.Database, noteID string, params map[string]interface{}) ([]models.Presence, error)
+	SetPresence(db *database.Database, connectionID string, noteID string, blockID string, expiresAt time.Time, params map[string]interface{}) ([]models.PresenceChange, error)
+	RemovePresence(connectionID string) []models.PresenceChange
+	RefreshPresence(db *database.Database, connectionID string, expiresAt time.Time) []models.PresenceChange
+	ExpirePresence(now time.Time) []models.PresenceChange
+	Apply(change models.PresenceChange) []models.PresenceChange
+}
+
+// PresenceService keeps the entries in memory, by connection ID. A
+// connection views a single note at a time.
+type PresenceService struct {
+	mu      sync.Mutex
+	entries map[string]models.Presence
+}
+
+// GetNotePresence returns the live entries of a note, most recently active
+// first
+func (s *PresenceService) GetNotePresence(db *database.Database, noteID string, params map[string]interface{}) ([]models.Presence, error) {
+	userIDStr, ok := params["user_id"].(string)
+	if !ok {
+		return nil, errors.New("user_id must be provided in parameters")
+	}
+
+	id, err := uuid.Parse(noteID)
+	if err != nil {
+		return nil, ErrInvalidInput
+	}
+
+	hasAccess, err := RoleServiceInstance.HasNoteAccess(db, userIDStr, noteID, "viewer")
+	if err != nil {
+		return nil, err
+	}
+
+	if !hasAccess {
+		return nil, fmt.Errorf("%w: cannot view this note", ErrUnauthorized)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	presence := []models.Presence{}
+	for _, entry := range s.entries {
+		if entry.NoteID == id && entry.ExpiresAt.After(now) {
+			presence = append(presence, entry)
+		}
+	}
+
+	sort.Slice(presence, func(i, j int) bool {
+		if !presence[i].LastActive.Equal(presence[j].LastActive) {
+			return presence[i].LastActive.After(presence[j].LastActive)
+		}
+		return presence[i].ConnectionID < presence[j].ConnectionID
+	})
+
+	return presence, nil
+}
+
+// SetPresence records that a connection is viewing a note, with its cursor
+// in blockID unless that is empty. Moving to another note leaves the one
+// before; an empty noteID just leaves. Access to the note is checked on
+// every call, and a block the cursor moves into has to be one of the note.
+func (s *PresenceService) SetPresence(db *database.Database, connectionID string, noteID string, blockID string, expiresAt time.Time, params map[string]interface{}) ([]models.PresenceChange, error) {
+	userIDStr, ok := params["user_id"].(string)
+	if !ok {
+		return nil, errors.New("user_id must be provided in parameters")
+	}
+
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return nil, ErrInvalidInput
+	}
+
+	if noteID == "" {
+		return s.RemovePresence(connectionID), nil
+	}
+
+	id, err := uuid.Parse(noteID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: note_id must be a UUID", ErrInvalidInput)
+	}
+
+	var block *uuid.UUID
+	if blockID != "" {
+		parsed, err := uuid.Parse(blockID)
+		if err != nil {
+			return nil, fmt.Errorf("%w: block_id must be a UUID", ErrInvalidInput)
+		}
+		block = &parsed
+	}
+
+	// Only the connection itself moves its entry, so the note it is on
+	// stays the same while access is checked
+	s.mu.Lock()
+	previous, had := s.entries[connectionID]
+	s.mu.Unlock()
+
+	hasAccess, err := RoleServiceInstance.HasNoteAccess(db, userIDStr, noteID, "viewer")
+	if err != nil {
+		return nil, err
+	}
+
+	if !hasAccess {
+		return nil, fmt.Errorf("%w: cannot view this note", ErrUnauthorized)
+	}
+
+	joining := !had || previous.NoteID != id
+	if block != nil && (joining || previous.BlockID == nil || *previous.BlockID != *block) {
+		var count int64
+		if err := db.DB.Model(&models.Block{}).Where("id = ? AND note_id = ?", *block, id).Count(&count).Error; err != nil {
+			return nil, err
+		}
+		if count == 0 {
+			return nil, fmt.Errorf("%w: block_id is not a block of this note", ErrInvalidInput)
+		}
+	}
+
+	entry := models.Presence{
+		ConnectionID: connectionID,
+		UserID:       userID,
+		NoteID:       id,
+		BlockID:      block,
+		LastActive:   time.Now(),
+		ExpiresAt:    expiresAt,
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var changes []models.PresenceChange
+	if had && joining {
+		changes = append(changes, models.PresenceChange{Event: string(broker.PresenceLeft), Presence: previous})
+	}
+	event := broker.PresenceUpdated
+	if joining {
+		event = broker.PresenceJoined
+	}
+	s.entries[connectionID] = entry
+
+	return append(changes, models.PresenceChange{Event: string(event), Presence: entry}), nil
+}
+
+// RemovePresence takes a connection off the note it was viewing
+func (s *PresenceService) RemovePresence(connectionID string) []models.PresenceChange {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[connectionID]
+	if !ok {
+		return nil
+	}
+
+	delete(s.entries, connectionID)
+	return []models.PresenceChange{{Event: string(broker.PresenceLeft), Presence: entry}}
+}
+
+// RefreshPresence moves the expiry of a connection's entry to its new pong
+// deadline. Being reachable is no activity, so LastActive stays. Access to
+// the note is checked again, and a user who lost it leaves the note.
+func (s *PresenceService) RefreshPresence(db *database.Database, connectionID string, expiresAt time.Time) []models.PresenceChange {
+	s.mu.Lock()
+	entry, ok := s.entries[connectionID]
+	s.mu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	hasAccess, err := RoleServiceInstance.HasNoteAccess(db, entry.UserID.String(), entry.NoteID.String(), "viewer")
+	if err != nil {
+		// The entry lapses on its own if access can't be checked again
+		log.Printf("Failed to check access of %s to note %s: %v", entry.UserID, entry.NoteID, err)
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// The connection may have moved on while access was checked
+	current, ok := s.entries[connectionID]
+	if !ok || current.NoteID != entry.NoteID {
+		return nil
+	}
+
+	if !hasAccess {
+		delete(s.entries, connectionID)
+		return []models.PresenceChange{{Event: string(broker.PresenceLeft), Presence: current}}
+	}
+
+	current.ExpiresAt = expiresAt
+	s.entries[connectionID] = current
+	return []models.PresenceChange{{Event: string(broker.PresenceRefreshed), Presence: current}}
+}
+
+// ExpirePresence drops the entries whose connections stopped answering,
+// including those of servers that went away without a word
+func (s *PresenceService) ExpirePresence(now time.Time) []models.PresenceChange {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var changes []models.PresenceChange
+	for connectionID, entry := range s.entries {
+		if !entry.ExpiresAt.After(now) {
+			delete(s.entries, connectionID)
+			changes = append(changes, models.PresenceChange{Event: string(broker.PresenceLeft), Presence: entry})
+		}
+	}
+	return changes
+}
+
+// Apply takes in a change of another server and returns what the viewers
+// here need to hear of it. A refresh of an entry missed so far, because
+// this server started after the join, counts as the join.
+func (s *PresenceService) Apply(change models.PresenceChange) []models.PresenceChange {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry := change.Presence
+	previous, had := s.entries[entry.ConnectionID]
+
+	switch broker.EventType(change.Event) {
+	case broker.PresenceLeft:
+		if !had {
+			return nil
+		}
+		delete(s.entries, entry.ConnectionID)
+		return []models.PresenceChange{{Event: change.Event, Presence: previous}}
+
+	case broker.PresenceJoined, broker.PresenceUpdated, broker.PresenceRefreshed:
+		if !entry.ExpiresAt.After(time.Now()) {
+			return nil
+		}
+		s.entries[entry.ConnectionID] = entry
+
+		if broker.EventType(change.Event) != broker.PresenceRefreshed {
+			return []models.PresenceChange{change}
+		}
+		if !had || previous.NoteID != entry.NoteID {
+			return []models.PresenceChange{{Event: string(broker.PresenceJoined), Presence: entry}}
+		}
+	}
+	return nil
+}
+
+// NewPresenceService creates a new instance of PresenceService
+func NewPresenceService() PresenceServiceInterface {
+	return &PresenceService{entries: make(map[string]models.Presence)}
+}
+
+// Don't initialize here, will be set properly in main.go
+var PresenceServiceInstance PresenceServiceInterface
@@ -0,0 +1,175 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"owlistic-notes/owlistic/broker"
+	"owlistic-notes/owlistic/database"
+	"owlistic-notes/owlistic/models"
+	"owlistic-notes/owlistic/testutils"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetPresence(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	noteID, otherNoteID, hiddenNoteID := uuid.New(), uuid.New(), uuid.New()
+	previous := RoleServiceInstance
+	RoleServiceInstance = &noteAccessStub{notes: map[string]bool{noteID.String(): true, otherNoteID.String(): true}}
+	defer func() { RoleServiceInstance = previous }()
+
+	service := NewPresenceService()
+	params := map[string]interface{}{"user_id": uuid.New().String()}
+	expiresAt := time.Now().Add(time.Minute)
+
+	changes, err := service.SetPresence(db, "conn", noteID.String(), "", expiresAt, params)
+	assert.NoError(t, err)
+	assert.Len(t, changes, 1)
+	assert.Equal(t, string(broker.PresenceJoined), changes[0].Event)
+	assert.Nil(t, changes[0].Presence.BlockID)
+
+	blockID := uuid.New()
+	mock.ExpectQuery("SELECT count\\(\\*\\) FROM \"blocks\" WHERE \\(id = (.+) AND note_id = (.+)\\)").
+		WithArgs(blockID, noteID).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	changes, err = service.SetPresence(db, "conn", noteID.String(), blockID.String(), expiresAt, params)
+	assert.NoError(t, err)
+	assert.Len(t, changes, 1)
+	assert.Equal(t, string(broker.PresenceUpdated), changes[0].Event)
+	assert.Equal(t, blockID, *changes[0].Presence.BlockID)
+
+	// Staying in the block needs no second look
+	_, err = service.SetPresence(db, "conn", noteID.String(), blockID.String(), expiresAt, params)
+	assert.NoError(t, err)
+
+	// The cursor can't be put into a block of another note
+	mock.ExpectQuery("SELECT count\\(\\*\\) FROM \"blocks\" WHERE \\(id = (.+) AND note_id = (.+)\\)").
+		WithArgs(blockID, otherNoteID).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	_, err = service.SetPresence(db, "conn", otherNoteID.String(), blockID.String(), expiresAt, params)
+	assert.ErrorIs(t, err, ErrInvalidInput)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	// Moving on leaves the note before
+	changes, err = service.SetPresence(db, "conn", otherNoteID.String(), "", expiresAt, params)
+	assert.NoError(t, err)
+	assert.Len(t, changes, 2)
+	assert.Equal(t, string(broker.PresenceLeft), changes[0].Event)
+	assert.Equal(t, noteID, changes[0].Presence.NoteID)
+	assert.Equal(t, string(broker.PresenceJoined), changes[1].Event)
+	assert.Equal(t, otherNoteID, changes[1].Presence.NoteID)
+
+	_, err = service.SetPresence(db, "conn", hiddenNoteID.String(), "", expiresAt, params)
+	assert.ErrorIs(t, err, ErrUnauthorized)
+	_, err = service.SetPresence(db, "conn", otherNoteID.String(), "first", expiresAt, params)
+	assert.ErrorIs(t, err, ErrInvalidInput)
+
+	// Access is checked again on updates within the note
+	RoleServiceInstance.(*noteAccessStub).notes[otherNoteID.String()] = false
+	_, err = service.SetPresence(db, "conn", otherNoteID.String(), "", expiresAt, params)
+	assert.ErrorIs(t, err, ErrUnauthorized)
+	RoleServiceInstance.(*noteAccessStub).notes[otherNoteID.String()] = true
+
+	changes, err = service.SetPresence(db, "conn", "", "", expiresAt, params)
+	assert.NoError(t, err)
+	assert.Len(t, changes, 1)
+	assert.Equal(t, string(broker.PresenceLeft), changes[0].Event)
+	assert.Equal(t, otherNoteID, changes[0].Presence.NoteID)
+	assert.Empty(t, service.RemovePresence("conn"))
+}
+
+func TestGetNotePresence(t *testing.T) {
+	noteID := uuid.New()
+	previous := RoleServiceInstance
+	RoleServiceInstance = &noteAccessStub{notes: map[string]bool{noteID.String(): true}}
+	defer func() { RoleServiceInstance = previous }()
+
+	service := NewPresenceService()
+	expiresAt := time.Now().Add(time.Minute)
+	for _, connID := range []string{"first", "second"} {
+		_, err := service.SetPresence(&database.Database{}, connID, noteID.String(), "", expiresAt, map[string]interface{}{"user_id": uuid.New().String()})
+		assert.NoError(t, err)
+	}
+	// Entries of other servers count as well, unless they lapsed
+	service.Apply(models.PresenceChange{Event: string(broker.PresenceJoined), Presence: models.Presence{
+		ConnectionID: "lapsed", UserID: uuid.New(), NoteID: noteID, ExpiresAt: time.Now().Add(-time.Second),
+	}})
+
+	presence, err := service.GetNotePresence(&database.Database{}, noteID.String(), map[string]interface{}{"user_id": uuid.New().String()})
+	assert.NoError(t, err)
+	assert.Len(t, presence, 2)
+	assert.Equal(t, "second", presence[0].ConnectionID)
+	assert.Equal(t, "first", presence[1].ConnectionID)
+
+	_, err = service.GetNotePresence(&database.Database{}, uuid.New().String(), map[string]interface{}{"user_id": uuid.New().String()})
+	assert.ErrorIs(t, err, ErrUnauthorized)
+	_, err = service.GetNotePresence(&database.Database{}, "not-a-note", map[string]interface{}{"user_id": uuid.New().String()})
+	assert.ErrorIs(t, err, ErrInvalidInput)
+}
+
+func TestPresenceExpiry(t *testing.T) {
+	noteID := uuid.New()
+	previous := RoleServiceInstance
+	RoleServiceInstance = &noteAccessStub{notes: map[string]bool{noteID.String(): true}}
+	defer func() { RoleServiceInstance = previous }()
+
+	service := NewPresenceService()
+	now := time.Now()
+	_, err := service.SetPresence(&database.Database{}, "conn", noteID.String(), "", now.Add(time.Minute), map[string]interface{}{"user_id": uuid.New().String()})
+	assert.NoError(t, err)
+
+	// Answering a ping keeps the entry past its first deadline
+	changes := service.RefreshPresence(&database.Database{}, "conn", now.Add(3*time.Minute))
+	assert.Len(t, changes, 1)
+	assert.Equal(t, string(broker.PresenceRefreshed), changes[0].Event)
+	assert.Empty(t, service.ExpirePresence(now.Add(2*time.Minute)))
+
+	changes = service.ExpirePresence(now.Add(3 * time.Minute))
+	assert.Len(t, changes, 1)
+	assert.Equal(t, string(broker.PresenceLeft), changes[0].Event)
+	assert.Empty(t, service.RefreshPresence(&database.Database{}, "conn", now.Add(5*time.Minute)))
+}
+
+func TestRefreshPresence_AccessRevoked(t *testing.T) {
+	noteID := uuid.New()
+	access := &noteAccessStub{notes: map[string]bool{noteID.String(): true}}
+	previous := RoleServiceInstance
+	RoleServiceInstance = access
+	defer func() { RoleServiceInstance = previous }()
+
+	service := NewPresenceService()
+	now := time.Now()
+	_, err := service.SetPresence(&database.Database{}, "conn", noteID.String(), "", now.Add(time.Minute), map[string]interface{}{"user_id": uuid.New().String()})
+	assert.NoError(t, err)
+
+	// Losing access to the note takes the connection off it at the next ping
+	access.notes[noteID.String()] = false
+	changes := service.RefreshPresence(&database.Database{}, "conn", now.Add(2*time.Minute))
+	assert.Len(t, changes, 1)
+	assert.Equal(t, string(broker.PresenceLeft), changes[0].Event)
+	assert.Empty(t, service.RemovePresence("conn"))
+}
+
+func TestPresenceApply(t *testing.T) {
+	service := NewPresenceService()
+	entry := models.Presence{ConnectionID: "remote", UserID: uuid.New(), NoteID: uuid.New(), ExpiresAt: time.Now().Add(time.Minute)}
+
+	// A refresh of an entry not seen before stands for its join
+	changes := service.Apply(models.PresenceChange{Event: string(broker.PresenceRefreshed), Presence: entry})
+	assert.Len(t, changes, 1)
+	assert.Equal(t, string(broker.PresenceJoined), changes[0].Event)
+	assert.Empty(t, service.Apply(models.PresenceChange{Event: string(broker.PresenceRefreshed), Presence: entry}))
+
+	changes = service.Apply(models.PresenceChange{Event: string(broker.PresenceUpdated), Presence: entry})
+	assert.Len(t, changes, 1)
+	assert.Equal(t, string(broker.PresenceUpdated), changes[0].Event)
+
+	changes = service.Apply(models.PresenceChange{Event: string(broker.PresenceLeft), Presence: entry})
+	assert.Len(t, changes, 1)
+	assert.Empty(t, service.Apply(models.PresenceChange{Event: string(broker.PresenceLeft), Presence: entry}))
+}
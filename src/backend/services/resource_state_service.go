@@ -0,0 +1,256 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"owlistic-notes/owlistic/broker"
+	"owlistic-notes/owlistic/database"
+	"owlistic-notes/owlistic/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// pinOrderGap spaces out pin orders so items can be pinned in between
+const pinOrderGap = 1000
+
+// ArchivedAll lists archived items along with the others
+const ArchivedAll = "all"
+
+type ResourceStateServiceInterface interface {
+	UpdateNoteState(db *database.Database, noteID string, stateData map[string]interface{}, params map[string]interface{}) (models.ResourceState, error)
+	UpdateNotebookState(db *database.Database, notebookID string, stateData map[string]interface{}, params map[string]interface{}) (models.ResourceState, error)
+}
+
+type ResourceStateService struct{}
+
+// UpdateNoteState changes the user's pinned, favourite or archived state of
+// a note. Only the fields present in stateData change.
+func (s *ResourceStateService) UpdateNoteState(db *database.Database, noteID string, stateData map[string]interface{}, params map[string]interface{}) (models.ResourceState, error) {
+	return updateResourceState(db, models.NoteResource, noteID, stateData, params)
+}
+
+// UpdateNotebookState changes the user's pinned, favourite or archived
+// state of a notebook. Only the fields present in stateData change.
+func (s *ResourceStateService) UpdateNotebookState(db *database.Database, notebookID string, stateData map[string]interface{}, params map[string]interface{}) (models.ResourceState, error) {
+	return updateResourceState(db, models.NotebookResource, notebookID, stateData, params)
+}
+
+func updateResourceState(db *database.Database, resourceType models.ResourceType, id string, stateData map[string]interface{}, params map[string]interface{}) (models.ResourceState, error) {
+	userIDStr, ok := params["user_id"].(string)
+	if !ok {
+		return models.ResourceState{}, errors.New("user_id must be provided in parameters")
+	}
+
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return models.ResourceState{}, ErrInvalidInput
+	}
+
+	resourceID, err := uuid.Parse(id)
+	if err != nil {
+		return models.ResourceState{}, ErrInvalidInput
+	}
+
+	// Notes and notebooks missing or in the trash have no state to change
+	var count int64
+	var notFound error
+	if resourceType == models.NoteResource {
+		err = db.DB.Model(&models.Note{}).Where("id = ?", resourceID).Count(&count).Error
+		notFound = ErrNoteNotFound
+	} else {
+		err = db.DB.Model(&models.Notebook{}).Where("id = ?", resourceID).Count(&count).Error
+		notFound = ErrNotebookNotFound
+	}
+	if err != nil {
+		return models.ResourceState{}, err
+	}
+	if count == 0 {
+		return models.ResourceState{}, notFound
+	}
+
+	hasAccess, err := RoleServiceInstance.HasAccessByStrings(db, userIDStr, id, string(resourceType), "viewer")
+	if err != nil {
+		return models.ResourceState{}, err
+	}
+
+	if !hasAccess {
+		return models.ResourceState{}, fmt.Errorf("not authorized to access this %s", resourceType)
+	}
+
+	tx := db.DB.Begin()
+	if tx.Error != nil {
+		return models.ResourceState{}, tx.Error
+	}
+
+	state := models.ResourceState{
+		UserID:       userID,
+		ResourceID:   resourceID,
+		ResourceType: resourceType,
+	}
+	if err := tx.Where("user_id = ? AND resource_id = ?", userID, resourceID).
+		Limit(1).Find(&state).Error; err != nil {
+		tx.Rollback()
+		return models.ResourceState{}, err
+	}
+
+	wasPinned := state.Pinned
+	if err := applyResourceState(&state, stateData); err != nil {
+		tx.Rollback()
+		return models.ResourceState{}, err
+	}
+
+	switch {
+	case !state.Pinned:
+		state.PinOrder = 0
+	case !wasPinned && stateData["pin_order"] == nil:
+		// Newly pinned items go last
+		var maxOrder float64
+		if err := tx.Model(&models.ResourceState{}).
+			Where("user_id = ? AND resource_type = ? AND pinned", userID, resourceType).
+			Select("COALESCE(MAX(pin_order), 0)").Scan(&maxOrder).Error; err != nil {
+			tx.Rollback()
+			return models.ResourceState{}, err
+		}
+		state.PinOrder = maxOrder + pinOrderGap
+	}
+
+	state.UpdatedAt = time.Now()
+	if err := tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "resource_id"}},
+		UpdateAll: true,
+	}).Create(&state).Error; err != nil {
+		tx.Rollback()
+		return models.ResourceState{}, err
+	}
+
+	eventType, idKey := broker.NoteStateUpdated, "note_id"
+	if resourceType == models.NotebookResource {
+		eventType, idKey = broker.NotebookStateUpdated, "notebook_id"
+	}
+	if err := createEvent(tx, string(eventType), string(resourceType), map[string]interface{}{
+		idKey:       resourceID.String(),
+		"user_id":   userID.String(),
+		"pinned":    state.Pinned,
+		"pin_order": state.PinOrder,
+		"favourite": state.Favourite,
+		"archived":  state.Archived,
+	}); err != nil {
+		tx.Rollback()
+		return models.ResourceState{}, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return models.ResourceState{}, err
+	}
+
+	return state, nil
+}
+
+// applyResourceState copies the fields present in stateData onto state
+func applyResourceState(state *models.ResourceState, stateData map[string]interface{}) error {
+	flags := map[string]*bool{
+		"pinned":    &state.Pinned,
+		"favourite": &state.Favourite,
+		"archived":  &state.Archived,
+	}
+	for key, field := range flags {
+		value, exists := stateData[key]
+		if !exists {
+			continue
+		}
+		flag, ok := value.(bool)
+		if !ok {
+			return fmt.Errorf("%w: %s must be true or false", ErrInvalidInput, key)
+		}
+		*field = flag
+	}
+
+	if value, exists := stateData["pin_order"]; exists && value != nil {
+		order, ok := value.(float64)
+		if !ok {
+			return fmt.Errorf("%w: pin_order must be a number", ErrInvalidInput)
+		}
+		state.PinOrder = order
+	}
+
+	return nil
+}
+
+// resourceStateScope narrows a note or notebook listing by the user's own
+// state. Archived items are left out unless "archived" is "true", which
+// lists only them, or "all"; "pinned" and "favourite" keep only the items
+// with that flag set or unset.
+func resourceStateScope(userID string, resourceType models.ResourceType, params map[string]interface{}) (func(*gorm.DB) *gorm.DB, error) {
+	type stateFilter struct {
+		column string
+		in     bool
+	}
+
+	var filters []stateFilter
+	switch archived, _ := params["archived"].(string); archived {
+	case "", "false":
+		filters = append(filters, stateFilter{column: "archived", in: false})
+	case "true":
+		filters = append(filters, stateFilter{column: "archived", in: true})
+	case ArchivedAll:
+	default:
+		return nil, fmt.Errorf("%w: archived must be true, false or all", ErrInvalidInput)
+	}
+
+	for _, column := range []string{"pinned", "favourite"} {
+		value, _ := params[column].(string)
+		if value == "" {
+			continue
+		}
+		flag, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s must be true or false", ErrInvalidInput, column)
+		}
+		filters = append(filters, stateFilter{column: column, in: flag})
+	}
+
+	return func(query *gorm.DB) *gorm.DB {
+		for _, filter := range filters {
+			// Items without a state row have every flag unset
+			subquery := "SELECT resource_id FROM resource_states WHERE user_id = ? AND resource_type = ? AND " + filter.column
+			if filter.in {
+				query = query.Where("id IN ("+subquery+")", userID, resourceType)
+			} else {
+				query = query.Where("id NOT IN ("+subquery+")", userID, resourceType)
+			}
+		}
+		return query
+	}, nil
+}
+
+// loadResourceStates returns the user's state of each of the given items
+// that has one
+func loadResourceStates(db *gorm.DB, userID string, ids []uuid.UUID) (map[uuid.UUID]*models.ResourceState, error) {
+	states := make(map[uuid.UUID]*models.ResourceState, len(ids))
+	if len(ids) == 0 {
+		return states, nil
+	}
+
+	var rows []models.ResourceState
+	if err := db.Where("user_id = ? AND resource_id IN ?", userID, ids).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	for i := range rows {
+		states[rows[i].ResourceID] = &rows[i]
+	}
+	return states, nil
+}
+
+// NewResourceStateService creates a new instance of ResourceStateService
+func NewResourceStateService() ResourceStateServiceInterface {
+	return &ResourceStateService{}
+}
+
+// Don't initialize here, will be set properly in main.go
+var ResourceStateServiceInstance ResourceStateServiceInterface
@@ -0,0 +1,143 @@
+package services
+
+import (
+	"testing"
+
+	"owlistic-notes/owlistic/database"
+	"owlistic-notes/owlistic/models"
+	"owlistic-notes/owlistic/testutils"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+// stateAccessStub grants viewer access to every note and notebook
+type stateAccessStub struct {
+	RoleServiceInterface
+}
+
+func (s *stateAccessStub) HasAccessByStrings(db *database.Database, userID string, resourceID string, resourceType string, minimumRole string) (bool, error) {
+	return true, nil
+}
+
+func TestUpdateNoteState_PinsLast(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	userID := uuid.New()
+	noteID := uuid.New()
+
+	previous := RoleServiceInstance
+	RoleServiceInstance = &stateAccessStub{}
+	defer func() { RoleServiceInstance = previous }()
+
+	mock.ExpectQuery("SELECT count\\(\\*\\) FROM \"notes\"").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT \\* FROM \"resource_states\" WHERE").
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}))
+	mock.ExpectQuery("SELECT COALESCE\\(MAX\\(pin_order\\), 0\\) FROM \"resource_states\"").
+		WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(2000.0))
+	mock.ExpectQuery("INSERT INTO \"resource_states\" (.+) ON CONFLICT (.+) DO UPDATE").
+		WillReturnRows(sqlmock.NewRows([]string{"updated_at"}).AddRow(nil))
+	mock.ExpectQuery("INSERT INTO \"events\"").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(uuid.New()))
+	mock.ExpectCommit()
+
+	service := &ResourceStateService{}
+	state, err := service.UpdateNoteState(db, noteID.String(), map[string]interface{}{
+		"pinned":    true,
+		"favourite": true,
+	}, map[string]interface{}{"user_id": userID.String()})
+
+	assert.NoError(t, err)
+	assert.True(t, state.Pinned)
+	assert.True(t, state.Favourite)
+	assert.False(t, state.Archived)
+	assert.Equal(t, 3000.0, state.PinOrder)
+	assert.Equal(t, models.NoteResource, state.ResourceType)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdateNotebookState_UnpinKeepsOtherFlags(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	userID := uuid.New()
+	notebookID := uuid.New()
+
+	previous := RoleServiceInstance
+	RoleServiceInstance = &stateAccessStub{}
+	defer func() { RoleServiceInstance = previous }()
+
+	mock.ExpectQuery("SELECT count\\(\\*\\) FROM \"notebooks\"").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT \\* FROM \"resource_states\" WHERE").
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "resource_id", "resource_type", "pinned", "pin_order", "favourite", "archived"}).
+			AddRow(userID.String(), notebookID.String(), "notebook", true, 1000.0, true, false))
+	mock.ExpectQuery("INSERT INTO \"resource_states\" (.+) ON CONFLICT (.+) DO UPDATE").
+		WillReturnRows(sqlmock.NewRows([]string{"updated_at"}).AddRow(nil))
+	mock.ExpectQuery("INSERT INTO \"events\"").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(uuid.New()))
+	mock.ExpectCommit()
+
+	service := &ResourceStateService{}
+	state, err := service.UpdateNotebookState(db, notebookID.String(), map[string]interface{}{
+		"pinned": false,
+	}, map[string]interface{}{"user_id": userID.String()})
+
+	assert.NoError(t, err)
+	assert.False(t, state.Pinned)
+	assert.Equal(t, 0.0, state.PinOrder)
+	assert.True(t, state.Favourite)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdateNoteState_InvalidInput(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	previous := RoleServiceInstance
+	RoleServiceInstance = &stateAccessStub{}
+	defer func() { RoleServiceInstance = previous }()
+
+	mock.ExpectQuery("SELECT count\\(\\*\\) FROM \"notes\"").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT \\* FROM \"resource_states\" WHERE").
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}))
+	mock.ExpectRollback()
+
+	service := &ResourceStateService{}
+	_, err := service.UpdateNoteState(db, uuid.New().String(), map[string]interface{}{
+		"archived": "yes",
+	}, map[string]interface{}{"user_id": uuid.New().String()})
+
+	assert.ErrorIs(t, err, ErrInvalidInput)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdateNoteState_NotFound(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	mock.ExpectQuery("SELECT count\\(\\*\\) FROM \"notes\"").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+
+	service := &ResourceStateService{}
+	_, err := service.UpdateNoteState(db, uuid.New().String(), map[string]interface{}{"pinned": true},
+		map[string]interface{}{"user_id": uuid.New().String()})
+
+	assert.ErrorIs(t, err, ErrNoteNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestResourceStateScope_InvalidArchived(t *testing.T) {
+	_, err := resourceStateScope(uuid.New().String(), models.NoteResource, map[string]interface{}{"archived": "maybe"})
+	assert.ErrorIs(t, err, ErrInvalidInput)
+
+	_, err = resourceStateScope(uuid.New().String(), models.NoteResource, map[string]interface{}{"pinned": "nope"})
+	assert.ErrorIs(t, err, ErrInvalidInput)
+}
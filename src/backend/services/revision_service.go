@@ -0,0 +1,451 @@
+package services
+
+import (
+	"errors"
+	"reflect"
+	"strconv"
+	"time"
+
+	"owlistic-notes/owlistic/broker"
+	"owlistic-notes/owlistic/database"
+	"owlistic-notes/owlistic/models"
+	"owlistic-notes/owlistic/utils/diff"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type RevisionServiceInterface interface {
+	ListRevisions(db *database.Database, noteID string, params map[string]interface{}) ([]models.NoteRevision, error)
+	GetRevision(db *database.Database, noteID string, revision string, params map[string]interface{}) (models.NoteRevision, error)
+	RestoreRevision(db *database.Database, noteID string, revision string, params map[string]interface{}) (models.Note, error)
+	DiffRevisions(db *database.Database, noteID string, from string, to string, params map[string]interface{}) (models.NoteDiff, error)
+}
+
+// LiveRevision refers to the current state of a note when diffing
+const LiveRevision = "live"
+
+type RevisionService struct{}
+
+// ListRevisions returns the revisions of a note, newest first, without their blocks
+func (s *RevisionService) ListRevisions(db *database.Database, noteID string, params map[string]interface{}) ([]models.NoteRevision, error) {
+	userIDStr, ok := params["user_id"].(string)
+	if !ok {
+		return nil, errors.New("user_id must be provided in parameters")
+	}
+
+	hasAccess, err := RoleServiceInstance.HasNoteAccess(db, userIDStr, noteID, "viewer")
+	if err != nil {
+		return nil, err
+	}
+
+	if !hasAccess {
+		return nil, errors.New("not authorized to access revisions of this note")
+	}
+
+	var revisions []models.NoteRevision
+	if err := db.DB.Select("id", "note_id", "revision", "user_id", "title", "created_at").
+		Where("note_id = ?", noteID).
+		Order("revision DESC").
+		Find(&revisions).Error; err != nil {
+		return nil, err
+	}
+
+	return revisions, nil
+}
+
+// GetRevision returns a single revision of a note including its blocks
+func (s *RevisionService) GetRevision(db *database.Database, noteID string, revision string, params map[string]interface{}) (models.NoteRevision, error) {
+	userIDStr, ok := params["user_id"].(string)
+	if !ok {
+		return models.NoteRevision{}, errors.New("user_id must be provided in parameters")
+	}
+
+	hasAccess, err := RoleServiceInstance.HasNoteAccess(db, userIDStr, noteID, "viewer")
+	if err != nil {
+		return models.NoteRevision{}, err
+	}
+
+	if !hasAccess {
+		return models.NoteRevision{}, errors.New("not authorized to access revisions of this note")
+	}
+
+	return findNoteRevision(db.DB, noteID, revision)
+}
+
+// RestoreRevision brings a note back to the state captured in a revision.
+// Blocks are updated, recreated or deleted individually with the usual
+// block events so that connected clients converge on the restored state,
+// and the result is recorded as a new revision so the restore can be undone.
+func (s *RevisionService) RestoreRevision(db *database.Database, noteID string, revision string, params map[string]interface{}) (models.Note, error) {
+	userIDStr, ok := params["user_id"].(string)
+	if !ok {
+		return models.Note{}, errors.New("user_id must be provided in parameters")
+	}
+
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return models.Note{}, ErrInvalidInput
+	}
+
+	hasAccess, err := RoleServiceInstance.HasNoteAccess(db, userIDStr, noteID, "editor")
+	if err != nil {
+		return models.Note{}, err
+	}
+
+	if !hasAccess {
+		return models.Note{}, errors.New("not authorized to restore this note")
+	}
+
+	tx := db.DB.Begin()
+	if tx.Error != nil {
+		return models.Note{}, tx.Error
+	}
+
+	snapshot, err := findNoteRevision(tx, noteID, revision)
+	if err != nil {
+		tx.Rollback()
+		return models.Note{}, err
+	}
+
+	var note models.Note
+	if err := tx.First(&note, "id = ?", noteID).Error; err != nil {
+		tx.Rollback()
+		return models.Note{}, ErrNoteNotFound
+	}
+
+	if note.Title != snapshot.Title {
+		note.Title = snapshot.Title
+		note.UpdatedAt = time.Now()
+		note.Version++
+		if err := tx.Save(&note).Error; err != nil {
+			tx.Rollback()
+			return models.Note{}, err
+		}
+
+		if err := createEvent(tx, string(broker.NoteUpdated), "note", map[string]interface{}{
+			"note_id":     note.ID.String(),
+			"notebook_id": note.NotebookID.String(),
+			"title":       note.Title,
+			"version":     note.Version,
+		}); err != nil {
+			tx.Rollback()
+			return models.Note{}, err
+		}
+	}
+
+	if err := restoreBlocks(tx, note.ID, userID, snapshot.Blocks); err != nil {
+		tx.Rollback()
+		return models.Note{}, err
+	}
+
+	if _, err := newNoteRevision(tx, note.ID, userID); err != nil {
+		tx.Rollback()
+		return models.Note{}, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		tx.Rollback()
+		return models.Note{}, err
+	}
+
+	var restored models.Note
+	if err := db.DB.Preload("Blocks", func(db *gorm.DB) *gorm.DB {
+		return db.Order("\"blocks\".\"order\" ASC")
+	}).First(&restored, "id = ?", note.ID).Error; err != nil {
+		return models.Note{}, err
+	}
+
+	return restored, nil
+}
+
+// DiffRevisions compares two revisions of a note block by block. An empty
+// or "live" to revision compares against the current state of the note.
+func (s *RevisionService) DiffRevisions(db *database.Database, noteID string, from string, to string, params map[string]interface{}) (models.NoteDiff, error) {
+	userIDStr, ok := params["user_id"].(string)
+	if !ok {
+		return models.NoteDiff{}, errors.New("user_id must be provided in parameters")
+	}
+
+	hasAccess, err := RoleServiceInstance.HasNoteAccess(db, userIDStr, noteID, "viewer")
+	if err != nil {
+		return models.NoteDiff{}, err
+	}
+
+	if !hasAccess {
+		return models.NoteDiff{}, errors.New("not authorized to access revisions of this note")
+	}
+
+	fromRevision, err := findNoteRevision(db.DB, noteID, from)
+	if err != nil {
+		return models.NoteDiff{}, err
+	}
+
+	var toNumber *int
+	var toTitle string
+	var toBlocks models.BlockSnapshots
+
+	if to == "" || to == LiveRevision {
+		var note models.Note
+		if err := db.DB.Preload("Blocks", func(db *gorm.DB) *gorm.DB {
+			return db.Order("\"blocks\".\"order\" ASC")
+		}).First(&note, "id = ?", noteID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return models.NoteDiff{}, ErrNoteNotFound
+			}
+			return models.NoteDiff{}, err
+		}
+
+		toTitle = note.Title
+		for _, block := range note.Blocks {
+			toBlocks = append(toBlocks, models.NewBlockSnapshot(block))
+		}
+	} else {
+		toRevision, err := findNoteRevision(db.DB, noteID, to)
+		if err != nil {
+			return models.NoteDiff{}, err
+		}
+
+		toNumber = &toRevision.Revision
+		toTitle = toRevision.Title
+		toBlocks = toRevision.Blocks
+	}
+
+	result := diff.Blocks(fromRevision.Blocks, toBlocks)
+	result.NoteID = fromRevision.NoteID
+	result.From = fromRevision.Revision
+	result.To = toNumber
+
+	if fromRevision.Title != toTitle {
+		result.Title = &models.FieldChange{Field: "title", From: fromRevision.Title, To: toTitle}
+	}
+
+	return result, nil
+}
+
+// restoreBlocks makes the live blocks of a note match the snapshot
+func restoreBlocks(tx *gorm.DB, noteID uuid.UUID, userID uuid.UUID, snapshots models.BlockSnapshots) error {
+	// Soft-deleted blocks are included so they can be brought back with their original IDs
+	var existing []models.Block
+	if err := tx.Unscoped().Where("note_id = ?", noteID).Find(&existing).Error; err != nil {
+		return err
+	}
+
+	existingByID := make(map[uuid.UUID]models.Block, len(existing))
+	for _, block := range existing {
+		existingByID[block.ID] = block
+	}
+
+	restored := make(map[uuid.UUID]bool, len(snapshots))
+	for _, snapshot := range snapshots {
+		restored[snapshot.ID] = true
+
+		block, found := existingByID[snapshot.ID]
+		if !found || block.DeletedAt.Valid {
+			if !found {
+				block = models.Block{ID: snapshot.ID, NoteID: noteID, UserID: userID}
+			}
+			block.ParentBlockID = snapshot.ParentBlockID
+			block.Type = snapshot.Type
+			block.Content = snapshot.Content
+			block.Metadata = snapshot.Metadata
+			block.Order = snapshot.Order
+			block.DeletedAt = gorm.DeletedAt{}
+
+			var err error
+			if found {
+				block.Version++
+				err = tx.Unscoped().Save(&block).Error
+			} else {
+				err = tx.Create(&block).Error
+			}
+			if err != nil {
+				return err
+			}
+
+			if err := syncNoteLinks(tx, block, nil); err != nil {
+				return err
+			}
+
+			if err := createEvent(tx, string(broker.BlockCreated), "block", blockCreatedEventData(block)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if block.Type == snapshot.Type && block.Order == snapshot.Order &&
+			sameParent(block.ParentBlockID, snapshot.ParentBlockID) &&
+			reflect.DeepEqual(block.Content, snapshot.Content) &&
+			reflect.DeepEqual(block.Metadata, snapshot.Metadata) {
+			continue
+		}
+
+		previousLinks := block.GetLinkedNoteIDs()
+		block.ParentBlockID = snapshot.ParentBlockID
+		block.Type = snapshot.Type
+		block.Content = snapshot.Content
+		block.Metadata = snapshot.Metadata
+		block.Order = snapshot.Order
+		block.Version++
+		if err := tx.Save(&block).Error; err != nil {
+			return err
+		}
+
+		if err := syncNoteLinks(tx, block, previousLinks); err != nil {
+			return err
+		}
+
+		if err := createEvent(tx, string(broker.BlockUpdated), "block", map[string]interface{}{
+			"block_id":        block.ID.String(),
+			"note_id":         block.NoteID.String(),
+			"user_id":         block.UserID.String(),
+			"parent_block_id": parentBlockIDValue(block.ParentBlockID),
+			"type":            string(block.Type),
+			"content":         block.Content,
+			"metadata":        block.Metadata,
+			"order":           block.Order,
+			"version":         block.Version,
+			"updated_at":      time.Now().UTC(),
+		}); err != nil {
+			return err
+		}
+	}
+
+	// Blocks added after the revision was taken are removed
+	for _, block := range existing {
+		if restored[block.ID] || block.DeletedAt.Valid {
+			continue
+		}
+
+		if err := tx.Delete(&block).Error; err != nil {
+			return err
+		}
+
+		if len(block.GetLinkedNoteIDs()) > 0 {
+			if err := removeNoteLinks(tx, []uuid.UUID{block.ID}); err != nil {
+				return err
+			}
+		}
+
+		if err := createEvent(tx, string(broker.BlockDeleted), "block", map[string]interface{}{
+			"block_id": block.ID.String(),
+			"note_id":  block.NoteID.String(),
+			"user_id":  block.UserID.String(),
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// revisionCoalesceWindow is how long a revision keeps taking in further
+// edits of the user who started it, so a burst of typing is kept as one
+// revision rather than one per keystroke
+const revisionCoalesceWindow = 5 * time.Minute
+
+// maxNoteRevisions is how many revisions are kept per note. Older ones are
+// dropped as new ones are taken.
+const maxNoteRevisions = 200
+
+// createNoteRevision snapshots the current title and ordered blocks of a
+// note after an edit. An edit by the user who took the latest revision
+// within revisionCoalesceWindow updates that revision instead. It is called
+// from within the transaction that modified the note, so the revision is
+// only kept if that transaction commits.
+func createNoteRevision(tx *gorm.DB, noteID uuid.UUID, userID uuid.UUID) (models.NoteRevision, error) {
+	return saveNoteRevision(tx, noteID, userID, true)
+}
+
+// newNoteRevision always snapshots the note as a new revision, for changes
+// that must stay undoable on their own, such as restores
+func newNoteRevision(tx *gorm.DB, noteID uuid.UUID, userID uuid.UUID) (models.NoteRevision, error) {
+	return saveNoteRevision(tx, noteID, userID, false)
+}
+
+func saveNoteRevision(tx *gorm.DB, noteID uuid.UUID, userID uuid.UUID, coalesce bool) (models.NoteRevision, error) {
+	// Locking the note serializes the numbering of its revisions
+	var note models.Note
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("Blocks", func(db *gorm.DB) *gorm.DB {
+		return db.Order("\"blocks\".\"order\" ASC")
+	}).First(&note, "id = ?", noteID).Error; err != nil {
+		return models.NoteRevision{}, err
+	}
+
+	var latest models.NoteRevision
+	if err := tx.Select("id", "revision", "user_id", "created_at").
+		Where("note_id = ?", noteID).
+		Order("revision DESC").
+		Limit(1).
+		Find(&latest).Error; err != nil {
+		return models.NoteRevision{}, err
+	}
+
+	blocks := make(models.BlockSnapshots, 0, len(note.Blocks))
+	for _, block := range note.Blocks {
+		blocks = append(blocks, models.NewBlockSnapshot(block))
+	}
+
+	if coalesce && latest.ID != uuid.Nil && latest.UserID == userID && time.Since(latest.CreatedAt) < revisionCoalesceWindow {
+		if err := tx.Model(&models.NoteRevision{}).Where("id = ?", latest.ID).Updates(map[string]interface{}{
+			"title":  note.Title,
+			"blocks": blocks,
+		}).Error; err != nil {
+			return models.NoteRevision{}, err
+		}
+
+		latest.NoteID = noteID
+		latest.Title = note.Title
+		latest.Blocks = blocks
+		return latest, nil
+	}
+
+	revision := models.NoteRevision{
+		ID:       uuid.New(),
+		NoteID:   noteID,
+		Revision: latest.Revision + 1,
+		UserID:   userID,
+		Title:    note.Title,
+		Blocks:   blocks,
+	}
+
+	if err := tx.Create(&revision).Error; err != nil {
+		return models.NoteRevision{}, err
+	}
+
+	if revision.Revision > maxNoteRevisions {
+		if err := tx.Where("note_id = ? AND revision <= ?", noteID, revision.Revision-maxNoteRevisions).
+			Delete(&models.NoteRevision{}).Error; err != nil {
+			return models.NoteRevision{}, err
+		}
+	}
+
+	return revision, nil
+}
+
+// findNoteRevision loads a revision by its number within a note
+func findNoteRevision(db *gorm.DB, noteID string, revision string) (models.NoteRevision, error) {
+	number, err := strconv.Atoi(revision)
+	if err != nil || number < 1 {
+		return models.NoteRevision{}, ErrInvalidInput
+	}
+
+	var noteRevision models.NoteRevision
+	if err := db.Where("note_id = ? AND revision = ?", noteID, number).First(&noteRevision).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return models.NoteRevision{}, ErrRevisionNotFound
+		}
+		return models.NoteRevision{}, err
+	}
+
+	return noteRevision, nil
+}
+
+// NewRevisionService creates a new instance of RevisionService
+func NewRevisionService() RevisionServiceInterface {
+	return &RevisionService{}
+}
+
+// Don't initialize here, will be set properly in main.go
+var RevisionServiceInstance RevisionServiceInterface
@@ -0,0 +1,281 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"owlistic-notes/owlistic/testutils"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListRevisions_Success(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	userID := uuid.New()
+	noteID := uuid.New()
+	now := time.Now()
+
+	// Admin users pass the access check immediately
+	mock.ExpectQuery("SELECT count\\(\\*\\) FROM \"roles\"").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+	mock.ExpectQuery("SELECT \"id\",\"note_id\",\"revision\",\"user_id\",\"title\",\"created_at\" FROM \"note_revisions\" WHERE note_id = (.+) ORDER BY revision DESC").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "note_id", "revision", "user_id", "title", "created_at"}).
+			AddRow(uuid.New().String(), noteID.String(), 2, userID.String(), "Renamed", now).
+			AddRow(uuid.New().String(), noteID.String(), 1, userID.String(), "Original", now))
+
+	service := &RevisionService{}
+	revisions, err := service.ListRevisions(db, noteID.String(), map[string]interface{}{
+		"user_id": userID.String(),
+	})
+
+	assert.NoError(t, err)
+	if assert.Len(t, revisions, 2) {
+		assert.Equal(t, 2, revisions[0].Revision)
+		assert.Equal(t, "Original", revisions[1].Title)
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetRevision_InvalidNumber(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	mock.ExpectQuery("SELECT count\\(\\*\\) FROM \"roles\"").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+	service := &RevisionService{}
+	_, err := service.GetRevision(db, uuid.New().String(), "latest", map[string]interface{}{
+		"user_id": uuid.New().String(),
+	})
+
+	assert.ErrorIs(t, err, ErrInvalidInput)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetRevision_NotFound(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	mock.ExpectQuery("SELECT count\\(\\*\\) FROM \"roles\"").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+	mock.ExpectQuery("SELECT (.+) FROM \"note_revisions\" WHERE note_id = (.+) AND revision = (.+)").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	service := &RevisionService{}
+	_, err := service.GetRevision(db, uuid.New().String(), "7", map[string]interface{}{
+		"user_id": uuid.New().String(),
+	})
+
+	assert.ErrorIs(t, err, ErrRevisionNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRestoreRevision_Success(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	userID := uuid.New()
+	noteID := uuid.New()
+	notebookID := uuid.New()
+	editedID := uuid.New()
+	removedID := uuid.New()
+	addedID := uuid.New()
+	now := time.Now()
+
+	// The revision holds the original text of one block and a block deleted since
+	snapshot := `[` +
+		`{"id":"` + editedID.String() + `","type":"text","content":{"text":"original"},"metadata":{},"order":1000},` +
+		`{"id":"` + removedID.String() + `","type":"task","content":{"text":"gone"},"metadata":{"is_completed":false},"order":2000}` +
+		`]`
+
+	mock.ExpectQuery("SELECT count\\(\\*\\) FROM \"roles\"").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+	mock.ExpectBegin()
+
+	mock.ExpectQuery("SELECT (.+) FROM \"note_revisions\" WHERE note_id = (.+) AND revision = (.+)").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "note_id", "revision", "user_id", "title", "blocks", "created_at"}).
+			AddRow(uuid.New().String(), noteID.String(), 1, userID.String(), "Plan", []byte(snapshot), now))
+
+	mock.ExpectQuery("SELECT (.+) FROM \"notes\" WHERE id = (.+)").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "notebook_id", "title"}).
+			AddRow(noteID.String(), userID.String(), notebookID.String(), "Plan"))
+
+	// Live state: the first block was edited and a new block was added
+	mock.ExpectQuery("SELECT (.+) FROM \"blocks\" WHERE note_id = (.+)").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "note_id", "type", "content", "metadata", "order", "created_at", "updated_at", "deleted_at"}).
+			AddRow(editedID.String(), userID.String(), noteID.String(), "text", []byte(`{"text":"overwritten"}`), []byte(`{}`), 1000, now, now, nil).
+			AddRow(addedID.String(), userID.String(), noteID.String(), "text", []byte(`{"text":"new"}`), []byte(`{}`), 3000, now, now, nil))
+
+	mock.ExpectExec("UPDATE \"blocks\" SET (.+)").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectEventInsert(mock, "block.updated")
+
+	mock.ExpectQuery("INSERT INTO \"blocks\"").
+		WillReturnRows(sqlmock.NewRows([]string{"created_at", "updated_at"}).AddRow(now, now))
+	expectEventInsert(mock, "block.created")
+
+	mock.ExpectExec("UPDATE \"blocks\" SET \"deleted_at\"=(.+)").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectEventInsert(mock, "block.deleted")
+
+	// The restored state is recorded as a new revision
+	mock.ExpectQuery("SELECT (.+) FROM \"notes\" WHERE id = (.+)").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "notebook_id", "title"}).
+			AddRow(noteID.String(), userID.String(), notebookID.String(), "Plan"))
+	mock.ExpectQuery("SELECT (.+) FROM \"blocks\" WHERE \"blocks\".\"note_id\" = (.+)").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "note_id"}))
+	mock.ExpectQuery("SELECT \"id\",\"revision\",\"user_id\",\"created_at\" FROM \"note_revisions\" WHERE note_id = (.+) ORDER BY revision DESC LIMIT").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "revision", "user_id", "created_at"}).
+			AddRow(uuid.New().String(), 3, userID.String(), now))
+	mock.ExpectQuery("INSERT INTO \"note_revisions\"").
+		WithArgs(noteID.String(), 4, userID.String(), "Plan", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"created_at"}).AddRow(now))
+
+	mock.ExpectCommit()
+
+	mock.ExpectQuery("SELECT (.+) FROM \"notes\" WHERE id = (.+)").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "notebook_id", "title"}).
+			AddRow(noteID.String(), userID.String(), notebookID.String(), "Plan"))
+	mock.ExpectQuery("SELECT (.+) FROM \"blocks\" WHERE \"blocks\".\"note_id\" = (.+)").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "note_id"}))
+
+	service := &RevisionService{}
+	note, err := service.RestoreRevision(db, noteID.String(), "1", map[string]interface{}{
+		"user_id": userID.String(),
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "Plan", note.Title)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDiffRevisions_AgainstLive(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	userID := uuid.New()
+	noteID := uuid.New()
+	taskID := uuid.New()
+	now := time.Now()
+
+	snapshot := `[{"id":"` + taskID.String() + `","type":"task","content":{"text":"draft agenda"},"metadata":{"is_completed":false},"order":1000}]`
+
+	mock.ExpectQuery("SELECT count\\(\\*\\) FROM \"roles\"").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+	mock.ExpectQuery("SELECT (.+) FROM \"note_revisions\" WHERE note_id = (.+) AND revision = (.+)").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "note_id", "revision", "user_id", "title", "blocks", "created_at"}).
+			AddRow(uuid.New().String(), noteID.String(), 3, userID.String(), "Planning", []byte(snapshot), now))
+
+	mock.ExpectQuery("SELECT (.+) FROM \"notes\" WHERE id = (.+)").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "title"}).
+			AddRow(noteID.String(), userID.String(), "Weekly planning"))
+
+	mock.ExpectQuery("SELECT (.+) FROM \"blocks\" WHERE \"blocks\".\"note_id\" = (.+) ORDER BY \"blocks\".\"order\" ASC").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "note_id", "type", "content", "metadata", "order"}).
+			AddRow(taskID.String(), noteID.String(), "task", []byte(`{"text":"draft the agenda"}`), []byte(`{"is_completed":true}`), 1000))
+
+	service := &RevisionService{}
+	result, err := service.DiffRevisions(db, noteID.String(), "3", LiveRevision, map[string]interface{}{
+		"user_id": userID.String(),
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 3, result.From)
+	assert.Nil(t, result.To)
+	if assert.NotNil(t, result.Title) {
+		assert.Equal(t, "Weekly planning", result.Title.To)
+	}
+	assert.Empty(t, result.Added)
+	assert.Empty(t, result.Removed)
+	assert.Empty(t, result.Moved)
+	if assert.Len(t, result.Modified, 1) {
+		assert.Len(t, result.Modified[0].Changes, 2)
+		assert.Equal(t, "draft ", result.Modified[0].TextDiff[0].Text)
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// expectEventInsert expects an outbox event with the given name to be stored
+func expectEventInsert(mock sqlmock.Sqlmock, eventName string) {
+	mock.ExpectQuery("INSERT INTO \"events\"").
+		WithArgs(eventName, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), "pending", false, nil, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(uuid.New().String()))
+}
+
+func TestCreateNoteRevision_CoalescesEdits(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	userID := uuid.New()
+	noteID := uuid.New()
+	revisionID := uuid.New()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT (.+) FROM \"notes\" WHERE id = (.+) FOR UPDATE").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "title"}).
+			AddRow(noteID.String(), userID.String(), "Plan"))
+	mock.ExpectQuery("SELECT (.+) FROM \"blocks\" WHERE \"blocks\".\"note_id\" = (.+)").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "note_id"}))
+
+	// The user's latest revision was taken a minute ago
+	mock.ExpectQuery("SELECT \"id\",\"revision\",\"user_id\",\"created_at\" FROM \"note_revisions\" WHERE note_id = (.+) ORDER BY revision DESC LIMIT").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "revision", "user_id", "created_at"}).
+			AddRow(revisionID.String(), 7, userID.String(), time.Now().Add(-time.Minute)))
+	mock.ExpectExec("UPDATE \"note_revisions\" SET \"blocks\"=(.+),\"title\"=(.+) WHERE id = (.+)").
+		WithArgs(sqlmock.AnyArg(), "Plan", revisionID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	tx := db.DB.Begin()
+	revision, err := createNoteRevision(tx, noteID, userID)
+	assert.NoError(t, tx.Commit().Error)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 7, revision.Revision)
+	assert.Equal(t, revisionID, revision.ID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateNoteRevision_DropsOldest(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	userID := uuid.New()
+	noteID := uuid.New()
+	now := time.Now()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT (.+) FROM \"notes\" WHERE id = (.+) FOR UPDATE").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "title"}).
+			AddRow(noteID.String(), userID.String(), "Plan"))
+	mock.ExpectQuery("SELECT (.+) FROM \"blocks\" WHERE \"blocks\".\"note_id\" = (.+)").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "note_id"}))
+
+	// Another user took the latest revision, so the edit starts a new one
+	mock.ExpectQuery("SELECT \"id\",\"revision\",\"user_id\",\"created_at\" FROM \"note_revisions\" WHERE note_id = (.+) ORDER BY revision DESC LIMIT").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "revision", "user_id", "created_at"}).
+			AddRow(uuid.New().String(), maxNoteRevisions, uuid.New().String(), now))
+	mock.ExpectQuery("INSERT INTO \"note_revisions\"").
+		WithArgs(noteID.String(), maxNoteRevisions+1, userID.String(), "Plan", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"created_at"}).AddRow(now))
+	mock.ExpectExec("DELETE FROM \"note_revisions\" WHERE note_id = (.+) AND revision <= (.+)").
+		WithArgs(noteID, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	tx := db.DB.Begin()
+	revision, err := createNoteRevision(tx, noteID, userID)
+	assert.NoError(t, tx.Commit().Error)
+
+	assert.NoError(t, err)
+	assert.Equal(t, maxNoteRevisions+1, revision.Revision)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
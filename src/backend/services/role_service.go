@@ -192,22 +192,35 @@ func (s *RoleService) HasAccess(db *database.Database, userID uuid.UUID, resourc
 			return false, parentResult.Error
 		}
 
-		// If note not found or no role, check parent notebook
+		// If note not found or no role, check the notebooks above it
 		var note models.Note
 		if err := db.DB.Select("notebook_id").First(&note, "id = ?", parentID).Error; err == nil {
-			var notebookRole models.Role
-			notebookResult := db.DB.Where(
-				"user_id = ? AND resource_id = ? AND resource_type = ?",
-				userID, note.NotebookID, models.NotebookResource).First(&notebookRole)
+			notebookRole, found, err := notebookChainRole(db.DB, userID, note.NotebookID)
+			if err != nil {
+				return false, err
+			}
 
-			if notebookResult.Error == nil {
+			if found {
 				// Check if notebook role is sufficient
 				sufficient := isRoleSufficient(notebookRole.Role, minimumRole)
-				log.Printf("User %s has role %s for grandparent notebook %s (required: %s): access %v",
-					userID, notebookRole.Role, note.NotebookID, minimumRole, sufficient)
+				log.Printf("User %s has role %s for ancestor notebook %s (required: %s): access %v",
+					userID, notebookRole.Role, notebookRole.ResourceID, minimumRole, sufficient)
 				return sufficient, nil
 			}
 		}
+	} else if resourceType == models.NotebookResource {
+		// For notebooks, roles are inherited from the notebooks above
+		notebookRole, found, err := notebookChainRole(db.DB, userID, resourceID)
+		if err != nil {
+			return false, err
+		}
+
+		if found {
+			sufficient := isRoleSufficient(notebookRole.Role, minimumRole)
+			log.Printf("User %s has role %s for ancestor notebook %s (required: %s): access %v",
+				userID, notebookRole.Role, notebookRole.ResourceID, minimumRole, sufficient)
+			return sufficient, nil
+		}
 	} else if resourceType == models.NoteResource {
 		// For notes, check if user has access to the parent notebook
 		var note models.Note
@@ -218,17 +231,17 @@ func (s *RoleService) HasAccess(db *database.Database, userID uuid.UUID, resourc
 				return true, nil
 			}
 
-			// Check for inherited permissions from notebook
-			var notebookRole models.Role
-			notebookResult := db.DB.Where(
-				"user_id = ? AND resource_id = ? AND resource_type = ?",
-				userID, note.NotebookID, models.NotebookResource).First(&notebookRole)
+			// Check for inherited permissions from the notebook and those above it
+			notebookRole, found, err := notebookChainRole(db.DB, userID, note.NotebookID)
+			if err != nil {
+				return false, err
+			}
 
-			if notebookResult.Error == nil {
+			if found {
 				// Check if notebook role is sufficient
 				sufficient := isRoleSufficient(notebookRole.Role, minimumRole)
-				log.Printf("User %s has role %s for parent notebook %s (required: %s): access %v",
-					userID, notebookRole.Role, note.NotebookID, minimumRole, sufficient)
+				log.Printf("User %s has role %s for ancestor notebook %s (required: %s): access %v",
+					userID, notebookRole.Role, notebookRole.ResourceID, minimumRole, sufficient)
 				return sufficient, nil
 			}
 		}
@@ -239,6 +252,59 @@ func (s *RoleService) HasAccess(db *database.Database, userID uuid.UUID, resourc
 	return false, nil
 }
 
+// notebookChainRole finds the role the user holds on the nearest of the
+// notebook and the notebooks it is nested under. A role closer to the
+// resource overrides one further up.
+func notebookChainRole(db *gorm.DB, userID uuid.UUID, notebookID uuid.UUID) (models.Role, bool, error) {
+	chain, err := notebookAncestors(db, notebookID)
+	if err != nil || len(chain) == 0 {
+		return models.Role{}, false, err
+	}
+
+	var roles []models.Role
+	if err := db.Where("user_id = ? AND resource_id IN ? AND resource_type = ?",
+		userID, chain, models.NotebookResource).Find(&roles).Error; err != nil {
+		return models.Role{}, false, err
+	}
+
+	byNotebook := make(map[uuid.UUID]models.Role, len(roles))
+	for _, role := range roles {
+		byNotebook[role.ResourceID] = role
+	}
+
+	for _, id := range chain {
+		if role, ok := byNotebook[id]; ok {
+			return role, true, nil
+		}
+	}
+	return models.Role{}, false, nil
+}
+
+// viewableNotebooks selects the IDs of the notebooks the user can view:
+// those they own or hold a role on, and every notebook nested under those.
+// Any role grants viewing, so this matches HasAccess for viewers except
+// that admins are left to the caller. It is meant as a subquery. Trashed
+// notebooks are included.
+func viewableNotebooks(db *gorm.DB, userID uuid.UUID) *gorm.DB {
+	return db.Raw(`WITH RECURSIVE viewable_notebooks AS (
+			SELECT id FROM notebooks WHERE user_id = ? OR id IN (
+				SELECT resource_id FROM roles WHERE user_id = ? AND resource_type = ? AND deleted_at IS NULL)
+			UNION
+			SELECT notebooks.id FROM notebooks JOIN viewable_notebooks ON notebooks.parent_notebook_id = viewable_notebooks.id
+		)
+		SELECT id FROM viewable_notebooks`, userID, userID, models.NotebookResource)
+}
+
+// viewableNotes selects the IDs of the notes the user can view: those they
+// own or hold a role on and those in a notebook they can view. Like
+// viewableNotebooks it leaves admins to the caller and includes the trash.
+func viewableNotes(db *gorm.DB, userID uuid.UUID) *gorm.DB {
+	return db.Raw(`SELECT id FROM notes WHERE user_id = ? OR notebook_id IN (?)
+		UNION
+		SELECT resource_id FROM roles WHERE user_id = ? AND resource_type = ? AND deleted_at IS NULL`,
+		userID, viewableNotebooks(db, userID), userID, models.NoteResource)
+}
+
 // isRoleSufficient checks if the assigned role is at least as powerful as the required role
 func isRoleSufficient(assigned models.RoleType, required models.RoleType) bool {
 	roleRank := map[models.RoleType]int{
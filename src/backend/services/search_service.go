@@ -0,0 +1,211 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+
+	"owlistic-notes/owlistic/database"
+	"owlistic-notes/owlistic/models"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// searchFragmentDelimiter separates the fragments returned by ts_headline
+	searchFragmentDelimiter = " ... "
+	// searchHeadlineOptions configures how matches are highlighted in snippets
+	searchHeadlineOptions = `StartSel=<mark>, StopSel=</mark>, MaxFragments=3, MaxWords=20, MinWords=5, FragmentDelimiter=" ... "`
+)
+
+// searchQuery ranks the notes, blocks and tasks the user can view against a
+// single tsquery. Blocks are visible with their note, tasks with their note
+// or to the user they belong to or who holds a role on them. The
+// to_tsvector expressions match the GIN indexes created by the migrations.
+const searchQuery = `
+WITH q AS (SELECT websearch_to_tsquery('english', @query) AS query),
+viewable_notes AS (@viewable)
+SELECT * FROM (
+	SELECT 'note' AS resource_type, n.id AS resource_id, n.id AS note_id, '' AS block_id, n.title AS title,
+		ts_headline('english', coalesce(n.title, ''), q.query, @options) AS headline,
+		ts_rank(to_tsvector('english', coalesce(n.title, '')), q.query) AS rank
+	FROM notes n CROSS JOIN q
+	WHERE n.deleted_at IS NULL
+		AND (@admin OR n.id IN (SELECT id FROM viewable_notes))
+		AND to_tsvector('english', coalesce(n.title, '')) @@ q.query
+	UNION ALL
+	SELECT 'block', b.id, b.note_id, b.id::text, n.title,
+		ts_headline('english', coalesce(b.content->>'text', ''), q.query, @options),
+		ts_rank(to_tsvector('english', coalesce(b.content->>'text', '')), q.query)
+	FROM blocks b JOIN notes n ON n.id = b.note_id AND n.deleted_at IS NULL CROSS JOIN q
+	WHERE b.deleted_at IS NULL
+		AND (@admin OR n.id IN (SELECT id FROM viewable_notes))
+		AND to_tsvector('english', coalesce(b.content->>'text', '')) @@ q.query
+	UNION ALL
+	SELECT 'task', t.id, t.note_id, coalesce(t.metadata->>'block_id', ''), t.title,
+		ts_headline('english', coalesce(t.title, '') || ' ' || coalesce(t.description, ''), q.query, @options),
+		ts_rank(to_tsvector('english', coalesce(t.title, '') || ' ' || coalesce(t.description, '')), q.query)
+	FROM tasks t CROSS JOIN q
+	WHERE t.deleted_at IS NULL
+		AND (@admin OR t.user_id = @user_id OR t.note_id IN (SELECT id FROM viewable_notes)
+			OR t.id IN (SELECT resource_id FROM roles WHERE user_id = @user_id AND resource_type = @task_resource AND deleted_at IS NULL))
+		AND to_tsvector('english', coalesce(t.title, '') || ' ' || coalesce(t.description, '')) @@ q.query
+) hits
+WHERE @resource_type = '' OR hits.resource_type = @resource_type
+ORDER BY rank DESC
+LIMIT @limit OFFSET @offset`
+
+type SearchServiceInterface interface {
+	Search(db *database.Database, params map[string]interface{}) ([]models.SearchResult, error)
+}
+
+type SearchService struct{}
+
+// searchRow is the raw row shape returned by searchQuery
+type searchRow struct {
+	ResourceType string
+	ResourceID   uuid.UUID
+	NoteID       uuid.UUID
+	BlockID      string
+	Title        string
+	Headline     string
+	Rank         float64
+}
+
+// Search runs a ranked full-text search over the notes, blocks and tasks
+// the requesting user can view. "limit" and "offset" page through the hits.
+func (s *SearchService) Search(db *database.Database, params map[string]interface{}) ([]models.SearchResult, error) {
+	userIDStr, ok := params["user_id"].(string)
+	if !ok || userIDStr == "" {
+		return nil, errors.New("user_id must be provided in parameters")
+	}
+
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return nil, ErrInvalidInput
+	}
+
+	query, _ := params["query"].(string)
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return nil, ErrInvalidInput
+	}
+
+	resourceType, _ := params["type"].(string)
+	switch models.ResourceType(resourceType) {
+	case "", models.NoteResource, models.BlockResource, models.TaskResource:
+	default:
+		return nil, ErrInvalidInput
+	}
+
+	limit := parseSearchLimit(params["limit"])
+	offset := parseSearchOffset(params["offset"])
+
+	admin, err := RoleServiceInstance.HasSystemRole(db, userIDStr, string(models.AdminRole))
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []searchRow
+	if err := db.DB.Raw(searchQuery, map[string]interface{}{
+		"query":         query,
+		"options":       searchHeadlineOptions,
+		"resource_type": resourceType,
+		"viewable":      viewableNotes(db.DB, userID),
+		"admin":         admin,
+		"user_id":       userID,
+		"task_resource": models.TaskResource,
+		"limit":         limit,
+		"offset":        offset,
+	}).Scan(&rows).Error; err != nil {
+		log.Printf("Error executing search query: %v", err)
+		return nil, err
+	}
+
+	results := make([]models.SearchResult, 0, len(rows))
+	for _, row := range rows {
+		results = append(results, newSearchResult(row))
+	}
+
+	return results, nil
+}
+
+// newSearchResult converts a raw search row into an API result
+func newSearchResult(row searchRow) models.SearchResult {
+	result := models.SearchResult{
+		ResourceType: models.ResourceType(row.ResourceType),
+		ResourceID:   row.ResourceID,
+		NoteID:       row.NoteID,
+		Title:        row.Title,
+		Snippets:     splitSearchHeadline(row.Headline),
+		Rank:         row.Rank,
+	}
+
+	if blockID, err := uuid.Parse(row.BlockID); err == nil {
+		result.BlockID = &blockID
+	}
+
+	return result
+}
+
+// splitSearchHeadline splits a ts_headline result into its fragments
+func splitSearchHeadline(headline string) []string {
+	snippets := []string{}
+	for _, fragment := range strings.Split(headline, searchFragmentDelimiter) {
+		if fragment = strings.TrimSpace(fragment); fragment != "" {
+			snippets = append(snippets, fragment)
+		}
+	}
+	return snippets
+}
+
+// parseSearchLimit reads the result limit, defaulting to 20 and capping at 100
+func parseSearchLimit(value interface{}) int {
+	var limit int
+	switch v := value.(type) {
+	case int:
+		limit = v
+	case float64:
+		limit = int(v)
+	case string:
+		if l, err := strconv.Atoi(v); err == nil {
+			limit = l
+		}
+	}
+
+	if limit <= 0 {
+		return 20
+	} else if limit > 100 {
+		return 100
+	}
+	return limit
+}
+
+// parseSearchOffset reads the number of results to skip, defaulting to 0
+func parseSearchOffset(value interface{}) int {
+	var offset int
+	switch v := value.(type) {
+	case int:
+		offset = v
+	case float64:
+		offset = int(v)
+	case string:
+		if o, err := strconv.Atoi(v); err == nil {
+			offset = o
+		}
+	}
+
+	if offset < 0 {
+		return 0
+	}
+	return offset
+}
+
+// NewSearchService creates a new instance of SearchService
+func NewSearchService() SearchServiceInterface {
+	return &SearchService{}
+}
+
+// Don't initialize here, will be set properly in main.go
+var SearchServiceInstance SearchServiceInterface
@@ -0,0 +1,92 @@
+package services
+
+import (
+	"testing"
+
+	"owlistic-notes/owlistic/models"
+	"owlistic-notes/owlistic/testutils"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSearch_Success(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	userID := uuid.New()
+	noteID := uuid.New()
+	blockID := uuid.New()
+
+	// Visibility is worked out in the query for users who aren't admins
+	mock.ExpectQuery("SELECT count\\(\\*\\) FROM \"roles\"").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery("SELECT \\* FROM \"roles\"").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	mock.ExpectQuery("WITH q AS \\(SELECT websearch_to_tsquery(.+)viewable_notes AS \\(SELECT id FROM notes WHERE user_id = (.+) OR notebook_id IN \\(WITH RECURSIVE viewable_notebooks AS (.+)LIMIT (.+) OFFSET").
+		WithArgs("roadmap", userID, userID, userID, models.NotebookResource, userID, models.NoteResource,
+			searchHeadlineOptions, false, searchHeadlineOptions, false, searchHeadlineOptions, false, userID, userID, models.TaskResource,
+			"", "", 20, 10).
+		WillReturnRows(sqlmock.NewRows([]string{
+			"resource_type", "resource_id", "note_id", "block_id", "title", "headline", "rank",
+		}).
+			AddRow("block", blockID.String(), noteID.String(), blockID.String(), "Planning",
+				"the <mark>roadmap</mark> for Q3 ... next <mark>roadmap</mark> review", 0.6).
+			AddRow("note", noteID.String(), noteID.String(), "", "Planning <mark>roadmap</mark>",
+				"Planning <mark>roadmap</mark>", 0.3))
+
+	service := &SearchService{}
+	results, err := service.Search(db, map[string]interface{}{
+		"user_id": userID.String(),
+		"query":   "roadmap",
+		"offset":  10,
+	})
+
+	assert.NoError(t, err)
+	assert.Len(t, results, 2)
+	assert.Equal(t, models.BlockResource, results[0].ResourceType)
+	assert.Equal(t, noteID, results[0].NoteID)
+	assert.Equal(t, &blockID, results[0].BlockID)
+	assert.Equal(t, []string{
+		"the <mark>roadmap</mark> for Q3",
+		"next <mark>roadmap</mark> review",
+	}, results[0].Snippets)
+	assert.Equal(t, models.NoteResource, results[1].ResourceType)
+	assert.Nil(t, results[1].BlockID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSearch_InvalidInput(t *testing.T) {
+	db, _, close := testutils.SetupMockDB()
+	defer close()
+
+	service := &SearchService{}
+
+	_, err := service.Search(db, map[string]interface{}{"query": "roadmap"})
+	assert.Error(t, err)
+
+	_, err = service.Search(db, map[string]interface{}{"user_id": uuid.New().String(), "query": "  "})
+	assert.ErrorIs(t, err, ErrInvalidInput)
+
+	_, err = service.Search(db, map[string]interface{}{
+		"user_id": uuid.New().String(),
+		"query":   "roadmap",
+		"type":    "notebook",
+	})
+	assert.ErrorIs(t, err, ErrInvalidInput)
+}
+
+func TestParseSearchLimit(t *testing.T) {
+	assert.Equal(t, 20, parseSearchLimit(nil))
+	assert.Equal(t, 5, parseSearchLimit(5))
+	assert.Equal(t, 10, parseSearchLimit("10"))
+	assert.Equal(t, 100, parseSearchLimit(1000))
+}
+
+func TestParseSearchOffset(t *testing.T) {
+	assert.Equal(t, 0, parseSearchOffset(nil))
+	assert.Equal(t, 40, parseSearchOffset("40"))
+	assert.Equal(t, 0, parseSearchOffset(-5))
+}
@@ -71,8 +71,8 @@ func (s *SyncHandlerService) processEvents(messageChan chan *nats.Msg) {
 	}
 }
 
-// handleSyncEvent processes a block or task event
-func (s *SyncHandlerService) handleSyncEvent(eventType string, data []byte) error {
+// handleSyncEvent processes a block or task event received on the given subject
+func (s *SyncHandlerService) handleSyncEvent(subject string, data []byte) error {
 	// Parse the message using StandardMessage format
 	var message models.StandardMessage
 	if err := json.Unmarshal(data, &message); err != nil {
@@ -91,7 +91,8 @@ func (s *SyncHandlerService) handleSyncEvent(eventType string, data []byte) erro
 		return nil
 	}
 
-	switch eventType {
+	// Subjects only name the entity, the event type travels in the message
+	switch message.Event {
 	case string(broker.BlockCreated):
 		return s.handleBlockCreated(message.Payload)
 	case string(broker.BlockUpdated):
@@ -159,10 +160,12 @@ func (s *SyncHandlerService) handleBlockCreated(payload map[string]interface{})
 		return nil
 	}
 
+	// Link the existing block so the task service doesn't create another one
 	taskData := map[string]interface{}{
-		"user_id": userIDStr,
-		"note_id": noteIDStr,
-		"title":   textContent,
+		"user_id":  userIDStr,
+		"note_id":  noteIDStr,
+		"block_id": blockIDStr,
+		"title":    textContent,
 		"metadata": models.TaskMetadata{
 			"_sync_source": "block",
 			"block_id":     blockIDStr,
@@ -312,7 +315,7 @@ func (s *SyncHandlerService) handleBlockUpdated(payload map[string]interface{})
 
 	// Only update if there are changes to apply
 	if updateData.Title != "" || updateData.IsCompleted != task.IsCompleted || len(updateData.Metadata) > 0 {
-		_, err := s.taskService.UpdateTask(s.db, task.ID.String(), updateData)
+		_, err := s.taskService.UpdateTask(s.db, task.ID.String(), updateData, nil)
 		if err != nil {
 			return err
 		}
@@ -500,7 +503,7 @@ func (s *SyncHandlerService) createBlockForTask(task models.Task) error {
 		},
 	}
 
-	_, err = s.taskService.UpdateTask(s.db, task.ID.String(), updateData)
+	_, err = s.taskService.UpdateTask(s.db, task.ID.String(), updateData, nil)
 	return err
 }
 
@@ -0,0 +1,748 @@
+package services
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+	"time"
+
+	"owlistic-notes/owlistic/broker"
+	"owlistic-notes/owlistic/database"
+	"owlistic-notes/owlistic/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	// defaultSyncLimit is the number of events a page of the change feed
+	// covers unless the client asks for another
+	defaultSyncLimit = 100
+	// maxSyncMutations bounds the number of mutations pushed at once
+	maxSyncMutations = 500
+)
+
+// syncEntities are the event entities the change feed is made of
+var syncEntities = []string{"notebook", "note", "block", "task"}
+
+// syncReferenceKeys are the fields of mutation data that may name a resource
+// created earlier in the same push by its client ID
+var syncReferenceKeys = []string{"notebook_id", "parent_notebook_id", "note_id", "parent_block_id", "block_id"}
+
+type SyncServiceInterface interface {
+	// Pull returns a page of the changes visible to the user since the
+	// "since" cursor. Without one it pages through a snapshot of everything
+	// the user can view first.
+	Pull(db *database.Database, params map[string]interface{}) (models.SyncPage, error)
+	// Push applies mutations queued by an offline client in order and
+	// reports how each one went
+	Push(db *database.Database, mutations []models.SyncMutation, params map[string]interface{}) ([]models.SyncResult, error)
+}
+
+type SyncService struct{}
+
+// syncCursor marks the sequence of the last event a page of the change
+// feed covered. While a snapshot is paged through, Kind and After tell the
+// resource it got to. It is handed out base64 encoded.
+type syncCursor struct {
+	Sequence int64     `json:"s"`
+	Kind     string    `json:"k,omitempty"`
+	After    uuid.UUID `json:"a"`
+}
+
+func (c syncCursor) encode() string {
+	encoded, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(encoded)
+}
+
+func decodeSyncCursor(encoded string) (syncCursor, error) {
+	var cursor syncCursor
+	decoded, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return cursor, err
+	}
+	if err := json.Unmarshal(decoded, &cursor); err != nil {
+		return cursor, err
+	}
+	if cursor.Kind != "" && !slices.Contains(syncEntities, cursor.Kind) {
+		return cursor, fmt.Errorf("unknown kind %q", cursor.Kind)
+	}
+	return cursor, nil
+}
+
+// Pull reads the events of notebooks, notes, blocks and tasks after the
+// cursor and returns the current state of each resource they touched, once
+// per page. Deleting or restoring a note or notebook reports everything in
+// it as well, since those events don't name the blocks and notes that go
+// along. Resources the user can't view are left out. Without a cursor the
+// feed starts with a snapshot, continuing with the events after it.
+func (s *SyncService) Pull(db *database.Database, params map[string]interface{}) (models.SyncPage, error) {
+	userIDStr, ok := params["user_id"].(string)
+	if !ok {
+		return models.SyncPage{}, errors.New("user_id must be provided in parameters")
+	}
+
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return models.SyncPage{}, ErrInvalidInput
+	}
+
+	limit := defaultSyncLimit
+	if value, ok := params["limit"].(int); ok {
+		if value < 1 {
+			return models.SyncPage{}, fmt.Errorf("%w: limit must be positive", ErrInvalidInput)
+		}
+		limit = min(value, maxPageSize)
+	}
+
+	var cursor syncCursor
+	since, _ := params["since"].(string)
+	if since != "" {
+		if cursor, err = decodeSyncCursor(since); err != nil {
+			return models.SyncPage{}, fmt.Errorf("%w: since is not a sync cursor", ErrInvalidInput)
+		}
+	}
+
+	access, err := newSyncAccess(db, userID)
+	if err != nil {
+		return models.SyncPage{}, err
+	}
+
+	if since == "" {
+		// The events after the snapshot starts pick up what changes meanwhile
+		if err := db.DB.Model(&models.Event{}).Select("COALESCE(MAX(sequence), 0)").Scan(&cursor.Sequence).Error; err != nil {
+			return models.SyncPage{}, err
+		}
+		cursor.Kind = syncEntities[0]
+	}
+	if cursor.Kind != "" {
+		return pullSnapshot(db.DB, access, cursor, limit)
+	}
+
+	page := models.SyncPage{Changes: []models.SyncChange{}, Cursor: since}
+	query := db.DB.Where("entity IN ? AND sequence > ?", syncEntities, cursor.Sequence)
+	if !access.admin {
+		// Events name the resource and the note, notebook or user it belongs to
+		query = query.Where(`(data->>'user_id' = ?
+			OR data->>'note_id' IN (SELECT id::text FROM (?) AS viewable_notes)
+			OR data->>'notebook_id' IN (SELECT id::text FROM (?) AS viewable_notebooks)
+			OR data->>'task_id' IN (SELECT id::text FROM tasks WHERE user_id = ?))`,
+			userID.String(), viewableNotes(db.DB, userID), viewableNotebooks(db.DB, userID), userID)
+	}
+
+	var events []models.Event
+	if err := query.Order("sequence ASC").Limit(limit + 1).Find(&events).Error; err != nil {
+		return models.SyncPage{}, err
+	}
+
+	if len(events) > limit {
+		events = events[:limit]
+		page.HasMore = true
+	}
+	if len(events) == 0 {
+		return page, nil
+	}
+	page.Cursor = syncCursor{Sequence: *events[len(events)-1].Sequence}.encode()
+
+	feed := &syncFeed{entries: make(map[syncKey]*syncEntry)}
+	for i, event := range events {
+		if err := feed.add(db.DB, i, event); err != nil {
+			return models.SyncPage{}, err
+		}
+	}
+
+	changes, err := feed.changes(db.DB, access)
+	if err != nil {
+		return models.SyncPage{}, err
+	}
+	page.Changes = changes
+	return page, nil
+}
+
+// pullSnapshot returns a page of the current state of everything the user
+// can view, outside the trash, kind by kind in the order of syncEntities and
+// by ID within a kind. Once through, the cursor moves on to the events after
+// the snapshot started.
+func pullSnapshot(db *gorm.DB, access *syncAccess, cursor syncCursor, limit int) (models.SyncPage, error) {
+	page := models.SyncPage{Changes: []models.SyncChange{}}
+
+	start := slices.Index(syncEntities, cursor.Kind)
+	for _, kind := range syncEntities[start:] {
+		changes, err := snapshotChanges(db, access, kind, cursor.After, limit-len(page.Changes)+1)
+		if err != nil {
+			return models.SyncPage{}, err
+		}
+
+		if len(page.Changes)+len(changes) > limit {
+			changes = changes[:limit-len(page.Changes)]
+			if len(changes) > 0 {
+				cursor.After = changes[len(changes)-1].ID
+			}
+			page.Changes = append(page.Changes, changes...)
+			page.Cursor = syncCursor{Sequence: cursor.Sequence, Kind: kind, After: cursor.After}.encode()
+			page.HasMore = true
+			return page, nil
+		}
+
+		page.Changes = append(page.Changes, changes...)
+		cursor.After = uuid.Nil
+	}
+
+	page.Cursor = syncCursor{Sequence: cursor.Sequence}.encode()
+	return page, nil
+}
+
+// snapshotChanges loads up to limit resources of a kind the user can view
+// with IDs after the given one
+func snapshotChanges(db *gorm.DB, access *syncAccess, kind string, after uuid.UUID, limit int) ([]models.SyncChange, error) {
+	query := db.Where("id > ?", after).Order("id ASC").Limit(limit)
+
+	// Blocks of notes in the trash stay behind with their note
+	notes := db.Model(&models.Note{}).Select("id")
+	if !access.admin {
+		notes = notes.Where("id IN (?)", viewableNotes(db, access.userID))
+	}
+
+	changes := []models.SyncChange{}
+	add := func(id uuid.UUID, version int64, data interface{}, changedAt time.Time) {
+		changes = append(changes, models.SyncChange{Type: kind, ID: id, Version: version, Data: data, ChangedAt: changedAt})
+	}
+
+	switch kind {
+	case "notebook":
+		if !access.admin {
+			query = query.Where("id IN (?)", viewableNotebooks(db, access.userID))
+		}
+		var notebooks []models.Notebook
+		if err := query.Find(&notebooks).Error; err != nil {
+			return nil, err
+		}
+		for _, notebook := range notebooks {
+			add(notebook.ID, notebook.Version, notebook, notebook.UpdatedAt)
+		}
+
+	case "note":
+		var rows []models.Note
+		if err := query.Where("id IN (?)", notes).Find(&rows).Error; err != nil {
+			return nil, err
+		}
+		for _, note := range rows {
+			add(note.ID, note.Version, note, note.UpdatedAt)
+		}
+
+	case "block":
+		var blocks []models.Block
+		if err := query.Where("note_id IN (?)", notes).Find(&blocks).Error; err != nil {
+			return nil, err
+		}
+		for _, block := range blocks {
+			add(block.ID, block.Version, block, block.UpdatedAt)
+		}
+
+	case "task":
+		// Tasks are only ever shown to their owner
+		var tasks []models.Task
+		if err := query.Where("user_id = ?", access.userID).Find(&tasks).Error; err != nil {
+			return nil, err
+		}
+		for _, task := range tasks {
+			add(task.ID, task.Version, task, task.UpdatedAt)
+		}
+	}
+
+	return changes, nil
+}
+
+// syncKey names a resource of the change feed
+type syncKey struct {
+	kind string
+	id   uuid.UUID
+}
+
+// syncEntry is a resource touched by the events of a page. The IDs the
+// events mention tell who may see it once the resource itself is gone.
+type syncEntry struct {
+	seq        int
+	changedAt  time.Time
+	userID     string
+	noteID     string
+	notebookID string
+}
+
+// syncFeed gathers the resources touched by the events of a page
+type syncFeed struct {
+	keys    []syncKey
+	entries map[syncKey]*syncEntry
+}
+
+// touch records a change to a resource, keeping the latest one
+func (f *syncFeed) touch(kind string, id uuid.UUID, seq int, at time.Time) *syncEntry {
+	key := syncKey{kind: kind, id: id}
+	entry, exists := f.entries[key]
+	if !exists {
+		entry = &syncEntry{}
+		f.entries[key] = entry
+		f.keys = append(f.keys, key)
+	}
+	if seq >= entry.seq {
+		entry.seq, entry.changedAt = seq, at
+	}
+	return entry
+}
+
+// add records the resources an event touched
+func (f *syncFeed) add(db *gorm.DB, seq int, event models.Event) error {
+	var data map[string]interface{}
+	if err := json.Unmarshal(event.Data, &data); err != nil {
+		log.Printf("Skipping event %s with unreadable data: %v", event.ID, err)
+		return nil
+	}
+
+	idStr, _ := data[event.Entity+"_id"].(string)
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		return nil
+	}
+
+	entry := f.touch(event.Entity, id, seq, event.Timestamp)
+	for key, hint := range map[string]*string{"user_id": &entry.userID, "note_id": &entry.noteID, "notebook_id": &entry.notebookID} {
+		if value, ok := data[key].(string); ok && value != "" && *hint == "" {
+			*hint = value
+		}
+	}
+
+	switch broker.EventType(event.Event) {
+	case broker.NoteDeleted, broker.NoteRestored:
+		return f.addNoteContents(db, []uuid.UUID{id}, seq, event.Timestamp)
+
+	case broker.NotebookDeleted, broker.NotebookRestored:
+		notebookIDs := []uuid.UUID{id}
+		// A deleted notebook names its subtree as it was at the time
+		if listed, ok := data["notebook_ids"].([]interface{}); ok {
+			for _, value := range listed {
+				if s, ok := value.(string); ok {
+					if parsed, err := uuid.Parse(s); err == nil {
+						notebookIDs = append(notebookIDs, parsed)
+					}
+				}
+			}
+		}
+
+		subtree, err := notebookSubtree(db, notebookIDs)
+		if err != nil {
+			return err
+		}
+		for _, notebookID := range append(notebookIDs, subtree...) {
+			f.touch("notebook", notebookID, seq, event.Timestamp)
+		}
+
+		if len(subtree) == 0 {
+			return nil
+		}
+
+		var noteIDs []uuid.UUID
+		if err := db.Unscoped().Model(&models.Note{}).Where("notebook_id IN ?", subtree).Pluck("id", &noteIDs).Error; err != nil {
+			return err
+		}
+		for _, noteID := range noteIDs {
+			f.touch("note", noteID, seq, event.Timestamp)
+		}
+		return f.addNoteContents(db, noteIDs, seq, event.Timestamp)
+	}
+
+	return nil
+}
+
+// addNoteContents records the blocks and tasks of the notes as changed
+func (f *syncFeed) addNoteContents(db *gorm.DB, noteIDs []uuid.UUID, seq int, at time.Time) error {
+	if len(noteIDs) == 0 {
+		return nil
+	}
+
+	var blockIDs, taskIDs []uuid.UUID
+	if err := db.Unscoped().Model(&models.Block{}).Where("note_id IN ?", noteIDs).Pluck("id", &blockIDs).Error; err != nil {
+		return err
+	}
+	if err := db.Unscoped().Model(&models.Task{}).Where("note_id IN ?", noteIDs).Pluck("id", &taskIDs).Error; err != nil {
+		return err
+	}
+
+	for _, blockID := range blockIDs {
+		f.touch("block", blockID, seq, at)
+	}
+	for _, taskID := range taskIDs {
+		f.touch("task", taskID, seq, at)
+	}
+	return nil
+}
+
+// syncRow is the current state of a resource of the feed
+type syncRow struct {
+	deleted bool
+	version int64
+	data    interface{}
+	visible bool
+}
+
+// changes loads the current state of the recorded resources, trashed ones
+// included, and returns those the user can view in the order of their
+// latest change
+func (f *syncFeed) changes(db *gorm.DB, access *syncAccess) ([]models.SyncChange, error) {
+	ids := make(map[string][]uuid.UUID)
+	for _, key := range f.keys {
+		ids[key.kind] = append(ids[key.kind], key.id)
+	}
+
+	var notebooks []models.Notebook
+	var notes []models.Note
+	var blocks []models.Block
+	var tasks []models.Task
+	for _, load := range []struct {
+		kind string
+		rows interface{}
+	}{{"notebook", &notebooks}, {"note", &notes}, {"block", &blocks}, {"task", &tasks}} {
+		if len(ids[load.kind]) == 0 {
+			continue
+		}
+		if err := db.Unscoped().Where("id IN ?", ids[load.kind]).Find(load.rows).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	// The notes decide who sees them and their blocks
+	var noteIDs []uuid.UUID
+	for _, note := range notes {
+		noteIDs = append(noteIDs, note.ID)
+	}
+	for _, block := range blocks {
+		noteIDs = append(noteIDs, block.NoteID)
+	}
+	for _, key := range f.keys {
+		if noteID, err := uuid.Parse(f.entries[key].noteID); err == nil {
+			noteIDs = append(noteIDs, noteID)
+		}
+	}
+	if err := access.loadNotes(db, noteIDs); err != nil {
+		return nil, err
+	}
+
+	rows := make(map[syncKey]syncRow)
+	for _, notebook := range notebooks {
+		rows[syncKey{"notebook", notebook.ID}] = syncRow{notebook.DeletedAt.Valid, notebook.Version, notebook, access.notebooks[notebook.ID]}
+	}
+	for _, note := range notes {
+		rows[syncKey{"note", note.ID}] = syncRow{note.DeletedAt.Valid, note.Version, note, access.notes[note.ID]}
+	}
+	for _, block := range blocks {
+		rows[syncKey{"block", block.ID}] = syncRow{block.DeletedAt.Valid, block.Version, block, access.notes[block.NoteID]}
+	}
+	for _, task := range tasks {
+		// Tasks are only ever shown to their owner
+		rows[syncKey{"task", task.ID}] = syncRow{task.DeletedAt.Valid, task.Version, task, task.UserID == access.userID}
+	}
+
+	keys := append([]syncKey(nil), f.keys...)
+	sort.SliceStable(keys, func(i, j int) bool {
+		return f.entries[keys[i]].seq < f.entries[keys[j]].seq
+	})
+
+	changes := []models.SyncChange{}
+	for _, key := range keys {
+		entry := f.entries[key]
+		change := models.SyncChange{Type: key.kind, ID: key.id, Deleted: true, ChangedAt: entry.changedAt}
+
+		row, exists := rows[key]
+		if exists {
+			if !row.visible {
+				continue
+			}
+			change.Version = row.version
+			if !row.deleted {
+				change.Deleted, change.Data = false, row.data
+			}
+		} else if !access.mentioned(key.kind, entry) {
+			// Gone for good: only the events tell whose it was
+			continue
+		}
+
+		changes = append(changes, change)
+	}
+	return changes, nil
+}
+
+// syncAccess tells which notebooks and notes a user can view, trashed ones
+// included: those they own or hold a role on, directly or through a
+// notebook they are nested in. Admins view everything.
+type syncAccess struct {
+	userID    uuid.UUID
+	admin     bool
+	notebooks map[uuid.UUID]bool
+	notes     map[uuid.UUID]bool
+}
+
+func newSyncAccess(db *database.Database, userID uuid.UUID) (*syncAccess, error) {
+	access := &syncAccess{userID: userID, notebooks: make(map[uuid.UUID]bool), notes: make(map[uuid.UUID]bool)}
+
+	admin, err := RoleServiceInstance.HasSystemRole(db, userID.String(), string(models.AdminRole))
+	if err != nil {
+		return nil, err
+	}
+	access.admin = admin
+
+	var roots []uuid.UUID
+	if err := db.DB.Raw(`SELECT id FROM notebooks WHERE user_id = ?
+		UNION SELECT resource_id FROM roles WHERE user_id = ? AND resource_type = ? AND deleted_at IS NULL`,
+		userID, userID, models.NotebookResource).Scan(&roots).Error; err != nil {
+		return nil, err
+	}
+	if len(roots) == 0 {
+		return access, nil
+	}
+
+	subtree, err := notebookSubtree(db.DB, roots)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range subtree {
+		access.notebooks[id] = true
+	}
+	return access, nil
+}
+
+// loadNotes works out which of the notes the user can view
+func (a *syncAccess) loadNotes(db *gorm.DB, noteIDs []uuid.UUID) error {
+	if len(noteIDs) == 0 {
+		return nil
+	}
+
+	var notes []models.Note
+	if err := db.Unscoped().Select("id", "user_id", "notebook_id").Where("id IN ?", noteIDs).Find(&notes).Error; err != nil {
+		return err
+	}
+
+	var roleNoteIDs []uuid.UUID
+	if err := db.Model(&models.Role{}).Where("user_id = ? AND resource_type = ? AND resource_id IN ?",
+		a.userID, models.NoteResource, noteIDs).Pluck("resource_id", &roleNoteIDs).Error; err != nil {
+		return err
+	}
+	hasRole := make(map[uuid.UUID]bool, len(roleNoteIDs))
+	for _, id := range roleNoteIDs {
+		hasRole[id] = true
+	}
+
+	for _, note := range notes {
+		a.notes[note.ID] = a.admin || note.UserID == a.userID || hasRole[note.ID] || a.notebooks[note.NotebookID]
+	}
+	return nil
+}
+
+// mentioned tells whether the events of a resource that no longer exists
+// name the user, or a note or notebook they can view
+func (a *syncAccess) mentioned(kind string, entry *syncEntry) bool {
+	if entry.userID == a.userID.String() {
+		return true
+	}
+	if kind == "task" {
+		return false
+	}
+	if a.admin {
+		return true
+	}
+
+	if noteID, err := uuid.Parse(entry.noteID); err == nil && a.notes[noteID] {
+		return true
+	}
+	if notebookID, err := uuid.Parse(entry.notebookID); err == nil && a.notebooks[notebookID] {
+		return true
+	}
+	return false
+}
+
+// Push applies the mutations one by one, each in its own transaction, so
+// one failing leaves the others in place. A create's client ID may stand in
+// for the new resource's ID in the mutations after it.
+func (s *SyncService) Push(db *database.Database, mutations []models.SyncMutation, params map[string]interface{}) ([]models.SyncResult, error) {
+	if _, ok := params["user_id"].(string); !ok {
+		return nil, errors.New("user_id must be provided in parameters")
+	}
+
+	if len(mutations) > maxSyncMutations {
+		return nil, fmt.Errorf("%w: at most %d mutations can be pushed at once", ErrInvalidInput, maxSyncMutations)
+	}
+
+	created := make(map[string]string)
+	results := make([]models.SyncResult, len(mutations))
+	for i, mutation := range mutations {
+		results[i] = s.apply(db, mutation, created, params)
+		if mutation.Op == models.SyncCreate && mutation.ClientID != "" && results[i].Status == models.SyncApplied {
+			created[mutation.ClientID] = results[i].ID
+		}
+	}
+	return results, nil
+}
+
+// apply runs one mutation through the service of its resource type
+func (s *SyncService) apply(db *database.Database, mutation models.SyncMutation, created map[string]string, params map[string]interface{}) models.SyncResult {
+	result := models.SyncResult{ClientID: mutation.ClientID, Status: models.SyncApplied}
+
+	id := mutation.ID
+	if createdID, ok := created[id]; ok {
+		id = createdID
+	}
+
+	data := make(map[string]interface{}, len(mutation.Data)+1)
+	for key, value := range mutation.Data {
+		data[key] = value
+	}
+	for _, key := range syncReferenceKeys {
+		if value, ok := data[key].(string); ok && created[value] != "" {
+			data[key] = created[value]
+		}
+	}
+	delete(data, "expected_version")
+	if mutation.ExpectedVersion != nil {
+		data["expected_version"] = *mutation.ExpectedVersion
+	}
+
+	resource, resourceID, err := applySyncMutation(db, mutation.Type, mutation.Op, id, mutation.ExpectedVersion, data, params)
+	if err != nil {
+		var conflict *VersionConflictError
+		switch {
+		case errors.As(err, &conflict):
+			result.Status, result.Current = models.SyncConflict, conflict.Current
+		case mutation.Op == models.SyncDelete && isSyncNotFound(err):
+			// Deleted already, which is what the client wanted
+			result.ID = id
+			return result
+		default:
+			result.Status = models.SyncFailed
+		}
+		result.ID, result.Error = id, err.Error()
+		return result
+	}
+
+	result.ID, result.Data = resourceID, resource
+	return result
+}
+
+// applySyncMutation creates, updates or deletes a resource and returns it
+// with its ID. Deletes based on an outdated version are refused.
+func applySyncMutation(db *database.Database, kind string, op string, id string, expected *int64, data map[string]interface{}, params map[string]interface{}) (interface{}, string, error) {
+	userIDStr := params["user_id"].(string)
+
+	switch kind + "." + op {
+	case "notebook.create":
+		data["user_id"] = userIDStr
+		notebook, err := NotebookServiceInstance.CreateNotebook(db, data)
+		return notebook, notebook.ID.String(), err
+	case "notebook.update":
+		notebook, err := NotebookServiceInstance.UpdateNotebook(db, id, data, params)
+		return notebook, id, err
+	case "notebook.delete":
+		if expected != nil {
+			notebook, err := NotebookServiceInstance.GetNotebookById(db, id, params)
+			if err != nil {
+				return nil, id, err
+			}
+			if err := checkVersion(expected, notebook.Version, notebook); err != nil {
+				return nil, id, err
+			}
+		}
+		return nil, id, NotebookServiceInstance.DeleteNotebook(db, id, params)
+
+	case "note.create":
+		data["user_id"] = userIDStr
+		note, err := NoteServiceInstance.CreateNote(db, data)
+		return note, note.ID.String(), err
+	case "note.update":
+		note, err := NoteServiceInstance.UpdateNote(db, id, data, params)
+		return note, id, err
+	case "note.delete":
+		if expected != nil {
+			note, err := NoteServiceInstance.GetNoteById(db, id, params)
+			if err != nil {
+				return nil, id, err
+			}
+			if err := checkVersion(expected, note.Version, note); err != nil {
+				return nil, id, err
+			}
+		}
+		return nil, id, NoteServiceInstance.DeleteNote(db, id, params)
+
+	case "block.create":
+		block, err := BlockServiceInstance.CreateBlock(db, data, params)
+		return block, block.ID.String(), err
+	case "block.update":
+		block, err := BlockServiceInstance.UpdateBlock(db, id, data, params)
+		return block, id, err
+	case "block.delete":
+		if expected != nil {
+			block, err := BlockServiceInstance.GetBlockById(db, id, params)
+			if err != nil {
+				return nil, id, err
+			}
+			if err := checkVersion(expected, block.Version, block); err != nil {
+				return nil, id, err
+			}
+		}
+		return nil, id, BlockServiceInstance.DeleteBlock(db, id, params)
+
+	case "task.create":
+		data["user_id"] = userIDStr
+		task, err := TaskServiceInstance.CreateTask(db, data)
+		return task, task.ID.String(), err
+	case "task.update", "task.delete":
+		// Tasks belong to their owner alone, as on the task routes
+		task, err := TaskServiceInstance.GetTaskById(db, id)
+		if err != nil {
+			return nil, id, err
+		}
+		if task.UserID.String() != userIDStr {
+			return nil, id, fmt.Errorf("not authorized to %s this task", op)
+		}
+
+		if op == models.SyncDelete {
+			if err := checkVersion(expected, task.Version, task); err != nil {
+				return nil, id, err
+			}
+			return nil, id, TaskServiceInstance.DeleteTask(db, id)
+		}
+
+		var update models.Task
+		delete(data, "expected_version")
+		encoded, err := json.Marshal(data)
+		if err != nil {
+			return nil, id, err
+		}
+		if err := json.Unmarshal(encoded, &update); err != nil {
+			return nil, id, fmt.Errorf("%w: %v", ErrInvalidInput, err)
+		}
+		update.ID, update.UserID = uuid.Nil, uuid.Nil
+		task, err = TaskServiceInstance.UpdateTask(db, id, update, expected)
+		return task, id, err
+	}
+
+	return nil, id, fmt.Errorf("%w: cannot %s a %s", ErrInvalidInput, op, kind)
+}
+
+// isSyncNotFound tells whether an error says the resource doesn't exist
+func isSyncNotFound(err error) bool {
+	for _, notFound := range []error{ErrNotFound, ErrNotebookNotFound, ErrNoteNotFound, ErrBlockNotFound, ErrTaskNotFound, gorm.ErrRecordNotFound} {
+		if errors.Is(err, notFound) {
+			return true
+		}
+	}
+	return false
+}
+
+// NewSyncService creates a new instance of SyncService
+func NewSyncService() SyncServiceInterface {
+	return &SyncService{}
+}
+
+// Don't initialize here, will be set properly in main.go
+var SyncServiceInstance SyncServiceInterface
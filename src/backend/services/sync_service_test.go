@@ -0,0 +1,298 @@
+package services
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"owlistic-notes/owlistic/database"
+	"owlistic-notes/owlistic/models"
+	"owlistic-notes/owlistic/testutils"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+// syncRoleStub answers that nobody is an admin
+type syncRoleStub struct {
+	RoleServiceInterface
+}
+
+func (s *syncRoleStub) HasSystemRole(db *database.Database, userID string, requiredRole string) (bool, error) {
+	return false, nil
+}
+
+func syncEventRow(rows *sqlmock.Rows, sequence int64, event string, entity string, at time.Time, data map[string]interface{}) *sqlmock.Rows {
+	encoded, _ := json.Marshal(data)
+	return rows.AddRow(uuid.New().String(), event, 1, entity, at, encoded, "completed", true, sequence)
+}
+
+func TestPull(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	previous := RoleServiceInstance
+	RoleServiceInstance = &syncRoleStub{}
+	defer func() { RoleServiceInstance = previous }()
+
+	userID := uuid.New()
+	otherID := uuid.New()
+	notebookID := uuid.New()
+	ownNoteID := uuid.New()
+	trashedNoteID := uuid.New()
+	hiddenNoteID := uuid.New()
+	hiddenBlockID := uuid.New()
+	purgedBlockID := uuid.New()
+	trashedBlockID := uuid.New()
+	at := time.Now().Add(-time.Minute).UTC()
+
+	events := sqlmock.NewRows([]string{"id", "event", "version", "entity", "timestamp", "data", "status", "dispatched", "sequence"})
+	syncEventRow(events, 11, "note.updated", "note", at, map[string]interface{}{"note_id": ownNoteID.String()})
+	syncEventRow(events, 12, "block.updated", "block", at.Add(time.Second), map[string]interface{}{
+		"block_id": hiddenBlockID.String(), "note_id": hiddenNoteID.String(), "user_id": otherID.String(),
+	})
+	syncEventRow(events, 13, "block.deleted", "block", at.Add(2*time.Second), map[string]interface{}{
+		"block_id": purgedBlockID.String(), "note_id": hiddenNoteID.String(), "user_id": userID.String(),
+	})
+	syncEventRow(events, 14, "note.deleted", "note", at.Add(3*time.Second), map[string]interface{}{
+		"note_id": trashedNoteID.String(), "notebook_id": notebookID.String(),
+	})
+	syncEventRow(events, 15, "note.updated", "note", at.Add(4*time.Second), map[string]interface{}{"note_id": ownNoteID.String()})
+
+	mock.ExpectQuery(`SELECT id FROM notebooks WHERE user_id = \$1\s+UNION SELECT resource_id FROM roles`).
+		WithArgs(userID, userID, models.NotebookResource).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	// Only the events of resources that may be the user's are read
+	cursor := syncCursor{Sequence: 10}
+	mock.ExpectQuery(`SELECT \* FROM "events" WHERE \(entity IN \(\$1,\$2,\$3,\$4\) AND sequence > \$5\) AND \(data->>'user_id' = \$6\s+OR data->>'note_id' IN \(SELECT id::text FROM \(SELECT id FROM notes (.+)\) AS viewable_notes\)(.+) AS viewable_notebooks\)\s+OR data->>'task_id' IN \(SELECT id::text FROM tasks WHERE user_id = (.+)\)\) ORDER BY sequence ASC LIMIT`).
+		WillReturnRows(events)
+
+	// The trashed note's blocks and tasks come along
+	mock.ExpectQuery(`SELECT "id" FROM "blocks" WHERE note_id IN \(\$1\)`).
+		WithArgs(trashedNoteID).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(trashedBlockID.String()))
+	mock.ExpectQuery(`SELECT "id" FROM "tasks" WHERE note_id IN \(\$1\)`).
+		WithArgs(trashedNoteID).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	deletedAt := at.Add(3 * time.Second)
+	mock.ExpectQuery(`SELECT \* FROM "notes" WHERE id IN \(\$1,\$2\)`).
+		WithArgs(ownNoteID, trashedNoteID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "notebook_id", "title", "version", "deleted_at"}).
+			AddRow(ownNoteID.String(), userID.String(), notebookID.String(), "Plans", 4, nil).
+			AddRow(trashedNoteID.String(), userID.String(), notebookID.String(), "Old", 2, deletedAt))
+	mock.ExpectQuery(`SELECT \* FROM "blocks" WHERE id IN \(\$1,\$2,\$3\)`).
+		WithArgs(hiddenBlockID, purgedBlockID, trashedBlockID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "note_id", "type", "order", "version", "deleted_at"}).
+			AddRow(hiddenBlockID.String(), otherID.String(), hiddenNoteID.String(), "text", 1, 7, nil).
+			AddRow(trashedBlockID.String(), userID.String(), trashedNoteID.String(), "text", 1, 3, deletedAt))
+
+	mock.ExpectQuery(`SELECT "id","user_id","notebook_id" FROM "notes" WHERE id IN`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "notebook_id"}).
+			AddRow(ownNoteID.String(), userID.String(), notebookID.String()).
+			AddRow(trashedNoteID.String(), userID.String(), notebookID.String()).
+			AddRow(hiddenNoteID.String(), otherID.String(), uuid.New().String()))
+	mock.ExpectQuery(`SELECT "resource_id" FROM "roles" WHERE \(user_id = \$1 AND resource_type = \$2 AND resource_id IN`).
+		WillReturnRows(sqlmock.NewRows([]string{"resource_id"}))
+
+	service := &SyncService{}
+	page, err := service.Pull(db, map[string]interface{}{"user_id": userID.String(), "since": cursor.encode(), "limit": 4})
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	assert.True(t, page.HasMore)
+	assert.Equal(t, syncCursor{Sequence: 14}.encode(), page.Cursor)
+
+	// The hidden block is left out; the purged one is named by its event
+	assert.Len(t, page.Changes, 4)
+	assert.Equal(t, ownNoteID, page.Changes[0].ID)
+	assert.False(t, page.Changes[0].Deleted)
+	assert.Equal(t, int64(4), page.Changes[0].Version)
+	assert.NotNil(t, page.Changes[0].Data)
+
+	assert.Equal(t, purgedBlockID, page.Changes[1].ID)
+	assert.True(t, page.Changes[1].Deleted)
+	assert.Nil(t, page.Changes[1].Data)
+
+	assert.Equal(t, trashedNoteID, page.Changes[2].ID)
+	assert.True(t, page.Changes[2].Deleted)
+	assert.Equal(t, int64(2), page.Changes[2].Version)
+
+	assert.Equal(t, "block", page.Changes[3].Type)
+	assert.Equal(t, trashedBlockID, page.Changes[3].ID)
+	assert.True(t, page.Changes[3].Deleted)
+}
+
+func TestPull_Cursor(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	previous := RoleServiceInstance
+	RoleServiceInstance = &syncRoleStub{}
+	defer func() { RoleServiceInstance = previous }()
+
+	mock.ExpectQuery(`SELECT id FROM notebooks WHERE user_id`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	cursor := syncCursor{Sequence: 42}
+	mock.ExpectQuery(`SELECT \* FROM "events" WHERE \(entity IN .* AND sequence > \$5\)`).
+		WithArgs("notebook", "note", "block", "task", int64(42), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(),
+			sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(),
+			sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	service := &SyncService{}
+	page, err := service.Pull(db, map[string]interface{}{"user_id": uuid.New().String(), "since": cursor.encode()})
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	// Nothing new: the client keeps its cursor
+	assert.Equal(t, cursor.encode(), page.Cursor)
+	assert.Empty(t, page.Changes)
+	assert.False(t, page.HasMore)
+
+	_, err = service.Pull(db, map[string]interface{}{"user_id": uuid.New().String(), "since": "not a cursor"})
+	assert.ErrorIs(t, err, ErrInvalidInput)
+}
+
+func TestPull_Snapshot(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	previous := RoleServiceInstance
+	RoleServiceInstance = &syncRoleStub{}
+	defer func() { RoleServiceInstance = previous }()
+
+	userID := uuid.New()
+	notebookID := uuid.New()
+	noteID := uuid.New()
+	blockID := uuid.New()
+	now := time.Now().UTC()
+
+	mock.ExpectQuery(`SELECT id FROM notebooks WHERE user_id`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(notebookID.String()))
+	mock.ExpectQuery(`WITH RECURSIVE subtree`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(notebookID.String()))
+
+	// The snapshot starts at the latest event
+	mock.ExpectQuery(`SELECT COALESCE\(MAX\(sequence\), 0\) FROM "events"`).
+		WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(7))
+
+	mock.ExpectQuery(`SELECT \* FROM "notebooks" WHERE id > \$1 AND id IN \(WITH RECURSIVE viewable_notebooks (.+) ORDER BY id ASC LIMIT \$5`).
+		WithArgs(uuid.Nil, userID, userID, models.NotebookResource, 4).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "version", "updated_at"}).
+			AddRow(notebookID.String(), userID.String(), "Work", 2, now))
+	mock.ExpectQuery(`SELECT \* FROM "notes" WHERE id > \$1 AND id IN \(SELECT "id" FROM "notes" WHERE id IN \(SELECT id FROM notes WHERE user_id = (.+) ORDER BY id ASC LIMIT \$8`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "notebook_id", "title", "version", "updated_at"}).
+			AddRow(noteID.String(), userID.String(), notebookID.String(), "Plans", 3, now))
+
+	// The page is full; one more block tells there is more
+	mock.ExpectQuery(`SELECT \* FROM "blocks" WHERE id > \$1 AND note_id IN \(SELECT "id" FROM "notes" WHERE (.+) ORDER BY id ASC LIMIT \$8`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "note_id", "type", "version", "updated_at"}).
+			AddRow(blockID.String(), userID.String(), noteID.String(), "text", 1, now).
+			AddRow(uuid.New().String(), userID.String(), noteID.String(), "text", 1, now))
+
+	service := &SyncService{}
+	page, err := service.Pull(db, map[string]interface{}{"user_id": userID.String(), "limit": 3})
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	assert.True(t, page.HasMore)
+	if assert.Len(t, page.Changes, 3) {
+		assert.Equal(t, "notebook", page.Changes[0].Type)
+		assert.Equal(t, int64(2), page.Changes[0].Version)
+		assert.Equal(t, noteID, page.Changes[1].ID)
+		assert.Equal(t, blockID, page.Changes[2].ID)
+		assert.False(t, page.Changes[2].Deleted)
+	}
+	assert.Equal(t, syncCursor{Sequence: 7, Kind: "block", After: blockID}.encode(), page.Cursor)
+}
+
+// syncNoteStub creates notes and refuses to delete missing ones
+type syncNoteStub struct {
+	NoteServiceInterface
+	created []map[string]interface{}
+}
+
+func (s *syncNoteStub) CreateNote(db *database.Database, noteData map[string]interface{}) (models.Note, error) {
+	s.created = append(s.created, noteData)
+	return models.Note{ID: uuid.New(), Title: noteData["title"].(string), Version: 1}, nil
+}
+
+func (s *syncNoteStub) DeleteNote(db *database.Database, id string, params map[string]interface{}) error {
+	return ErrNoteNotFound
+}
+
+// syncBlockStub creates blocks and turns down updates based on version 1
+type syncBlockStub struct {
+	BlockServiceInterface
+	created []map[string]interface{}
+}
+
+func (s *syncBlockStub) CreateBlock(db *database.Database, blockData map[string]interface{}, params map[string]interface{}) (models.Block, error) {
+	s.created = append(s.created, blockData)
+	return models.Block{ID: uuid.New(), Version: 1}, nil
+}
+
+func (s *syncBlockStub) UpdateBlock(db *database.Database, id string, blockData map[string]interface{}, params map[string]interface{}) (models.Block, error) {
+	expected, err := expectedVersion(blockData)
+	if err != nil {
+		return models.Block{}, err
+	}
+	current := models.Block{ID: uuid.MustParse(id), Version: 2}
+	if err := checkVersion(expected, current.Version, current); err != nil {
+		return models.Block{}, err
+	}
+	current.Version++
+	return current, nil
+}
+
+func TestPush(t *testing.T) {
+	notes, blocks := &syncNoteStub{}, &syncBlockStub{}
+	previousNotes, previousBlocks := NoteServiceInstance, BlockServiceInstance
+	NoteServiceInstance, BlockServiceInstance = notes, blocks
+	defer func() { NoteServiceInstance, BlockServiceInstance = previousNotes, previousBlocks }()
+
+	userID := uuid.New().String()
+	blockID := uuid.New().String()
+	one, two := int64(1), int64(2)
+
+	service := &SyncService{}
+	results, err := service.Push(&database.Database{}, []models.SyncMutation{
+		{ClientID: "tmp-note", Type: "note", Op: models.SyncCreate, Data: map[string]interface{}{"title": "Offline"}},
+		{ClientID: "tmp-block", Type: "block", Op: models.SyncCreate, Data: map[string]interface{}{"note_id": "tmp-note", "type": "text"}},
+		{ClientID: "edit", Type: "block", Op: models.SyncUpdate, ID: blockID, ExpectedVersion: &one},
+		{ClientID: "edit-again", Type: "block", Op: models.SyncUpdate, ID: blockID, ExpectedVersion: &two},
+		{ClientID: "gone", Type: "note", Op: models.SyncDelete, ID: uuid.New().String()},
+		{ClientID: "odd", Type: "tag", Op: models.SyncCreate},
+	}, map[string]interface{}{"user_id": userID})
+	assert.NoError(t, err)
+	assert.Len(t, results, 6)
+
+	assert.Equal(t, models.SyncApplied, results[0].Status)
+	assert.Equal(t, userID, notes.created[0]["user_id"])
+
+	// The block lands in the note created just before it
+	assert.Equal(t, models.SyncApplied, results[1].Status)
+	assert.Equal(t, results[0].ID, blocks.created[0]["note_id"])
+
+	assert.Equal(t, models.SyncConflict, results[2].Status)
+	assert.Equal(t, "edit", results[2].ClientID)
+	assert.Equal(t, int64(2), results[2].Current.(models.Block).Version)
+
+	assert.Equal(t, models.SyncApplied, results[3].Status)
+	assert.Equal(t, int64(3), results[3].Data.(models.Block).Version)
+
+	// Deleting what is gone already is no failure
+	assert.Equal(t, models.SyncApplied, results[4].Status)
+
+	assert.Equal(t, models.SyncFailed, results[5].Status)
+	assert.NotEmpty(t, results[5].Error)
+}
+
+func TestPush_TooMany(t *testing.T) {
+	service := &SyncService{}
+	_, err := service.Push(&database.Database{}, make([]models.SyncMutation, maxSyncMutations+1), map[string]interface{}{"user_id": uuid.New().String()})
+	assert.ErrorIs(t, err, ErrInvalidInput)
+}
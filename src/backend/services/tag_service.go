@@ -0,0 +1,507 @@
+package services
+
+import (
+	"errors"
+	"regexp"
+	"time"
+
+	"owlistic-notes/owlistic/broker"
+	"owlistic-notes/owlistic/database"
+	"owlistic-notes/owlistic/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Tag matching modes for note listings
+const (
+	TagMatchAll = "all"
+	TagMatchAny = "any"
+)
+
+// tagColorPattern accepts colours written as #rrggbb
+var tagColorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// tagNoteCount counts the notes outside the trash carrying a tag
+const tagNoteCount = `(SELECT count(*) FROM notes WHERE notes.user_id = tags.user_id
+	AND tags.name = ANY(notes.tags) AND notes.deleted_at IS NULL) AS note_count`
+
+type TagServiceInterface interface {
+	ListTags(db *database.Database, params map[string]interface{}) ([]models.Tag, error)
+	CreateTag(db *database.Database, tagData map[string]interface{}, params map[string]interface{}) (models.Tag, error)
+	UpdateTag(db *database.Database, id string, tagData map[string]interface{}, params map[string]interface{}) (models.Tag, error)
+	MergeTag(db *database.Database, id string, targetID string, params map[string]interface{}) (models.Tag, error)
+	DeleteTag(db *database.Database, id string, params map[string]interface{}) error
+}
+
+type TagService struct{}
+
+// ListTags returns the user's tags by name with the number of notes using
+// each
+func (s *TagService) ListTags(db *database.Database, params map[string]interface{}) ([]models.Tag, error) {
+	userID, err := tagUserID(params)
+	if err != nil {
+		return nil, err
+	}
+
+	tags := []models.Tag{}
+	if err := db.DB.Model(&models.Tag{}).Select("tags.*, "+tagNoteCount).
+		Where("tags.user_id = ?", userID).
+		Order("tags.name ASC").
+		Find(&tags).Error; err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+// CreateTag adds a tag, usually to give it a colour before it is used
+func (s *TagService) CreateTag(db *database.Database, tagData map[string]interface{}, params map[string]interface{}) (models.Tag, error) {
+	userID, err := tagUserID(params)
+	if err != nil {
+		return models.Tag{}, err
+	}
+
+	name, _ := tagData["name"].(string)
+	name = models.NormalizeTagName(name)
+	if name == "" {
+		return models.Tag{}, ErrInvalidInput
+	}
+
+	color, err := tagColor(tagData)
+	if err != nil {
+		return models.Tag{}, err
+	}
+
+	if err := checkTagNameFree(db.DB, userID, name); err != nil {
+		return models.Tag{}, err
+	}
+
+	tag := models.Tag{
+		ID:     uuid.New(),
+		UserID: userID,
+		Name:   name,
+		Color:  color,
+	}
+
+	if err := db.DB.Create(&tag).Error; err != nil {
+		return models.Tag{}, err
+	}
+
+	return withTagNoteCount(db.DB, tag)
+}
+
+// UpdateTag renames a tag or changes its colour. A rename rewrites every
+// note of the user carrying the tag in the same transaction.
+func (s *TagService) UpdateTag(db *database.Database, id string, tagData map[string]interface{}, params map[string]interface{}) (models.Tag, error) {
+	userID, err := tagUserID(params)
+	if err != nil {
+		return models.Tag{}, err
+	}
+
+	tx := db.DB.Begin()
+	if tx.Error != nil {
+		return models.Tag{}, tx.Error
+	}
+
+	tag, err := loadTag(tx, id, userID)
+	if err != nil {
+		tx.Rollback()
+		return models.Tag{}, err
+	}
+
+	if nameValue, exists := tagData["name"]; exists {
+		name, _ := nameValue.(string)
+		name = models.NormalizeTagName(name)
+		if name == "" {
+			tx.Rollback()
+			return models.Tag{}, ErrInvalidInput
+		}
+
+		if name != tag.Name {
+			if err := checkTagNameFree(tx, userID, name); err != nil {
+				tx.Rollback()
+				return models.Tag{}, err
+			}
+
+			if err := rewriteNoteTags(tx, userID, tag.Name, name); err != nil {
+				tx.Rollback()
+				return models.Tag{}, err
+			}
+			tag.Name = name
+		}
+	}
+
+	if _, exists := tagData["color"]; exists {
+		color, err := tagColor(tagData)
+		if err != nil {
+			tx.Rollback()
+			return models.Tag{}, err
+		}
+		tag.Color = color
+	}
+
+	tag.UpdatedAt = time.Now()
+	if err := tx.Save(&tag).Error; err != nil {
+		tx.Rollback()
+		return models.Tag{}, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return models.Tag{}, err
+	}
+
+	return withTagNoteCount(db.DB, tag)
+}
+
+// MergeTag replaces a tag with another one on every note of the user and
+// deletes it. It returns the tag merged into.
+func (s *TagService) MergeTag(db *database.Database, id string, targetID string, params map[string]interface{}) (models.Tag, error) {
+	userID, err := tagUserID(params)
+	if err != nil {
+		return models.Tag{}, err
+	}
+
+	tx := db.DB.Begin()
+	if tx.Error != nil {
+		return models.Tag{}, tx.Error
+	}
+
+	tag, err := loadTag(tx, id, userID)
+	if err != nil {
+		tx.Rollback()
+		return models.Tag{}, err
+	}
+
+	target, err := loadTag(tx, targetID, userID)
+	if err != nil {
+		tx.Rollback()
+		return models.Tag{}, err
+	}
+
+	if tag.ID == target.ID {
+		tx.Rollback()
+		return models.Tag{}, ErrInvalidInput
+	}
+
+	if err := rewriteNoteTags(tx, userID, tag.Name, target.Name); err != nil {
+		tx.Rollback()
+		return models.Tag{}, err
+	}
+
+	if err := tx.Delete(&tag).Error; err != nil {
+		tx.Rollback()
+		return models.Tag{}, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return models.Tag{}, err
+	}
+
+	return withTagNoteCount(db.DB, target)
+}
+
+// DeleteTag removes a tag from every note of the user and deletes it
+func (s *TagService) DeleteTag(db *database.Database, id string, params map[string]interface{}) error {
+	userID, err := tagUserID(params)
+	if err != nil {
+		return err
+	}
+
+	tx := db.DB.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+
+	tag, err := loadTag(tx, id, userID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := rewriteNoteTags(tx, userID, tag.Name, ""); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Delete(&tag).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+func tagUserID(params map[string]interface{}) (uuid.UUID, error) {
+	userIDStr, ok := params["user_id"].(string)
+	if !ok {
+		return uuid.Nil, errors.New("user_id must be provided in parameters")
+	}
+
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return uuid.Nil, ErrInvalidInput
+	}
+	return userID, nil
+}
+
+// loadTag loads one of the user's tags. Tags of other users are reported
+// as not found.
+func loadTag(tx *gorm.DB, id string, userID uuid.UUID) (models.Tag, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return models.Tag{}, ErrInvalidInput
+	}
+
+	var tag models.Tag
+	if err := tx.Where("id = ? AND user_id = ?", id, userID).First(&tag).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return models.Tag{}, ErrTagNotFound
+		}
+		return models.Tag{}, err
+	}
+	return tag, nil
+}
+
+// tagColor validates the optional colour of a tag
+func tagColor(tagData map[string]interface{}) (string, error) {
+	value, exists := tagData["color"]
+	if !exists || value == nil {
+		return "", nil
+	}
+
+	color, ok := value.(string)
+	if !ok || (color != "" && !tagColorPattern.MatchString(color)) {
+		return "", ErrInvalidInput
+	}
+	return color, nil
+}
+
+func checkTagNameFree(tx *gorm.DB, userID uuid.UUID, name string) error {
+	var count int64
+	if err := tx.Model(&models.Tag{}).Where("user_id = ? AND name = ?", userID, name).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrResourceExists
+	}
+	return nil
+}
+
+func withTagNoteCount(db *gorm.DB, tag models.Tag) (models.Tag, error) {
+	if err := db.Model(&models.Tag{}).Select(tagNoteCount).
+		Where("tags.id = ?", tag.ID).
+		Scan(&tag.NoteCount).Error; err != nil {
+		return models.Tag{}, err
+	}
+	return tag, nil
+}
+
+// parseTagNames reads a list of tag names from request data
+func parseTagNames(value interface{}) (models.StringArray, error) {
+	var names []string
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case []string:
+		names = v
+	case []interface{}:
+		for _, item := range v {
+			name, ok := item.(string)
+			if !ok {
+				return nil, ErrInvalidInput
+			}
+			names = append(names, name)
+		}
+	default:
+		return nil, ErrInvalidInput
+	}
+
+	tags := models.StringArray{}
+	for _, name := range names {
+		name = models.NormalizeTagName(name)
+		if name == "" {
+			return nil, ErrInvalidInput
+		}
+		tags = addTagName(tags, name)
+	}
+	return tags, nil
+}
+
+func addTagName(tags models.StringArray, name string) models.StringArray {
+	for _, tag := range tags {
+		if tag == name {
+			return tags
+		}
+	}
+	return append(tags, name)
+}
+
+// ensureTags creates the tag rows missing for names used on a note
+func ensureTags(tx *gorm.DB, userID uuid.UUID, names []string) error {
+	if len(names) == 0 {
+		return nil
+	}
+
+	tags := make([]models.Tag, len(names))
+	for i, name := range names {
+		tags[i] = models.Tag{ID: uuid.New(), UserID: userID, Name: name}
+	}
+
+	return tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "name"}},
+		DoNothing: true,
+	}).Create(&tags).Error
+}
+
+// rewriteNoteTags replaces a tag on every note of the user, or removes it
+// when replacement is empty. The #tags written in the notes' blocks are
+// rewritten along, so the next edit of a block doesn't bring the old tag
+// back. Notes in the trash are rewritten too, so that restoring them
+// doesn't either, but only notes outside the trash get a note.updated event.
+func rewriteNoteTags(tx *gorm.DB, userID uuid.UUID, name string, replacement string) error {
+	if err := rewriteBlockTags(tx, userID, name, replacement); err != nil {
+		return err
+	}
+
+	var notes []models.Note
+	if err := tx.Unscoped().Select("id", "notebook_id", "title", "tags", "version", "deleted_at").
+		Where("user_id = ? AND ? = ANY(tags)", userID, name).
+		Find(&notes).Error; err != nil {
+		return err
+	}
+
+	for _, note := range notes {
+		tags := make(models.StringArray, 0, len(note.Tags))
+		for _, tag := range note.Tags {
+			if tag == name {
+				tag = replacement
+			}
+			if tag != "" {
+				tags = addTagName(tags, tag)
+			}
+		}
+
+		note.Version++
+		if err := tx.Unscoped().Model(&models.Note{}).Where("id = ?", note.ID).
+			Updates(map[string]interface{}{"tags": tags, "version": note.Version, "updated_at": time.Now()}).Error; err != nil {
+			return err
+		}
+
+		if note.DeletedAt.Valid {
+			continue
+		}
+
+		note.Tags = tags
+		if err := createEvent(tx, string(broker.NoteUpdated), "note", noteTagsEventData(note)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// rewriteBlockTags rewrites the inline #tags of the blocks in the user's
+// notes as rewriteNoteTags does the notes. A removed tag is left as a
+// plain word.
+func rewriteBlockTags(tx *gorm.DB, userID uuid.UUID, name string, replacement string) error {
+	notes := tx.Unscoped().Model(&models.Note{}).Select("id").Where("user_id = ?", userID)
+
+	var blocks []models.Block
+	if err := tx.Unscoped().Select("id", "note_id", "user_id", "type", "content", "version", "deleted_at").
+		Where("note_id IN (?) AND type <> ? AND strpos(content->>'text', ?) > 0", notes, models.CodeBlock, "#"+name).
+		Find(&blocks).Error; err != nil {
+		return err
+	}
+
+	for _, block := range blocks {
+		text, _ := block.Content["text"].(string)
+		rewritten := models.ReplaceInlineTag(text, name, replacement)
+		if rewritten == text {
+			continue
+		}
+
+		content := models.BlockContent{}
+		for key, value := range block.Content {
+			content[key] = value
+		}
+		content["text"] = rewritten
+
+		block.Version++
+		if err := tx.Unscoped().Model(&models.Block{}).Where("id = ?", block.ID).
+			Updates(map[string]interface{}{"content": content, "version": block.Version, "updated_at": time.Now()}).Error; err != nil {
+			return err
+		}
+
+		if block.DeletedAt.Valid {
+			continue
+		}
+
+		if err := createEvent(tx, string(broker.BlockUpdated), "block", map[string]interface{}{
+			"block_id":   block.ID.String(),
+			"note_id":    block.NoteID.String(),
+			"user_id":    block.UserID.String(),
+			"content":    content,
+			"version":    block.Version,
+			"updated_at": time.Now().UTC(),
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// syncNoteTags adds the inline #tags of a block to its note. Tags stay on
+// the note when their text is edited away; they are taken off through the
+// note or the tag endpoints.
+func syncNoteTags(tx *gorm.DB, block models.Block) error {
+	inline := block.GetInlineTags()
+	if len(inline) == 0 {
+		return nil
+	}
+
+	var note models.Note
+	if err := tx.Select("id", "user_id", "notebook_id", "title", "tags", "version").
+		First(&note, "id = ?", block.NoteID).Error; err != nil {
+		return err
+	}
+
+	tags := append(models.StringArray{}, note.Tags...)
+	for _, name := range inline {
+		tags = addTagName(tags, name)
+	}
+	if len(tags) == len(note.Tags) {
+		return nil
+	}
+
+	note.Version++
+	if err := tx.Model(&models.Note{}).Where("id = ?", note.ID).
+		Updates(map[string]interface{}{"tags": tags, "version": note.Version}).Error; err != nil {
+		return err
+	}
+
+	if err := ensureTags(tx, note.UserID, tags[len(note.Tags):]); err != nil {
+		return err
+	}
+
+	note.Tags = tags
+	return createEvent(tx, string(broker.NoteUpdated), "note", noteTagsEventData(note))
+}
+
+func noteTagsEventData(note models.Note) map[string]interface{} {
+	return map[string]interface{}{
+		"note_id":     note.ID.String(),
+		"notebook_id": note.NotebookID.String(),
+		"title":       note.Title,
+		"tags":        note.Tags,
+		"version":     note.Version,
+	}
+}
+
+// NewTagService creates a new instance of TagService
+func NewTagService() TagServiceInterface {
+	return &TagService{}
+}
+
+// Don't initialize here, will be set properly in main.go
+var TagServiceInstance TagServiceInterface
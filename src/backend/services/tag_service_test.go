@@ -0,0 +1,147 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"owlistic-notes/owlistic/database"
+	"owlistic-notes/owlistic/models"
+	"owlistic-notes/owlistic/testutils"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpdateTag_RenameRewritesNotes(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	userID := uuid.New()
+	tagID := uuid.New()
+	noteID := uuid.New()
+	trashedID := uuid.New()
+	now := time.Now()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT \\* FROM \"tags\" WHERE id = (.+) AND user_id = (.+)").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "color"}).
+			AddRow(tagID.String(), userID.String(), "design", "#ff0000"))
+	mock.ExpectQuery("SELECT count\\(\\*\\) FROM \"tags\" WHERE user_id = (.+) AND name = (.+)").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+
+	// Inline #design text becomes #architecture, so editing the block
+	// doesn't bring the old tag back
+	blockID := uuid.New()
+	mock.ExpectQuery("SELECT (.+) FROM \"blocks\" WHERE note_id IN \\(SELECT \"id\" FROM \"notes\" WHERE user_id = (.+)\\) AND type <> (.+) AND strpos\\(content->>'text', (.+)\\) > 0").
+		WithArgs(userID, models.CodeBlock, "#design").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "note_id", "user_id", "type", "content", "version", "deleted_at"}).
+			AddRow(blockID.String(), noteID.String(), userID.String(), "text", []byte(`{"text":"#design review"}`), 2, nil).
+			AddRow(uuid.New().String(), noteID.String(), userID.String(), "text", []byte(`{"text":"#designs"}`), 1, nil))
+	mock.ExpectExec("UPDATE \"blocks\" SET \"content\"=(.+),\"updated_at\"=(.+),\"version\"=(.+) WHERE id = (.+)").
+		WithArgs([]byte(`{"text":"#architecture review"}`), sqlmock.AnyArg(), int64(3), blockID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("INSERT INTO \"events\"").
+		WithArgs("block.updated", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), "pending", false, nil, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(uuid.New().String()))
+
+	mock.ExpectQuery("SELECT \"id\",\"notebook_id\",\"title\",\"tags\",\"version\",\"deleted_at\" FROM \"notes\" WHERE user_id = (.+) AND (.+) = ANY\\(tags\\)").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "notebook_id", "title", "tags", "version", "deleted_at"}).
+			AddRow(noteID.String(), uuid.New().String(), "Plan", "{design,architecture}", 3, nil).
+			AddRow(trashedID.String(), uuid.New().String(), "Old", "{architecture,design}", 1, now))
+
+	// The live note is rewritten and announced, the trashed one only rewritten
+	mock.ExpectExec("UPDATE \"notes\" SET \"tags\"=(.+),\"updated_at\"=(.+),\"version\"=(.+) WHERE id = (.+)").
+		WithArgs(`{"architecture"}`, sqlmock.AnyArg(), int64(4), noteID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("INSERT INTO \"events\"").
+		WithArgs("note.updated", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), "pending", false, nil, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(uuid.New().String()))
+	mock.ExpectExec("UPDATE \"notes\" SET \"tags\"=(.+),\"updated_at\"=(.+),\"version\"=(.+) WHERE id = (.+)").
+		WithArgs(`{"architecture"}`, sqlmock.AnyArg(), int64(2), trashedID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	mock.ExpectExec("UPDATE \"tags\" SET").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectQuery("SELECT \\(SELECT count\\(\\*\\) FROM notes").
+		WillReturnRows(sqlmock.NewRows([]string{"note_count"}).AddRow(1))
+
+	service := &TagService{}
+	tag, err := service.UpdateTag(db, tagID.String(), map[string]interface{}{
+		"name": "#architecture",
+	}, map[string]interface{}{
+		"user_id": userID.String(),
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "architecture", tag.Name)
+	assert.Equal(t, "#ff0000", tag.Color)
+	assert.Equal(t, int64(1), tag.NoteCount)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdateTag_NameTaken(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	userID := uuid.New()
+	tagID := uuid.New()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT \\* FROM \"tags\" WHERE id = (.+) AND user_id = (.+)").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name"}).
+			AddRow(tagID.String(), userID.String(), "design"))
+	mock.ExpectQuery("SELECT count\\(\\*\\) FROM \"tags\"").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectRollback()
+
+	service := &TagService{}
+	_, err := service.UpdateTag(db, tagID.String(), map[string]interface{}{"name": "ux"}, map[string]interface{}{
+		"user_id": userID.String(),
+	})
+
+	assert.ErrorIs(t, err, ErrResourceExists)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateTag_InvalidInput(t *testing.T) {
+	service := &TagService{}
+	params := map[string]interface{}{"user_id": uuid.New().String()}
+
+	_, err := service.CreateTag(&database.Database{}, map[string]interface{}{"name": "two words"}, params)
+	assert.ErrorIs(t, err, ErrInvalidInput)
+
+	_, err = service.CreateTag(&database.Database{}, map[string]interface{}{"name": "design", "color": "red"}, params)
+	assert.ErrorIs(t, err, ErrInvalidInput)
+}
+
+func TestSyncNoteTags(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	noteID := uuid.New()
+	userID := uuid.New()
+
+	mock.ExpectBegin()
+	tx := db.DB.Begin()
+
+	// Blocks without inline tags don't touch the note
+	assert.NoError(t, syncNoteTags(tx, models.Block{NoteID: noteID, Type: models.TextBlock, Content: models.BlockContent{"text": "plain"}}))
+
+	mock.ExpectQuery("SELECT \"id\",\"user_id\",\"notebook_id\",\"title\",\"tags\",\"version\" FROM \"notes\" WHERE id = (.+)").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "notebook_id", "title", "tags", "version"}).
+			AddRow(noteID.String(), userID.String(), uuid.New().String(), "Plan", "{design}", 2))
+	mock.ExpectExec("UPDATE \"notes\" SET \"tags\"=(.+),\"version\"=(.+),\"updated_at\"=(.+) WHERE id = (.+)").
+		WithArgs(`{"design","release"}`, int64(3), sqlmock.AnyArg(), noteID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("INSERT INTO \"tags\" (.+) ON CONFLICT \\(\"user_id\",\"name\"\\) DO NOTHING").
+		WillReturnRows(sqlmock.NewRows([]string{"color", "created_at", "updated_at"}).AddRow("", time.Now(), time.Now()))
+	mock.ExpectQuery("INSERT INTO \"events\"").
+		WithArgs("note.updated", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), "pending", false, nil, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(uuid.New().String()))
+
+	block := models.Block{NoteID: noteID, Type: models.TextBlock, Content: models.BlockContent{"text": "#design done, #release next"}}
+	assert.NoError(t, syncNoteTags(tx, block))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
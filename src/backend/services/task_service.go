@@ -11,15 +11,16 @@ import (
 	"github.com/google/uuid"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type TaskServiceInterface interface {
 	CreateTask(db *database.Database, taskData map[string]interface{}) (models.Task, error)
 	GetTaskById(db *database.Database, id string) (models.Task, error)
-	UpdateTask(db *database.Database, id string, updatedData models.Task) (models.Task, error)
+	UpdateTask(db *database.Database, id string, updatedData models.Task, expected *int64) (models.Task, error)
 	DeleteTask(db *database.Database, id string) error
 	GetAllTasks(db *database.Database) ([]models.Task, error)
-	GetTasks(db *database.Database, params map[string]interface{}) ([]models.Task, error)
+	GetTasks(db *database.Database, params map[string]interface{}) ([]models.Task, PageInfo, error)
 }
 
 type TaskService struct{}
@@ -237,14 +238,17 @@ func (s *TaskService) GetTaskById(db *database.Database, id string) (models.Task
 	return task, nil
 }
 
-func (s *TaskService) UpdateTask(db *database.Database, id string, updatedData models.Task) (models.Task, error) {
+// UpdateTask applies the non-zero fields of updatedData to the task.
+// expected, when given, is the version the update is based on, and the
+// update fails with a VersionConflictError when the task has moved past it.
+func (s *TaskService) UpdateTask(db *database.Database, id string, updatedData models.Task, expected *int64) (models.Task, error) {
 	tx := db.DB.Begin()
 	if tx.Error != nil {
 		return models.Task{}, tx.Error
 	}
 
 	var task models.Task
-	if err := tx.First(&task, "id = ?", id).Error; err != nil {
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&task, "id = ?", id).Error; err != nil {
 		tx.Rollback()
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return models.Task{}, ErrTaskNotFound
@@ -252,6 +256,12 @@ func (s *TaskService) UpdateTask(db *database.Database, id string, updatedData m
 		return models.Task{}, err
 	}
 
+	if err := checkVersion(expected, task.Version, task); err != nil {
+		tx.Rollback()
+		return models.Task{}, err
+	}
+	updatedData.Version = task.Version + 1
+
 	if err := tx.Model(&task).Updates(updatedData).Error; err != nil {
 		tx.Rollback()
 		return models.Task{}, err
@@ -264,6 +274,7 @@ func (s *TaskService) UpdateTask(db *database.Database, id string, updatedData m
 		"block_id":     task.Metadata["block_id"],
 		"title":        task.Title,
 		"is_completed": task.IsCompleted,
+		"version":      task.Version,
 	}
 
 	event, err := models.NewEvent(
@@ -365,9 +376,14 @@ func (s *TaskService) GetAllTasks(db *database.Database) ([]models.Task, error)
 	return tasks, nil
 }
 
-func (s *TaskService) GetTasks(db *database.Database, params map[string]interface{}) ([]models.Task, error) {
+func (s *TaskService) GetTasks(db *database.Database, params map[string]interface{}) ([]models.Task, PageInfo, error) {
 	var tasks []models.Task
-	query := db.DB
+	query := db.DB.Model(&models.Task{})
+
+	page, err := parseListPage(params, "updated_at", "created_at", "title")
+	if err != nil {
+		return nil, PageInfo{}, err
+	}
 
 	// Apply filters based on params
 	if userID, ok := params["user_id"].(string); ok && userID != "" {
@@ -387,13 +403,28 @@ func (s *TaskService) GetTasks(db *database.Database, params map[string]interfac
 		query = query.Where("note_id = ?", noteID)
 	}
 
-	query = query.Where("deleted_at IS NULL")
+	query = query.Where("deleted_at IS NULL").Session(&gorm.Session{})
 
-	result := query.Find(&tasks)
+	var info PageInfo
+	if err := query.Count(&info.Total).Error; err != nil {
+		return nil, PageInfo{}, err
+	}
+
+	keys, err := page.keys("tasks", "")
+	if err != nil {
+		return nil, PageInfo{}, err
+	}
+
+	result := page.apply(query, keys).Find(&tasks)
 	if result.Error != nil {
-		return nil, result.Error
+		return nil, PageInfo{}, result.Error
 	}
-	return tasks, nil
+
+	var count int
+	count, info.NextCursor = page.trim(len(tasks), func(i int) listItem {
+		return listItem{ID: tasks[i].ID, CreatedAt: tasks[i].CreatedAt, UpdatedAt: tasks[i].UpdatedAt, Title: tasks[i].Title}
+	})
+	return tasks[:count], info, nil
 }
 
 // NewTaskService creates a new instance of TaskService
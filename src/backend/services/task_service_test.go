@@ -241,12 +241,41 @@ func TestUpdateTask_Success(t *testing.T) {
 
 	taskService := &TaskService{}
 	updatedData := models.Task{Title: "Updated Task"}
-	task, err := taskService.UpdateTask(db, existingID.String(), updatedData)
+	task, err := taskService.UpdateTask(db, existingID.String(), updatedData, nil)
 	assert.NoError(t, err)
 	assert.Equal(t, "Updated Task", task.Title)
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
+func TestUpdateTask_VersionConflict(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	existingID := uuid.New()
+
+	mock.ExpectBegin()
+
+	// The task was saved twice since the client read version 2
+	mock.ExpectQuery("SELECT (.+) FROM \"tasks\" WHERE id = (.+) FOR UPDATE").
+		WithArgs(existingID.String(), 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "title", "version"}).
+			AddRow(existingID.String(), uuid.Nil.String(), "Theirs", 4))
+	mock.ExpectRollback()
+
+	expected := int64(2)
+	taskService := &TaskService{}
+	_, err := taskService.UpdateTask(db, existingID.String(), models.Task{Title: "Mine"}, &expected)
+
+	assert.ErrorIs(t, err, ErrVersionConflict)
+	var conflict *VersionConflictError
+	if assert.ErrorAs(t, err, &conflict) {
+		current := conflict.Current.(models.Task)
+		assert.Equal(t, int64(4), current.Version)
+		assert.Equal(t, "Theirs", current.Title)
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
 func TestDeleteTask_Success(t *testing.T) {
 	db, mock, close := testutils.SetupMockDB()
 	defer close()
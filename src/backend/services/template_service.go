@@ -0,0 +1,616 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"owlistic-notes/owlistic/broker"
+	"owlistic-notes/owlistic/database"
+	"owlistic-notes/owlistic/models"
+	"owlistic-notes/owlistic/utils/placeholder"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// templateBookkeeping holds block metadata tying a block to its note or
+// task, which a template must not carry over to new notes
+var templateBookkeeping = []string{"_sync_source", "block_id", "task_id", "last_synced"}
+
+type TemplateServiceInterface interface {
+	ListTemplates(db *database.Database, params map[string]interface{}) ([]models.Template, error)
+	GetTemplateById(db *database.Database, id string, params map[string]interface{}) (models.Template, error)
+	CreateTemplate(db *database.Database, templateData map[string]interface{}, params map[string]interface{}) (models.Template, error)
+	UpdateTemplate(db *database.Database, id string, templateData map[string]interface{}, params map[string]interface{}) (models.Template, error)
+	DeleteTemplate(db *database.Database, id string, params map[string]interface{}) error
+	CreateNoteFromTemplate(db *database.Database, notebookID string, templateID string, noteData map[string]interface{}, params map[string]interface{}) (models.Note, error)
+}
+
+type TemplateService struct{}
+
+// ListTemplates returns the user's templates by name
+func (s *TemplateService) ListTemplates(db *database.Database, params map[string]interface{}) ([]models.Template, error) {
+	userID, err := templateUserID(params)
+	if err != nil {
+		return nil, err
+	}
+
+	templates := []models.Template{}
+	if err := db.DB.Where("user_id = ?", userID).Order("name ASC").Find(&templates).Error; err != nil {
+		return nil, err
+	}
+
+	for i := range templates {
+		templates[i].Prompts = templatePrompts(templates[i])
+	}
+	return templates, nil
+}
+
+func (s *TemplateService) GetTemplateById(db *database.Database, id string, params map[string]interface{}) (models.Template, error) {
+	userID, err := templateUserID(params)
+	if err != nil {
+		return models.Template{}, err
+	}
+
+	return loadTemplate(db.DB, id, userID)
+}
+
+// CreateTemplate saves a template from a list of blocks, or from the
+// blocks of an existing note given as "note_id"
+func (s *TemplateService) CreateTemplate(db *database.Database, templateData map[string]interface{}, params map[string]interface{}) (models.Template, error) {
+	userID, err := templateUserID(params)
+	if err != nil {
+		return models.Template{}, err
+	}
+
+	template := models.Template{
+		ID:     uuid.New(),
+		UserID: userID,
+		Blocks: models.BlockSnapshots{},
+	}
+
+	if err := applyTemplateData(db, &template, templateData, params); err != nil {
+		return models.Template{}, err
+	}
+
+	if strings.TrimSpace(template.Name) == "" {
+		return models.Template{}, fmt.Errorf("%w: name is required", ErrInvalidInput)
+	}
+
+	if err := db.DB.Create(&template).Error; err != nil {
+		return models.Template{}, err
+	}
+
+	template.Prompts = templatePrompts(template)
+	return template, nil
+}
+
+func (s *TemplateService) UpdateTemplate(db *database.Database, id string, templateData map[string]interface{}, params map[string]interface{}) (models.Template, error) {
+	userID, err := templateUserID(params)
+	if err != nil {
+		return models.Template{}, err
+	}
+
+	template, err := loadTemplate(db.DB, id, userID)
+	if err != nil {
+		return models.Template{}, err
+	}
+
+	if err := applyTemplateData(db, &template, templateData, params); err != nil {
+		return models.Template{}, err
+	}
+
+	if strings.TrimSpace(template.Name) == "" {
+		return models.Template{}, fmt.Errorf("%w: name is required", ErrInvalidInput)
+	}
+
+	template.UpdatedAt = time.Now()
+	if err := db.DB.Save(&template).Error; err != nil {
+		return models.Template{}, err
+	}
+
+	template.Prompts = templatePrompts(template)
+	return template, nil
+}
+
+func (s *TemplateService) DeleteTemplate(db *database.Database, id string, params map[string]interface{}) error {
+	userID, err := templateUserID(params)
+	if err != nil {
+		return err
+	}
+
+	template, err := loadTemplate(db.DB, id, userID)
+	if err != nil {
+		return err
+	}
+
+	return db.DB.Delete(&template).Error
+}
+
+// CreateNoteFromTemplate creates a note in the notebook with the template's
+// title, tags and blocks, placeholders filled in. Prompt answers are given
+// in "values" by label, "title" overrides the template's title and "date"
+// (YYYY-MM-DD) sets the day the date placeholders refer to.
+// Block events are emitted so that task blocks become tasks through the
+// sync handler like any other block.
+func (s *TemplateService) CreateNoteFromTemplate(db *database.Database, notebookID string, templateID string, noteData map[string]interface{}, params map[string]interface{}) (models.Note, error) {
+	userID, err := templateUserID(params)
+	if err != nil {
+		return models.Note{}, err
+	}
+
+	pending, err := newTemplateNote(db, notebookID, templateID, noteData, userID)
+	if err != nil {
+		return models.Note{}, err
+	}
+
+	tx := db.DB.Begin()
+	if tx.Error != nil {
+		return models.Note{}, tx.Error
+	}
+
+	note, err := pending.create(tx)
+	if err != nil {
+		tx.Rollback()
+		return models.Note{}, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		tx.Rollback()
+		return models.Note{}, err
+	}
+
+	return note, nil
+}
+
+// templateNote is a note about to be created from a template, with the
+// placeholder values and the attachments its blocks get copies of
+type templateNote struct {
+	note        models.Note
+	blocks      models.BlockSnapshots
+	values      map[string]string
+	attachments []models.Attachment
+}
+
+// newTemplateNote checks what CreateNoteFromTemplate needs before anything
+// is written and fills in the template
+func newTemplateNote(db *database.Database, notebookID string, templateID string, noteData map[string]interface{}, userID uuid.UUID) (templateNote, error) {
+	template, err := loadTemplate(db.DB, templateID, userID)
+	if err != nil {
+		return templateNote{}, err
+	}
+
+	if _, err := uuid.Parse(notebookID); err != nil {
+		return templateNote{}, ErrInvalidInput
+	}
+
+	hasAccess, err := RoleServiceInstance.HasNotebookAccess(db, userID.String(), notebookID, "editor")
+	if err != nil {
+		return templateNote{}, err
+	}
+
+	if !hasAccess {
+		return templateNote{}, errors.New("not authorized to add notes to this notebook")
+	}
+
+	var notebook models.Notebook
+	if err := db.DB.First(&notebook, "id = ?", notebookID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return templateNote{}, ErrNotebookNotFound
+		}
+		return templateNote{}, err
+	}
+
+	var user models.User
+	if err := db.DB.First(&user, "id = ?", userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return templateNote{}, ErrUserNotFound
+		}
+		return templateNote{}, err
+	}
+
+	now := time.Now()
+	if dateStr, ok := noteData["date"].(string); ok && dateStr != "" {
+		date, err := time.Parse("2006-01-02", dateStr)
+		if err != nil {
+			return templateNote{}, fmt.Errorf("%w: date must be YYYY-MM-DD", ErrInvalidInput)
+		}
+		now = time.Date(date.Year(), date.Month(), date.Day(), now.Hour(), now.Minute(), 0, 0, now.Location())
+	}
+
+	values, err := templateValues(template, user, notebook, noteData["values"], now)
+	if err != nil {
+		return templateNote{}, err
+	}
+
+	title := template.Title
+	if title == "" {
+		title = template.Name
+	}
+	if override, ok := noteData["title"].(string); ok && override != "" {
+		title = override
+	}
+
+	// Attachments are checked before anything is written, only the copies
+	// are made in the transaction
+	attachments, err := visibleTemplateAttachments(db, template.Blocks, userID.String())
+	if err != nil {
+		return templateNote{}, err
+	}
+
+	return templateNote{
+		note: models.Note{
+			ID:         uuid.New(),
+			UserID:     userID,
+			NotebookID: notebook.ID,
+			Title:      placeholder.Replace(title, values),
+			Tags:       append(models.StringArray{}, template.Tags...),
+		},
+		blocks:      template.Blocks,
+		values:      values,
+		attachments: attachments,
+	}, nil
+}
+
+// create writes the note in tx
+func (n templateNote) create(tx *gorm.DB) (models.Note, error) {
+	return createTemplateNote(tx, n.note, n.blocks, n.values, n.attachments)
+}
+
+// createTemplateNote creates note with the blocks of a template through
+// createNoteTx, emitting the same events as BlockService.CreateBlock too
+func createTemplateNote(tx *gorm.DB, note models.Note, snapshots models.BlockSnapshots, values map[string]string, attachments []models.Attachment) (models.Note, error) {
+	// The note gets its own copies of the attachments the template shows
+	attachmentIDs, err := copyAttachments(tx, attachments, note)
+	if err != nil {
+		return models.Note{}, err
+	}
+
+	// Parents come before their children in a template
+	blockIDs := make(map[uuid.UUID]uuid.UUID, len(snapshots))
+	blocks := make([]models.Block, 0, len(snapshots))
+	for _, snapshot := range snapshots {
+		content, metadata := templateBlockContent(snapshot, values)
+		block := models.Block{
+			ID:       uuid.New(),
+			Type:     snapshot.Type,
+			Content:  repointAttachment(content, attachmentIDs),
+			Metadata: metadata,
+			Order:    snapshot.Order,
+		}
+		if snapshot.ParentBlockID != nil {
+			if parentID, ok := blockIDs[*snapshot.ParentBlockID]; ok {
+				block.ParentBlockID = &parentID
+			}
+		}
+		block.Metadata["_sync_source"] = "block"
+		block.Metadata["block_id"] = block.ID
+
+		if err := validateBlock(block.Type, block.Content, block.Metadata); err != nil {
+			return models.Note{}, err
+		}
+
+		blockIDs[snapshot.ID] = block.ID
+		blocks = append(blocks, block)
+	}
+
+	// Every note starts with at least one block, as in CreateNote
+	if len(blocks) == 0 {
+		blocks = append(blocks, models.Block{
+			ID:      uuid.New(),
+			Type:    models.TextBlock,
+			Content: models.BlockContent{"text": ""},
+			Order:   1,
+		})
+	}
+
+	note, err = createNoteTx(tx, note, blocks, nil)
+	if err != nil {
+		return models.Note{}, err
+	}
+
+	// Block events let the sync handler create tasks for the template's task blocks
+	for _, block := range note.Blocks {
+		if err := createEvent(tx, string(broker.BlockCreated), "block", blockCreatedEventData(block)); err != nil {
+			return models.Note{}, err
+		}
+	}
+
+	return note, nil
+}
+
+func templateUserID(params map[string]interface{}) (uuid.UUID, error) {
+	userIDStr, ok := params["user_id"].(string)
+	if !ok {
+		return uuid.Nil, errors.New("user_id must be provided in parameters")
+	}
+
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return uuid.Nil, ErrInvalidInput
+	}
+	return userID, nil
+}
+
+// loadTemplate loads one of the user's templates. Templates of other users
+// are reported as not found.
+func loadTemplate(db *gorm.DB, id string, userID uuid.UUID) (models.Template, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return models.Template{}, ErrInvalidInput
+	}
+
+	var template models.Template
+	if err := db.Where("id = ? AND user_id = ?", id, userID).First(&template).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return models.Template{}, ErrTemplateNotFound
+		}
+		return models.Template{}, err
+	}
+
+	template.Prompts = templatePrompts(template)
+	return template, nil
+}
+
+// applyTemplateData copies the fields present in templateData onto template
+func applyTemplateData(db *database.Database, template *models.Template, templateData map[string]interface{}, params map[string]interface{}) error {
+	if name, ok := templateData["name"].(string); ok {
+		template.Name = strings.TrimSpace(name)
+	}
+
+	if title, ok := templateData["title"].(string); ok {
+		template.Title = title
+	}
+
+	if tagsValue, exists := templateData["tags"]; exists {
+		tags, err := parseTagNames(tagsValue)
+		if err != nil {
+			return err
+		}
+		template.Tags = tags
+	}
+
+	if blocksValue, exists := templateData["blocks"]; exists {
+		blocks, err := parseTemplateBlocks(blocksValue)
+		if err != nil {
+			return err
+		}
+		template.Blocks = blocks
+	} else if noteID, ok := templateData["note_id"].(string); ok {
+		blocks, err := BlockServiceInstance.ListBlocksByNote(db, noteID, params)
+		if err != nil {
+			return err
+		}
+		template.Blocks = noteTemplateBlocks(blocks)
+	}
+
+	return nil
+}
+
+// parseTemplateBlocks reads the ordered block list of a template. Blocks
+// may set an "id" for later blocks to name as their "parent_block_id".
+func parseTemplateBlocks(value interface{}) (models.BlockSnapshots, error) {
+	items, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%w: blocks must be a list", ErrInvalidInput)
+	}
+
+	blocks := make(models.BlockSnapshots, 0, len(items))
+	types := make(map[uuid.UUID]models.BlockType, len(items))
+	for i, item := range items {
+		data, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%w: block %d must be an object", ErrInvalidInput, i)
+		}
+
+		blockType, _ := data["type"].(string)
+		content, _ := data["content"].(map[string]interface{})
+		if content == nil {
+			content = map[string]interface{}{}
+		}
+		metadata, _ := data["metadata"].(map[string]interface{})
+		if metadata == nil {
+			metadata = map[string]interface{}{}
+		}
+		for _, key := range templateBookkeeping {
+			delete(metadata, key)
+		}
+
+		if err := validateBlock(models.BlockType(blockType), content, metadata); err != nil {
+			return nil, err
+		}
+
+		block := models.BlockSnapshot{
+			ID:       uuid.New(),
+			Type:     models.BlockType(blockType),
+			Content:  content,
+			Metadata: metadata,
+		}
+
+		if idValue, exists := data["id"]; exists {
+			id, err := uuid.Parse(fmt.Sprint(idValue))
+			if err != nil || types[id] != "" {
+				return nil, fmt.Errorf("%w: block %d has an invalid or repeated id", ErrInvalidInput, i)
+			}
+			block.ID = id
+		}
+
+		if parentValue, exists := data["parent_block_id"]; exists && parentValue != nil && parentValue != "" {
+			parentID, err := uuid.Parse(fmt.Sprint(parentValue))
+			if err != nil || types[parentID] == "" {
+				return nil, fmt.Errorf("%w: block %d must follow its parent block", ErrInvalidInput, i)
+			}
+			if schema, _ := BlockSchemaRegistryInstance.Lookup(types[parentID]); !schema.AllowsChildren {
+				return nil, parentBlockError(block.Type, fmt.Sprintf("cannot be a %s block", types[parentID]))
+			}
+			block.ParentBlockID = &parentID
+		}
+
+		block.Order = float64(i+1) * blockOrderGap
+		types[block.ID] = block.Type
+		blocks = append(blocks, block)
+	}
+
+	return blocks, nil
+}
+
+// noteTemplateBlocks turns the blocks of a note, parents first, into
+// template blocks
+func noteTemplateBlocks(blocks []models.Block) models.BlockSnapshots {
+	snapshots := make(models.BlockSnapshots, 0, len(blocks))
+	for i, block := range blocks {
+		snapshot := models.NewBlockSnapshot(block)
+		snapshot.Metadata = models.BlockMetadata{}
+		for key, value := range block.Metadata {
+			snapshot.Metadata[key] = value
+		}
+		for _, key := range templateBookkeeping {
+			delete(snapshot.Metadata, key)
+		}
+		snapshot.Order = float64(i+1) * blockOrderGap
+		snapshots = append(snapshots, snapshot)
+	}
+	return snapshots
+}
+
+// templatePrompts lists the prompts of the template's title and blocks
+func templatePrompts(template models.Template) []string {
+	prompts := []string{}
+	seen := make(map[string]bool)
+	collect := func(text string) string {
+		for _, prompt := range placeholder.Prompts(text) {
+			if !seen[prompt] {
+				seen[prompt] = true
+				prompts = append(prompts, prompt)
+			}
+		}
+		return text
+	}
+
+	collect(template.Title)
+	for _, block := range template.Blocks {
+		mapTemplateStrings(map[string]interface{}(block.Content), collect)
+	}
+	return prompts
+}
+
+// templateValues gathers the placeholder values for a note created from the
+// template. Every prompt of the template must be answered.
+func templateValues(template models.Template, user models.User, notebook models.Notebook, answers interface{}, now time.Time) (map[string]string, error) {
+	displayName := user.DisplayName
+	if displayName == "" {
+		displayName = user.Username
+	}
+
+	values := map[string]string{
+		"date":              now.Format("2006-01-02"),
+		"time":              now.Format("15:04"),
+		"datetime":          now.Format("2006-01-02 15:04"),
+		"user.display_name": displayName,
+		"user.username":     user.Username,
+		"user.email":        user.Email,
+		"notebook.name":     notebook.Name,
+	}
+
+	given, _ := answers.(map[string]interface{})
+	for _, prompt := range templatePrompts(template) {
+		answer, ok := given[prompt].(string)
+		if !ok {
+			return nil, fmt.Errorf("%w: missing value for prompt %q", ErrInvalidInput, prompt)
+		}
+		values[placeholder.PromptPrefix+prompt] = answer
+	}
+
+	return values, nil
+}
+
+// visibleTemplateAttachments loads the attachments template blocks show.
+// Attachments the user can no longer view are left out, so their blocks
+// fail validation rather than show another user's file.
+func visibleTemplateAttachments(db *database.Database, blocks models.BlockSnapshots, userID string) ([]models.Attachment, error) {
+	var ids []string
+	for _, block := range blocks {
+		if id, ok := blockAttachmentID(block.Content); ok {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	var attachments []models.Attachment
+	if err := db.DB.Where("id IN ?", ids).Find(&attachments).Error; err != nil {
+		return nil, err
+	}
+
+	access := make(map[uuid.UUID]bool)
+	visible := make([]models.Attachment, 0, len(attachments))
+	for _, attachment := range attachments {
+		hasAccess, checked := access[attachment.NoteID]
+		if !checked {
+			var err error
+			hasAccess, err = RoleServiceInstance.HasNoteAccess(db, userID, attachment.NoteID.String(), "viewer")
+			if err != nil {
+				return nil, err
+			}
+			access[attachment.NoteID] = hasAccess
+		}
+		if hasAccess {
+			visible = append(visible, attachment)
+		}
+	}
+	return visible, nil
+}
+
+// templateBlockContent fills in the placeholders of a template block,
+// returning copies of its content and metadata
+func templateBlockContent(snapshot models.BlockSnapshot, values map[string]string) (models.BlockContent, models.BlockMetadata) {
+	content := mapTemplateStrings(map[string]interface{}(snapshot.Content), func(text string) string {
+		return placeholder.Replace(text, values)
+	}).(map[string]interface{})
+
+	metadata := models.BlockMetadata{}
+	for key, value := range snapshot.Metadata {
+		metadata[key] = value
+	}
+
+	// Span offsets point into the template text, so they are dropped once
+	// placeholders change the text's length
+	if text, _ := content["text"].(string); text != snapshot.Content["text"] {
+		delete(metadata, "spans")
+	}
+
+	return content, metadata
+}
+
+// mapTemplateStrings returns a copy of value with fn applied to every string
+// it holds, however deeply nested
+func mapTemplateStrings(value interface{}, fn func(string) string) interface{} {
+	switch v := value.(type) {
+	case string:
+		return fn(v)
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			result[key] = mapTemplateStrings(item, fn)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, item := range v {
+			result[i] = mapTemplateStrings(item, fn)
+		}
+		return result
+	default:
+		return value
+	}
+}
+
+// NewTemplateService creates a new instance of TemplateService
+func NewTemplateService() TemplateServiceInterface {
+	return &TemplateService{}
+}
+
+// Don't initialize here, will be set properly in main.go
+var TemplateServiceInstance TemplateServiceInterface
@@ -0,0 +1,178 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"owlistic-notes/owlistic/models"
+	"owlistic-notes/owlistic/testutils"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTemplateBlocks(t *testing.T) {
+	parentID := uuid.New().String()
+	blocks, err := parseTemplateBlocks([]interface{}{
+		map[string]interface{}{"id": parentID, "type": "toggle", "content": map[string]interface{}{"text": "Details"}},
+		map[string]interface{}{
+			"type":            "task",
+			"parent_block_id": parentID,
+			"content":         map[string]interface{}{"text": "Follow up"},
+			"metadata":        map[string]interface{}{"task_id": uuid.New().String(), "is_completed": false},
+		},
+	})
+
+	assert.NoError(t, err)
+	if assert.Len(t, blocks, 2) {
+		assert.Equal(t, parentID, blocks[1].ParentBlockID.String())
+		assert.Less(t, blocks[0].Order, blocks[1].Order)
+		assert.NotContains(t, blocks[1].Metadata, "task_id")
+	}
+
+	// Parents must come first
+	_, err = parseTemplateBlocks([]interface{}{
+		map[string]interface{}{"type": "text", "parent_block_id": parentID, "content": map[string]interface{}{"text": ""}},
+	})
+	assert.ErrorIs(t, err, ErrInvalidInput)
+
+	_, err = parseTemplateBlocks([]interface{}{
+		map[string]interface{}{"type": "nope", "content": map[string]interface{}{}},
+	})
+	assert.Error(t, err)
+}
+
+// expectTemplateLookups expects the template, notebook and user to be loaded
+func expectTemplateLookups(mock sqlmock.Sqlmock, templateID, notebookID, userID uuid.UUID) {
+	mock.ExpectQuery("SELECT \\* FROM \"templates\" WHERE").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "title", "tags", "blocks"}).
+			AddRow(templateID.String(), userID.String(), "Design doc", "{{prompt:Project}} design", "{design}",
+				[]byte(`[{"id":"`+uuid.New().String()+`","type":"header","content":{"text":"{{prompt:Project}} by {{user.display_name}}"},"metadata":{"level":1,"spans":[{"type":"bold","start":0,"end":4}]},"order":1000},
+				  {"id":"`+uuid.New().String()+`","type":"task","content":{"text":"Review in {{notebook.name}} #review"},"metadata":{},"order":2000}]`)))
+	mock.ExpectQuery("SELECT \\* FROM \"notebooks\" WHERE id = (.+)").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(notebookID.String(), "Architecture"))
+	mock.ExpectQuery("SELECT \\* FROM \"users\" WHERE id = (.+)").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "display_name"}).AddRow(userID.String(), "sam", "Sam"))
+}
+
+func TestCreateNoteFromTemplate(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	userID := uuid.New()
+	notebookID := uuid.New()
+	templateID := uuid.New()
+	now := time.Now()
+
+	previous := RoleServiceInstance
+	RoleServiceInstance = &graphAccessStub{notebooks: map[string]bool{notebookID.String(): true}}
+	defer func() { RoleServiceInstance = previous }()
+
+	expectTemplateLookups(mock, templateID, notebookID, userID)
+
+	// The note and its blocks are created in one transaction
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO "notes"`).
+		WithArgs(userID.String(), notebookID.String(), "Owl design", `{"design","review"}`, 1, nil, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"created_at", "updated_at"}).AddRow(now, now))
+	mock.ExpectQuery(`INSERT INTO "tags"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at"}))
+	mock.ExpectExec(`INSERT INTO "roles"`).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	for i := 0; i < 2; i++ {
+		mock.ExpectQuery(`INSERT INTO "blocks"`).
+			WillReturnRows(sqlmock.NewRows([]string{"created_at", "updated_at"}).AddRow(now, now))
+	}
+	for _, eventName := range []string{"note.created", "block.created", "block.created"} {
+		mock.ExpectQuery(`INSERT INTO "events"`).
+			WithArgs(eventName, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), "pending", false, nil, sqlmock.AnyArg()).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(uuid.New().String()))
+	}
+	mock.ExpectCommit()
+
+	service := &TemplateService{}
+	note, err := service.CreateNoteFromTemplate(db, notebookID.String(), templateID.String(), map[string]interface{}{
+		"values": map[string]interface{}{"Project": "Owl"},
+	}, map[string]interface{}{"user_id": userID.String()})
+
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	assert.Equal(t, "Owl design", note.Title)
+	assert.Equal(t, models.StringArray{"design", "review"}, note.Tags)
+	if assert.Len(t, note.Blocks, 2) {
+		assert.Equal(t, "Owl by Sam", note.Blocks[0].Content["text"])
+		assert.NotContains(t, note.Blocks[0].Metadata, "spans")
+		assert.Equal(t, models.TaskBlock, note.Blocks[1].Type)
+		assert.Equal(t, "Review in Architecture #review", note.Blocks[1].Content["text"])
+		assert.Equal(t, note.ID, note.Blocks[1].NoteID)
+	}
+}
+
+func TestCreateNoteFromTemplate_RollsBackOnFailure(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	userID := uuid.New()
+	notebookID := uuid.New()
+	templateID := uuid.New()
+	now := time.Now()
+
+	previous := RoleServiceInstance
+	RoleServiceInstance = &graphAccessStub{notebooks: map[string]bool{notebookID.String(): true}}
+	defer func() { RoleServiceInstance = previous }()
+
+	expectTemplateLookups(mock, templateID, notebookID, userID)
+
+	// A block that fails to save takes the note with it
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO "notes"`).
+		WillReturnRows(sqlmock.NewRows([]string{"created_at", "updated_at"}).AddRow(now, now))
+	mock.ExpectQuery(`INSERT INTO "tags"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at"}))
+	mock.ExpectExec(`INSERT INTO "roles"`).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery(`INSERT INTO "blocks"`).
+		WillReturnRows(sqlmock.NewRows([]string{"created_at", "updated_at"}).AddRow(now, now))
+	mock.ExpectQuery(`INSERT INTO "blocks"`).
+		WillReturnError(errors.New("connection reset"))
+	mock.ExpectRollback()
+
+	service := &TemplateService{}
+	_, err := service.CreateNoteFromTemplate(db, notebookID.String(), templateID.String(), map[string]interface{}{
+		"values": map[string]interface{}{"Project": "Owl"},
+	}, map[string]interface{}{"user_id": userID.String()})
+
+	assert.Error(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateNoteFromTemplate_MissingPrompt(t *testing.T) {
+	db, mock, close := testutils.SetupMockDB()
+	defer close()
+
+	userID := uuid.New()
+	notebookID := uuid.New()
+
+	previous := RoleServiceInstance
+	RoleServiceInstance = &graphAccessStub{notebooks: map[string]bool{notebookID.String(): true}}
+	defer func() { RoleServiceInstance = previous }()
+
+	mock.ExpectQuery("SELECT \\* FROM \"templates\" WHERE").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "title", "blocks"}).
+			AddRow(uuid.New().String(), userID.String(), "Incident", "Incident {{prompt:Service}}", []byte(`[]`)))
+	mock.ExpectQuery("SELECT \\* FROM \"notebooks\" WHERE id = (.+)").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(notebookID.String(), "Ops"))
+	mock.ExpectQuery("SELECT \\* FROM \"users\" WHERE id = (.+)").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username"}).AddRow(userID.String(), "sam"))
+
+	service := &TemplateService{}
+	_, err := service.CreateNoteFromTemplate(db, notebookID.String(), uuid.New().String(), map[string]interface{}{},
+		map[string]interface{}{"user_id": userID.String()})
+
+	assert.ErrorIs(t, err, ErrInvalidInput)
+	assert.Contains(t, err.Error(), `"Service"`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -88,27 +88,54 @@ func (s *TrashService) RestoreItem(db *database.Database, itemType, itemID, user
 				blockID, models.BlockResource)
 		}
 
+		if err := setNoteLinksDeleted(tx, []uuid.UUID{parsedItemID}, false); err != nil {
+			tx.Rollback()
+			return err
+		}
+
 		eventType = "note.restored"
 		entityType = "note"
 
 	case "notebook":
-		// Restore the notebook and its notes
-		result := tx.Exec("UPDATE notebooks SET deleted_at = NULL WHERE id = ? AND user_id = ?", itemID, userID)
-		if result.RowsAffected == 0 {
+		var notebook models.Notebook
+		if err := tx.Unscoped().Where("id = ? AND user_id = ? AND deleted_at IS NOT NULL", parsedItemID, parsedUserID).
+			First(&notebook).Error; err != nil {
 			tx.Rollback()
 			return errors.New("notebook not found or not authorized")
 		}
 
-		// Restore roles for the notebook
-		tx.Exec("UPDATE roles SET deleted_at = NULL WHERE resource_id = ? AND resource_type = ?",
-			parsedItemID, models.NotebookResource)
+		// Nested notebooks trashed along with it share its deletion time
+		subtree, err := notebookSubtree(tx, []uuid.UUID{parsedItemID})
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		var notebookIDs []uuid.UUID
+		if err := tx.Unscoped().Model(&models.Notebook{}).
+			Where("id IN ? AND deleted_at = ?", subtree, notebook.DeletedAt.Time).
+			Pluck("id", &notebookIDs).Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		// Restore the notebooks and their notes
+		tx.Exec("UPDATE notebooks SET deleted_at = NULL WHERE id IN ?", notebookIDs)
+
+		// A notebook whose parent is still in the trash comes back at the top
+		tx.Exec(`UPDATE notebooks SET parent_notebook_id = NULL
+			WHERE id = ? AND parent_notebook_id IN (SELECT id FROM notebooks WHERE deleted_at IS NOT NULL)`, parsedItemID)
+
+		// Restore roles for the notebooks
+		tx.Exec("UPDATE roles SET deleted_at = NULL WHERE resource_id IN ? AND resource_type = ?",
+			notebookIDs, models.NotebookResource)
 
-		// Get related note IDs
+		// Get related note IDs, they are still in the trash at this point
 		var noteIDs []uuid.UUID
-		tx.Model(&models.Note{}).Where("notebook_id = ?", parsedItemID).Pluck("id", &noteIDs)
+		tx.Unscoped().Model(&models.Note{}).Where("notebook_id IN ?", notebookIDs).Pluck("id", &noteIDs)
 
-		// Restore notes in the notebook
-		tx.Exec("UPDATE notes SET deleted_at = NULL WHERE notebook_id = ?", itemID)
+		// Restore notes in the notebooks
+		tx.Exec("UPDATE notes SET deleted_at = NULL WHERE notebook_id IN ?", notebookIDs)
 
 		// Restore roles for those notes
 		for _, noteID := range noteIDs {
@@ -128,6 +155,11 @@ func (s *TrashService) RestoreItem(db *database.Database, itemType, itemID, user
 			}
 		}
 
+		if err := setNoteLinksDeleted(tx, noteIDs, false); err != nil {
+			tx.Rollback()
+			return err
+		}
+
 		eventType = "notebook.restored"
 		entityType = "notebook"
 
@@ -190,6 +222,8 @@ func (s *TrashService) PermanentlyDeleteItem(db *database.Database, itemType, it
 	}
 
 	var eventType, entityType string
+	// Hashes of the deleted attachments, whose blobs may be unused now
+	var attachmentHashes []string
 
 	// Handle different item types
 	switch itemType {
@@ -198,6 +232,10 @@ func (s *TrashService) PermanentlyDeleteItem(db *database.Database, itemType, it
 		tx.Exec("DELETE FROM tasks WHERE block_id IN (SELECT id FROM blocks WHERE note_id = ? AND user_id = ?)", itemID, userID)
 		tx.Exec("DELETE FROM blocks WHERE note_id = ? AND user_id = ?", itemID, userID)
 
+		// Delete the attachments of the note
+		tx.Raw("SELECT hash FROM attachments WHERE note_id = ?", itemID).Scan(&attachmentHashes)
+		tx.Exec("DELETE FROM attachments WHERE note_id = ?", itemID)
+
 		// Delete associated roles
 		tx.Exec("DELETE FROM roles WHERE resource_id = ? AND resource_type = ?", parsedItemID, models.NoteResource)
 
@@ -212,57 +250,80 @@ func (s *TrashService) PermanentlyDeleteItem(db *database.Database, itemType, it
 		entityType = "note"
 
 	case "notebook":
-		// First handle tasks related to blocks in notes of this notebook
+		// Notebooks nested under it are deleted along with it
+		notebookIDs, err := notebookSubtree(tx, []uuid.UUID{parsedItemID})
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		// First handle tasks related to blocks in notes of these notebooks
 		tx.Exec(`DELETE FROM tasks 
 			WHERE block_id IN (
 				SELECT b.id FROM blocks b 
 				JOIN notes n ON b.note_id = n.id 
-				WHERE n.notebook_id = ? AND n.user_id = ?
-			)`, itemID, userID)
+				WHERE n.notebook_id IN ? AND n.user_id = ?
+			)`, notebookIDs, userID)
 
-		// Delete blocks related to notes in this notebook
-		tx.Exec(`DELETE FROM blocks 
-			WHERE note_id IN (
-				SELECT id FROM notes 
-				WHERE notebook_id = ? AND user_id = ?
-			)`, itemID, userID)
-
-		// Delete roles for those blocks
+		// Delete roles for the blocks before the blocks themselves
 		var blockIDs []uuid.UUID
 		tx.Raw(`SELECT id FROM blocks 
 			WHERE note_id IN (
 				SELECT id FROM notes 
-				WHERE notebook_id = ? AND user_id = ?
-			)`, itemID, userID).Scan(&blockIDs)
+				WHERE notebook_id IN ? AND user_id = ?
+			)`, notebookIDs, userID).Scan(&blockIDs)
 
 		for _, blockID := range blockIDs {
 			tx.Exec("DELETE FROM roles WHERE resource_id = ? AND resource_type = ?",
 				blockID, models.BlockResource)
 		}
 
-		// Delete notes in the notebook
-		tx.Exec("DELETE FROM notes WHERE notebook_id = ? AND user_id = ?", itemID, userID)
+		// Delete blocks related to notes in these notebooks
+		tx.Exec(`DELETE FROM blocks 
+			WHERE note_id IN (
+				SELECT id FROM notes 
+				WHERE notebook_id IN ? AND user_id = ?
+			)`, notebookIDs, userID)
 
-		// Delete roles for those notes
+		// Delete attachments of notes in these notebooks
+		tx.Raw(`SELECT hash FROM attachments 
+			WHERE note_id IN (
+				SELECT id FROM notes 
+				WHERE notebook_id IN ? AND user_id = ?
+			)`, notebookIDs, userID).Scan(&attachmentHashes)
+		tx.Exec(`DELETE FROM attachments 
+			WHERE note_id IN (
+				SELECT id FROM notes 
+				WHERE notebook_id IN ? AND user_id = ?
+			)`, notebookIDs, userID)
+
+		// Delete roles for the notes before the notes themselves
 		var noteIDs []uuid.UUID
-		tx.Raw("SELECT id FROM notes WHERE notebook_id = ? AND user_id = ?",
-			itemID, userID).Scan(&noteIDs)
+		tx.Raw("SELECT id FROM notes WHERE notebook_id IN ? AND user_id = ?",
+			notebookIDs, userID).Scan(&noteIDs)
 
 		for _, noteID := range noteIDs {
 			tx.Exec("DELETE FROM roles WHERE resource_id = ? AND resource_type = ?",
 				noteID, models.NoteResource)
 		}
 
-		// Delete roles for the notebook
-		tx.Exec("DELETE FROM roles WHERE resource_id = ? AND resource_type = ?",
-			parsedItemID, models.NotebookResource)
+		// Delete notes in the notebooks
+		tx.Exec("DELETE FROM notes WHERE notebook_id IN ? AND user_id = ?", notebookIDs, userID)
+
+		// Delete roles for the notebooks
+		tx.Exec("DELETE FROM roles WHERE resource_id IN ? AND resource_type = ?",
+			notebookIDs, models.NotebookResource)
 
-		// Now delete the notebook
+		// Now delete the notebook and those nested under it
 		result := tx.Exec("DELETE FROM notebooks WHERE id = ? AND user_id = ?", itemID, userID)
 		if result.RowsAffected == 0 {
 			tx.Rollback()
 			return errors.New("notebook not found or not authorized")
 		}
+		tx.Exec("DELETE FROM notebooks WHERE id IN ? AND user_id = ?", notebookIDs, userID)
+
+		// Nested notebooks of other users that are left move to the top
+		tx.Exec("UPDATE notebooks SET parent_notebook_id = NULL WHERE parent_notebook_id IN ?", notebookIDs)
 
 		eventType = "notebook.permanent_deleted"
 		entityType = "notebook"
@@ -272,12 +333,14 @@ func (s *TrashService) PermanentlyDeleteItem(db *database.Database, itemType, it
 		return ErrInvalidInput
 	}
 
-	// Create an event for the permanent deletion
+	// Create an event for the permanent deletion; the owner is named since
+	// nothing is left to look them up by
 	event, err := models.NewEvent(
 		eventType,
 		entityType,
 		map[string]interface{}{
 			fmt.Sprintf("%s_id", entityType): itemID,
+			"user_id":                        userID,
 		},
 	)
 
@@ -295,6 +358,7 @@ func (s *TrashService) PermanentlyDeleteItem(db *database.Database, itemType, it
 		return err
 	}
 
+	deleteUnusedAttachmentBlobs(db, attachmentHashes)
 	return nil
 }
 
@@ -320,6 +384,19 @@ func (s *TrashService) EmptyTrash(db *database.Database, userID string) error {
 		return err
 	}
 
+	// Hard delete attachments of trashed notes
+	var attachmentHashes []string
+	if err := tx.Raw(`SELECT hash FROM attachments WHERE note_id IN 
+		(SELECT id FROM notes WHERE user_id = ? AND deleted_at IS NOT NULL)`, userID).Scan(&attachmentHashes).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Exec(`DELETE FROM attachments WHERE note_id IN 
+		(SELECT id FROM notes WHERE user_id = ? AND deleted_at IS NOT NULL)`, userID).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
 	// Hard delete all trashed notes
 	if err := tx.Unscoped().Exec("DELETE FROM notes WHERE user_id = ? AND deleted_at IS NOT NULL", userID).Error; err != nil {
 		tx.Rollback()
@@ -332,6 +409,13 @@ func (s *TrashService) EmptyTrash(db *database.Database, userID string) error {
 		return err
 	}
 
+	// Nested notebooks of other users that are left move to the top
+	if err := tx.Exec(`UPDATE notebooks SET parent_notebook_id = NULL WHERE parent_notebook_id IS NOT NULL
+		AND NOT EXISTS (SELECT 1 FROM notebooks parent WHERE parent.id = notebooks.parent_notebook_id)`).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
 	// Create event for emptying trash
 	event, err := models.NewEvent(
 		string(broker.TrashEmptied),
@@ -350,7 +434,12 @@ func (s *TrashService) EmptyTrash(db *database.Database, userID string) error {
 		return err
 	}
 
-	return tx.Commit().Error
+	if err := tx.Commit().Error; err != nil {
+		return err
+	}
+
+	deleteUnusedAttachmentBlobs(db, attachmentHashes)
+	return nil
 }
 
 // NewTrashService creates a new instance of TrashService
@@ -228,7 +228,7 @@ func (s *UserService) UpdateUser(db *database.Database, id string, updatedData m
 		updates["profile_pic"] = profilePic
 	}
 	if preferences, ok := updatedData["preferences"].(map[string]interface{}); ok {
-		updates["preferences"] = preferences
+		updates["preferences"] = models.UserPreferences(preferences)
 	}
 
 	// Handle password update separately
@@ -439,7 +439,7 @@ func (s *UserService) UpdateUserProfile(db *database.Database, id string, profil
 		updates["profile_pic"] = profile.ProfilePic
 	}
 	if profile.Preferences != nil {
-		updates["preferences"] = profile.Preferences
+		updates["preferences"] = models.UserPreferences(profile.Preferences)
 	}
 
 	if err := tx.Model(&user).Updates(updates).Error; err != nil {
@@ -0,0 +1,65 @@
+package services
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// VersionConflictError reports an update based on a version of a block,
+// note, notebook or task that is no longer the latest. Current holds the
+// resource as the server has it, for the client to merge with.
+type VersionConflictError struct {
+	Expected int64
+	Current  interface{}
+}
+
+func (e *VersionConflictError) Error() string {
+	return fmt.Sprintf("version %d is out of date", e.Expected)
+}
+
+func (e *VersionConflictError) Unwrap() error {
+	return ErrVersionConflict
+}
+
+// expectedVersion takes the "expected_version" the client based its update
+// on out of the update data, nil when there is none. A "version" is dropped
+// too, since versions are only ever set by the server.
+func expectedVersion(data map[string]interface{}) (*int64, error) {
+	value, exists := data["expected_version"]
+	delete(data, "expected_version")
+	delete(data, "version")
+	if !exists || value == nil {
+		return nil, nil
+	}
+
+	var version int64
+	switch v := value.(type) {
+	case float64:
+		if v != float64(int64(v)) {
+			return nil, fmt.Errorf("%w: expected_version must be a whole number", ErrInvalidInput)
+		}
+		version = int64(v)
+	case int:
+		version = int64(v)
+	case int64:
+		version = v
+	case string:
+		parsed, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: expected_version must be a whole number", ErrInvalidInput)
+		}
+		version = parsed
+	default:
+		return nil, fmt.Errorf("%w: expected_version must be a whole number", ErrInvalidInput)
+	}
+	return &version, nil
+}
+
+// checkVersion fails with a VersionConflictError holding current unless the
+// client expects the version the server has, or doesn't say
+func checkVersion(expected *int64, version int64, current interface{}) error {
+	if expected != nil && *expected != version {
+		return &VersionConflictError{Expected: *expected, Current: current}
+	}
+	return nil
+}
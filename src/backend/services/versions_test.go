@@ -0,0 +1,47 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpectedVersion(t *testing.T) {
+	data := map[string]interface{}{"title": "Plan", "expected_version": float64(7), "version": float64(99)}
+	version, err := expectedVersion(data)
+	assert.NoError(t, err)
+	if assert.NotNil(t, version) {
+		assert.Equal(t, int64(7), *version)
+	}
+	// Neither key reaches the update
+	assert.Equal(t, map[string]interface{}{"title": "Plan"}, data)
+
+	version, err = expectedVersion(map[string]interface{}{"expected_version": "12"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(12), *version)
+
+	version, err = expectedVersion(map[string]interface{}{"title": "Plan"})
+	assert.NoError(t, err)
+	assert.Nil(t, version)
+
+	_, err = expectedVersion(map[string]interface{}{"expected_version": 1.5})
+	assert.ErrorIs(t, err, ErrInvalidInput)
+
+	_, err = expectedVersion(map[string]interface{}{"expected_version": true})
+	assert.ErrorIs(t, err, ErrInvalidInput)
+}
+
+func TestCheckVersion(t *testing.T) {
+	assert.NoError(t, checkVersion(nil, 4, "current"))
+
+	expected := int64(4)
+	assert.NoError(t, checkVersion(&expected, 4, "current"))
+
+	expected = 3
+	err := checkVersion(&expected, 4, "current")
+	assert.ErrorIs(t, err, ErrVersionConflict)
+	var conflict *VersionConflictError
+	if assert.ErrorAs(t, err, &conflict) {
+		assert.Equal(t, "current", conflict.Current)
+	}
+}
@@ -2,6 +2,8 @@ package services
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"sync"
@@ -11,6 +13,7 @@ import (
 	"owlistic-notes/owlistic/config"
 	"owlistic-notes/owlistic/database"
 	"owlistic-notes/owlistic/models"
+	"owlistic-notes/owlistic/utils/ot"
 	"owlistic-notes/owlistic/utils/token"
 
 	"github.com/gin-gonic/gin"
@@ -34,6 +37,12 @@ type WebSocketService struct {
 	isRunning   bool
 	jwtSecret   []byte
 	eventTopics []string
+	// sessions keeps the subscriptions of clients by session ID
+	sessions     map[string]*websocketSession
+	sessionMutex sync.Mutex
+	// instanceID tells the presence changes of this server apart from those
+	// of the others on the broker
+	instanceID string
 }
 
 type websocketConnection struct {
@@ -41,8 +50,33 @@ type websocketConnection struct {
 	userID    uuid.UUID
 	send      chan []byte
 	createdAt time.Time
+	// joined holds the blocks whose editing session the connection is in;
+	// only the read pump touches it
+	joined map[string]bool
+	// session holds what the connection subscribed to
+	session *websocketSession
+	// pongDeadline is when the connection is given up on unless it answers a
+	// ping; only the read pump touches it
+	pongDeadline time.Time
 }
 
+// subscriptions returns what the connection subscribed to, nil when it has
+// no session
+func (c *websocketConnection) subscriptions() *subscriptions {
+	if c.session == nil {
+		return nil
+	}
+	return c.session.subscriptions
+}
+
+// maxMessageSize bounds client messages, which carry pasted text when
+// editing blocks together
+const maxMessageSize = 64 << 10
+
+// pongWait is how long a connection may go without answering a ping, which
+// is also how long its presence lasts without one
+const pongWait = 120 * time.Second
+
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
@@ -57,7 +91,9 @@ func NewWebSocketService(db *database.Database) WebSocketServiceInterface {
 		db:          db,
 		connections: make(map[string]*websocketConnection),
 		isRunning:   false,
-		eventTopics: broker.SubjectNames,
+		eventTopics: append(append([]string{}, broker.SubjectNames...), broker.LiveSubjectNames...),
+		sessions:    make(map[string]*websocketSession),
+		instanceID:  uuid.New().String(),
 	}
 }
 
@@ -68,6 +104,8 @@ func NewWebSocketServiceWithTopics(db *database.Database, topics []string) WebSo
 		connections: make(map[string]*websocketConnection),
 		isRunning:   false,
 		eventTopics: topics,
+		sessions:    make(map[string]*websocketSession),
+		instanceID:  uuid.New().String(),
 	}
 }
 
@@ -106,7 +144,9 @@ func (s *WebSocketService) Stop() {
 	s.connMutex.Unlock()
 }
 
-// HandleConnection handles a new WebSocket connection with token authentication from query parameters
+// HandleConnection handles a new WebSocket connection with token authentication from query parameters.
+// A "session_id" from an earlier connection brings back what it subscribed to; the session the
+// connection goes on with is announced in a "session" message.
 func (s *WebSocketService) HandleConnection(c *gin.Context) {
 	// Extract token from query parameter
 	tokenString := c.Query("token")
@@ -144,14 +184,25 @@ func (s *WebSocketService) HandleConnection(c *gin.Context) {
 	// Create a unique connection ID
 	connID := uuid.New().String()
 
+	session, restored := s.attachSession(c.Query("session_id"), userID)
+
 	// Create websocket connection object
 	wsConn := &websocketConnection{
 		conn:      conn,
 		userID:    userID,
 		send:      make(chan []byte, 256),
 		createdAt: time.Now(),
+		session:   session,
 	}
 
+	established := models.NewStandardMessage("session", "established", map[string]interface{}{
+		"session_id":    session.id,
+		"restored":      restored,
+		"subscriptions": session.subscriptions.list(),
+	})
+	establishedBytes, _ := json.Marshal(established)
+	wsConn.send <- establishedBytes
+
 	// Register the connection
 	s.connMutex.Lock()
 	s.connections[connID] = wsConn
@@ -164,8 +215,12 @@ func (s *WebSocketService) HandleConnection(c *gin.Context) {
 	go s.writePump(connID, wsConn)
 }
 
-// consumeMessages processes messages and dispatches them to clients
+// consumeMessages processes messages and dispatches them to clients. It
+// also expires the presence of connections that stopped answering.
 func (s *WebSocketService) consumeMessages(messageChan chan *nats.Msg) {
+	expiry := time.NewTicker(1 * time.Second)
+	defer expiry.Stop()
+
 	for {
 		select {
 		case msg := <-messageChan:
@@ -175,9 +230,16 @@ func (s *WebSocketService) consumeMessages(messageChan chan *nats.Msg) {
 				log.Printf("Error unmarshalling event: %v", err)
 				continue
 			}
+			if msg.Subject == broker.PresenceSubject {
+				s.applyPresence(&event)
+				continue
+			}
 			// Broadcast the event to all connected clients
 			s.BroadcastEvent(&event)
-		case <-time.After(1 * time.Second):
+		case now := <-expiry.C:
+			if PresenceServiceInstance != nil {
+				s.sharePresence("", PresenceServiceInstance.ExpirePresence(now), false)
+			}
 		}
 	}
 }
@@ -189,13 +251,23 @@ func (s *WebSocketService) readPump(connID string, wsConn *websocketConnection)
 		s.connMutex.Unlock()
 		wsConn.conn.Close()
 		close(wsConn.send)
+		s.leaveBlocks(connID, wsConn)
+		s.leavePresence(connID, wsConn)
+		s.detachSession(wsConn.session)
 		log.Printf("WebSocket connection closed: %s", connID)
 	}()
 
-	wsConn.conn.SetReadLimit(1024)                                 // Increase read limit to handle larger messages
-	wsConn.conn.SetReadDeadline(time.Now().Add(120 * time.Second)) // Increase timeout
+	wsConn.conn.SetReadLimit(maxMessageSize)
+	wsConn.pongDeadline = time.Now().Add(pongWait)
+	wsConn.conn.SetReadDeadline(wsConn.pongDeadline)
 	wsConn.conn.SetPongHandler(func(string) error {
-		wsConn.conn.SetReadDeadline(time.Now().Add(120 * time.Second))
+		wsConn.pongDeadline = time.Now().Add(pongWait)
+		wsConn.conn.SetReadDeadline(wsConn.pongDeadline)
+		if PresenceServiceInstance != nil {
+			changes := PresenceServiceInstance.RefreshPresence(s.db, connID, wsConn.pongDeadline)
+			s.followPresence(wsConn, changes)
+			s.sharePresence(connID, changes, true)
+		}
 		return nil
 	})
 
@@ -256,8 +328,14 @@ func (s *WebSocketService) readPump(connID string, wsConn *websocketConnection)
 			switch eventName {
 
 			case "presence":
-				// Handle presence notifications
-				log.Printf("User %s sent presence event", wsConn.userID)
+				// Presence answers with its own messages
+				s.handlePresence(connID, wsConn, &clientMsg)
+				continue
+
+			case "block.join", "block.operation", "block.leave":
+				// Collaborative editing answers with its own messages
+				s.handleCollabMessage(connID, wsConn, &clientMsg)
+				continue
 
 			case "typing":
 				// Handle typing indicators
@@ -289,88 +367,8 @@ func (s *WebSocketService) readPump(connID string, wsConn *websocketConnection)
 			confirmBytes, _ := json.Marshal(confirm)
 			wsConn.send <- confirmBytes
 
-		case models.SubscribeMessage:
-			// Handle subscription requests
-			log.Printf("Subscription request from user %s", wsConn.userID)
-
-			// Extract subscription details
-			if clientMsg.Payload != nil {
-				// Check for event_type subscription
-				if clientMsg.Event != "" {
-					log.Printf("User %s subscribed to event: %s", wsConn.userID, clientMsg.Event)
-
-					payload := map[string]interface{}{
-						"event_type": clientMsg.Event,
-					}
-					// Send confirmation
-					confirm := models.NewStandardMessage("subscription", "confirmed", payload)
-					confirmBytes, _ := json.Marshal(confirm)
-					wsConn.send <- confirmBytes
-				}
-
-				// Check for resource subscription
-				if resource, ok := clientMsg.Payload["resource"].(string); ok {
-					resourceID, hasID := clientMsg.Payload["id"].(string)
-
-					log.Printf("User %s subscribed to resource: %s ID: %s",
-						wsConn.userID, resource, resourceID)
-
-					// Send confirmation - only include ID if it's not empty
-					payload := map[string]interface{}{
-						"resource": resource,
-					}
-
-					// Only add the ID to the payload if it exists and is not empty
-					if hasID && resourceID != "" {
-						payload["id"] = resourceID
-					}
-
-					confirm := models.NewStandardMessage("subscription", "confirmed", payload)
-					confirmBytes, _ := json.Marshal(confirm)
-					wsConn.send <- confirmBytes
-				}
-			}
-
-		case models.UnsubscribeMessage:
-			// Handle unsubscription requests
-			log.Printf("Unsubscription request from user %s", wsConn.userID)
-
-			// Extract unsubscription details
-			if clientMsg.Payload != nil {
-				// Check for event_type unsubscription
-				if et, ok := clientMsg.Payload["event_type"].(string); ok {
-					log.Printf("User %s unsubscribed from event: %s", wsConn.userID, et)
-
-					// Send confirmation
-					confirm := models.NewStandardMessage("unsubscription", "confirmed", map[string]interface{}{
-						"event_type": et,
-					})
-					confirmBytes, _ := json.Marshal(confirm)
-					wsConn.send <- confirmBytes
-				}
-
-				// Check for resource unsubscription
-				if resource, ok := clientMsg.Payload["resource"].(string); ok {
-					resourceID, hasID := clientMsg.Payload["id"].(string)
-
-					log.Printf("User %s unsubscribed from resource: %s ID: %s",
-						wsConn.userID, resource, resourceID)
-
-					// Send confirmation - only include ID if it's not empty
-					payload := map[string]interface{}{
-						"resource": resource,
-					}
-
-					// Only add the ID to the payload if it exists and is not empty
-					if hasID && resourceID != "" {
-						payload["id"] = resourceID
-					}
-
-					confirm := models.NewStandardMessage("unsubscription", "confirmed", payload)
-					confirmBytes, _ := json.Marshal(confirm)
-					wsConn.send <- confirmBytes
-				}
-			}
+		case models.SubscribeMessage, models.UnsubscribeMessage:
+			s.handleSubscription(wsConn, &clientMsg)
 
 		default:
 			log.Printf("Received unknown message type '%s' from user %s", clientMsg.Type, wsConn.userID)
@@ -434,6 +432,12 @@ func (s *WebSocketService) writePump(connID string, wsConn *websocketConnection)
 
 // BroadcastEvent sends an event to all connected clients that should receive it
 func (s *WebSocketService) BroadcastEvent(event *models.StandardMessage) {
+	s.broadcast(event, "")
+}
+
+// broadcast sends an event to the clients that should receive it, except
+// the connection it came from
+func (s *WebSocketService) broadcast(event *models.StandardMessage, exceptConnID string) {
 	// Prepare the message once
 	msgBytes, err := json.Marshal(event)
 	if err != nil {
@@ -444,22 +448,41 @@ func (s *WebSocketService) BroadcastEvent(event *models.StandardMessage) {
 	s.connMutex.RLock()
 	defer s.connMutex.RUnlock()
 
-	// Send to all connected clients
-	// Note: In a production system, you would filter based on permissions
-	for _, conn := range s.connections {
+	// Access is checked once per user, however many connections they have
+	access := make(map[uuid.UUID]bool)
+
+	// A private event without its user goes to nobody
+	private := broker.PrivateEventTypes[broker.EventType(event.Event)]
+	owner, _ := event.Payload["user_id"].(string)
+
+	// Send to the connected clients that subscribed to the event
+	for connID, conn := range s.connections {
+		if connID == exceptConnID || !conn.subscriptions().matches(event) {
+			continue
+		}
+
+		if private && conn.userID.String() != owner {
+			continue
+		}
+
 		// Check if this user has access to the resource before sending the event
 		if event.ResourceType != "" && event.ResourceID != "" {
 			// Skip RBAC check for public events with no resource
 			resourceUUID, err := uuid.Parse(event.ResourceID)
 			if err == nil {
-				hasAccess, err := RoleServiceInstance.HasAccess(
-					s.db,
-					conn.userID,
-					resourceUUID,
-					models.ResourceType(event.ResourceType),
-					models.ViewerRole,
-				)
-				if err != nil || !hasAccess {
+				hasAccess, checked := access[conn.userID]
+				if !checked {
+					hasAccess, err = RoleServiceInstance.HasAccess(
+						s.db,
+						conn.userID,
+						resourceUUID,
+						models.ResourceType(event.ResourceType),
+						models.ViewerRole,
+					)
+					hasAccess = err == nil && hasAccess
+					access[conn.userID] = hasAccess
+				}
+				if !hasAccess {
 					// Skip this client if they don't have access
 					continue
 				}
@@ -477,5 +500,300 @@ func (s *WebSocketService) BroadcastEvent(event *models.StandardMessage) {
 	}
 }
 
+// handleSubscription adds or removes the subscription of a subscribe or
+// unsubscribe message and confirms each part of it, the event type and the
+// resource, with a "subscription" or "unsubscription" message
+func (s *WebSocketService) handleSubscription(wsConn *websocketConnection, msg *models.StandardMessage) {
+	subscribed := msg.Type == models.SubscribeMessage
+	confirmation := "subscription"
+	if !subscribed {
+		confirmation = "unsubscription"
+	}
+
+	sub, err := parseSubscription(msg)
+	if err != nil {
+		errorMsg := models.NewStandardMessage(models.ErrorMessage, msg.Type, map[string]interface{}{
+			"event_id": msg.ID,
+			"message":  err.Error(),
+		})
+		errorBytes, _ := json.Marshal(errorMsg)
+		wsConn.send <- errorBytes
+		return
+	}
+
+	subs := wsConn.subscriptions()
+	if subs == nil {
+		return
+	}
+	subs.set(sub, subscribed)
+	log.Printf("User %s %s: %+v", wsConn.userID, confirmation, sub)
+
+	var payloads []map[string]interface{}
+	if sub.EventType != "" {
+		payloads = append(payloads, map[string]interface{}{"event_type": sub.EventType})
+	}
+	if sub.Resource != "" {
+		payload := map[string]interface{}{"resource": sub.Resource}
+		if sub.ID != "" {
+			payload["id"] = sub.ID
+		}
+		payloads = append(payloads, payload)
+	}
+
+	for _, payload := range payloads {
+		confirm := models.NewStandardMessage(confirmation, "confirmed", payload)
+		confirmBytes, _ := json.Marshal(confirm)
+		wsConn.send <- confirmBytes
+	}
+}
+
+// handleCollabMessage serves the collaborative editing messages of a
+// connection. "block.join" answers with "block.joined" carrying the text and
+// revision to start from. Each "block.operation" is acknowledged with
+// "block.operation_ack" to its sender and goes out as "block.operation" to
+// everyone else with access to the note. Errors come back as error messages
+// whose "resync" flag asks the client to join again.
+func (s *WebSocketService) handleCollabMessage(connID string, wsConn *websocketConnection, msg *models.StandardMessage) {
+	blockID, _ := msg.Payload["block_id"].(string)
+	params := map[string]interface{}{
+		"user_id":   wsConn.userID.String(),
+		"client_id": connID,
+	}
+
+	reply := func(message *models.StandardMessage) {
+		messageBytes, _ := json.Marshal(message)
+		select {
+		case wsConn.send <- messageBytes:
+		default:
+			log.Printf("Client buffer full, dropping message")
+		}
+	}
+	replyError := func(err error) {
+		reply(models.NewStandardMessage(models.ErrorMessage, msg.Event, map[string]interface{}{
+			"block_id": blockID,
+			"event_id": msg.ID,
+			"message":  err.Error(),
+			"resync":   errors.Is(err, ErrCollabResync),
+		}))
+	}
+
+	if CollabServiceInstance == nil {
+		replyError(errors.New("collaborative editing is not available"))
+		return
+	}
+
+	switch msg.Event {
+	case "block.join":
+		document, err := CollabServiceInstance.JoinBlock(s.db, blockID, params)
+		if err != nil {
+			replyError(err)
+			return
+		}
+		if wsConn.joined == nil {
+			wsConn.joined = make(map[string]bool)
+		}
+		wsConn.joined[blockID] = true
+		if subs := wsConn.subscriptions(); subs != nil {
+			subs.setEditing(blockID, true)
+		}
+
+		reply(models.NewStandardMessage(models.EventMessage, "block.joined", map[string]interface{}{
+			"block_id": document.BlockID.String(),
+			"note_id":  document.NoteID.String(),
+			"session":  document.Session,
+			"revision": document.Revision,
+			"text":     document.Text,
+		}).WithResource("block", document.BlockID.String()))
+
+	case "block.operation":
+		session, _ := msg.Payload["session"].(string)
+		revision, ok := msg.Payload["revision"].(float64)
+		values, valuesOk := msg.Payload["operation"].([]interface{})
+		if !ok || !valuesOk {
+			replyError(fmt.Errorf("%w: revision and operation are required", ErrInvalidInput))
+			return
+		}
+		operation, err := ot.FromValues(values)
+		if err != nil {
+			replyError(fmt.Errorf("%w: %v", ErrInvalidInput, err))
+			return
+		}
+
+		merged, err := CollabServiceInstance.ApplyBlockOperation(s.db, blockID, session, int(revision), operation, params)
+		if err != nil {
+			replyError(err)
+			return
+		}
+
+		reply(models.NewStandardMessage(models.EventMessage, "block.operation_ack", map[string]interface{}{
+			"block_id": merged.BlockID.String(),
+			"event_id": msg.ID,
+			"revision": merged.Revision,
+		}).WithResource("block", merged.BlockID.String()))
+
+		s.broadcast(models.NewStandardMessage(models.EventMessage, "block.operation", map[string]interface{}{
+			"block_id":  merged.BlockID.String(),
+			"note_id":   merged.NoteID.String(),
+			"user_id":   merged.UserID.String(),
+			"session":   merged.Session,
+			"revision":  merged.Revision,
+			"operation": merged.Operation,
+		}).WithResource(string(models.NoteResource), merged.NoteID.String()), connID)
+
+	case "block.leave":
+		delete(wsConn.joined, blockID)
+		if subs := wsConn.subscriptions(); subs != nil {
+			subs.setEditing(blockID, false)
+		}
+		if err := CollabServiceInstance.LeaveBlock(s.db, blockID, params); err != nil {
+			replyError(err)
+		}
+	}
+}
+
+// leaveBlocks ends the editing sessions of a closed connection
+func (s *WebSocketService) leaveBlocks(connID string, wsConn *websocketConnection) {
+	if CollabServiceInstance == nil {
+		return
+	}
+
+	params := map[string]interface{}{
+		"user_id":   wsConn.userID.String(),
+		"client_id": connID,
+	}
+	for blockID := range wsConn.joined {
+		if subs := wsConn.subscriptions(); subs != nil {
+			subs.setEditing(blockID, false)
+		}
+		if err := CollabServiceInstance.LeaveBlock(s.db, blockID, params); err != nil {
+			log.Printf("Failed to leave block %s for conn %s: %v", blockID, connID, err)
+		}
+	}
+}
+
+// handlePresence serves a "presence" message, which names the note the
+// connection is viewing in "note_id" and the block its cursor is in in
+// "block_id". Without a note it leaves the one it was viewing. The other
+// viewers hear of it as "presence.joined", "presence.updated" or
+// "presence.left"; errors come back as error messages.
+func (s *WebSocketService) handlePresence(connID string, wsConn *websocketConnection, msg *models.StandardMessage) {
+	noteID, _ := msg.Payload["note_id"].(string)
+	blockID, _ := msg.Payload["block_id"].(string)
+
+	var err error
+	if PresenceServiceInstance == nil {
+		err = errors.New("presence is not available")
+	} else {
+		var changes []models.PresenceChange
+		changes, err = PresenceServiceInstance.SetPresence(s.db, connID, noteID, blockID, wsConn.pongDeadline, map[string]interface{}{
+			"user_id": wsConn.userID.String(),
+		})
+		if err == nil {
+			s.followPresence(wsConn, changes)
+			s.sharePresence(connID, changes, true)
+			return
+		}
+	}
+
+	errorMsg := models.NewStandardMessage(models.ErrorMessage, msg.Event, map[string]interface{}{
+		"event_id": msg.ID,
+		"message":  err.Error(),
+	})
+	errorBytes, _ := json.Marshal(errorMsg)
+	select {
+	case wsConn.send <- errorBytes:
+	default:
+		log.Printf("Client buffer full, dropping message")
+	}
+}
+
+// leavePresence takes a closed connection off the note it was viewing
+func (s *WebSocketService) leavePresence(connID string, wsConn *websocketConnection) {
+	if PresenceServiceInstance == nil {
+		return
+	}
+
+	changes := PresenceServiceInstance.RemovePresence(connID)
+	s.followPresence(wsConn, changes)
+	s.sharePresence(connID, changes, true)
+}
+
+// followPresence has the connection hear about the other viewers of the
+// note it joined, and stop hearing about those of the note it left
+func (s *WebSocketService) followPresence(wsConn *websocketConnection, changes []models.PresenceChange) {
+	subs := wsConn.subscriptions()
+	if subs == nil {
+		return
+	}
+	for _, change := range changes {
+		switch broker.EventType(change.Event) {
+		case broker.PresenceJoined:
+			subs.setViewing(change.Presence.NoteID.String(), true)
+		case broker.PresenceLeft:
+			subs.setViewing(change.Presence.NoteID.String(), false)
+		}
+	}
+}
+
+// sharePresence tells the viewers of the notes here about presence changes,
+// except the connection they come from, and the other servers through the
+// broker when publish is set. Refreshes only go to the other servers.
+func (s *WebSocketService) sharePresence(connID string, changes []models.PresenceChange, publish bool) {
+	for _, change := range changes {
+		if broker.EventType(change.Event) != broker.PresenceRefreshed {
+			s.broadcast(presenceMessage(change), connID)
+		}
+		if !publish || !broker.IsProducerAvailable() {
+			continue
+		}
+
+		message := presenceMessage(change)
+		message.Payload["instance_id"] = s.instanceID
+		messageBytes, err := json.Marshal(message)
+		if err != nil {
+			log.Printf("Error marshalling presence: %v", err)
+			continue
+		}
+		if err := broker.DefaultProducer.Notify(broker.PresenceSubject, string(messageBytes)); err != nil {
+			log.Printf("Failed to share presence: %v", err)
+		}
+	}
+}
+
+// applyPresence takes in a presence change another server shared
+func (s *WebSocketService) applyPresence(event *models.StandardMessage) {
+	if PresenceServiceInstance == nil || event.Payload["instance_id"] == s.instanceID {
+		return
+	}
+
+	payloadBytes, _ := json.Marshal(event.Payload)
+	var presence models.Presence
+	if err := json.Unmarshal(payloadBytes, &presence); err != nil || presence.ConnectionID == "" {
+		log.Printf("Ignoring malformed presence event: %v", err)
+		return
+	}
+
+	changes := PresenceServiceInstance.Apply(models.PresenceChange{Event: event.Event, Presence: presence})
+	s.sharePresence("", changes, false)
+}
+
+// presenceMessage is the event telling viewers about a presence change
+func presenceMessage(change models.PresenceChange) *models.StandardMessage {
+	presence := change.Presence
+	payload := map[string]interface{}{
+		"connection_id": presence.ConnectionID,
+		"user_id":       presence.UserID.String(),
+		"note_id":       presence.NoteID.String(),
+		"last_active":   presence.LastActive,
+		"expires_at":    presence.ExpiresAt,
+	}
+	if presence.BlockID != nil {
+		payload["block_id"] = presence.BlockID.String()
+	}
+
+	return models.NewStandardMessage(models.EventMessage, change.Event, payload).
+		WithResource(string(models.NoteResource), presence.NoteID.String())
+}
+
 // Global instance for the application
 var WebSocketServiceInstance WebSocketServiceInterface
@@ -11,7 +11,9 @@ import (
 	"owlistic-notes/owlistic/database"
 	"owlistic-notes/owlistic/models"
 	"owlistic-notes/owlistic/testutils"
+	"owlistic-notes/owlistic/utils/ot"
 
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 	"github.com/nats-io/nats.go"
@@ -131,8 +133,9 @@ func setupWebSocketTest(t *testing.T) (*WebSocketService, *MockConsumer) {
 	// Create a test connection to add to the websocket service
 	userId := uuid.New()
 	testConnection := &websocketConnection{
-		userID: userId,
-		send:   make(chan []byte, 10),
+		userID:  userId,
+		send:    make(chan []byte, 10),
+		session: &websocketSession{subscriptions: newSubscriptions()},
 	}
 	service.connections = map[string]*websocketConnection{
 		"test-conn-id": testConnection,
@@ -174,6 +177,7 @@ func TestWebSocketService_BroadcastMessage(t *testing.T) {
 	if testConn == nil {
 		t.Fatal("Test connection not found")
 	}
+	testConn.subscriptions().set(subscription{EventType: "test_event"}, true)
 
 	// Start a goroutine to check if the message is received
 	messageReceived := make(chan struct{})
@@ -225,6 +229,7 @@ func TestWebSocketService_HandleMessage(t *testing.T) {
 	if testConn == nil {
 		t.Fatal("Test connection not found")
 	}
+	testConn.subscriptions().set(subscription{EventType: "note.updated"}, true)
 
 	// Start a goroutine that consumes messages
 	go service.consumeMessages(make(chan *nats.Msg))
@@ -335,6 +340,7 @@ func TestForwardMessages(t *testing.T) {
 	if testConn == nil {
 		t.Fatal("Test connection not found")
 	}
+	testConn.subscriptions().set(subscription{EventType: "test_event"}, true)
 
 	// Start a goroutine that consumes messages
 	go service.consumeMessages(make(chan *nats.Msg))
@@ -389,3 +395,352 @@ func TestForwardMessages(t *testing.T) {
 
 	safeStop(service)
 }
+
+// collabServiceStub merges every operation into revision 1
+type collabServiceStub struct {
+	noteID uuid.UUID
+	left   []string
+}
+
+func (s *collabServiceStub) JoinBlock(db *database.Database, blockID string, params map[string]interface{}) (models.BlockDocument, error) {
+	return models.BlockDocument{BlockID: uuid.MustParse(blockID), NoteID: s.noteID, Session: "s1", Text: "abc"}, nil
+}
+
+func (s *collabServiceStub) ApplyBlockOperation(db *database.Database, blockID string, session string, revision int, operation ot.Operation, params map[string]interface{}) (models.BlockOperation, error) {
+	if session != "s1" {
+		return models.BlockOperation{}, ErrCollabResync
+	}
+	return models.BlockOperation{BlockID: uuid.MustParse(blockID), NoteID: s.noteID, Session: session, Revision: revision + 1, Operation: operation}, nil
+}
+
+func (s *collabServiceStub) LeaveBlock(db *database.Database, blockID string, params map[string]interface{}) error {
+	s.left = append(s.left, blockID+"/"+params["client_id"].(string))
+	return nil
+}
+
+// allowAllStub grants access to everything
+type allowAllStub struct {
+	RoleServiceInterface
+}
+
+func (s *allowAllStub) HasAccess(db *database.Database, userID uuid.UUID, resourceID uuid.UUID, resourceType models.ResourceType, minimumRole models.RoleType) (bool, error) {
+	return true, nil
+}
+
+func receiveMessage(t *testing.T, conn *websocketConnection) models.StandardMessage {
+	var message models.StandardMessage
+	select {
+	case data := <-conn.send:
+		assert.NoError(t, json.Unmarshal(data, &message))
+	default:
+		t.Fatal("No message was sent")
+	}
+	return message
+}
+
+func TestWebSocketService_CollabMessages(t *testing.T) {
+	service, _ := setupWebSocketTest(t)
+	defer safeStop(service)
+
+	collab := &collabServiceStub{noteID: uuid.New()}
+	previousCollab, previousRoles := CollabServiceInstance, RoleServiceInstance
+	CollabServiceInstance, RoleServiceInstance = collab, &allowAllStub{}
+	defer func() { CollabServiceInstance, RoleServiceInstance = previousCollab, previousRoles }()
+
+	author := service.connections["test-conn-id"]
+	other := &websocketConnection{userID: uuid.New(), send: make(chan []byte, 10), session: &websocketSession{subscriptions: newSubscriptions()}}
+	service.connections["other-conn-id"] = other
+	other.subscriptions().set(subscription{Resource: "note", ID: collab.noteID.String()}, true)
+	blockID := uuid.New().String()
+
+	service.handleCollabMessage("test-conn-id", author, &models.StandardMessage{
+		Type: models.EventMessage, Event: "block.join", Payload: map[string]interface{}{"block_id": blockID},
+	})
+	joined := receiveMessage(t, author)
+	assert.Equal(t, "block.joined", joined.Event)
+	assert.Equal(t, "abc", joined.Payload["text"])
+	assert.True(t, author.joined[blockID])
+
+	service.handleCollabMessage("test-conn-id", author, &models.StandardMessage{
+		ID: "op-1", Type: models.EventMessage, Event: "block.operation",
+		Payload: map[string]interface{}{
+			"block_id": blockID, "session": "s1", "revision": float64(0),
+			"operation": []interface{}{float64(3), "d"},
+		},
+	})
+	ack := receiveMessage(t, author)
+	assert.Equal(t, "block.operation_ack", ack.Event)
+	assert.Equal(t, float64(1), ack.Payload["revision"])
+	assert.Empty(t, author.send)
+
+	// Everyone else gets the merged operation
+	broadcast := receiveMessage(t, other)
+	assert.Equal(t, "block.operation", broadcast.Event)
+	assert.Equal(t, []interface{}{float64(3), "d"}, broadcast.Payload["operation"])
+	assert.Equal(t, collab.noteID.String(), broadcast.ResourceID)
+
+	service.handleCollabMessage("test-conn-id", author, &models.StandardMessage{
+		Type: models.EventMessage, Event: "block.operation",
+		Payload: map[string]interface{}{
+			"block_id": blockID, "session": "s0", "revision": float64(0), "operation": []interface{}{float64(3)},
+		},
+	})
+	failed := receiveMessage(t, author)
+	assert.Equal(t, models.ErrorMessage, failed.Type)
+	assert.Equal(t, true, failed.Payload["resync"])
+
+	service.leaveBlocks("test-conn-id", author)
+	assert.Equal(t, []string{blockID + "/test-conn-id"}, collab.left)
+}
+
+// accessCountingStub grants access to everything and counts the checks
+type accessCountingStub struct {
+	RoleServiceInterface
+	checks int
+}
+
+func (s *accessCountingStub) HasAccess(db *database.Database, userID uuid.UUID, resourceID uuid.UUID, resourceType models.ResourceType, minimumRole models.RoleType) (bool, error) {
+	s.checks++
+	return true, nil
+}
+
+func TestWebSocketService_Subscriptions(t *testing.T) {
+	service, _ := setupWebSocketTest(t)
+	defer safeStop(service)
+
+	roles := &accessCountingStub{}
+	previous := RoleServiceInstance
+	RoleServiceInstance = roles
+	defer func() { RoleServiceInstance = previous }()
+
+	userID := uuid.New()
+	noteID := uuid.New().String()
+	connect := func(connID string) *websocketConnection {
+		conn := &websocketConnection{userID: userID, send: make(chan []byte, 10), session: &websocketSession{subscriptions: newSubscriptions()}}
+		service.connections[connID] = conn
+		return conn
+	}
+	byEvent, byNote, byTasks := connect("by-event"), connect("by-note"), connect("by-tasks")
+	idle := service.connections["test-conn-id"]
+
+	service.handleSubscription(byEvent, &models.StandardMessage{
+		Type: models.SubscribeMessage, Payload: map[string]interface{}{"event_type": "note.updated"},
+	})
+	assert.Equal(t, "subscription", receiveMessage(t, byEvent).Type)
+	service.handleSubscription(byNote, &models.StandardMessage{
+		Type: models.SubscribeMessage, Payload: map[string]interface{}{"resource": "note", "id": noteID},
+	})
+	confirmed := receiveMessage(t, byNote)
+	assert.Equal(t, noteID, confirmed.Payload["id"])
+	service.handleSubscription(byTasks, &models.StandardMessage{
+		Type: models.SubscribeMessage, Payload: map[string]interface{}{"resource": "task"},
+	})
+	receiveMessage(t, byTasks)
+
+	service.BroadcastEvent(models.NewStandardMessage(models.EventMessage, "note.updated",
+		map[string]interface{}{"note_id": noteID}).WithResource("note", noteID))
+	assert.Equal(t, "note.updated", receiveMessage(t, byEvent).Event)
+	assert.Equal(t, "note.updated", receiveMessage(t, byNote).Event)
+	assert.Empty(t, byTasks.send)
+	assert.Empty(t, idle.send)
+	// Both connections belong to the same user
+	assert.Equal(t, 1, roles.checks)
+
+	// A note subscription covers the blocks of the note
+	service.BroadcastEvent(models.NewStandardMessage(models.EventMessage, "block.updated",
+		map[string]interface{}{"block_id": uuid.New().String(), "note_id": noteID}))
+	assert.Equal(t, "block.updated", receiveMessage(t, byNote).Event)
+	assert.Empty(t, byEvent.send)
+
+	service.handleSubscription(byNote, &models.StandardMessage{
+		Type: models.UnsubscribeMessage, Payload: map[string]interface{}{"resource": "note", "id": noteID},
+	})
+	assert.Equal(t, "unsubscription", receiveMessage(t, byNote).Type)
+	service.BroadcastEvent(models.NewStandardMessage(models.EventMessage, "note.updated",
+		map[string]interface{}{"note_id": noteID}).WithResource("note", noteID))
+	receiveMessage(t, byEvent)
+	assert.Empty(t, byNote.send)
+
+	service.handleSubscription(byNote, &models.StandardMessage{
+		Type: models.SubscribeMessage, Payload: map[string]interface{}{"resource": "user"},
+	})
+	assert.Equal(t, models.ErrorMessage, receiveMessage(t, byNote).Type)
+}
+
+func TestWebSocketService_Sessions(t *testing.T) {
+	service, _ := setupWebSocketTest(t)
+	defer safeStop(service)
+
+	userID := uuid.New()
+	session, restored := service.attachSession("", userID)
+	assert.False(t, restored)
+	session.subscriptions.set(subscription{EventType: "note.created"}, true)
+	service.detachSession(session)
+
+	// Reconnecting picks the subscriptions up again
+	again, restored := service.attachSession(session.id, userID)
+	assert.True(t, restored)
+	assert.Same(t, session, again)
+	assert.Equal(t, []map[string]interface{}{{"event_type": "note.created"}}, again.subscriptions.list())
+	service.detachSession(again)
+
+	// Nobody else can take the session over
+	other, restored := service.attachSession(session.id, uuid.New())
+	assert.False(t, restored)
+	assert.NotEqual(t, session.id, other.id)
+
+	// Sessions closed too long ago are gone
+	session.closedAt = time.Now().Add(-sessionRetention - time.Minute)
+	expired, restored := service.attachSession(session.id, userID)
+	assert.False(t, restored)
+	assert.NotEqual(t, session.id, expired.id)
+}
+
+// presenceRoleStub grants access to everything, notes included
+type presenceRoleStub struct {
+	allowAllStub
+}
+
+func (s *presenceRoleStub) HasNoteAccess(db *database.Database, userID string, noteID string, requiredRole string) (bool, error) {
+	return true, nil
+}
+
+func TestWebSocketService_Presence(t *testing.T) {
+	service, _ := setupWebSocketTest(t)
+	defer safeStop(service)
+
+	previousPresence, previousRoles := PresenceServiceInstance, RoleServiceInstance
+	PresenceServiceInstance, RoleServiceInstance = NewPresenceService(), &presenceRoleStub{}
+	defer func() { PresenceServiceInstance, RoleServiceInstance = previousPresence, previousRoles }()
+
+	noteID := uuid.New().String()
+	connect := func(connID string) *websocketConnection {
+		conn := &websocketConnection{
+			userID:       uuid.New(),
+			send:         make(chan []byte, 10),
+			session:      &websocketSession{subscriptions: newSubscriptions()},
+			pongDeadline: time.Now().Add(pongWait),
+		}
+		service.connections[connID] = conn
+		return conn
+	}
+	viewer, editor := connect("viewer"), connect("editor")
+	idle := service.connections["test-conn-id"]
+
+	service.handlePresence("viewer", viewer, &models.StandardMessage{Event: "presence", Payload: map[string]interface{}{"note_id": noteID}})
+	assert.Empty(t, viewer.send)
+
+	// Viewers hear about each other without subscribing
+	service.handlePresence("editor", editor, &models.StandardMessage{Event: "presence", Payload: map[string]interface{}{"note_id": noteID}})
+	joined := receiveMessage(t, viewer)
+	assert.Equal(t, "presence.joined", joined.Event)
+	assert.Equal(t, editor.userID.String(), joined.Payload["user_id"])
+	assert.Empty(t, editor.send)
+	assert.Empty(t, idle.send)
+
+	db, dbMock, closeDB := testutils.SetupMockDB()
+	defer closeDB()
+	service.db = db
+
+	blockID := uuid.New().String()
+	dbMock.ExpectQuery("SELECT count\\(\\*\\) FROM \"blocks\"").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	service.handlePresence("editor", editor, &models.StandardMessage{Event: "presence", Payload: map[string]interface{}{"note_id": noteID, "block_id": blockID}})
+	updated := receiveMessage(t, viewer)
+	assert.Equal(t, "presence.updated", updated.Event)
+	assert.Equal(t, blockID, updated.Payload["block_id"])
+
+	// Changes shared by other servers reach the viewers here
+	remote := models.NewStandardMessage(models.EventMessage, "presence.joined", map[string]interface{}{
+		"connection_id": "far-away",
+		"user_id":       uuid.New().String(),
+		"note_id":       noteID,
+		"expires_at":    time.Now().Add(time.Minute),
+		"instance_id":   "other-server",
+	})
+	encoded, _ := json.Marshal(remote)
+	var shared models.StandardMessage
+	assert.NoError(t, json.Unmarshal(encoded, &shared))
+	service.applyPresence(&shared)
+	assert.Equal(t, "far-away", receiveMessage(t, viewer).Payload["connection_id"])
+	assert.Equal(t, "far-away", receiveMessage(t, editor).Payload["connection_id"])
+
+	// Our own changes coming back from the broker are no news
+	shared.Payload["instance_id"] = service.instanceID
+	shared.Payload["connection_id"] = "echo"
+	service.applyPresence(&shared)
+	assert.Empty(t, viewer.send)
+
+	presence, err := PresenceServiceInstance.GetNotePresence(service.db, noteID, map[string]interface{}{"user_id": viewer.userID.String()})
+	assert.NoError(t, err)
+	assert.Len(t, presence, 3)
+
+	service.leavePresence("editor", editor)
+	assert.Equal(t, "presence.left", receiveMessage(t, viewer).Event)
+	service.handlePresence("viewer", viewer, &models.StandardMessage{Event: "presence", Payload: map[string]interface{}{}})
+	assert.False(t, viewer.subscriptions().matches(&joined))
+
+	service.handlePresence("viewer", viewer, &models.StandardMessage{Event: "presence", Payload: map[string]interface{}{"note_id": "nowhere"}})
+	assert.Equal(t, models.ErrorMessage, receiveMessage(t, viewer).Type)
+}
+
+// denyAllStub grants access to nothing
+type denyAllStub struct {
+	RoleServiceInterface
+}
+
+func (s *denyAllStub) HasAccess(db *database.Database, userID uuid.UUID, resourceID uuid.UUID, resourceType models.ResourceType, minimumRole models.RoleType) (bool, error) {
+	return false, nil
+}
+
+func TestWebSocketService_BroadcastChecksNoteAccess(t *testing.T) {
+	service, _ := setupWebSocketTest(t)
+	defer safeStop(service)
+
+	previous := RoleServiceInstance
+	RoleServiceInstance = &denyAllStub{}
+	defer func() { RoleServiceInstance = previous }()
+
+	// Subscribing to an event type is no way around the note's roles
+	stranger := service.connections["test-conn-id"]
+	stranger.subscriptions().set(subscription{EventType: "attachment.created"}, true)
+
+	noteID := uuid.New().String()
+	service.BroadcastEvent(models.NewStandardMessage(models.EventMessage, "attachment.created", map[string]interface{}{
+		"note_id":  noteID,
+		"filename": "secret.pdf",
+	}).WithResource("note", noteID))
+
+	assert.Empty(t, stranger.send)
+}
+
+func TestWebSocketService_BroadcastPrivateEvents(t *testing.T) {
+	service, _ := setupWebSocketTest(t)
+	defer safeStop(service)
+
+	previous := RoleServiceInstance
+	RoleServiceInstance = &allowAllStub{}
+	defer func() { RoleServiceInstance = previous }()
+
+	owner := service.connections["test-conn-id"]
+	collaborator := &websocketConnection{
+		userID:  uuid.New(),
+		send:    make(chan []byte, 10),
+		session: &websocketSession{subscriptions: newSubscriptions()},
+	}
+	service.connections["collaborator"] = collaborator
+	for _, conn := range []*websocketConnection{owner, collaborator} {
+		conn.subscriptions().set(subscription{EventType: "note.state_updated"}, true)
+	}
+
+	// Pinning a shared note is nobody else's business
+	noteID := uuid.New().String()
+	service.BroadcastEvent(models.NewStandardMessage(models.EventMessage, "note.state_updated", map[string]interface{}{
+		"note_id": noteID,
+		"user_id": owner.userID.String(),
+		"pinned":  true,
+	}).WithResource("note", noteID))
+
+	assert.Equal(t, "note.state_updated", receiveMessage(t, owner).Event)
+	assert.Empty(t, collaborator.send)
+}
@@ -0,0 +1,228 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"owlistic-notes/owlistic/models"
+
+	"github.com/google/uuid"
+)
+
+// sessionRetention is how long the subscriptions of a closed connection are
+// kept for the client to pick up again by reconnecting with its session ID
+const sessionRetention = 10 * time.Minute
+
+// subscribableResources are the resource types a connection can subscribe to
+var subscribableResources = map[string]bool{
+	string(models.NotebookResource): true,
+	string(models.NoteResource):     true,
+	string(models.BlockResource):    true,
+	string(models.TaskResource):     true,
+}
+
+// subscription is one entry of a subscribe or unsubscribe message: an event
+// type, a resource type, or a single resource when ID is set
+type subscription struct {
+	EventType string
+	Resource  string
+	ID        string
+}
+
+// parseSubscription reads a subscribe or unsubscribe message. The event type
+// comes in the payload's "event_type", or the message's event for older
+// clients; a resource in "resource" and "id".
+func parseSubscription(msg *models.StandardMessage) (subscription, error) {
+	var sub subscription
+	sub.EventType, _ = msg.Payload["event_type"].(string)
+	if sub.EventType == "" {
+		sub.EventType = msg.Event
+	}
+	sub.Resource, _ = msg.Payload["resource"].(string)
+	sub.ID, _ = msg.Payload["id"].(string)
+
+	if sub.Resource != "" && !subscribableResources[sub.Resource] {
+		return subscription{}, fmt.Errorf("%w: cannot subscribe to %s", ErrInvalidInput, sub.Resource)
+	}
+	if sub.ID != "" && sub.Resource == "" {
+		return subscription{}, fmt.Errorf("%w: id needs a resource", ErrInvalidInput)
+	}
+	if sub.EventType == "" && sub.Resource == "" {
+		return subscription{}, fmt.Errorf("%w: event_type or resource is required", ErrInvalidInput)
+	}
+	return sub, nil
+}
+
+// subscriptions is what a connection asked to receive: events of some
+// types, events about some resource types, and events about single
+// resources or anything inside them, such as the blocks of a note. It is
+// read while broadcasting and changed by the read pump, hence the lock.
+type subscriptions struct {
+	mu            sync.RWMutex
+	eventTypes    map[string]bool
+	resourceTypes map[string]bool
+	resources     map[string]bool
+	// editing holds the blocks the connection is in the editing session of,
+	// whose operations it gets without subscribing
+	editing map[string]bool
+	// viewing holds the notes the connection is present in, whose presence
+	// events it gets without subscribing
+	viewing map[string]bool
+}
+
+func newSubscriptions() *subscriptions {
+	return &subscriptions{
+		eventTypes:    make(map[string]bool),
+		resourceTypes: make(map[string]bool),
+		resources:     make(map[string]bool),
+		editing:       make(map[string]bool),
+		viewing:       make(map[string]bool),
+	}
+}
+
+// set adds or removes a subscription
+func (s *subscriptions) set(sub subscription, subscribed bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if sub.EventType != "" {
+		setFlag(s.eventTypes, sub.EventType, subscribed)
+	}
+	switch {
+	case sub.ID != "":
+		setFlag(s.resources, sub.Resource+":"+sub.ID, subscribed)
+	case sub.Resource != "":
+		setFlag(s.resourceTypes, sub.Resource, subscribed)
+	}
+}
+
+// setEditing records joining or leaving the editing session of a block
+func (s *subscriptions) setEditing(blockID string, editing bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	setFlag(s.editing, blockID, editing)
+}
+
+// setViewing records joining or leaving the presence of a note
+func (s *subscriptions) setViewing(noteID string, viewing bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	setFlag(s.viewing, noteID, viewing)
+}
+
+func setFlag(flags map[string]bool, key string, on bool) {
+	if on {
+		flags[key] = true
+	} else {
+		delete(flags, key)
+	}
+}
+
+// matches tells whether the event falls under any of the subscriptions. A
+// nil set matches nothing.
+func (s *subscriptions) matches(event *models.StandardMessage) bool {
+	if s == nil {
+		return false
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.eventTypes[event.Event] || s.resourceTypes[event.ResourceType] {
+		return true
+	}
+	if event.ResourceType != "" && s.resources[event.ResourceType+":"+event.ResourceID] {
+		return true
+	}
+	for resource := range subscribableResources {
+		if id, ok := event.Payload[resource+"_id"].(string); ok && s.resources[resource+":"+id] {
+			return true
+		}
+	}
+	if strings.HasPrefix(event.Event, "presence.") {
+		noteID, _ := event.Payload["note_id"].(string)
+		return s.viewing[noteID]
+	}
+	blockID, _ := event.Payload["block_id"].(string)
+	return s.editing[blockID]
+}
+
+// list describes the subscriptions the way clients send them
+func (s *subscriptions) list() []map[string]interface{} {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	entries := []map[string]interface{}{}
+	for _, eventType := range sortedKeys(s.eventTypes) {
+		entries = append(entries, map[string]interface{}{"event_type": eventType})
+	}
+	for _, resource := range sortedKeys(s.resourceTypes) {
+		entries = append(entries, map[string]interface{}{"resource": resource})
+	}
+	for _, key := range sortedKeys(s.resources) {
+		resource, id, _ := strings.Cut(key, ":")
+		entries = append(entries, map[string]interface{}{"resource": resource, "id": id})
+	}
+	return entries
+}
+
+func sortedKeys(flags map[string]bool) []string {
+	keys := make([]string, 0, len(flags))
+	for key := range flags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// websocketSession carries the subscriptions of a client across
+// reconnects. Attached counts the connections using it; once there are none
+// left it is kept for sessionRetention after closedAt.
+type websocketSession struct {
+	id            string
+	userID        uuid.UUID
+	subscriptions *subscriptions
+	attached      int
+	closedAt      time.Time
+}
+
+// attachSession returns the session a new connection of the user goes on
+// with: the one named by sessionID if the user has it, a new one otherwise.
+// Sessions closed for longer than sessionRetention are dropped on the way.
+func (s *WebSocketService) attachSession(sessionID string, userID uuid.UUID) (*websocketSession, bool) {
+	s.sessionMutex.Lock()
+	defer s.sessionMutex.Unlock()
+
+	now := time.Now()
+	for id, session := range s.sessions {
+		if session.attached == 0 && now.Sub(session.closedAt) > sessionRetention {
+			delete(s.sessions, id)
+		}
+	}
+
+	session, restored := s.sessions[sessionID]
+	if !restored || session.userID != userID {
+		session = &websocketSession{id: uuid.New().String(), userID: userID, subscriptions: newSubscriptions()}
+		s.sessions[session.id] = session
+		restored = false
+	}
+	session.attached++
+	return session, restored
+}
+
+// detachSession lets go of the session of a closed connection
+func (s *WebSocketService) detachSession(session *websocketSession) {
+	if session == nil {
+		return
+	}
+
+	s.sessionMutex.Lock()
+	defer s.sessionMutex.Unlock()
+
+	session.attached--
+	if session.attached == 0 {
+		session.closedAt = time.Now()
+	}
+}
@@ -0,0 +1,40 @@
+package storage
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocalStore(t *testing.T) {
+	store, err := NewLocalStore(t.TempDir())
+	assert.NoError(t, err)
+
+	key := "2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae"
+	assert.NoError(t, store.Put(key, strings.NewReader("foo"), 3, "text/plain"))
+
+	exists, err := store.Exists(key)
+	assert.NoError(t, err)
+	assert.True(t, exists)
+
+	blob, err := store.Get(key)
+	if assert.NoError(t, err) {
+		data, _ := io.ReadAll(blob)
+		blob.Close()
+		assert.Equal(t, "foo", string(data))
+	}
+
+	// A short write leaves nothing behind
+	assert.Error(t, store.Put("fcde2b2edba56bf408601fb721fe9b5c338d10ee429ea04fae5511b68fbf8fb9", strings.NewReader("ba"), 3, ""))
+	exists, _ = store.Exists("fcde2b2edba56bf408601fb721fe9b5c338d10ee429ea04fae5511b68fbf8fb9")
+	assert.False(t, exists)
+
+	assert.NoError(t, store.Delete(key))
+	assert.NoError(t, store.Delete(key))
+	_, err = store.Get(key)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	assert.Error(t, store.Put("../../etc/passwd", strings.NewReader(""), 0, ""))
+}
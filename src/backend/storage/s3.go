@@ -0,0 +1,267 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3Config locates a bucket of an S3 compatible service such as MinIO
+type S3Config struct {
+	// Endpoint is the base URL of the service, e.g. http://localhost:9000
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+}
+
+// S3Store keeps blobs as objects in a bucket. Requests use path-style URLs
+// and are signed with AWS Signature Version 4.
+type S3Store struct {
+	config S3Config
+	base   *url.URL
+	client *http.Client
+	// now is replaced in tests to sign with a fixed time
+	now func() time.Time
+}
+
+// emptyPayloadHash is the SHA-256 of an empty request body
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// NewS3Store creates a store for the bucket. The bucket must exist.
+func NewS3Store(config S3Config) (*S3Store, error) {
+	base, err := url.Parse(config.Endpoint)
+	if err != nil || base.Host == "" {
+		return nil, fmt.Errorf("invalid S3 endpoint %q", config.Endpoint)
+	}
+	if config.Bucket == "" {
+		return nil, errors.New("S3 bucket must be set")
+	}
+	if config.Region == "" {
+		config.Region = "us-east-1"
+	}
+
+	return &S3Store{
+		config: config,
+		base:   base,
+		client: &http.Client{Timeout: 5 * time.Minute},
+		now:    time.Now,
+	}, nil
+}
+
+func (s *S3Store) request(method, key string, body io.Reader, size int64) (*http.Request, error) {
+	target := *s.base
+	target.Path = strings.TrimSuffix(target.Path, "/") + "/" + s.config.Bucket + "/" + key
+
+	req, err := http.NewRequest(method, target.String(), body)
+	if err != nil {
+		return nil, err
+	}
+
+	payloadHash := emptyPayloadHash
+	if body != nil {
+		// The body is streamed, so its hash is not known up front
+		req.ContentLength = size
+		payloadHash = "UNSIGNED-PAYLOAD"
+	}
+	signV4(req, payloadHash, s.config.AccessKey, s.config.SecretKey, s.config.Region, s.now().UTC())
+	return req, nil
+}
+
+func (s *S3Store) do(req *http.Request) (*http.Response, error) {
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, ErrNotFound
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("S3 %s %s: %s: %s", req.Method, req.URL.Path, resp.Status, strings.TrimSpace(string(message)))
+	}
+	return resp, nil
+}
+
+func (s *S3Store) Put(key string, r io.Reader, size int64, contentType string) error {
+	req, err := s.request(http.MethodPut, key, r, size)
+	if err != nil {
+		return err
+	}
+	if contentType != "" {
+		// Set after signing; it is not one of the signed headers
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (s *S3Store) Get(key string) (io.ReadCloser, error) {
+	req, err := s.request(http.MethodGet, key, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.do(req)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (s *S3Store) Exists(key string) (bool, error) {
+	req, err := s.request(http.MethodHead, key, nil, 0)
+	if err != nil {
+		return false, err
+	}
+
+	resp, err := s.do(req)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, resp.Body.Close()
+}
+
+func (s *S3Store) Delete(key string) error {
+	req, err := s.request(http.MethodDelete, key, nil, 0)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.do(req)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// signV4 adds the AWS Signature Version 4 headers to req. The host, range
+// and x-amz-* headers are signed.
+func signV4(req *http.Request, payloadHash, accessKey, secretKey, region string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	headers := map[string]string{"host": host}
+	for name, values := range req.Header {
+		name = strings.ToLower(name)
+		if name == "range" || strings.HasPrefix(name, "x-amz-") {
+			headers[name] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		canonicalURI(req.URL.EscapedPath()),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	for _, part := range []string{region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// canonicalURI encodes every path segment the way S3 expects
+func canonicalURI(escapedPath string) string {
+	if escapedPath == "" {
+		return "/"
+	}
+	segments := strings.Split(escapedPath, "/")
+	for i, segment := range segments {
+		unescaped, err := url.PathUnescape(segment)
+		if err != nil {
+			unescaped = segment
+		}
+		segments[i] = uriEncode(unescaped)
+	}
+	return strings.Join(segments, "/")
+}
+
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var pairs []string
+	for _, key := range keys {
+		values := append([]string(nil), query[key]...)
+		sort.Strings(values)
+		for _, value := range values {
+			pairs = append(pairs, uriEncode(key)+"="+uriEncode(value))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// uriEncode percent-encodes everything but the unreserved characters
+func uriEncode(value string) string {
+	var encoded strings.Builder
+	for _, b := range []byte(value) {
+		if ('A' <= b && b <= 'Z') || ('a' <= b && b <= 'z') || ('0' <= b && b <= '9') ||
+			b == '-' || b == '_' || b == '.' || b == '~' {
+			encoded.WriteByte(b)
+		} else {
+			fmt.Fprintf(&encoded, "%%%02X", b)
+		}
+	}
+	return encoded.String()
+}
@@ -0,0 +1,45 @@
+// Package storage keeps the bytes of attachments. Blobs are written once
+// under a key and never changed; callers choose keys that name the content.
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"owlistic-notes/owlistic/config"
+)
+
+// ErrNotFound is returned when no blob is stored under a key
+var ErrNotFound = errors.New("blob not found")
+
+// Store is a place blobs can be kept in
+type Store interface {
+	// Put stores size bytes read from r under key, replacing any blob there
+	Put(key string, r io.Reader, size int64, contentType string) error
+	// Get opens the blob stored under key
+	Get(key string) (io.ReadCloser, error)
+	// Exists reports whether a blob is stored under key
+	Exists(key string) (bool, error)
+	// Delete removes the blob stored under key; missing blobs are no error
+	Delete(key string) error
+}
+
+// New creates the store selected by the configuration: "local" keeps blobs
+// in a directory, "s3" in a bucket of an S3 compatible service
+func New(cfg config.Config) (Store, error) {
+	switch cfg.StorageBackend {
+	case "local":
+		return NewLocalStore(cfg.StoragePath)
+	case "s3":
+		return NewS3Store(S3Config{
+			Endpoint:  cfg.S3Endpoint,
+			Region:    cfg.S3Region,
+			Bucket:    cfg.S3Bucket,
+			AccessKey: cfg.S3AccessKey,
+			SecretKey: cfg.S3SecretKey,
+		})
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", cfg.StorageBackend)
+	}
+}
@@ -0,0 +1,83 @@
+package dateformat
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// tokens lists the supported format tokens, longest first so that "MMMM"
+// wins over "MM":
+//
+//	YYYY 2026   YY 26      GGGG ISO week-numbering year
+//	MMMM October  MMM Oct  MM 01-12  M 1-12
+//	DD 01-31    D 1-31     dddd Friday  ddd Fri
+//	WW ISO week 01-53      W ISO week 1-53
+//
+// Text inside square brackets is copied as is, as in "GGGG-[W]WW".
+var tokens = []string{"YYYY", "GGGG", "MMMM", "dddd", "MMM", "ddd", "YY", "MM", "DD", "WW", "M", "D", "W"}
+
+// Format renders t according to format
+func Format(t time.Time, format string) string {
+	var b strings.Builder
+	for i := 0; i < len(format); {
+		if format[i] == '[' {
+			if end := strings.IndexByte(format[i:], ']'); end > 0 {
+				b.WriteString(format[i+1 : i+end])
+				i += end + 1
+				continue
+			}
+		}
+
+		token := ""
+		for _, candidate := range tokens {
+			if strings.HasPrefix(format[i:], candidate) {
+				token = candidate
+				break
+			}
+		}
+
+		if token == "" {
+			b.WriteByte(format[i])
+			i++
+			continue
+		}
+
+		b.WriteString(value(t, token))
+		i += len(token)
+	}
+	return b.String()
+}
+
+func value(t time.Time, token string) string {
+	isoYear, isoWeek := t.ISOWeek()
+	switch token {
+	case "YYYY":
+		return fmt.Sprintf("%04d", t.Year())
+	case "YY":
+		return fmt.Sprintf("%02d", t.Year()%100)
+	case "GGGG":
+		return fmt.Sprintf("%04d", isoYear)
+	case "MMMM":
+		return t.Month().String()
+	case "MMM":
+		return t.Month().String()[:3]
+	case "MM":
+		return fmt.Sprintf("%02d", int(t.Month()))
+	case "M":
+		return fmt.Sprint(int(t.Month()))
+	case "DD":
+		return fmt.Sprintf("%02d", t.Day())
+	case "D":
+		return fmt.Sprint(t.Day())
+	case "dddd":
+		return t.Weekday().String()
+	case "ddd":
+		return t.Weekday().String()[:3]
+	case "WW":
+		return fmt.Sprintf("%02d", isoWeek)
+	case "W":
+		return fmt.Sprint(isoWeek)
+	}
+	return token
+}
@@ -0,0 +1,21 @@
+package dateformat
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormat(t *testing.T) {
+	// Jan 1st 2027 falls in ISO week 53 of 2026
+	date := time.Date(2027, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, "2027-01-01", Format(date, "YYYY-MM-DD"))
+	assert.Equal(t, "Friday, January 1 27", Format(date, "dddd, MMMM D YY"))
+	assert.Equal(t, "Fri 1 Jan", Format(date, "ddd D MMM"))
+	assert.Equal(t, "2026-W53", Format(date, "GGGG-[W]WW"))
+	assert.Equal(t, "Week 53 of 2026", Format(date, "[Week] W [of] GGGG"))
+	assert.Equal(t, "2027/1", Format(date, "YYYY/M"))
+	assert.Equal(t, "Journal [", Format(date, "[Journal] ["))
+}
@@ -0,0 +1,387 @@
+package diff
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"unicode"
+
+	"owlistic-notes/owlistic/models"
+
+	"github.com/google/uuid"
+)
+
+// ignoredMetadata holds bookkeeping keys that are not user visible changes
+var ignoredMetadata = map[string]bool{
+	"_sync_source": true,
+	"block_id":     true,
+	"task_id":      true,
+	"last_synced":  true,
+}
+
+// maxWordDiffCells bounds the size of the word LCS table; longer texts are
+// reported as a single replacement instead
+const maxWordDiffCells = 1 << 20
+
+// Blocks compares two ordered sets of block snapshots, matching blocks by ID.
+// Only the block fields of the returned diff are filled in. A block counts as
+// moved when its place among its siblings changed, not its order value.
+func Blocks(from, to []models.BlockSnapshot) models.NoteDiff {
+	result := models.NoteDiff{
+		Added:    []models.BlockSnapshot{},
+		Removed:  []models.BlockSnapshot{},
+		Moved:    []models.BlockMove{},
+		Modified: []models.BlockChange{},
+	}
+
+	before := make(map[string]models.BlockSnapshot, len(from))
+	for _, block := range from {
+		before[block.ID.String()] = block
+	}
+
+	moved := movedBlocks(from, to)
+
+	after := make(map[string]bool, len(to))
+	for _, block := range to {
+		after[block.ID.String()] = true
+
+		old, found := before[block.ID.String()]
+		if !found {
+			result.Added = append(result.Added, block)
+			continue
+		}
+
+		if moved[block.ID] {
+			result.Moved = append(result.Moved, models.BlockMove{
+				BlockID:   block.ID,
+				FromOrder: old.Order,
+				ToOrder:   block.Order,
+			})
+		}
+
+		if change, changed := compareBlock(old, block); changed {
+			result.Modified = append(result.Modified, change)
+		}
+	}
+
+	for _, block := range from {
+		if !after[block.ID.String()] {
+			result.Removed = append(result.Removed, block)
+		}
+	}
+
+	return result
+}
+
+// movedBlocks returns the blocks kept between the versions whose place among
+// their siblings changed: those now under another parent, and those left out
+// of the longest run of siblings staying in sequence. Renumbering orders
+// without reordering, as rebalancing does, moves nothing.
+func movedBlocks(from, to []models.BlockSnapshot) map[uuid.UUID]bool {
+	parents := make(map[uuid.UUID]*uuid.UUID, len(from))
+	for _, block := range from {
+		parents[block.ID] = block.ParentBlockID
+	}
+
+	moved := make(map[uuid.UUID]bool)
+	kept := make(map[uuid.UUID]bool)
+	for _, block := range to {
+		parent, found := parents[block.ID]
+		if !found {
+			continue
+		}
+		if sameParent(parent, block.ParentBlockID) {
+			kept[block.ID] = true
+		} else {
+			moved[block.ID] = true
+		}
+	}
+
+	oldSiblings := siblingGroups(from, kept)
+	for parent, siblings := range siblingGroups(to, kept) {
+		for _, id := range outOfSequence(oldSiblings[parent], siblings) {
+			moved[id] = true
+		}
+	}
+	return moved
+}
+
+// siblingGroups returns the kept blocks by parent, in order
+func siblingGroups(blocks []models.BlockSnapshot, kept map[uuid.UUID]bool) map[uuid.UUID][]models.BlockSnapshot {
+	sorted := make([]models.BlockSnapshot, 0, len(blocks))
+	for _, block := range blocks {
+		if kept[block.ID] {
+			sorted = append(sorted, block)
+		}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Order < sorted[j].Order })
+
+	groups := make(map[uuid.UUID][]models.BlockSnapshot)
+	for _, block := range sorted {
+		parent := uuid.Nil
+		if block.ParentBlockID != nil {
+			parent = *block.ParentBlockID
+		}
+		groups[parent] = append(groups[parent], block)
+	}
+	return groups
+}
+
+// outOfSequence returns the blocks of after that are left out of a longest
+// subsequence keeping the order of before, which holds the same blocks. Of
+// the longest ones, the one with the most blocks still at their old order
+// value wins, so a block dragged elsewhere is the one reported rather than
+// the blocks it passed.
+func outOfSequence(before, after []models.BlockSnapshot) []uuid.UUID {
+	type run struct{ length, unchanged, end int }
+	better := func(a, b run) bool {
+		return a.length > b.length || a.length == b.length && a.unchanged > b.unchanged
+	}
+
+	position := make(map[uuid.UUID]int, len(before))
+	orders := make(map[uuid.UUID]float64, len(before))
+	for i, block := range before {
+		position[block.ID] = i
+		orders[block.ID] = block.Order
+	}
+
+	// tree is a Fenwick tree holding the best run ending at each position
+	// of before, so the best run to extend is found in logarithmic time
+	tree := make([]run, len(before)+1)
+	for i := range tree {
+		tree[i].end = -1
+	}
+	previous := make([]int, len(after))
+	best := run{end: -1}
+	for i, block := range after {
+		p := position[block.ID]
+
+		prefix := run{end: -1}
+		for k := p; k > 0; k -= k & -k {
+			if better(tree[k], prefix) {
+				prefix = tree[k]
+			}
+		}
+
+		current := run{length: prefix.length + 1, unchanged: prefix.unchanged, end: i}
+		if orders[block.ID] == block.Order {
+			current.unchanged++
+		}
+		previous[i] = prefix.end
+
+		for k := p + 1; k < len(tree); k += k & -k {
+			if better(current, tree[k]) {
+				tree[k] = current
+			}
+		}
+		if better(current, best) {
+			best = current
+		}
+	}
+
+	inRun := make([]bool, len(after))
+	for i := best.end; i >= 0; i = previous[i] {
+		inRun[i] = true
+	}
+
+	var out []uuid.UUID
+	for i, block := range after {
+		if !inRun[i] {
+			out = append(out, block.ID)
+		}
+	}
+	return out
+}
+
+// compareBlock lists the field changes between two versions of a block
+func compareBlock(before, after models.BlockSnapshot) (models.BlockChange, bool) {
+	change := models.BlockChange{
+		BlockID: after.ID,
+		Before:  before,
+		After:   after,
+		Changes: []models.FieldChange{},
+	}
+
+	if !sameParent(before.ParentBlockID, after.ParentBlockID) {
+		change.Changes = append(change.Changes, models.FieldChange{
+			Field: "parent_block_id",
+			From:  before.ParentBlockID,
+			To:    after.ParentBlockID,
+		})
+	}
+
+	if before.Type != after.Type {
+		change.Changes = append(change.Changes, models.FieldChange{
+			Field: "type",
+			From:  before.Type,
+			To:    after.Type,
+		})
+	}
+
+	for _, key := range unionKeys(before.Content, after.Content, nil) {
+		from, to := before.Content[key], after.Content[key]
+		if equalValues(from, to) {
+			continue
+		}
+
+		change.Changes = append(change.Changes, models.FieldChange{Field: "content." + key, From: from, To: to})
+
+		if key == "text" {
+			fromText, _ := from.(string)
+			toText, _ := to.(string)
+			change.TextDiff = Words(fromText, toText)
+		}
+	}
+
+	for _, key := range unionKeys(before.Metadata, after.Metadata, ignoredMetadata) {
+		from, to := before.Metadata[key], after.Metadata[key]
+		if !equalValues(from, to) {
+			change.Changes = append(change.Changes, models.FieldChange{Field: "metadata." + key, From: from, To: to})
+		}
+	}
+
+	return change, len(change.Changes) > 0
+}
+
+func sameParent(a, b *uuid.UUID) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// unionKeys returns the sorted keys present in either map, minus ignored ones
+func unionKeys(a, b map[string]interface{}, ignored map[string]bool) []string {
+	seen := make(map[string]bool, len(a)+len(b))
+	var keys []string
+	for _, m := range []map[string]interface{}{a, b} {
+		for key := range m {
+			if !seen[key] && !ignored[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// equalValues compares JSON values regardless of their decoded Go types,
+// so that for example an int and a float64 holding 2 are equal
+func equalValues(a, b interface{}) bool {
+	aJSON, aErr := json.Marshal(a)
+	bJSON, bErr := json.Marshal(b)
+	if aErr != nil || bErr != nil {
+		return false
+	}
+	return string(aJSON) == string(bJSON)
+}
+
+// Words computes a word-level diff between two texts. Whitespace is kept as
+// separate tokens so that concatenating the changes of one side yields its text.
+func Words(from, to string) []models.TextChange {
+	a, b := tokenize(from), tokenize(to)
+
+	// Common prefix and suffix don't need to go through the LCS table
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var changes []models.TextChange
+	changes = appendChange(changes, models.DiffEqual, a[:prefix]...)
+
+	midA, midB := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	if len(midA)*len(midB) > maxWordDiffCells {
+		changes = appendChange(changes, models.DiffDelete, midA...)
+		changes = appendChange(changes, models.DiffInsert, midB...)
+	} else {
+		changes = appendLCS(changes, midA, midB)
+	}
+
+	changes = appendChange(changes, models.DiffEqual, a[len(a)-suffix:]...)
+
+	if changes == nil {
+		return []models.TextChange{}
+	}
+	return changes
+}
+
+// appendLCS appends the edit script between two token lists
+func appendLCS(changes []models.TextChange, a, b []string) []models.TextChange {
+	n, m := len(a), len(b)
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int32, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int32, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case a[i] == b[j]:
+			changes = appendChange(changes, models.DiffEqual, a[i])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			changes = appendChange(changes, models.DiffDelete, a[i])
+			i++
+		default:
+			changes = appendChange(changes, models.DiffInsert, b[j])
+			j++
+		}
+	}
+	changes = appendChange(changes, models.DiffDelete, a[i:]...)
+	changes = appendChange(changes, models.DiffInsert, b[j:]...)
+
+	return changes
+}
+
+// appendChange appends tokens, merging them into the last change when the operation matches
+func appendChange(changes []models.TextChange, op string, tokens ...string) []models.TextChange {
+	if len(tokens) == 0 {
+		return changes
+	}
+
+	text := strings.Join(tokens, "")
+	if last := len(changes) - 1; last >= 0 && changes[last].Op == op {
+		changes[last].Text += text
+		return changes
+	}
+	return append(changes, models.TextChange{Op: op, Text: text})
+}
+
+// tokenize splits text into alternating runs of whitespace and non-whitespace
+func tokenize(text string) []string {
+	var tokens []string
+	start := 0
+	var inSpace bool
+	for i, r := range text {
+		space := unicode.IsSpace(r)
+		if i > start && space != inSpace {
+			tokens = append(tokens, text[start:i])
+			start = i
+		}
+		inSpace = space
+	}
+	if start < len(text) {
+		tokens = append(tokens, text[start:])
+	}
+	return tokens
+}
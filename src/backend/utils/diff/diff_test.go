@@ -0,0 +1,163 @@
+package diff
+
+import (
+	"testing"
+
+	"owlistic-notes/owlistic/models"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWords(t *testing.T) {
+	testCases := []struct {
+		name     string
+		from     string
+		to       string
+		expected []models.TextChange
+	}{
+		{
+			name:     "Identical",
+			from:     "same text",
+			to:       "same text",
+			expected: []models.TextChange{{Op: "equal", Text: "same text"}},
+		},
+		{
+			name: "Replaced word",
+			from: "ship the export feature",
+			to:   "ship the import feature",
+			expected: []models.TextChange{
+				{Op: "equal", Text: "ship the "},
+				{Op: "delete", Text: "export"},
+				{Op: "insert", Text: "import"},
+				{Op: "equal", Text: " feature"},
+			},
+		},
+		{
+			name: "Inserted words",
+			from: "review notes",
+			to:   "review planning notes today",
+			expected: []models.TextChange{
+				{Op: "equal", Text: "review "},
+				{Op: "insert", Text: "planning "},
+				{Op: "equal", Text: "notes"},
+				{Op: "insert", Text: " today"},
+			},
+		},
+		{
+			name:     "From empty",
+			from:     "",
+			to:       "new",
+			expected: []models.TextChange{{Op: "insert", Text: "new"}},
+		},
+		{
+			name:     "Both empty",
+			expected: []models.TextChange{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, Words(tc.from, tc.to))
+		})
+	}
+}
+
+func TestBlocks(t *testing.T) {
+	kept, moved, edited, removed, added := uuid.New(), uuid.New(), uuid.New(), uuid.New(), uuid.New()
+
+	from := []models.BlockSnapshot{
+		{ID: kept, Type: models.TextBlock, Content: models.BlockContent{"text": "intro"}, Order: 1000},
+		{ID: moved, Type: models.TextBlock, Content: models.BlockContent{"text": "later"}, Order: 2000},
+		{ID: edited, Type: models.TaskBlock, Content: models.BlockContent{"text": "write tests"},
+			Metadata: models.BlockMetadata{"is_completed": false, "_sync_source": "block"}, Order: 3000},
+		{ID: removed, Type: models.HeadingBlock, Content: models.BlockContent{"text": "Old"},
+			Metadata: models.BlockMetadata{"level": float64(2)}, Order: 4000},
+	}
+	to := []models.BlockSnapshot{
+		{ID: kept, Type: models.TextBlock, Content: models.BlockContent{"text": "intro"}, Order: 1000},
+		{ID: added, Type: models.TextBlock, Content: models.BlockContent{"text": "new"}, Order: 1500},
+		{ID: edited, Type: models.TaskBlock, Content: models.BlockContent{"text": "write more tests"},
+			Metadata: models.BlockMetadata{"is_completed": true, "_sync_source": "task"}, Order: 3000},
+		{ID: moved, Type: models.TextBlock, Content: models.BlockContent{"text": "later"}, Order: 5000},
+	}
+
+	result := Blocks(from, to)
+
+	if assert.Len(t, result.Added, 1) {
+		assert.Equal(t, added, result.Added[0].ID)
+	}
+	if assert.Len(t, result.Removed, 1) {
+		assert.Equal(t, removed, result.Removed[0].ID)
+	}
+	assert.Equal(t, []models.BlockMove{{BlockID: moved, FromOrder: 2000, ToOrder: 5000}}, result.Moved)
+
+	if assert.Len(t, result.Modified, 1) {
+		change := result.Modified[0]
+		assert.Equal(t, edited, change.BlockID)
+		assert.Equal(t, []models.FieldChange{
+			{Field: "content.text", From: "write tests", To: "write more tests"},
+			{Field: "metadata.is_completed", From: false, To: true},
+		}, change.Changes)
+		assert.Equal(t, []models.TextChange{
+			{Op: "equal", Text: "write "},
+			{Op: "insert", Text: "more "},
+			{Op: "equal", Text: "tests"},
+		}, change.TextDiff)
+	}
+}
+
+func TestBlocksReparented(t *testing.T) {
+	parent, child := uuid.New(), uuid.New()
+	from := []models.BlockSnapshot{
+		{ID: parent, Type: models.TaskBlock, Content: models.BlockContent{"text": "release"}, Order: 1000},
+		{ID: child, Type: models.TaskBlock, Content: models.BlockContent{"text": "tag"}, Order: 2000},
+	}
+	to := []models.BlockSnapshot{
+		from[0],
+		{ID: child, ParentBlockID: &parent, Type: models.TaskBlock, Content: models.BlockContent{"text": "tag"}, Order: 1000},
+	}
+
+	result := Blocks(from, to)
+	assert.Equal(t, []models.BlockMove{{BlockID: child, FromOrder: 2000, ToOrder: 1000}}, result.Moved)
+	if assert.Len(t, result.Modified, 1) {
+		assert.Equal(t, []models.FieldChange{{Field: "parent_block_id", From: (*uuid.UUID)(nil), To: &parent}}, result.Modified[0].Changes)
+	}
+}
+
+func TestBlocksRenumbered(t *testing.T) {
+	first, second, third := uuid.New(), uuid.New(), uuid.New()
+	from := []models.BlockSnapshot{
+		{ID: first, Type: models.TextBlock, Content: models.BlockContent{"text": "a"}, Order: 1000},
+		{ID: second, Type: models.TextBlock, Content: models.BlockContent{"text": "b"}, Order: 1000.5},
+		{ID: third, Type: models.TextBlock, Content: models.BlockContent{"text": "c"}, Order: 1000.75},
+	}
+
+	// Rebalancing spreads the orders out again without reordering
+	to := []models.BlockSnapshot{
+		{ID: first, Type: models.TextBlock, Content: models.BlockContent{"text": "a"}, Order: 1000},
+		{ID: second, Type: models.TextBlock, Content: models.BlockContent{"text": "b"}, Order: 2000},
+		{ID: third, Type: models.TextBlock, Content: models.BlockContent{"text": "c"}, Order: 3000},
+	}
+	assert.Empty(t, Blocks(from, to).Moved)
+
+	// Dragging the first block to the end after that moves just that one
+	to[0].Order = 4000
+	assert.Equal(t, []models.BlockMove{{BlockID: first, FromOrder: 1000, ToOrder: 4000}}, Blocks(from, to).Moved)
+}
+
+func TestBlocksHeadingLevel(t *testing.T) {
+	id := uuid.New()
+	from := []models.BlockSnapshot{{ID: id, Type: models.HeadingBlock, Metadata: models.BlockMetadata{"level": 1}}}
+	to := []models.BlockSnapshot{{ID: id, Type: models.HeadingBlock, Metadata: models.BlockMetadata{"level": float64(2)}}}
+
+	result := Blocks(from, to)
+	if assert.Len(t, result.Modified, 1) {
+		assert.Equal(t, "metadata.level", result.Modified[0].Changes[0].Field)
+		assert.Empty(t, result.Modified[0].TextDiff)
+	}
+
+	// Equal values decoded with different Go types are not a change
+	to[0].Metadata["level"] = float64(1)
+	assert.Empty(t, Blocks(from, to).Modified)
+}
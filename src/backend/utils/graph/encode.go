@@ -0,0 +1,122 @@
+package graph
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+
+	"owlistic-notes/owlistic/models"
+)
+
+const graphMLNamespace = "http://graphml.graphdrawing.org/xmlns"
+
+type graphML struct {
+	XMLName xml.Name     `xml:"graphml"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	Keys    []graphMLKey `xml:"key"`
+	Graph   graphMLGraph `xml:"graph"`
+}
+
+type graphMLKey struct {
+	ID       string `xml:"id,attr"`
+	For      string `xml:"for,attr"`
+	AttrName string `xml:"attr.name,attr"`
+	AttrType string `xml:"attr.type,attr"`
+}
+
+type graphMLGraph struct {
+	ID          string        `xml:"id,attr"`
+	EdgeDefault string        `xml:"edgedefault,attr"`
+	Nodes       []graphMLNode `xml:"node"`
+	Edges       []graphMLEdge `xml:"edge"`
+}
+
+type graphMLNode struct {
+	ID   string        `xml:"id,attr"`
+	Data []graphMLData `xml:"data"`
+}
+
+type graphMLEdge struct {
+	Source string        `xml:"source,attr"`
+	Target string        `xml:"target,attr"`
+	Data   []graphMLData `xml:"data"`
+}
+
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+// GraphML encodes a graph as a GraphML document with the node type, label
+// and orphan flag and the edge type as attributes
+func GraphML(g models.Graph) ([]byte, error) {
+	doc := graphML{
+		XMLNS: graphMLNamespace,
+		Keys: []graphMLKey{
+			{ID: "type", For: "all", AttrName: "type", AttrType: "string"},
+			{ID: "label", For: "node", AttrName: "label", AttrType: "string"},
+			{ID: "orphan", For: "node", AttrName: "orphan", AttrType: "boolean"},
+		},
+		Graph: graphMLGraph{ID: "notes", EdgeDefault: "directed"},
+	}
+
+	for _, node := range g.Nodes {
+		data := []graphMLData{
+			{Key: "type", Value: string(node.Type)},
+			{Key: "label", Value: node.Label},
+		}
+		if node.Type == models.GraphNoteNode {
+			data = append(data, graphMLData{Key: "orphan", Value: fmt.Sprint(node.Orphan)})
+		}
+		doc.Graph.Nodes = append(doc.Graph.Nodes, graphMLNode{ID: node.ID, Data: data})
+	}
+
+	for _, edge := range g.Edges {
+		doc.Graph.Edges = append(doc.Graph.Edges, graphMLEdge{
+			Source: edge.Source,
+			Target: edge.Target,
+			Data:   []graphMLData{{Key: "type", Value: string(edge.Type)}},
+		})
+	}
+
+	out, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(out, '\n')...), nil
+}
+
+// dotShapes draws each node type with its own Graphviz shape
+var dotShapes = map[models.GraphNodeType]string{
+	models.GraphNoteNode:     "box",
+	models.GraphNotebookNode: "folder",
+	models.GraphTagNode:      "ellipse",
+}
+
+// DOT encodes a graph in the Graphviz DOT language. Orphaned notes are
+// drawn dashed so they stand out.
+func DOT(g models.Graph) []byte {
+	var sb strings.Builder
+	sb.WriteString("digraph notes {\n")
+
+	for _, node := range g.Nodes {
+		fmt.Fprintf(&sb, "  %s [label=%s, type=%s, shape=%s", dotID(node.ID), dotID(node.Label), dotID(string(node.Type)), dotShapes[node.Type])
+		if node.Orphan {
+			sb.WriteString(", style=dashed")
+		}
+		sb.WriteString("];\n")
+	}
+
+	for _, edge := range g.Edges {
+		fmt.Fprintf(&sb, "  %s -> %s [type=%s];\n", dotID(edge.Source), dotID(edge.Target), dotID(string(edge.Type)))
+	}
+
+	sb.WriteString("}\n")
+	return []byte(sb.String())
+}
+
+// dotID quotes a DOT identifier
+func dotID(value string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", "")
+	return `"` + replacer.Replace(value) + `"`
+}
@@ -0,0 +1,51 @@
+package graph
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	"owlistic-notes/owlistic/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testGraph = models.Graph{
+	Nodes: []models.GraphNode{
+		{ID: "notebook:1", Type: models.GraphNotebookNode, Label: "Design"},
+		{ID: "note:1", Type: models.GraphNoteNode, Label: `The "plan" & more`},
+		{ID: "note:2", Type: models.GraphNoteNode, Label: "Scratch", Orphan: true},
+		{ID: "tag:arch", Type: models.GraphTagNode, Label: "arch"},
+	},
+	Edges: []models.GraphEdge{
+		{Source: "notebook:1", Target: "note:1", Type: models.GraphContainsEdge},
+		{Source: "note:1", Target: "tag:arch", Type: models.GraphTagEdge},
+	},
+}
+
+func TestGraphML(t *testing.T) {
+	data, err := GraphML(testGraph)
+	assert.NoError(t, err)
+
+	out := string(data)
+	assert.True(t, strings.HasPrefix(out, xml.Header))
+	assert.Contains(t, out, `<graph id="notes" edgedefault="directed">`)
+	assert.Contains(t, out, `<data key="label">The &#34;plan&#34; &amp; more</data>`)
+	assert.Contains(t, out, `<data key="orphan">true</data>`)
+	assert.Contains(t, out, `<edge source="note:1" target="tag:arch">`)
+
+	// The output is well-formed XML
+	var doc graphML
+	assert.NoError(t, xml.Unmarshal(data, &doc))
+	assert.Len(t, doc.Graph.Nodes, 4)
+	assert.Len(t, doc.Graph.Edges, 2)
+}
+
+func TestDOT(t *testing.T) {
+	out := string(DOT(testGraph))
+
+	assert.True(t, strings.HasPrefix(out, "digraph notes {\n"))
+	assert.Contains(t, out, `"note:1" [label="The \"plan\" & more", type="note", shape=box];`)
+	assert.Contains(t, out, `"note:2" [label="Scratch", type="note", shape=box, style=dashed];`)
+	assert.Contains(t, out, `"notebook:1" -> "note:1" [type="contains"];`)
+}
@@ -0,0 +1,692 @@
+package markdown
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+
+	"owlistic-notes/owlistic/models"
+)
+
+// Document is the result of parsing a Markdown file into note blocks
+type Document struct {
+	// Title is the text of a leading level 1 heading, if any
+	Title  string
+	Blocks []models.Block
+}
+
+var (
+	atxHeadingPattern     = regexp.MustCompile(`^ {0,3}(#{1,6})(?:[ \t]+(.*?))?(?:[ \t]+#+)?[ \t]*$`)
+	setextH1Pattern       = regexp.MustCompile(`^ {0,3}=+[ \t]*$`)
+	setextH2Pattern       = regexp.MustCompile(`^ {0,3}-+[ \t]*$`)
+	thematicBreakPattern  = regexp.MustCompile(`^ {0,3}(?:(?:-[ \t]*){3,}|(?:\*[ \t]*){3,}|(?:_[ \t]*){3,})$`)
+	taskItemPattern       = regexp.MustCompile(`^[ \t]*[-*+][ \t]+\[([ xX])\](?:[ \t]+(.*))?$`)
+	bulletItemPattern     = regexp.MustCompile(`^[ \t]*[-*+](?:[ \t]+(.*))?$`)
+	orderedItemPattern    = regexp.MustCompile(`^[ \t]*\d{1,9}[.)](?:[ \t]+(.*))?$`)
+	blockquotePattern     = regexp.MustCompile(`^ {0,3}>[ ]?(.*)$`)
+	fencePattern          = regexp.MustCompile("^ {0,3}(`{3,}|~{3,})[ \t]*([^`\\s]*)")
+	alertPattern          = regexp.MustCompile(`^\[!(NOTE|TIP|IMPORTANT|WARNING|CAUTION)\][ \t]*$`)
+	imagePattern          = regexp.MustCompile(`^ {0,3}!\[((?:[^\]\\]|\\.)*)\]\(<?([^\s<>()]+)>?(?:[ \t]+"[^"]*")?\)[ \t]*$`)
+	tableDelimiterPattern = regexp.MustCompile(`^ {0,3}\|?[ \t]*:?-+:?[ \t]*(?:\|[ \t]*:?-+:?[ \t]*)*\|?[ \t]*$`)
+)
+
+// alertVariants maps GitHub alert types onto callout variants
+var alertVariants = map[string]string{
+	"NOTE":      "info",
+	"IMPORTANT": "info",
+	"TIP":       "success",
+	"WARNING":   "warning",
+	"CAUTION":   "error",
+}
+
+// blockParser accumulates blocks while walking the source line by line
+type blockParser struct {
+	blocks    []models.Block
+	paragraph []string
+	// listOpen is true while lazy continuation lines belong to the last list item
+	listOpen bool
+}
+
+// Parse converts a Markdown document into typed blocks. Headings, task items,
+// bullet and ordered list items, thematic breaks, fenced code, blockquotes,
+// GitHub alerts, standalone images, GFM tables and paragraphs map onto the
+// corresponding block types; inline emphasis and links become metadata spans.
+func Parse(source string) Document {
+	source = strings.ReplaceAll(source, "\r\n", "\n")
+	source = strings.ReplaceAll(source, "\r", "\n")
+	source = strings.TrimPrefix(source, "\uFEFF")
+
+	p := &blockParser{}
+	lines := strings.Split(source, "\n")
+
+	for i := 0; i < len(lines); i++ {
+		line := strings.ReplaceAll(lines[i], "\t", "    ")
+
+		if strings.TrimSpace(line) == "" {
+			p.flushParagraph()
+			p.listOpen = false
+			continue
+		}
+
+		// Fenced code is kept verbatim in a single block
+		if m := fencePattern.FindStringSubmatch(line); m != nil {
+			p.flushParagraph()
+			p.listOpen = false
+			fence := m[1]
+			var code []string
+			for i++; i < len(lines); i++ {
+				if strings.HasPrefix(strings.TrimSpace(lines[i]), fence) {
+					break
+				}
+				code = append(code, lines[i])
+			}
+			var metadata models.BlockMetadata
+			if m[2] != "" {
+				metadata = models.BlockMetadata{"language": m[2]}
+			}
+			p.append(models.CodeBlock, strings.Join(code, "\n"), nil, metadata)
+			continue
+		}
+
+		// A single pending line followed by a delimiter row starts a table
+		if len(p.paragraph) == 1 && !p.listOpen && strings.Contains(line, "|") &&
+			strings.Contains(p.paragraph[0], "|") && tableDelimiterPattern.MatchString(line) {
+			header := splitTableRow(p.paragraph[0])
+			p.paragraph = nil
+
+			rows := []interface{}{tableRow(header, len(header))}
+			for i+1 < len(lines) && strings.Contains(lines[i+1], "|") && strings.TrimSpace(lines[i+1]) != "" {
+				i++
+				rows = append(rows, tableRow(splitTableRow(lines[i]), len(header)))
+			}
+			p.blocks = append(p.blocks, models.Block{
+				Type:     models.TableBlock,
+				Content:  models.BlockContent{"rows": rows},
+				Metadata: models.BlockMetadata{"header_row": true},
+			})
+			continue
+		}
+
+		// Setext underlines turn the pending paragraph into a heading
+		if len(p.paragraph) > 0 && !p.listOpen {
+			if setextH1Pattern.MatchString(line) {
+				p.flushHeading(1)
+				continue
+			}
+			if setextH2Pattern.MatchString(line) {
+				p.flushHeading(2)
+				continue
+			}
+		}
+
+		if thematicBreakPattern.MatchString(line) {
+			p.flushParagraph()
+			p.listOpen = false
+			p.append(models.HorizontalRuleBlock, "", nil, nil)
+			continue
+		}
+
+		if m := atxHeadingPattern.FindStringSubmatch(line); m != nil {
+			p.flushParagraph()
+			p.listOpen = false
+			p.appendInline(models.HeadingBlock, m[2], models.BlockMetadata{"level": len(m[1])})
+			continue
+		}
+
+		if m := taskItemPattern.FindStringSubmatch(line); m != nil {
+			p.flushParagraph()
+			p.appendInline(models.TaskBlock, m[2], models.BlockMetadata{"is_completed": m[1] != " "})
+			p.listOpen = true
+			continue
+		}
+
+		if m := bulletItemPattern.FindStringSubmatch(line); m != nil {
+			p.flushParagraph()
+			p.appendInline(models.ListItemBlock, m[1], models.BlockMetadata{"item_type": "unordered"})
+			p.listOpen = true
+			continue
+		}
+
+		if m := orderedItemPattern.FindStringSubmatch(line); m != nil {
+			p.flushParagraph()
+			p.appendInline(models.ListItemBlock, m[1], models.BlockMetadata{"item_type": "ordered"})
+			p.listOpen = true
+			continue
+		}
+
+		// Consecutive quoted lines form a single quote or callout block
+		if m := blockquotePattern.FindStringSubmatch(line); m != nil {
+			p.flushParagraph()
+			p.listOpen = false
+			quoted := []string{m[1]}
+			for i+1 < len(lines) {
+				next := blockquotePattern.FindStringSubmatch(strings.ReplaceAll(lines[i+1], "\t", "    "))
+				if next == nil {
+					break
+				}
+				i++
+				quoted = append(quoted, next[1])
+			}
+			p.appendQuote(quoted)
+			continue
+		}
+
+		if m := imagePattern.FindStringSubmatch(line); m != nil && len(p.paragraph) == 0 && !p.listOpen {
+			p.blocks = append(p.blocks, models.Block{
+				Type:     models.ImageBlock,
+				Content:  models.BlockContent{"url": m[2], "alt": unescapePunct(m[1])},
+				Metadata: models.BlockMetadata{},
+			})
+			continue
+		}
+
+		// Lines following a list item without a blank line continue that item
+		if p.listOpen {
+			p.continueListItem(line)
+			continue
+		}
+
+		p.paragraph = append(p.paragraph, line)
+	}
+
+	p.flushParagraph()
+
+	doc := Document{Blocks: p.blocks}
+	if len(doc.Blocks) > 0 && doc.Blocks[0].Type == models.HeadingBlock && doc.Blocks[0].Metadata["level"] == 1 {
+		doc.Title, _ = doc.Blocks[0].Content["text"].(string)
+		doc.Blocks = doc.Blocks[1:]
+	}
+
+	return doc
+}
+
+// append adds a block with the given plain text and metadata
+func (p *blockParser) append(blockType models.BlockType, text string, spans []interface{}, metadata models.BlockMetadata) {
+	if metadata == nil {
+		metadata = models.BlockMetadata{}
+	}
+	if len(spans) > 0 {
+		metadata["spans"] = spans
+	}
+
+	p.blocks = append(p.blocks, models.Block{
+		Type:     blockType,
+		Content:  models.BlockContent{"text": text},
+		Metadata: metadata,
+	})
+}
+
+// appendInline adds a block whose text may contain inline markup
+func (p *blockParser) appendInline(blockType models.BlockType, source string, metadata models.BlockMetadata) {
+	text, spans := ParseInline(strings.TrimSpace(source))
+	p.append(blockType, text, spans, metadata)
+}
+
+// appendQuote adds a quote block, or a callout when the quote opens with a
+// GitHub alert marker such as [!NOTE]
+func (p *blockParser) appendQuote(lines []string) {
+	blockType := models.QuoteBlock
+	var metadata models.BlockMetadata
+	if m := alertPattern.FindStringSubmatch(strings.TrimSpace(lines[0])); m != nil {
+		blockType = models.CalloutBlock
+		metadata = models.BlockMetadata{"variant": alertVariants[m[1]]}
+		lines = lines[1:]
+	}
+
+	// Blank quoted lines separate paragraphs, which are kept as line breaks
+	var paragraphs []string
+	var paragraph []string
+	for _, line := range append(lines, "") {
+		if strings.TrimSpace(line) != "" {
+			paragraph = append(paragraph, line)
+			continue
+		}
+		if len(paragraph) > 0 {
+			paragraphs = append(paragraphs, joinParagraph(paragraph))
+			paragraph = nil
+		}
+	}
+
+	p.appendInline(blockType, strings.Join(paragraphs, "\n"), metadata)
+}
+
+// splitTableRow splits a table row into its cells, honouring escaped pipes
+func splitTableRow(line string) []string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimPrefix(line, "|")
+	if strings.HasSuffix(line, "|") && !strings.HasSuffix(line, "\\|") {
+		line = strings.TrimSuffix(line, "|")
+	}
+
+	var cells []string
+	var cell strings.Builder
+	for i := 0; i < len(line); i++ {
+		switch {
+		case line[i] == '\\' && i+1 < len(line) && line[i+1] == '|':
+			cell.WriteByte('|')
+			i++
+		case line[i] == '|':
+			cells = append(cells, strings.TrimSpace(cell.String()))
+			cell.Reset()
+		default:
+			cell.WriteByte(line[i])
+		}
+	}
+	return append(cells, strings.TrimSpace(cell.String()))
+}
+
+// tableRow pads or truncates cells to the header width
+func tableRow(cells []string, columns int) []interface{} {
+	row := make([]interface{}, columns)
+	for i := range row {
+		row[i] = ""
+		if i < len(cells) {
+			row[i] = cells[i]
+		}
+	}
+	return row
+}
+
+// continueListItem appends a lazy continuation line to the last list item
+func (p *blockParser) continueListItem(line string) {
+	last := &p.blocks[len(p.blocks)-1]
+	text, _ := last.Content["text"].(string)
+
+	source := renderInline(text, last.GetSpans(), "")
+	source = strings.TrimRight(source, " ") + " " + strings.TrimSpace(line)
+
+	text, spans := ParseInline(source)
+	last.Content["text"] = text
+	delete(last.Metadata, "spans")
+	if len(spans) > 0 {
+		last.Metadata["spans"] = spans
+	}
+}
+
+// flushParagraph turns the pending paragraph lines into a text block
+func (p *blockParser) flushParagraph() {
+	if len(p.paragraph) == 0 {
+		return
+	}
+	p.appendInline(models.TextBlock, joinParagraph(p.paragraph), nil)
+	p.paragraph = nil
+}
+
+// flushHeading turns the pending paragraph lines into a setext heading
+func (p *blockParser) flushHeading(level int) {
+	p.appendInline(models.HeadingBlock, joinParagraph(p.paragraph), models.BlockMetadata{"level": level})
+	p.paragraph = nil
+}
+
+// joinParagraph joins paragraph lines, keeping hard line breaks as newlines
+func joinParagraph(lines []string) string {
+	var sb strings.Builder
+	for i, line := range lines {
+		line = strings.TrimLeft(line, " ")
+		if i == len(lines)-1 {
+			sb.WriteString(strings.TrimRight(line, " "))
+			break
+		}
+
+		switch {
+		case strings.HasSuffix(line, "\\"):
+			sb.WriteString(strings.TrimSuffix(line, "\\"))
+			sb.WriteString("\n")
+		case strings.HasSuffix(line, "  "):
+			sb.WriteString(strings.TrimRight(line, " "))
+			sb.WriteString("\n")
+		default:
+			sb.WriteString(strings.TrimRight(line, " "))
+			sb.WriteString(" ")
+		}
+	}
+	return sb.String()
+}
+
+// inlineToken is either literal text, an emphasis delimiter or a link
+type inlineToken struct {
+	text     string
+	delim    string
+	canOpen  bool
+	canClose bool
+	// opener is the index of the matching opener for closing delimiters
+	opener  int
+	matched bool
+	link    *inlineLink
+}
+
+type inlineLink struct {
+	text  string
+	spans []interface{}
+	href  string
+}
+
+// delimiterMarks maps emphasis delimiters onto span types
+var delimiterMarks = map[string]string{
+	"**": markBold,
+	"__": markBold,
+	"*":  markItalics,
+	"_":  markItalics,
+	"~~": markStrikethrough,
+}
+
+// ParseInline strips inline Markdown markup from source and returns the
+// plain text with formatting spans expressed as UTF-16 code unit offsets
+func ParseInline(source string) (string, []interface{}) {
+	tokens := tokenizeInline([]rune(source))
+	matchDelimiters(tokens)
+
+	var sb strings.Builder
+	var spans []map[string]interface{}
+	openAt := make(map[int]int)
+	offset := 0
+
+	for i, tok := range tokens {
+		switch {
+		case tok.link != nil:
+			start := offset
+			sb.WriteString(tok.link.text)
+			offset += utf16Len(tok.link.text)
+			if offset > start {
+				spans = append(spans, map[string]interface{}{
+					"start": start, "end": offset, "type": markLink, "href": tok.link.href,
+				})
+			}
+			for _, s := range tok.link.spans {
+				span := s.(map[string]interface{})
+				span["start"] = span["start"].(int) + start
+				span["end"] = span["end"].(int) + start
+				spans = append(spans, span)
+			}
+
+		case tok.matched && tok.opener >= 0:
+			if start := openAt[tok.opener]; offset > start {
+				spans = append(spans, map[string]interface{}{
+					"start": start, "end": offset, "type": delimiterMarks[tok.delim],
+				})
+			}
+
+		case tok.matched:
+			openAt[i] = offset
+
+		default:
+			sb.WriteString(tok.text)
+			offset += utf16Len(tok.text)
+		}
+	}
+
+	sort.SliceStable(spans, func(i, j int) bool {
+		if spans[i]["start"] != spans[j]["start"] {
+			return spans[i]["start"].(int) < spans[j]["start"].(int)
+		}
+		return markPriority[spans[i]["type"].(string)] < markPriority[spans[j]["type"].(string)]
+	})
+
+	result := make([]interface{}, 0, len(spans))
+	for _, span := range spans {
+		result = append(result, span)
+	}
+	return sb.String(), result
+}
+
+// tokenizeInline splits inline source into text, delimiter and link tokens
+func tokenizeInline(r []rune) []inlineToken {
+	var tokens []inlineToken
+	var text strings.Builder
+
+	flushText := func() {
+		if text.Len() > 0 {
+			tokens = append(tokens, inlineToken{text: text.String(), opener: -1})
+			text.Reset()
+		}
+	}
+
+	for i := 0; i < len(r); i++ {
+		c := r[i]
+
+		switch {
+		case c == '\\' && i+1 < len(r) && isASCIIPunct(r[i+1]):
+			text.WriteRune(r[i+1])
+			i++
+
+		case c == '`':
+			run := countRun(r, i, '`')
+			if end := findCodeSpanEnd(r, i+run, run); end >= 0 {
+				code := string(r[i+run : end])
+				if len(code) > 1 && strings.HasPrefix(code, " ") && strings.HasSuffix(code, " ") {
+					code = code[1 : len(code)-1]
+				}
+				text.WriteString(code)
+				i = end + run - 1
+			} else {
+				text.WriteString(string(r[i : i+run]))
+				i += run - 1
+			}
+
+		case c == '[':
+			if link, next := parseLink(r, i); link != nil {
+				flushText()
+				tokens = append(tokens, inlineToken{link: link, opener: -1})
+				i = next - 1
+			} else {
+				text.WriteRune(c)
+			}
+
+		case c == '<':
+			if end := findAutolinkEnd(r, i); end > 0 {
+				flushText()
+				href := string(r[i+1 : end])
+				tokens = append(tokens, inlineToken{link: &inlineLink{text: href, href: href}, opener: -1})
+				i = end
+			} else {
+				text.WriteRune(c)
+			}
+
+		case c == '*' || c == '_' || c == '~':
+			run := countRun(r, i, c)
+			if (c == '~' && run != 2) || run > 3 {
+				text.WriteString(string(r[i : i+run]))
+				i += run - 1
+				continue
+			}
+
+			prev, next := ' ', ' '
+			if i > 0 {
+				prev = r[i-1]
+			}
+			if i+run < len(r) {
+				next = r[i+run]
+			}
+
+			canOpen := !unicode.IsSpace(next)
+			canClose := !unicode.IsSpace(prev)
+			if c == '_' {
+				// Intraword underscores such as snake_case are literal
+				canOpen = canOpen && !isAlnum(prev)
+				canClose = canClose && !isAlnum(next)
+			}
+
+			flushText()
+			single, double := string(c), string([]rune{c, c})
+			delims := []string{string(r[i : i+run])}
+			if run == 3 {
+				// Split strong emphasis so the pairs nest properly
+				if canClose && !canOpen {
+					delims = []string{single, double}
+				} else {
+					delims = []string{double, single}
+				}
+			}
+			for _, d := range delims {
+				tokens = append(tokens, inlineToken{text: d, delim: d, canOpen: canOpen, canClose: canClose, opener: -1})
+			}
+			i += run - 1
+
+		default:
+			text.WriteRune(c)
+		}
+	}
+
+	flushText()
+	return tokens
+}
+
+// matchDelimiters pairs emphasis openers with closers. Delimiters left
+// unmatched, or crossing another pair, are kept as literal text.
+func matchDelimiters(tokens []inlineToken) {
+	var stack []int
+	for i := range tokens {
+		tok := &tokens[i]
+		if tok.delim == "" {
+			continue
+		}
+
+		if tok.canClose {
+			found := -1
+			for j := len(stack) - 1; j >= 0; j-- {
+				if tokens[stack[j]].delim == tok.delim {
+					found = j
+					break
+				}
+			}
+			if found >= 0 {
+				tokens[stack[found]].matched = true
+				tok.matched = true
+				tok.opener = stack[found]
+				stack = stack[:found]
+				continue
+			}
+		}
+
+		if tok.canOpen {
+			stack = append(stack, i)
+		}
+	}
+}
+
+// parseLink parses an inline link starting at the opening bracket and
+// returns the link together with the index just past it
+func parseLink(r []rune, start int) (*inlineLink, int) {
+	depth := 0
+	closeBracket := -1
+	for i := start; i < len(r) && closeBracket < 0; i++ {
+		switch r[i] {
+		case '\\':
+			i++
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth == 0 {
+				closeBracket = i
+			}
+		}
+	}
+	if closeBracket < 0 || closeBracket+1 >= len(r) || r[closeBracket+1] != '(' {
+		return nil, start
+	}
+
+	depth = 0
+	closeParen := -1
+	for i := closeBracket + 1; i < len(r) && closeParen < 0; i++ {
+		switch r[i] {
+		case '\\':
+			i++
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				closeParen = i
+			}
+		}
+	}
+	if closeParen < 0 {
+		return nil, start
+	}
+
+	destination := strings.TrimSpace(string(r[closeBracket+2 : closeParen]))
+	if strings.HasPrefix(destination, "<") {
+		if end := strings.Index(destination, ">"); end > 0 {
+			destination = destination[1:end]
+		}
+	} else if space := strings.IndexAny(destination, " \t"); space >= 0 {
+		// Drop an optional link title
+		destination = destination[:space]
+	}
+
+	text, spans := ParseInline(string(r[start+1 : closeBracket]))
+	return &inlineLink{text: text, spans: spans, href: unescapePunct(destination)}, closeParen + 1
+}
+
+// findAutolinkEnd returns the index of the closing angle bracket of an
+// autolink such as <https://example.com>, or -1
+func findAutolinkEnd(r []rune, start int) int {
+	for i := start + 1; i < len(r); i++ {
+		switch {
+		case r[i] == '>':
+			if strings.Contains(string(r[start+1:i]), ":") {
+				return i
+			}
+			return -1
+		case r[i] == '<' || unicode.IsSpace(r[i]):
+			return -1
+		}
+	}
+	return -1
+}
+
+// findCodeSpanEnd returns the start of the backtick run closing a code span
+func findCodeSpanEnd(r []rune, from int, run int) int {
+	for i := from; i < len(r); i++ {
+		if r[i] != '`' {
+			continue
+		}
+		n := countRun(r, i, '`')
+		if n == run {
+			return i
+		}
+		i += n - 1
+	}
+	return -1
+}
+
+// countRun counts consecutive occurrences of c starting at i
+func countRun(r []rune, i int, c rune) int {
+	n := 0
+	for i+n < len(r) && r[i+n] == c {
+		n++
+	}
+	return n
+}
+
+// unescapePunct removes backslash escapes in front of ASCII punctuation
+func unescapePunct(s string) string {
+	if !strings.Contains(s, "\\") {
+		return s
+	}
+	r := []rune(s)
+	var sb strings.Builder
+	for i := 0; i < len(r); i++ {
+		if r[i] == '\\' && i+1 < len(r) && isASCIIPunct(r[i+1]) {
+			i++
+		}
+		sb.WriteRune(r[i])
+	}
+	return sb.String()
+}
+
+// utf16Len returns the length of s in UTF-16 code units
+func utf16Len(s string) int {
+	return len(utf16.Encode([]rune(s)))
+}
+
+func isASCIIPunct(c rune) bool {
+	return c < 0x80 && unicode.IsPunct(c) || strings.ContainsRune("$+<=>^`|~", c)
+}
+
+func isAlnum(c rune) bool {
+	return unicode.IsLetter(c) || unicode.IsDigit(c)
+}
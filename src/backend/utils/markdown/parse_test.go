@@ -0,0 +1,191 @@
+package markdown
+
+import (
+	"testing"
+
+	"owlistic-notes/owlistic/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	source := "# Sprint Planning\r\n\r\n" +
+		"Goals\n" +
+		"-----\n\n" +
+		"Ship the\nimport feature\\\nthis week\n\n" +
+		"- [x] Write parser\n" +
+		"- [ ] Write importer\n" +
+		"  with tests\n\n" +
+		"1. first\n" +
+		"2) second\n\n" +
+		"***\n\n" +
+		"* bullet\n" +
+		"### Notes ###\n" +
+		"> quoted text\n"
+
+	doc := Parse(source)
+	assert.Equal(t, "Sprint Planning", doc.Title)
+
+	expected := []struct {
+		blockType models.BlockType
+		text      string
+		metadata  models.BlockMetadata
+	}{
+		{models.HeadingBlock, "Goals", models.BlockMetadata{"level": 2}},
+		{models.TextBlock, "Ship the import feature\nthis week", models.BlockMetadata{}},
+		{models.TaskBlock, "Write parser", models.BlockMetadata{"is_completed": true}},
+		{models.TaskBlock, "Write importer with tests", models.BlockMetadata{"is_completed": false}},
+		{models.ListItemBlock, "first", models.BlockMetadata{"item_type": "ordered"}},
+		{models.ListItemBlock, "second", models.BlockMetadata{"item_type": "ordered"}},
+		{models.HorizontalRuleBlock, "", models.BlockMetadata{}},
+		{models.ListItemBlock, "bullet", models.BlockMetadata{"item_type": "unordered"}},
+		{models.HeadingBlock, "Notes", models.BlockMetadata{"level": 3}},
+		{models.QuoteBlock, "quoted text", models.BlockMetadata{}},
+	}
+
+	if assert.Len(t, doc.Blocks, len(expected)) {
+		for i, e := range expected {
+			assert.Equal(t, e.blockType, doc.Blocks[i].Type, "block %d", i)
+			assert.Equal(t, e.text, doc.Blocks[i].Content["text"], "block %d", i)
+			assert.Equal(t, e.metadata, doc.Blocks[i].Metadata, "block %d", i)
+		}
+	}
+}
+
+func TestParseWithoutTitle(t *testing.T) {
+	doc := Parse("## Not a title\n\n```\n# raw *code*\n```\n")
+
+	assert.Empty(t, doc.Title)
+	if assert.Len(t, doc.Blocks, 2) {
+		assert.Equal(t, models.HeadingBlock, doc.Blocks[0].Type)
+		assert.Equal(t, models.CodeBlock, doc.Blocks[1].Type)
+		assert.Equal(t, "# raw *code*", doc.Blocks[1].Content["text"])
+		assert.Empty(t, doc.Blocks[1].GetCodeLanguage())
+	}
+}
+
+func TestParseRichBlocks(t *testing.T) {
+	source := "```go\nfmt.Println(\"hi\")\n```\n\n" +
+		"> first line\n" +
+		"> still quoted\n" +
+		">\n" +
+		"> second paragraph\n\n" +
+		"> [!WARNING]\n" +
+		"> Mind the gap\n\n" +
+		"![Architecture *diagram*](https://example.com/arch.png \"Overview\")\n\n" +
+		"| Name | Notes |\n" +
+		"| --- | :---: |\n" +
+		"| a \\| b | c |\n" +
+		"| short |\n"
+
+	doc := Parse(source)
+	if !assert.Len(t, doc.Blocks, 5) {
+		return
+	}
+
+	assert.Equal(t, models.CodeBlock, doc.Blocks[0].Type)
+	assert.Equal(t, `fmt.Println("hi")`, doc.Blocks[0].Content["text"])
+	assert.Equal(t, "go", doc.Blocks[0].GetCodeLanguage())
+
+	assert.Equal(t, models.QuoteBlock, doc.Blocks[1].Type)
+	assert.Equal(t, "first line still quoted\nsecond paragraph", doc.Blocks[1].Content["text"])
+
+	assert.Equal(t, models.CalloutBlock, doc.Blocks[2].Type)
+	assert.Equal(t, "Mind the gap", doc.Blocks[2].Content["text"])
+	assert.Equal(t, "warning", doc.Blocks[2].Metadata["variant"])
+
+	assert.Equal(t, models.ImageBlock, doc.Blocks[3].Type)
+	assert.Equal(t, models.BlockContent{"url": "https://example.com/arch.png", "alt": "Architecture *diagram*"}, doc.Blocks[3].Content)
+
+	assert.Equal(t, models.TableBlock, doc.Blocks[4].Type)
+	assert.Equal(t, [][]string{{"Name", "Notes"}, {"a | b", "c"}, {"short", ""}}, doc.Blocks[4].GetTableRows())
+}
+
+func TestParseInline(t *testing.T) {
+	testCases := []struct {
+		name   string
+		source string
+		text   string
+		spans  []interface{}
+	}{
+		{
+			name:   "Plain text",
+			source: "nothing to see",
+			text:   "nothing to see",
+			spans:  []interface{}{},
+		},
+		{
+			name:   "Bold and italics",
+			source: "make it **bold** and _italic_",
+			text:   "make it bold and italic",
+			spans: []interface{}{
+				map[string]interface{}{"start": 8, "end": 12, "type": "bold"},
+				map[string]interface{}{"start": 17, "end": 23, "type": "italics"},
+			},
+		},
+		{
+			name:   "Nested strong emphasis",
+			source: "***both*** ~~gone~~",
+			text:   "both gone",
+			spans: []interface{}{
+				map[string]interface{}{"start": 0, "end": 4, "type": "bold"},
+				map[string]interface{}{"start": 0, "end": 4, "type": "italics"},
+				map[string]interface{}{"start": 5, "end": 9, "type": "strikethrough"},
+			},
+		},
+		{
+			name:   "Link with emphasis",
+			source: "see [the **docs**](https://example.com/a_(b) \"Docs\")",
+			text:   "see the docs",
+			spans: []interface{}{
+				map[string]interface{}{"start": 4, "end": 12, "type": "link", "href": "https://example.com/a_(b)"},
+				map[string]interface{}{"start": 8, "end": 12, "type": "bold"},
+			},
+		},
+		{
+			name:   "Escapes, code and literal delimiters",
+			source: `2 \* 3 is snake_case_name, ` + "`**raw**`" + ` and * alone`,
+			text:   "2 * 3 is snake_case_name, **raw** and * alone",
+			spans:  []interface{}{},
+		},
+		{
+			name:   "UTF-16 offsets",
+			source: "😀 **hi**",
+			text:   "😀 hi",
+			spans: []interface{}{
+				map[string]interface{}{"start": 3, "end": 5, "type": "bold"},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			text, spans := ParseInline(tc.source)
+			assert.Equal(t, tc.text, text)
+			assert.Equal(t, tc.spans, spans)
+		})
+	}
+}
+
+func TestParseRoundTrip(t *testing.T) {
+	note := models.Note{
+		Title: "Round trip",
+		Blocks: []models.Block{
+			{Type: models.HeadingBlock, Content: models.BlockContent{"text": "Section"}, Metadata: models.BlockMetadata{"level": 2}},
+			{Type: models.TextBlock, Content: models.BlockContent{"text": "a [literal] *star*"}, Metadata: models.BlockMetadata{}},
+			{Type: models.TaskBlock, Content: models.BlockContent{"text": "done"}, Metadata: models.BlockMetadata{"is_completed": true}},
+			{Type: models.CodeBlock, Content: models.BlockContent{"text": "a := \"```\""}, Metadata: models.BlockMetadata{"language": "go"}},
+			{Type: models.QuoteBlock, Content: models.BlockContent{"text": "quoted"}, Metadata: models.BlockMetadata{}},
+			{Type: models.CalloutBlock, Content: models.BlockContent{"text": "careful"}, Metadata: models.BlockMetadata{"variant": "error"}},
+			{Type: models.ImageBlock, Content: models.BlockContent{"url": "/files/chart.png", "alt": "chart"}, Metadata: models.BlockMetadata{}},
+			{Type: models.TableBlock, Content: models.BlockContent{"rows": []interface{}{
+				[]interface{}{"key", "value"},
+				[]interface{}{"pipe", "a | b"},
+			}}, Metadata: models.BlockMetadata{"header_row": true}},
+		},
+	}
+
+	doc := Parse(RenderNote(note))
+	assert.Equal(t, note.Title, doc.Title)
+	assert.Equal(t, note.Blocks, doc.Blocks)
+}
@@ -0,0 +1,484 @@
+package markdown
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf16"
+
+	"owlistic-notes/owlistic/models"
+
+	"github.com/google/uuid"
+)
+
+// Inline mark types as stored in block metadata spans
+const (
+	markLink          = "link"
+	markBold          = "bold"
+	markItalics       = "italics"
+	markStrikethrough = "strikethrough"
+)
+
+// markPriority determines the nesting order of marks that open at the same
+// position: links are always outermost so their text can carry emphasis
+var markPriority = map[string]int{
+	markLink:          0,
+	markBold:          1,
+	markItalics:       2,
+	markStrikethrough: 3,
+}
+
+// inlineMark is a single formatting span resolved against the block text
+type inlineMark struct {
+	kind  string
+	start int
+	end   int
+	href  string
+}
+
+// RenderNote renders a note as a CommonMark document with its title as the top heading
+func RenderNote(note models.Note) string {
+	var sb strings.Builder
+
+	if title := strings.TrimSpace(note.Title); title != "" {
+		sb.WriteString("# ")
+		sb.WriteString(escapeText(title, true))
+		sb.WriteString("\n\n")
+	}
+
+	sb.WriteString(RenderBlocks(note.Blocks))
+	return sb.String()
+}
+
+// RenderBlocks renders the blocks of a note to CommonMark. Blocks nested
+// under list items and tasks are indented beneath them.
+func RenderBlocks(blocks []models.Block) string {
+	var sb strings.Builder
+	var prevType models.BlockType
+	var prevIndent string
+
+	// childIndent is the indentation of the children of each rendered block
+	childIndent := make(map[uuid.UUID]string)
+	// Ordered list numbering restarts in every group of siblings
+	listIndex := make(map[uuid.UUID]int)
+	lastSibling := make(map[uuid.UUID]models.BlockType)
+
+	for _, block := range models.SortBlocksDepthFirst(blocks) {
+		block := block
+		text, _ := block.Content["text"].(string)
+
+		// Empty paragraphs carry no content worth exporting
+		if block.Type == models.TextBlock && strings.TrimSpace(text) == "" {
+			continue
+		}
+
+		parent := uuid.Nil
+		indent := ""
+		if block.ParentBlockID != nil {
+			if parentIndent, ok := childIndent[*block.ParentBlockID]; ok {
+				parent = *block.ParentBlockID
+				indent = parentIndent
+			}
+		}
+
+		if isListBlock(block.Type) && isListBlock(prevType) && (block.Type == prevType || indent != prevIndent) {
+			sb.WriteString("\n")
+		} else if sb.Len() > 0 {
+			sb.WriteString("\n\n")
+		}
+
+		if block.Type == models.ListItemBlock && lastSibling[parent] == models.ListItemBlock {
+			listIndex[parent]++
+		} else {
+			listIndex[parent] = 1
+		}
+		lastSibling[parent] = block.Type
+		prevType = block.Type
+		prevIndent = indent
+
+		rendered := renderBlock(&block, text, listIndex[parent])
+		sb.WriteString(indentLines(rendered, indent))
+
+		// Children line up with the text of list items and tasks
+		childIndent[block.ID] = indent
+		if isListBlock(block.Type) {
+			marker := "- "
+			if block.Type == models.ListItemBlock && isOrderedListItem(&block) {
+				marker = fmt.Sprintf("%d. ", listIndex[parent])
+			}
+			childIndent[block.ID] = indent + strings.Repeat(" ", len(marker))
+		}
+	}
+
+	if sb.Len() > 0 {
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// indentLines prefixes every non-empty line with indent
+func indentLines(text, indent string) string {
+	if indent == "" {
+		return text
+	}
+
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = indent + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// renderBlock renders a single block without surrounding blank lines
+func renderBlock(block *models.Block, text string, listIndex int) string {
+	switch block.Type {
+	case models.HeadingBlock:
+		level := block.GetHeadingLevel()
+		if level < 1 {
+			level = 1
+		} else if level > 6 {
+			level = 6
+		}
+		return strings.Repeat("#", level) + " " + renderInline(text, block.GetSpans(), "")
+
+	case models.TaskBlock:
+		checkbox := "- [ ] "
+		if block.IsTaskCompleted() {
+			checkbox = "- [x] "
+		}
+		return checkbox + renderInline(text, block.GetSpans(), "      ")
+
+	case models.ListItemBlock:
+		if isOrderedListItem(block) {
+			marker := fmt.Sprintf("%d. ", listIndex)
+			return marker + renderInline(text, block.GetSpans(), strings.Repeat(" ", len(marker)))
+		}
+		return "- " + renderInline(text, block.GetSpans(), "  ")
+
+	case models.HorizontalRuleBlock:
+		return "---"
+
+	case models.CodeBlock:
+		return renderCodeBlock(text, block.GetCodeLanguage())
+
+	case models.QuoteBlock:
+		return quoteLines(renderInline(text, block.GetSpans(), ""))
+
+	case models.CalloutBlock:
+		variant, _ := block.Metadata["variant"].(string)
+		alert, ok := calloutAlerts[variant]
+		if !ok {
+			alert = calloutAlerts["info"]
+		}
+		return "> [!" + alert + "]\n" + quoteLines(renderInline(text, block.GetSpans(), ""))
+
+	case models.ImageBlock:
+		url, _ := block.Content["url"].(string)
+		alt, _ := block.Content["alt"].(string)
+		return "![" + markdownEscaper.Replace(alt) + "](" + escapeLinkDestination(url) + ")"
+
+	case models.TableBlock:
+		return renderTable(block.GetTableRows())
+
+	default:
+		return renderInline(text, block.GetSpans(), "")
+	}
+}
+
+// calloutAlerts maps callout variants onto GitHub alert types
+var calloutAlerts = map[string]string{
+	"info":    "NOTE",
+	"success": "TIP",
+	"warning": "WARNING",
+	"error":   "CAUTION",
+}
+
+// renderCodeBlock renders a fenced code block with a fence longer than any
+// backtick run in the code itself
+func renderCodeBlock(code, language string) string {
+	fence := "```"
+	for strings.Contains(code, fence) {
+		fence += "`"
+	}
+	return fence + language + "\n" + code + "\n" + fence
+}
+
+// quoteLines prefixes every line of rendered text with a blockquote marker
+func quoteLines(text string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight("> "+line, " ")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// renderTable renders a GFM table whose first row is the header
+func renderTable(rows [][]string) string {
+	if len(rows) == 0 {
+		return ""
+	}
+
+	columns := 0
+	for _, row := range rows {
+		if len(row) > columns {
+			columns = len(row)
+		}
+	}
+
+	cellEscaper := strings.NewReplacer("|", `\|`, "\n", " ")
+	renderRow := func(row []string) string {
+		cells := make([]string, columns)
+		for i := range cells {
+			if i < len(row) {
+				cells[i] = cellEscaper.Replace(row[i])
+			}
+		}
+		return "| " + strings.Join(cells, " | ") + " |"
+	}
+
+	lines := []string{renderRow(rows[0]), "|" + strings.Repeat(" --- |", columns)}
+	for _, row := range rows[1:] {
+		lines = append(lines, renderRow(row))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// isListBlock reports whether consecutive blocks of this type form a tight list
+func isListBlock(blockType models.BlockType) bool {
+	return blockType == models.ListItemBlock || blockType == models.TaskBlock
+}
+
+// isOrderedListItem reads the list style stored by the editor
+func isOrderedListItem(block *models.Block) bool {
+	for _, key := range []string{"item_type", "listType"} {
+		if itemType, ok := block.Metadata[key].(string); ok {
+			return itemType == "ordered"
+		}
+	}
+	return false
+}
+
+// renderInline renders text with its formatting spans applied as inline markup.
+// Span offsets are UTF-16 code unit indexes, as produced by the editor.
+func renderInline(text string, spans []map[string]interface{}, indent string) string {
+	text = strings.TrimRight(text, "\n")
+	units := utf16.Encode([]rune(text))
+	marks := parseMarks(spans, len(units))
+
+	// Collect every position where the set of active marks changes
+	boundaries := []int{0, len(units)}
+	for _, m := range marks {
+		boundaries = append(boundaries, m.start, m.end)
+	}
+	sort.Ints(boundaries)
+
+	var sb strings.Builder
+	var open []inlineMark
+
+	for i, pos := range boundaries {
+		if i > 0 && pos == boundaries[i-1] {
+			continue
+		}
+
+		// Marks active in the segment starting at pos
+		var active []inlineMark
+		for _, m := range marks {
+			if m.start <= pos && pos < m.end {
+				active = append(active, m)
+			}
+		}
+
+		// Close marks that end here, along with anything nested inside them
+		keep := 0
+		for keep < len(open) && containsMark(active, open[keep]) {
+			keep++
+		}
+		for j := len(open) - 1; j >= keep; j-- {
+			sb.WriteString(closeMarker(open[j]))
+		}
+		open = open[:keep]
+
+		// Open marks that start here or were closed to keep nesting valid
+		for _, m := range active {
+			if !containsMark(open, m) {
+				sb.WriteString(openMarker(m))
+				open = append(open, m)
+			}
+		}
+
+		if i+1 < len(boundaries) {
+			segment := string(utf16.Decode(units[pos:boundaries[i+1]]))
+			sb.WriteString(escapeText(segment, pos == 0))
+		}
+	}
+
+	for j := len(open) - 1; j >= 0; j-- {
+		sb.WriteString(closeMarker(open[j]))
+	}
+
+	// Preserve line breaks inside a block as CommonMark hard breaks
+	return strings.ReplaceAll(sb.String(), "\n", "\\\n"+indent)
+}
+
+// parseMarks converts raw metadata spans into sorted, bounds-checked marks
+func parseMarks(spans []map[string]interface{}, length int) []inlineMark {
+	marks := make([]inlineMark, 0, len(spans))
+	for _, span := range spans {
+		kind, _ := span["type"].(string)
+		if _, ok := markPriority[kind]; !ok {
+			continue
+		}
+
+		start, startOk := spanOffset(span["start"])
+		end, endOk := spanOffset(span["end"])
+		if !startOk || !endOk {
+			continue
+		}
+		if start < 0 {
+			start = 0
+		}
+		if end > length {
+			end = length
+		}
+		if start >= end {
+			continue
+		}
+
+		href, _ := span["href"].(string)
+		if kind == markLink && href == "" {
+			continue
+		}
+
+		marks = append(marks, inlineMark{kind: kind, start: start, end: end, href: href})
+	}
+
+	// Longer marks open first so that shorter ones nest inside them
+	sort.SliceStable(marks, func(i, j int) bool {
+		if marks[i].start != marks[j].start {
+			return marks[i].start < marks[j].start
+		}
+		if marks[i].end != marks[j].end {
+			return marks[i].end > marks[j].end
+		}
+		return markPriority[marks[i].kind] < markPriority[marks[j].kind]
+	})
+
+	return marks
+}
+
+// spanOffset reads a span offset decoded from JSON
+func spanOffset(value interface{}) (int, bool) {
+	switch v := value.(type) {
+	case float64:
+		return int(v), true
+	case int:
+		return v, true
+	case int64:
+		return int(v), true
+	default:
+		return 0, false
+	}
+}
+
+func containsMark(marks []inlineMark, mark inlineMark) bool {
+	for _, m := range marks {
+		if m == mark {
+			return true
+		}
+	}
+	return false
+}
+
+func openMarker(mark inlineMark) string {
+	switch mark.kind {
+	case markLink:
+		return "["
+	case markBold:
+		return "**"
+	case markItalics:
+		return "*"
+	case markStrikethrough:
+		return "~~"
+	}
+	return ""
+}
+
+func closeMarker(mark inlineMark) string {
+	switch mark.kind {
+	case markLink:
+		return "](" + escapeLinkDestination(mark.href) + ")"
+	case markBold:
+		return "**"
+	case markItalics:
+		return "*"
+	case markStrikethrough:
+		return "~~"
+	}
+	return ""
+}
+
+// markdownEscaper escapes characters that would otherwise be read as inline markup
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	"`", "\\`",
+	"*", `\*`,
+	"_", `\_`,
+	"[", `\[`,
+	"]", `\]`,
+	"<", `\<`,
+	"~", `\~`,
+)
+
+// escapeText escapes inline markup characters and, at the start of a line,
+// characters that would turn a paragraph into another block construct
+func escapeText(text string, lineStart bool) string {
+	escaped := markdownEscaper.Replace(text)
+
+	lines := strings.Split(escaped, "\n")
+	for i, line := range lines {
+		if i == 0 && !lineStart {
+			continue
+		}
+		lines[i] = escapeLineStart(line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// escapeLineStart escapes a leading block marker such as "#", ">", "- " or "1."
+func escapeLineStart(line string) string {
+	trimmed := strings.TrimLeft(line, " ")
+	if trimmed == "" {
+		return line
+	}
+	indent := line[:len(line)-len(trimmed)]
+
+	switch trimmed[0] {
+	case '#', '>', '=':
+		return indent + `\` + trimmed
+	case '-', '+':
+		if len(trimmed) == 1 || trimmed[1] == ' ' || trimmed[1] == trimmed[0] {
+			return indent + `\` + trimmed
+		}
+	}
+
+	// Ordered list markers: digits followed by "." or ")"
+	digits := 0
+	for digits < len(trimmed) && digits < 9 && trimmed[digits] >= '0' && trimmed[digits] <= '9' {
+		digits++
+	}
+	if digits > 0 && digits < len(trimmed) && (trimmed[digits] == '.' || trimmed[digits] == ')') {
+		return indent + trimmed[:digits] + `\` + trimmed[digits:]
+	}
+
+	return line
+}
+
+// escapeLinkDestination wraps destinations that contain spaces or parentheses
+func escapeLinkDestination(href string) string {
+	if strings.ContainsAny(href, " ()<>") {
+		return "<" + strings.NewReplacer("<", "%3C", ">", "%3E").Replace(href) + ">"
+	}
+	return href
+}
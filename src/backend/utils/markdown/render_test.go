@@ -0,0 +1,141 @@
+package markdown
+
+import (
+	"testing"
+
+	"owlistic-notes/owlistic/models"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderNote(t *testing.T) {
+	note := models.Note{
+		Title: "Sprint Planning",
+		Blocks: []models.Block{
+			{Type: models.HeadingBlock, Content: models.BlockContent{"text": "Goals"}, Metadata: models.BlockMetadata{"level": float64(2)}},
+			{Type: models.TextBlock, Content: models.BlockContent{"text": ""}},
+			{Type: models.TextBlock, Content: models.BlockContent{"text": "Ship the export feature"}},
+			{Type: models.TaskBlock, Content: models.BlockContent{"text": "Write parser"}, Metadata: models.BlockMetadata{"is_completed": true}},
+			{Type: models.TaskBlock, Content: models.BlockContent{"text": "Write renderer"}, Metadata: models.BlockMetadata{"is_completed": false}},
+			{Type: models.ListItemBlock, Content: models.BlockContent{"text": "first"}, Metadata: models.BlockMetadata{"item_type": "ordered"}},
+			{Type: models.ListItemBlock, Content: models.BlockContent{"text": "second"}, Metadata: models.BlockMetadata{"item_type": "ordered"}},
+			{Type: models.HorizontalRuleBlock},
+			{Type: models.ListItemBlock, Content: models.BlockContent{"text": "bullet"}},
+		},
+	}
+
+	expected := "# Sprint Planning\n\n" +
+		"## Goals\n\n" +
+		"Ship the export feature\n\n" +
+		"- [x] Write parser\n" +
+		"- [ ] Write renderer\n\n" +
+		"1. first\n" +
+		"2. second\n\n" +
+		"---\n\n" +
+		"- bullet\n"
+
+	assert.Equal(t, expected, RenderNote(note))
+}
+
+func TestRenderRichBlocks(t *testing.T) {
+	blocks := []models.Block{
+		{Type: models.CodeBlock, Content: models.BlockContent{"text": "x := 1"}, Metadata: models.BlockMetadata{"language": "go"}},
+		{Type: models.QuoteBlock, Content: models.BlockContent{"text": "one\ntwo"}},
+		{Type: models.CalloutBlock, Content: models.BlockContent{"text": "Heads up"}},
+		{Type: models.ImageBlock, Content: models.BlockContent{"url": "https://example.com/a b.png", "alt": "[plot]"}},
+		{Type: models.TableBlock, Content: models.BlockContent{"rows": []interface{}{
+			[]interface{}{"a", "b"},
+			[]interface{}{"1|2"},
+		}}},
+		{Type: models.ToggleBlock, Content: models.BlockContent{"text": "Details"}},
+	}
+
+	expected := "```go\nx := 1\n```\n\n" +
+		"> one\\\n> two\n\n" +
+		"> [!NOTE]\n> Heads up\n\n" +
+		"![\\[plot\\]](<https://example.com/a b.png>)\n\n" +
+		"| a | b |\n| --- | --- |\n| 1\\|2 |  |\n\n" +
+		"Details\n"
+
+	assert.Equal(t, expected, RenderBlocks(blocks))
+}
+
+func TestRenderNestedBlocks(t *testing.T) {
+	first := uuid.New()
+	second := uuid.New()
+	toggle := uuid.New()
+	ordered := models.BlockMetadata{"listType": "ordered"}
+
+	blocks := []models.Block{
+		{ID: first, Type: models.ListItemBlock, Content: models.BlockContent{"text": "Plan"}, Metadata: ordered, Order: 1},
+		{ID: second, Type: models.ListItemBlock, Content: models.BlockContent{"text": "Ship"}, Metadata: ordered, Order: 2},
+		{ParentBlockID: &first, Type: models.ListItemBlock, Content: models.BlockContent{"text": "Draft"}, Order: 1},
+		{ParentBlockID: &first, Type: models.TaskBlock, Content: models.BlockContent{"text": "Review"}, Order: 2},
+		{ParentBlockID: &second, Type: models.CodeBlock, Content: models.BlockContent{"text": "make release"}, Order: 1},
+		{ID: toggle, Type: models.ToggleBlock, Content: models.BlockContent{"text": "Details"}, Order: 3},
+		{ParentBlockID: &toggle, Type: models.TextBlock, Content: models.BlockContent{"text": "Hidden"}, Order: 1},
+	}
+
+	expected := "1. Plan\n" +
+		"   - Draft\n\n" +
+		"   - [ ] Review\n" +
+		"2. Ship\n\n" +
+		"   ```\n   make release\n   ```\n\n" +
+		"Details\n\n" +
+		"Hidden\n"
+
+	assert.Equal(t, expected, RenderBlocks(blocks))
+}
+
+func TestRenderInline(t *testing.T) {
+	testCases := []struct {
+		name     string
+		text     string
+		spans    []map[string]interface{}
+		expected string
+	}{
+		{
+			name:     "Plain text is escaped",
+			text:     "2 * 3 = 6 [approx]",
+			expected: `2 \* 3 = 6 \[approx\]`,
+		},
+		{
+			name: "Bold and italics",
+			text: "make it bold and italic",
+			spans: []map[string]interface{}{
+				{"start": float64(8), "end": float64(12), "type": "bold"},
+				{"start": float64(17), "end": float64(23), "type": "italics"},
+			},
+			expected: "make it **bold** and *italic*",
+		},
+		{
+			name: "Link containing emphasis",
+			text: "see the docs",
+			spans: []map[string]interface{}{
+				{"start": float64(4), "end": float64(12), "type": "link", "href": "https://example.com"},
+				{"start": float64(8), "end": float64(12), "type": "bold"},
+			},
+			expected: "see [the **docs**](https://example.com)",
+		},
+		{
+			name:     "Leading block marker is escaped",
+			text:     "# not a heading",
+			expected: `\# not a heading`,
+		},
+		{
+			name: "Offsets are UTF-16 code units",
+			text: "😀 wow",
+			spans: []map[string]interface{}{
+				{"start": float64(3), "end": float64(6), "type": "bold"},
+			},
+			expected: "😀 **wow**",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, renderInline(tc.text, tc.spans, ""))
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package ot
+
+// Client tracks the text of one editor, the way the editors talking to a
+// Document do: at most one operation is in flight at a time, and the edits
+// made meanwhile are buffered into one.
+type Client struct {
+	Text string
+	// Revision is the document revision the client last heard of
+	Revision int
+	// outstanding was sent and awaits its acknowledgement; buffer holds the
+	// edits made since
+	outstanding Operation
+	buffer      Operation
+}
+
+// NewClient starts a client on a document's text and revision
+func NewClient(text string, revision int) *Client {
+	return &Client{Text: text, Revision: revision}
+}
+
+// Edit applies a local edit. When it returns true, the operation is to be
+// sent to the document along with the client's revision.
+func (c *Client) Edit(op Operation) (Operation, bool, error) {
+	text, err := op.Apply(c.Text)
+	if err != nil {
+		return nil, false, err
+	}
+	c.Text = text
+
+	switch {
+	case c.outstanding == nil:
+		c.outstanding = op
+		return op, true, nil
+	case c.buffer == nil:
+		c.buffer = op
+	default:
+		if c.buffer, err = Compose(c.buffer, op); err != nil {
+			return nil, false, err
+		}
+	}
+	return nil, false, nil
+}
+
+// Ack records that the document accepted the outstanding operation. When
+// it returns true, the buffered edits are to be sent next.
+func (c *Client) Ack() (Operation, bool) {
+	c.Revision++
+	c.outstanding, c.buffer = c.buffer, nil
+	return c.outstanding, c.outstanding != nil
+}
+
+// Receive applies an operation of another client, as committed by the
+// document
+func (c *Client) Receive(op Operation) error {
+	var err error
+	if c.outstanding != nil {
+		if c.outstanding, op, err = Transform(c.outstanding, op); err != nil {
+			return err
+		}
+	}
+	if c.buffer != nil {
+		if c.buffer, op, err = Transform(c.buffer, op); err != nil {
+			return err
+		}
+	}
+
+	text, err := op.Apply(c.Text)
+	if err != nil {
+		return err
+	}
+	c.Text = text
+	c.Revision++
+	return nil
+}
+
+// Pending reports whether the client has edits the document has not
+// acknowledged
+func (c *Client) Pending() bool {
+	return c.outstanding != nil
+}
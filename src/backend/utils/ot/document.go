@@ -0,0 +1,69 @@
+package ot
+
+import "fmt"
+
+// DefaultHistory is the number of operations a document keeps by default
+// to rebase late operations on
+const DefaultHistory = 1000
+
+// Document is the authoritative copy of a text edited by several clients.
+// Every operation it accepts moves it to the next revision.
+type Document struct {
+	Text     string
+	Revision int
+	// history holds the operations leading to the current revision, the
+	// oldest first
+	history    []Operation
+	maxHistory int
+}
+
+// NewDocument starts a document at revision 0 that remembers up to
+// maxHistory operations
+func NewDocument(text string, maxHistory int) *Document {
+	return &Document{Text: text, maxHistory: maxHistory}
+}
+
+// Rebase transforms an operation a client made at revision so it applies to
+// the current text
+func (d *Document) Rebase(revision int, op Operation) (Operation, error) {
+	if revision > d.Revision || revision < d.Revision-len(d.history) {
+		return nil, fmt.Errorf("%w: %d, the document is at %d", ErrRevision, revision, d.Revision)
+	}
+
+	for _, concurrent := range d.history[len(d.history)-(d.Revision-revision):] {
+		var err error
+		if op, _, err = Transform(op, concurrent); err != nil {
+			return nil, err
+		}
+	}
+	return op, nil
+}
+
+// Commit applies an operation rebased on the current revision
+func (d *Document) Commit(op Operation) error {
+	text, err := op.Apply(d.Text)
+	if err != nil {
+		return err
+	}
+
+	d.Text = text
+	d.Revision++
+	d.history = append(d.history, op)
+	if len(d.history) > d.maxHistory {
+		d.history = append([]Operation(nil), d.history[len(d.history)-d.maxHistory:]...)
+	}
+	return nil
+}
+
+// Receive rebases an operation made at revision, commits it and returns it
+// as the other clients have to apply it
+func (d *Document) Receive(revision int, op Operation) (Operation, error) {
+	rebased, err := d.Rebase(revision, op)
+	if err != nil {
+		return nil, err
+	}
+	if err := d.Commit(rebased); err != nil {
+		return nil, err
+	}
+	return rebased, nil
+}
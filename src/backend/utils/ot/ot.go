@@ -0,0 +1,366 @@
+// Package ot merges concurrent edits of plain text through operational
+// transformation. An operation walks the whole text, retaining, inserting
+// and deleting characters; lengths and positions count UTF-16 code units,
+// the way the editor measures text.
+package ot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"unicode/utf16"
+)
+
+var (
+	// ErrLength is returned when an operation does not span the text or the
+	// operation it is combined with
+	ErrLength = errors.New("operation length does not match")
+	// ErrRevision is returned when an operation is based on a revision the
+	// document no longer holds the history for
+	ErrRevision = errors.New("revision is not in the document history")
+)
+
+// Component is one step of an operation. Exactly one field is set.
+type Component struct {
+	Retain int
+	Insert string
+	Delete int
+}
+
+// Operation is a sequence of components. It is encoded in JSON as an array
+// of positive numbers retaining, negative numbers deleting and strings
+// inserting characters, e.g. [5, "abc", -2, 3]. Like append, the builder
+// methods may reuse the operation they are called on.
+type Operation []Component
+
+func length16(s string) int {
+	n := 0
+	for _, r := range s {
+		n += utf16.RuneLen(r)
+	}
+	return n
+}
+
+func (c Component) length() int {
+	switch {
+	case c.Retain > 0:
+		return c.Retain
+	case c.Delete > 0:
+		return c.Delete
+	default:
+		return length16(c.Insert)
+	}
+}
+
+// Retain returns the operation followed by skipping n characters
+func (o Operation) Retain(n int) Operation {
+	if n <= 0 {
+		return o
+	}
+	if last := len(o) - 1; last >= 0 && o[last].Retain > 0 {
+		o[last].Retain += n
+		return o
+	}
+	return append(o, Component{Retain: n})
+}
+
+// Insert returns the operation followed by inserting s. Inserts are kept
+// ahead of adjacent deletes, so equal edits have equal operations.
+func (o Operation) Insert(s string) Operation {
+	if s == "" {
+		return o
+	}
+	last := len(o) - 1
+	if last >= 0 && o[last].Insert != "" {
+		o[last].Insert += s
+		return o
+	}
+	if last >= 0 && o[last].Delete > 0 {
+		if last > 0 && o[last-1].Insert != "" {
+			o[last-1].Insert += s
+			return o
+		}
+		o = append(o, o[last])
+		o[last] = Component{Insert: s}
+		return o
+	}
+	return append(o, Component{Insert: s})
+}
+
+// Delete returns the operation followed by deleting n characters
+func (o Operation) Delete(n int) Operation {
+	if n <= 0 {
+		return o
+	}
+	if last := len(o) - 1; last >= 0 && o[last].Delete > 0 {
+		o[last].Delete += n
+		return o
+	}
+	return append(o, Component{Delete: n})
+}
+
+// BaseLength is the length of the text the operation applies to
+func (o Operation) BaseLength() int {
+	n := 0
+	for _, c := range o {
+		if c.Insert == "" {
+			n += c.length()
+		}
+	}
+	return n
+}
+
+// TargetLength is the length of the text the operation produces
+func (o Operation) TargetLength() int {
+	n := 0
+	for _, c := range o {
+		if c.Delete == 0 {
+			n += c.length()
+		}
+	}
+	return n
+}
+
+// IsNoop reports whether the operation leaves the text unchanged
+func (o Operation) IsNoop() bool {
+	for _, c := range o {
+		if c.Retain == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Apply returns text with the operation applied
+func (o Operation) Apply(text string) (string, error) {
+	units := utf16.Encode([]rune(text))
+	if len(units) != o.BaseLength() {
+		return "", fmt.Errorf("%w: operation spans %d characters, the text has %d", ErrLength, o.BaseLength(), len(units))
+	}
+
+	result := make([]uint16, 0, o.TargetLength())
+	position := 0
+	for _, c := range o {
+		switch {
+		case c.Retain > 0:
+			result = append(result, units[position:position+c.Retain]...)
+			position += c.Retain
+		case c.Delete > 0:
+			position += c.Delete
+		default:
+			result = append(result, utf16.Encode([]rune(c.Insert))...)
+		}
+	}
+	return string(utf16.Decode(result)), nil
+}
+
+// TransformIndex moves a position in the text before the operation to the
+// same place after it. Text inserted right at the position ends up before
+// it when insertBefore is set, after it otherwise.
+func (o Operation) TransformIndex(index int, insertBefore bool) int {
+	position, moved := 0, index
+	for _, c := range o {
+		if position > index {
+			break
+		}
+		switch {
+		case c.Retain > 0:
+			position += c.Retain
+		case c.Delete > 0:
+			moved -= min(c.Delete, index-position)
+			position += c.Delete
+		default:
+			if position < index || insertBefore {
+				moved += c.length()
+			}
+		}
+	}
+	return moved
+}
+
+// MarshalJSON encodes the operation in its compact array form
+func (o Operation) MarshalJSON() ([]byte, error) {
+	values := make([]interface{}, len(o))
+	for i, c := range o {
+		switch {
+		case c.Retain > 0:
+			values[i] = c.Retain
+		case c.Delete > 0:
+			values[i] = -c.Delete
+		default:
+			values[i] = c.Insert
+		}
+	}
+	return json.Marshal(values)
+}
+
+// UnmarshalJSON decodes the compact array form
+func (o *Operation) UnmarshalJSON(data []byte) error {
+	var values []interface{}
+	if err := json.Unmarshal(data, &values); err != nil {
+		return err
+	}
+
+	op, err := FromValues(values)
+	if err != nil {
+		return err
+	}
+	*o = op
+	return nil
+}
+
+// FromValues builds an operation from its decoded JSON array form
+func FromValues(values []interface{}) (Operation, error) {
+	op := Operation{}
+	for _, value := range values {
+		switch v := value.(type) {
+		case float64:
+			if v != float64(int(v)) || v == 0 {
+				return nil, fmt.Errorf("invalid operation component %v", v)
+			}
+			if v > 0 {
+				op = op.Retain(int(v))
+			} else {
+				op = op.Delete(int(-v))
+			}
+		case string:
+			if v == "" {
+				return nil, errors.New("invalid operation component \"\"")
+			}
+			op = op.Insert(v)
+		default:
+			return nil, fmt.Errorf("invalid operation component %v", value)
+		}
+	}
+	return op, nil
+}
+
+// reader hands out the components of an operation in pieces
+type reader struct {
+	ops    Operation
+	index  int
+	offset int
+}
+
+// peek returns what is left of the current component
+func (r *reader) peek() (Component, bool) {
+	if r.index >= len(r.ops) {
+		return Component{}, false
+	}
+	c := r.ops[r.index]
+	switch {
+	case c.Retain > 0:
+		c.Retain -= r.offset
+	case c.Delete > 0:
+		c.Delete -= r.offset
+	default:
+		c.Insert = string(utf16.Decode(utf16.Encode([]rune(c.Insert))[r.offset:]))
+	}
+	return c, true
+}
+
+// take consumes n characters of the current component, or all of it for a
+// negative n
+func (r *reader) take(n int) Component {
+	c, _ := r.peek()
+	length := c.length()
+	if n < 0 || n >= length {
+		r.index++
+		r.offset = 0
+		return c
+	}
+
+	r.offset += n
+	switch {
+	case c.Retain > 0:
+		c.Retain = n
+	case c.Delete > 0:
+		c.Delete = n
+	default:
+		c.Insert = string(utf16.Decode(utf16.Encode([]rune(c.Insert))[:n]))
+	}
+	return c
+}
+
+// Transform takes two operations made concurrently on the same text and
+// returns a' and b' such that b' applied after a gives the same text as a'
+// applied after b. Inserts of a at the same position go first.
+func Transform(a, b Operation) (Operation, Operation, error) {
+	if a.BaseLength() != b.BaseLength() {
+		return nil, nil, fmt.Errorf("%w: concurrent operations span %d and %d characters", ErrLength, a.BaseLength(), b.BaseLength())
+	}
+
+	var aPrime, bPrime Operation
+	ra, rb := &reader{ops: a}, &reader{ops: b}
+	for {
+		ca, okA := ra.peek()
+		cb, okB := rb.peek()
+		switch {
+		case !okA && !okB:
+			return append(Operation{}, aPrime...), append(Operation{}, bPrime...), nil
+		case okA && ca.Insert != "":
+			ra.take(-1)
+			aPrime = aPrime.Insert(ca.Insert)
+			bPrime = bPrime.Retain(ca.length())
+			continue
+		case okB && cb.Insert != "":
+			rb.take(-1)
+			aPrime = aPrime.Retain(cb.length())
+			bPrime = bPrime.Insert(cb.Insert)
+			continue
+		}
+
+		n := min(ca.length(), cb.length())
+		ra.take(n)
+		rb.take(n)
+		switch {
+		case ca.Retain > 0 && cb.Retain > 0:
+			aPrime = aPrime.Retain(n)
+			bPrime = bPrime.Retain(n)
+		case ca.Delete > 0 && cb.Retain > 0:
+			aPrime = aPrime.Delete(n)
+		case ca.Retain > 0 && cb.Delete > 0:
+			bPrime = bPrime.Delete(n)
+		}
+		// Both deleting the same characters leaves nothing to do
+	}
+}
+
+// Compose merges a and the operation b following it into one operation
+func Compose(a, b Operation) (Operation, error) {
+	if a.TargetLength() != b.BaseLength() {
+		return nil, fmt.Errorf("%w: the first operation produces %d characters, the second spans %d", ErrLength, a.TargetLength(), b.BaseLength())
+	}
+
+	var composed Operation
+	ra, rb := &reader{ops: a}, &reader{ops: b}
+	for {
+		ca, okA := ra.peek()
+		cb, okB := rb.peek()
+		switch {
+		case okA && ca.Delete > 0:
+			ra.take(-1)
+			composed = composed.Delete(ca.Delete)
+			continue
+		case okB && cb.Insert != "":
+			rb.take(-1)
+			composed = composed.Insert(cb.Insert)
+			continue
+		case !okA && !okB:
+			return append(Operation{}, composed...), nil
+		}
+
+		n := min(ca.length(), cb.length())
+		pa := ra.take(n)
+		rb.take(n)
+		switch {
+		case ca.Retain > 0 && cb.Retain > 0:
+			composed = composed.Retain(n)
+		case ca.Retain > 0 && cb.Delete > 0:
+			composed = composed.Delete(n)
+		case ca.Insert != "" && cb.Retain > 0:
+			composed = composed.Insert(pa.Insert)
+		}
+		// Deleting freshly inserted characters cancels both out
+	}
+}
@@ -0,0 +1,238 @@
+package ot
+
+import (
+	"encoding/json"
+	"math/rand"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApply(t *testing.T) {
+	op := Operation{}.Retain(6).Delete(5).Insert("there")
+	text, err := op.Apply("Hello world")
+	assert.NoError(t, err)
+	assert.Equal(t, "Hello there", text)
+
+	// Positions count UTF-16 code units, so the emoji takes two
+	op = Operation{}.Retain(2).Insert("!").Retain(1)
+	text, err = op.Apply("😀a")
+	assert.NoError(t, err)
+	assert.Equal(t, "😀!a", text)
+
+	_, err = op.Apply("ab")
+	assert.ErrorIs(t, err, ErrLength)
+}
+
+func TestOperationJSON(t *testing.T) {
+	var op Operation
+	assert.NoError(t, json.Unmarshal([]byte(`[5, "abc", -2, 3]`), &op))
+	assert.Equal(t, Operation{{Retain: 5}, {Insert: "abc"}, {Delete: 2}, {Retain: 3}}, op)
+	assert.Equal(t, 10, op.BaseLength())
+	assert.Equal(t, 11, op.TargetLength())
+
+	encoded, err := json.Marshal(op)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `[5, "abc", -2, 3]`, string(encoded))
+
+	assert.Error(t, json.Unmarshal([]byte(`[1.5]`), &op))
+	assert.Error(t, json.Unmarshal([]byte(`[0]`), &op))
+	assert.Error(t, json.Unmarshal([]byte(`[{"retain": 1}]`), &op))
+}
+
+func TestBuilderKeepsInsertsBeforeDeletes(t *testing.T) {
+	assert.Equal(t, Operation{{Insert: "ab"}, {Delete: 3}}, Operation{}.Delete(2).Insert("a").Delete(1).Insert("b"))
+}
+
+func TestTransformIndex(t *testing.T) {
+	op := Operation{}.Retain(2).Insert("xy").Retain(1).Delete(2).Retain(1)
+
+	assert.Equal(t, 1, op.TransformIndex(1, false))
+	assert.Equal(t, 2, op.TransformIndex(2, false))
+	assert.Equal(t, 4, op.TransformIndex(2, true))
+	assert.Equal(t, 5, op.TransformIndex(3, false))
+	// Positions inside deleted text collapse onto the deletion
+	assert.Equal(t, 5, op.TransformIndex(4, false))
+	assert.Equal(t, 5, op.TransformIndex(5, false))
+	assert.Equal(t, 6, op.TransformIndex(6, false))
+}
+
+func TestTransformTieGoesToFirst(t *testing.T) {
+	a := Operation{}.Retain(1).Insert("a").Retain(1)
+	b := Operation{}.Retain(1).Insert("b").Retain(1)
+
+	aPrime, bPrime, err := Transform(a, b)
+	assert.NoError(t, err)
+
+	afterA, _ := a.Apply("xy")
+	afterB, _ := b.Apply("xy")
+	left, _ := bPrime.Apply(afterA)
+	right, _ := aPrime.Apply(afterB)
+	assert.Equal(t, "xaby", left)
+	assert.Equal(t, left, right)
+}
+
+// randomText returns text mixing characters of one and two code units
+func randomText(r *rand.Rand) string {
+	alphabet := []rune("abcdé 😀")
+	runes := make([]rune, r.Intn(4)+1)
+	for i := range runes {
+		runes[i] = alphabet[r.Intn(len(alphabet))]
+	}
+	return string(runes)
+}
+
+// randomOperation makes an edit of text that never splits a character
+func randomOperation(r *rand.Rand, text string) Operation {
+	op := Operation{}
+	for _, c := range []rune(text) {
+		switch r.Intn(6) {
+		case 0:
+			op = op.Delete(utf16.RuneLen(c))
+		case 1:
+			op = op.Insert(randomText(r)).Retain(utf16.RuneLen(c))
+		default:
+			op = op.Retain(utf16.RuneLen(c))
+		}
+	}
+	if r.Intn(3) == 0 {
+		op = op.Insert(randomText(r))
+	}
+	return op
+}
+
+func TestTransformAndCompose_Random(t *testing.T) {
+	r := rand.New(rand.NewSource(7))
+	for i := 0; i < 500; i++ {
+		text := randomText(r) + randomText(r)
+		a := randomOperation(r, text)
+		b := randomOperation(r, text)
+
+		aPrime, bPrime, err := Transform(a, b)
+		assert.NoError(t, err)
+		afterA, _ := a.Apply(text)
+		afterB, _ := b.Apply(text)
+		left, err := bPrime.Apply(afterA)
+		assert.NoError(t, err)
+		right, err := aPrime.Apply(afterB)
+		assert.NoError(t, err)
+		assert.Equal(t, left, right)
+
+		c := randomOperation(r, afterA)
+		ac, err := Compose(a, c)
+		assert.NoError(t, err)
+		expected, _ := c.Apply(afterA)
+		composed, err := ac.Apply(text)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, composed)
+	}
+}
+
+// message is an operation on its way between a client and the document
+type message struct {
+	revision int
+	op       Operation
+}
+
+func TestClientsConverge(t *testing.T) {
+	r := rand.New(rand.NewSource(42))
+	for round := 0; round < 50; round++ {
+		doc := NewDocument("shared text", DefaultHistory)
+		clients := make([]*Client, 3)
+		// Each client has a channel to the document and one back; channels
+		// keep their order but are drained in random interleavings
+		upstream := make([][]message, len(clients))
+		downstream := make([][]message, len(clients))
+		for i := range clients {
+			clients[i] = NewClient(doc.Text, doc.Revision)
+		}
+
+		deliver := func(i int) {
+			msg := upstream[i][0]
+			upstream[i] = upstream[i][1:]
+			rebased, err := doc.Receive(msg.revision, msg.op)
+			if !assert.NoError(t, err) {
+				return
+			}
+			for j := range clients {
+				// The author gets an acknowledgement, marked by a nil op
+				if j == i {
+					downstream[j] = append(downstream[j], message{})
+				} else {
+					downstream[j] = append(downstream[j], message{op: rebased})
+				}
+			}
+		}
+
+		receive := func(i int) {
+			msg := downstream[i][0]
+			downstream[i] = downstream[i][1:]
+			if msg.op == nil {
+				if op, send := clients[i].Ack(); send {
+					upstream[i] = append(upstream[i], message{revision: clients[i].Revision, op: op})
+				}
+				return
+			}
+			assert.NoError(t, clients[i].Receive(msg.op))
+		}
+
+		for step := 0; step < 60; step++ {
+			i := r.Intn(len(clients))
+			switch r.Intn(3) {
+			case 0:
+				op := randomOperation(r, clients[i].Text)
+				if sent, send, err := clients[i].Edit(op); assert.NoError(t, err) && send {
+					upstream[i] = append(upstream[i], message{revision: clients[i].Revision, op: sent})
+				}
+			case 1:
+				if len(upstream[i]) > 0 {
+					deliver(i)
+				}
+			case 2:
+				if len(downstream[i]) > 0 {
+					receive(i)
+				}
+			}
+		}
+
+		// Let every message arrive
+		for busy := true; busy; {
+			busy = false
+			for i := range clients {
+				for len(upstream[i]) > 0 {
+					deliver(i)
+					busy = true
+				}
+				for len(downstream[i]) > 0 {
+					receive(i)
+					busy = true
+				}
+			}
+		}
+
+		for _, client := range clients {
+			assert.False(t, client.Pending())
+			assert.Equal(t, doc.Revision, client.Revision)
+			assert.Equal(t, doc.Text, client.Text)
+		}
+	}
+}
+
+func TestDocumentRejectsForgottenRevisions(t *testing.T) {
+	doc := NewDocument("ab", 1)
+	_, err := doc.Receive(0, Operation{}.Retain(2).Insert("c"))
+	assert.NoError(t, err)
+	_, err = doc.Receive(1, Operation{}.Retain(3).Insert("d"))
+	assert.NoError(t, err)
+
+	_, err = doc.Receive(0, Operation{}.Insert("x").Retain(2))
+	assert.ErrorIs(t, err, ErrRevision)
+	_, err = doc.Receive(3, Operation{}.Insert("x").Retain(4))
+	assert.ErrorIs(t, err, ErrRevision)
+
+	rebased, err := doc.Receive(1, Operation{}.Insert("x").Retain(3))
+	assert.NoError(t, err)
+	assert.Equal(t, Operation{{Insert: "x"}, {Retain: 4}}, rebased)
+	assert.Equal(t, "xabcd", doc.Text)
+}
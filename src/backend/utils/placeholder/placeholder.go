@@ -0,0 +1,51 @@
+package placeholder
+
+import (
+	"regexp"
+	"strings"
+)
+
+// PromptPrefix marks placeholders whose value is asked from the user, as in
+// {{prompt:Project name}}
+const PromptPrefix = "prompt:"
+
+// pattern matches {{name}} placeholders, allowing spaces inside the braces
+var pattern = regexp.MustCompile(`\{\{\s*([^{}]*?)\s*\}\}`)
+
+// Prompts returns the distinct prompt labels used in text, in order
+func Prompts(text string) []string {
+	var prompts []string
+	seen := make(map[string]bool)
+	for _, match := range pattern.FindAllStringSubmatch(text, -1) {
+		label, ok := promptLabel(match[1])
+		if ok && !seen[label] {
+			seen[label] = true
+			prompts = append(prompts, label)
+		}
+	}
+	return prompts
+}
+
+// Replace fills in the placeholders of text. Prompts are looked up by their
+// full name, "prompt:" included. Unknown placeholders are left untouched.
+func Replace(text string, values map[string]string) string {
+	return pattern.ReplaceAllStringFunc(text, func(match string) string {
+		name := strings.TrimSpace(pattern.FindStringSubmatch(match)[1])
+		if label, ok := promptLabel(name); ok {
+			name = PromptPrefix + label
+		}
+		if value, ok := values[name]; ok {
+			return value
+		}
+		return match
+	})
+}
+
+// promptLabel returns the label of a prompt placeholder name
+func promptLabel(name string) (string, bool) {
+	if !strings.HasPrefix(name, PromptPrefix) {
+		return "", false
+	}
+	label := strings.TrimSpace(strings.TrimPrefix(name, PromptPrefix))
+	return label, label != ""
+}
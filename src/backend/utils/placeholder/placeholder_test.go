@@ -0,0 +1,26 @@
+package placeholder
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrompts(t *testing.T) {
+	text := "{{prompt:Project name}} review on {{date}} by {{ prompt: Owner }} for {{prompt:Project name}} {{prompt:}}"
+	assert.Equal(t, []string{"Project name", "Owner"}, Prompts(text))
+	assert.Nil(t, Prompts("no placeholders"))
+}
+
+func TestReplace(t *testing.T) {
+	values := map[string]string{
+		"date":                "2026-10-16",
+		"user.display_name":   "Sam",
+		"prompt:Project name": "Owl",
+	}
+
+	assert.Equal(t, "Owl standup 2026-10-16 (Sam)", Replace("{{prompt: Project name }} standup {{date}} ({{ user.display_name }})", values))
+
+	// Unknown placeholders and stray braces are kept as written
+	assert.Equal(t, "{{weather}} and {{prompt:Owner}} {not}", Replace("{{weather}} and {{prompt:Owner}} {not}", values))
+}